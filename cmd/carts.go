@@ -0,0 +1,99 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/deicod/dysv/internal/config"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/deicod/dysv/internal/service"
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// cartsCmd groups cart maintenance commands
+var cartsCmd = &cobra.Command{
+	Use:   "carts",
+	Short: "Maintain stored shopping carts",
+}
+
+// cartsPurgeCmd represents the carts purge command
+var cartsPurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Delete carts unchanged for longer than CART_TTL",
+	Long: `Deletes every cart whose last change is older than CART_TTL (default
+720h) and makes sure the TTL index that does the same continuously exists.
+Run it from cron where the TTL index is not available.`,
+	RunE: runCartsPurge,
+}
+
+// cartsRemindCmd represents the carts remind command
+var cartsRemindCmd = &cobra.Command{
+	Use:   "remind",
+	Short: "Email abandoned-cart reminders",
+	Long: `Emails every logged-in user who opted in to reminders and whose cart
+has been unchanged for CART_REMINDER_AFTER (default 24h). The email links
+to BASE_URL/cart?restore=<token>. Uses the AUTH_EMAIL_* SMTP settings.`,
+	RunE: runCartsRemind,
+}
+
+func init() {
+	cartsCmd.AddCommand(cartsPurgeCmd, cartsRemindCmd)
+	rootCmd.AddCommand(cartsCmd)
+}
+
+func runCartsPurge(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.CartTTL <= 0 {
+		return errors.New("CART_TTL is 0: carts never expire")
+	}
+
+	return withCartRepo(cfg, func(ctx context.Context, carts *repo.CartRepo) error {
+		if err := carts.EnsureIndexes(ctx, cfg.CartTTL); err != nil {
+			return err
+		}
+		n, err := service.NewCartService(carts, nil, nil, nil).PurgeExpired(ctx, cfg.CartTTL)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "purged %d carts older than %s\n", n, cfg.CartTTL)
+		return nil
+	})
+}
+
+func runCartsRemind(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.AuthEmailHost == "" || cfg.AuthEmailFrom == "" {
+		return errors.New("AUTH_EMAIL_HOST and AUTH_EMAIL_FROM must be set")
+	}
+	mailer := service.NewSMTPMailer(cfg.AuthEmailHost, cfg.AuthEmailPort, cfg.AuthEmailUser, cfg.AuthEmailPass, cfg.AuthEmailFrom, cfg.AuthEmailUseSSL)
+
+	return withCartRepo(cfg, func(ctx context.Context, carts *repo.CartRepo) error {
+		sent, err := service.NewCartReminder(carts, mailer, cfg.BaseURL, cfg.CartReminderAfter).Run(ctx)
+		fmt.Fprintf(cmd.OutOrStdout(), "sent %d reminders\n", sent)
+		return err
+	})
+}
+
+// withCartRepo connects to MongoDB and runs fn with the cart repository
+func withCartRepo(cfg *config.Config, fn func(context.Context, *repo.CartRepo) error) error {
+	ctx := context.Background()
+	client, err := mongo.Connect(options.Client().ApplyURI(cfg.MongoURI))
+	if err != nil {
+		return fmt.Errorf("mongodb connect: %w", err)
+	}
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	return fn(ctx, repo.NewCartRepo(client.Database("dysv"), cfg.MongoTimeout))
+}
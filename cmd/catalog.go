@@ -0,0 +1,79 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/deicod/dysv/internal/config"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/deicod/dysv/internal/service"
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// catalogCmd groups catalog maintenance commands
+var catalogCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: "Manage the plan and addon catalog",
+}
+
+// catalogSyncCmd represents the catalog sync command
+var catalogSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Create or update Stripe Products and Prices for the catalog",
+	Long: `Pushes every plan and addon to a Stripe Product with one Price per
+billing cycle and currency, and stores the Stripe IDs in the catalog.
+Checkout then references those prices instead of inline price data.
+
+Set STRIPE_API_URL to run against a local Stripe stand-in.`,
+	RunE: runCatalogSync,
+}
+
+func init() {
+	catalogSyncCmd.Flags().Bool("dry-run", false, "print the changes without calling Stripe or writing the catalog")
+	catalogCmd.AddCommand(catalogSyncCmd)
+	rootCmd.AddCommand(catalogCmd)
+}
+
+func runCatalogSync(cmd *cobra.Command, args []string) error {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.StripeSecret == "" && !dryRun {
+		return errors.New("STRIPE_SECRET is not set")
+	}
+
+	ctx := context.Background()
+	client, err := mongo.Connect(options.Client().ApplyURI(cfg.MongoURI))
+	if err != nil {
+		return fmt.Errorf("mongodb connect: %w", err)
+	}
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	catalogService := service.NewCatalogService(repo.NewCatalogRepo(client.Database("dysv"), cfg.MongoTimeout))
+	if err := catalogService.Seed(ctx); err != nil {
+		return fmt.Errorf("seed catalog: %w", err)
+	}
+
+	sync := service.NewCatalogSync(catalogService, service.NewStripeClient(cfg.StripeSecret, cfg.StripeAPIURL))
+	actions, err := sync.Run(ctx, dryRun)
+	for _, action := range actions {
+		fmt.Fprintln(cmd.OutOrStdout(), action)
+	}
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		fmt.Fprintf(cmd.OutOrStdout(), "dry run: %d actions not applied\n", len(actions))
+	}
+	return nil
+}
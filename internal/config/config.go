@@ -5,6 +5,7 @@ package config
 
 import (
 	"log"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -20,6 +21,7 @@ type Config struct {
 	StripePubKey        string        `mapstructure:"STRIPE_PUBLIC_KEY"`
 	StripeWebhookSecret string        `mapstructure:"STRIPE_WEBHOOK_SECRET"`
 	StripeAPIVersion    string        `mapstructure:"STRIPE_API_VERSION"`
+	StripeAPIURL        string        `mapstructure:"STRIPE_API_URL"` // override for a local Stripe stand-in
 	AuthSessionSecret   string        `mapstructure:"AUTH_SESSION_SECRET"`
 	AuthTokenSecret     string        `mapstructure:"AUTH_TOKEN_SECRET"`
 	AuthEmailFrom       string        `mapstructure:"AUTH_EMAIL_FROM"`
@@ -28,6 +30,13 @@ type Config struct {
 	AuthEmailUser       string        `mapstructure:"AUTH_EMAIL_USER"`
 	AuthEmailPass       string        `mapstructure:"AUTH_EMAIL_PASS"`
 	AuthEmailUseSSL     bool          `mapstructure:"AUTH_EMAIL_USE_SSL"`
+	CartSessionSecret   string        `mapstructure:"CART_SESSION_SECRET"`
+	CartSessionPrevious []string      `mapstructure:"CART_SESSION_PREVIOUS_SECRETS"` // comma-separated, still accepted after rotation
+	CartTTL             time.Duration `mapstructure:"CART_TTL"`                      // carts untouched this long are deleted; 0 keeps them
+	CartReminderAfter   time.Duration `mapstructure:"CART_REMINDER_AFTER"`           // idle time before an abandoned-cart reminder
+	QuoteSecret         string        `mapstructure:"QUOTE_SECRET"`                  // signs saved quote links
+	SellerVATID         string        `mapstructure:"SELLER_VAT_ID"`                 // our VAT ID, named in VIES requests
+	VIESURL             string        `mapstructure:"VIES_API_URL"`                  // VIES REST API; empty for the EU default
 }
 
 // Load reads configuration from environment variables
@@ -45,12 +54,10 @@ func Load() (*Config, error) {
 	viper.SetDefault("BASE_URL", "https://dysv.de")
 	viper.SetDefault("MONGODB_URI", "mongodb://localhost:27017/dysv")
 	viper.SetDefault("MONGODB_TIMEOUT", "30s")
+	viper.SetDefault("CART_TTL", "720h")
+	viper.SetDefault("CART_REMINDER_AFTER", "24h")
 
-	timeout, err := time.ParseDuration(viper.GetString("MONGODB_TIMEOUT"))
-	if err != nil {
-		log.Printf("Config: ParseDuration error: %v\n", err)
-		timeout = 30 * time.Second
-	}
+	timeout := duration("MONGODB_TIMEOUT", 30*time.Second)
 
 	cfg := &Config{
 		Port:                viper.GetString("PORT"),
@@ -61,6 +68,7 @@ func Load() (*Config, error) {
 		StripePubKey:        viper.GetString("STRIPE_PUBLIC_KEY"),
 		StripeWebhookSecret: viper.GetString("STRIPE_WEBHOOK_SECRET"),
 		StripeAPIVersion:    viper.GetString("STRIPE_API_VERSION"),
+		StripeAPIURL:        viper.GetString("STRIPE_API_URL"),
 		AuthSessionSecret:   viper.GetString("AUTH_SESSION_SECRET"),
 		AuthTokenSecret:     viper.GetString("AUTH_TOKEN_SECRET"),
 		AuthEmailFrom:       viper.GetString("AUTH_EMAIL_FROM"),
@@ -69,7 +77,24 @@ func Load() (*Config, error) {
 		AuthEmailUser:       viper.GetString("AUTH_EMAIL_USER"),
 		AuthEmailPass:       viper.GetString("AUTH_EMAIL_PASS"),
 		AuthEmailUseSSL:     viper.GetBool("AUTH_EMAIL_USE_SSL"),
+		CartSessionSecret:   viper.GetString("CART_SESSION_SECRET"),
+		CartSessionPrevious: strings.Split(viper.GetString("CART_SESSION_PREVIOUS_SECRETS"), ","),
+		CartTTL:             duration("CART_TTL", 720*time.Hour),
+		CartReminderAfter:   duration("CART_REMINDER_AFTER", 24*time.Hour),
+		QuoteSecret:         viper.GetString("QUOTE_SECRET"),
+		SellerVATID:         viper.GetString("SELLER_VAT_ID"),
+		VIESURL:             viper.GetString("VIES_API_URL"),
 	}
 
 	return cfg, nil
 }
+
+// duration parses a duration setting, falling back on invalid values
+func duration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(viper.GetString(key))
+	if err != nil {
+		log.Printf("Config: ParseDuration error for %s: %v\n", key, err)
+		return fallback
+	}
+	return d
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 
@@ -21,7 +22,7 @@ func NewAddressHandler(service *service.AddressService, auth auth.Service) *Addr
 
 func (h *AddressHandler) getUserID(r *http.Request) string {
 	token := getToken(r)
-	if token == "" {
+	if token == "" || h.auth == nil {
 		return ""
 	}
 	user, _, err := h.auth.AuthenticateSession(r.Context(), token)
@@ -66,7 +67,7 @@ func (h *AddressHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.service.CreateAddress(r.Context(), &addr); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to create address")
+		writeAddressError(w, err, "failed to create address")
 		return
 	}
 
@@ -97,7 +98,7 @@ func (h *AddressHandler) Update(w http.ResponseWriter, r *http.Request) {
 	addr.UserID = userID
 
 	if err := h.service.UpdateAddress(r.Context(), &addr); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to update address")
+		writeAddressError(w, err, "failed to update address")
 		return
 	}
 
@@ -126,6 +127,21 @@ func (h *AddressHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
+// writeAddressError answers a failed save, naming the invalid fields
+func writeAddressError(w http.ResponseWriter, err error, fallback string) {
+	var addrErr *service.AddressError
+	switch {
+	case errors.As(err, &addrErr):
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: service.ErrInvalidAddress.Error(), Fields: addrErr.Fields})
+	case errors.Is(err, service.ErrInvalidVATID):
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: service.ErrInvalidAddress.Error(), Fields: map[string]string{"vatId": err.Error()}})
+	case errors.Is(err, service.ErrAddressNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, fallback)
+	}
+}
+
 // UserID Extraction helper (Temporary until middleware injects it into context)
 // For now, we assume the Auth handler validated token and client passes it?
 // Actually, in `Me`, we decode session.
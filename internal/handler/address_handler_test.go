@@ -30,7 +30,7 @@ var _ = Describe("AddressHandler", func() {
 	BeforeEach(func() {
 		mockRepo = mocks.NewMockAddressRepo()
 		mockAuth = &mocks.MockAuthService{}
-		addrService = service.NewAddressService(mockRepo)
+		addrService = service.NewAddressService(mockRepo, nil)
 		addrHandler = handler.NewAddressHandler(addrService, mockAuth)
 		ctx = context.Background()
 		userID = "user_123"
@@ -74,14 +74,26 @@ var _ = Describe("AddressHandler", func() {
 
 			Expect(rec.Code).To(Equal(http.StatusUnauthorized))
 		})
+
+		It("should return 401 without an auth service", func() {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/addresses", nil)
+			req.Header.Set("Authorization", "Bearer valid-token")
+			rec := httptest.NewRecorder()
+
+			handler.NewAddressHandler(addrService, nil).List(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+		})
 	})
 
 	Describe("Create", func() {
 		It("should create address", func() {
 			body := map[string]interface{}{
-				"label":       "Work",
-				"street":      "456 Work St",
-				"countryCode": "DE",
+				"label":      "Work",
+				"line1":      "456 Work St",
+				"city":       "Berlin",
+				"postalCode": "10115",
+				"country":    "DE",
 			}
 			jsonBody, _ := json.Marshal(body)
 			req := httptest.NewRequest(http.MethodPost, "/api/user/addresses", bytes.NewBuffer(jsonBody))
@@ -101,7 +113,10 @@ var _ = Describe("AddressHandler", func() {
 
 		It("should set default label if missing", func() {
 			body := map[string]interface{}{
-				"street": "No Label",
+				"line1":      "No Label",
+				"city":       "Berlin",
+				"postalCode": "10115",
+				"country":    "DE",
 			}
 			jsonBody, _ := json.Marshal(body)
 			req := httptest.NewRequest(http.MethodPost, "/api/user/addresses", bytes.NewBuffer(jsonBody))
@@ -117,6 +132,59 @@ var _ = Describe("AddressHandler", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Expect(created.Label).To(Equal("Default"))
 		})
+
+		create := func(body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/addresses", bytes.NewBufferString(body))
+			req.Header.Set("Authorization", "Bearer valid-token")
+			rec := httptest.NewRecorder()
+			addrHandler.Create(rec, req)
+			return rec
+		}
+
+		It("should store company and invoice contact of business customers", func() {
+			rec := create(`{"label": "Office", "customerType": "business", "company": " Agentur GmbH ", "vatId": "DE123456789",
+				"email": "billing@agentur.example", "phone": "+49 30 1234567", "line1": "Hauptstr. 1", "city": "Berlin", "postalCode": "10115", "country": "DE"}`)
+			Expect(rec.Code).To(Equal(http.StatusCreated))
+
+			var created model.Address
+			Expect(json.Unmarshal(rec.Body.Bytes(), &created)).To(Succeed())
+			Expect(created.Company).To(Equal("Agentur GmbH"))
+			Expect(created.CustomerType).To(Equal(model.CustomerBusiness))
+			Expect(created.VATID).To(Equal("DE123456789"))
+			Expect(created.Email).To(Equal("billing@agentur.example"))
+			Expect(created.Phone).To(Equal("+49 30 1234567"))
+		})
+
+		It("should default to a private customer", func() {
+			rec := create(`{"label": "Home", "line1": "Ilica 1", "city": "Zagreb", "postalCode": "10000", "country": "HR"}`)
+			Expect(rec.Code).To(Equal(http.StatusCreated))
+			var created model.Address
+			Expect(json.Unmarshal(rec.Body.Bytes(), &created)).To(Succeed())
+			Expect(created.CustomerType).To(Equal(model.CustomerPrivate))
+		})
+
+		DescribeTable("should reject invalid contact fields",
+			func(body string) {
+				Expect(create(body).Code).To(Equal(http.StatusBadRequest))
+				Expect(mockRepo.Addresses).To(BeEmpty())
+			},
+			Entry("unknown customer type", `{"customerType": "reseller"}`),
+			Entry("business without company", `{"customerType": "business", "vatId": "DE123456789"}`),
+			Entry("private customer with VAT ID", `{"customerType": "private", "vatId": "DE123456789"}`),
+			Entry("malformed email", `{"email": "billing at agentur"}`),
+			Entry("email with display name", `{"email": "Billing <billing@agentur.example>"}`),
+			Entry("malformed phone", `{"phone": "call me"}`),
+		)
+
+		It("should name the invalid fields", func() {
+			rec := create(`{"line1": "Ilica 1", "city": "Zagreb", "postalCode": "1000", "country": "HR"}`)
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+
+			var resp handler.ErrorResponse
+			Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed())
+			Expect(resp.Error).To(Equal("invalid address"))
+			Expect(resp.Fields).To(Equal(map[string]string{"postalCode": "is not a valid postal code for HR"}))
+		})
 	})
 
 	Describe("Update", func() {
@@ -131,7 +199,11 @@ var _ = Describe("AddressHandler", func() {
 
 		It("should update address", func() {
 			body := map[string]interface{}{
-				"label": "New Label",
+				"label":      "New Label",
+				"line1":      "Hauptstr. 1",
+				"city":       "Berlin",
+				"postalCode": "10115",
+				"country":    "DE",
 			}
 			jsonBody, _ := json.Marshal(body)
 			url := "/api/user/addresses/" + existingID
@@ -149,6 +221,19 @@ var _ = Describe("AddressHandler", func() {
 			Expect(updated.Label).To(Equal("New Label"))
 			Expect(updated.ID).To(Equal(existingID))
 		})
+
+		It("should validate contact fields", func() {
+			url := "/api/user/addresses/" + existingID
+			req := httptest.NewRequest(http.MethodPut, url, bytes.NewBufferString(`{"customerType": "business"}`))
+			req.Header.Set("Authorization", "Bearer valid-token")
+			rec := httptest.NewRecorder()
+
+			addrHandler.Update(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+			stored, _ := mockRepo.Get(ctx, existingID, userID)
+			Expect(stored.Label).To(Equal("Old"))
+		})
 	})
 
 	Describe("Delete", func() {
@@ -6,31 +6,40 @@ package handler
 import (
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/deicod/auth"
 	"github.com/deicod/auth/core"
+	"github.com/deicod/dysv/internal/service"
 )
 
 // AuthHandler handles authentication requests
 type AuthHandler struct {
 	authService auth.Service
+	cartService *service.CartService
+	referrals   *service.ReferralService
 }
 
-// NewAuthHandler creates a new auth handler
-func NewAuthHandler(authService auth.Service) *AuthHandler {
+// NewAuthHandler creates a new auth handler.
+// cartService is optional; with it, Login merges the session cart into the user's cart.
+// referrals is optional; with it, Register accepts a referral code.
+func NewAuthHandler(authService auth.Service, cartService *service.CartService, referrals *service.ReferralService) *AuthHandler {
 	return &AuthHandler{
 		authService: authService,
+		cartService: cartService,
+		referrals:   referrals,
 	}
 }
 
 // Register handles user registration
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Email    string `json:"email"`
-		Username string `json:"username"`
-		Password string `json:"password"`
+		Email        string `json:"email"`
+		Username     string `json:"username"`
+		Password     string `json:"password"`
+		ReferralCode string `json:"referralCode"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -38,6 +47,14 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Reject bad codes before the account exists
+	if req.ReferralCode != "" && h.referrals != nil {
+		if _, err := h.referrals.CheckCode(r.Context(), req.ReferralCode, req.Email); err != nil {
+			writeReferralError(w, err)
+			return
+		}
+	}
+
 	cmd := core.RegisterCommand{
 		Email:     req.Email,
 		Username:  req.Username,
@@ -52,6 +69,13 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The account exists now; a failed attribution does not fail the registration
+	if req.ReferralCode != "" && h.referrals != nil {
+		if err := h.referrals.Attribute(r.Context(), req.ReferralCode, string(res.User.ID), res.User.Email); err != nil {
+			log.Printf("AuthHandler: Attribute referral Error: %v", err)
+		}
+	}
+
 	writeJSON(w, http.StatusCreated, res)
 }
 
@@ -80,6 +104,13 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Bring the anonymous cart along; a failed merge does not fail the login
+	if sessionID := getSessionID(r); sessionID != "" && h.cartService != nil {
+		if _, err := h.cartService.MergeCarts(r.Context(), sessionID, string(res.User.ID)); err != nil {
+			log.Printf("AuthHandler: MergeCarts Error: %v", err)
+		}
+	}
+
 	writeJSON(w, http.StatusOK, res)
 }
 
@@ -0,0 +1,100 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/deicod/auth/core"
+	"github.com/deicod/dysv/internal/handler"
+	"github.com/deicod/dysv/internal/mocks"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/deicod/dysv/internal/service"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Auth Handler", func() {
+	var (
+		ctx         context.Context
+		cartService *service.CartService
+		referrals   *service.ReferralService
+		authHandler *handler.AuthHandler
+		registered  int
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		cartService = service.NewCartService(repo.NewMockCartRepo(), catalogService, nil, nil)
+		referrals = service.NewReferralService(repo.NewMockReferralRepo(), nil)
+		registered = 0
+		mockAuth := &mocks.MockAuthService{
+			RegisterFunc: func(ctx context.Context, cmd core.RegisterCommand) (core.AuthResult, error) {
+				registered++
+				return core.AuthResult{User: core.UserPublic{ID: core.ID("user_2"), Email: cmd.Email}, Token: "token"}, nil
+			},
+			LoginFunc: func(ctx context.Context, cmd core.LoginCommand) (core.AuthResult, error) {
+				return core.AuthResult{User: core.UserPublic{ID: core.ID("user_1")}, Token: "token"}, nil
+			},
+		}
+		authHandler = handler.NewAuthHandler(mockAuth, cartService, referrals)
+	})
+
+	Describe("POST /api/auth/register", func() {
+		register := func(body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/api/auth/register", stringReader(body))
+			rec := httptest.NewRecorder()
+			authHandler.Register(rec, req)
+			return rec
+		}
+
+		It("should attribute the registration to the referral code", func() {
+			code, err := referrals.CodeFor(ctx, "user_1", "alice@example.com", true)
+			Expect(err).NotTo(HaveOccurred())
+
+			rec := register(`{"email": "bob@example.com", "username": "bob", "password": "secret", "referralCode": "` + code.Code + `"}`)
+			Expect(rec.Code).To(Equal(http.StatusCreated))
+
+			list, err := referrals.Referrals(ctx, "user_1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(HaveLen(1))
+			Expect(list[0].RefereeID).To(Equal("user_2"))
+		})
+
+		It("should reject unknown codes and self-referrals before registering", func() {
+			code, err := referrals.CodeFor(ctx, "user_1", "alice@example.com", true)
+			Expect(err).NotTo(HaveOccurred())
+
+			rec := register(`{"email": "bob@example.com", "username": "bob", "password": "secret", "referralCode": "NOSUCHCODE"}`)
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+			rec = register(`{"email": "Alice+new@example.com", "username": "alice2", "password": "secret", "referralCode": "` + code.Code + `"}`)
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+			Expect(registered).To(BeZero())
+		})
+	})
+
+	Describe("POST /api/auth/login", func() {
+		It("should merge the session cart into the user's cart", func() {
+			userCtx := service.WithUserID(ctx, "user_1")
+			_, err := cartService.AddPlan(userCtx, "laptop", "node-pro", 1)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = cartService.AddPlan(ctx, "phone", "static-micro", 1)
+			Expect(err).NotTo(HaveOccurred())
+
+			req := httptest.NewRequest(http.MethodPost, "/api/auth/login", stringReader(`{"email": "a@example.com", "password": "secret"}`))
+			req = handler.WithSessionID(req, "phone")
+			rec := httptest.NewRecorder()
+			authHandler.Login(rec, req)
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			cart, err := cartService.GetOrCreateCart(userCtx, "phone")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cart.Items).To(HaveLen(2))
+		})
+	})
+})
@@ -4,13 +4,16 @@ Copyright © 2025 Darko Luketic <info@icod.de>
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/davecgh/go-spew/spew"
 
+	"github.com/deicod/auth"
 	"github.com/deicod/dysv/internal/config"
 	"github.com/deicod/dysv/internal/model"
 	"github.com/deicod/dysv/internal/service"
@@ -18,24 +21,30 @@ import (
 
 // CartHandler handles cart-related HTTP requests
 type CartHandler struct {
-	cartService *service.CartService
+	cartService    *service.CartService
+	auth           auth.Service
+	addressService *service.AddressService
+	taxes          *service.TaxService
 }
 
-// NewCartHandler creates a new cart handler
-func NewCartHandler(cartService *service.CartService) *CartHandler {
+// NewCartHandler creates a new cart handler.
+// auth and addressService are optional; without them no profile currency is applied.
+// taxes is optional; without it quotes are net.
+func NewCartHandler(cartService *service.CartService, auth auth.Service, addressService *service.AddressService, taxes *service.TaxService) *CartHandler {
 	return &CartHandler{
-		cartService: cartService,
+		cartService:    cartService,
+		auth:           auth,
+		addressService: addressService,
+		taxes:          taxes,
 	}
 }
 
-// getSessionID extracts session ID from request (cookie or header)
+// getSessionID returns the cart session ID verified by SessionManager.Wrap.
+// Without the middleware there is no session; the raw cookie and header are
+// never trusted.
 func getSessionID(r *http.Request) string {
-	// Try cookie first
-	if cookie, err := r.Cookie("session_id"); err == nil {
-		return cookie.Value
-	}
-	// Fall back to header
-	return r.Header.Get("X-Session-ID")
+	id, _ := r.Context().Value(sessionIDKey{}).(string)
+	return id
 }
 
 // GetCart handles GET /api/cart
@@ -46,21 +55,142 @@ func (h *CartHandler) GetCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cart, err := h.cartService.GetOrCreateCart(r.Context(), sessionID)
+	ctx := h.cartContext(r)
+	cart, err := h.cartService.GetCart(ctx, sessionID)
 	if err != nil {
 		fmt.Printf("Handler: GetCart Error: %v\n", err)
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	monthly, yearly := h.cartService.GetCartTotal(cart)
-	resp := CartResponse{
-		Cart:         cart,
-		MonthlyTotal: monthly,
-		YearlyTotal:  yearly,
+	// Explicit ?currency= wins; otherwise an untouched empty cart follows the
+	// currency of the user's default billing address (see cartContext)
+	if currency := r.URL.Query().Get("currency"); currency != "" {
+		cart, err = h.cartService.SetCurrency(ctx, sessionID, currency, true)
+		if err != nil {
+			writeCartError(w, err)
+			return
+		}
 	}
 
-	writeJSON(w, http.StatusOK, resp)
+	h.writeCart(w, r, cart)
+}
+
+// GetQuote handles GET /api/cart/quote: net, tax, gross and discount per
+// line and in total for one invoice of the cart's billing cycle.
+// VAT follows the user's default billing address, else ?country=XX, else
+// the seller's home country.
+func (h *CartHandler) GetQuote(w http.ResponseWriter, r *http.Request) {
+	sessionID := getSessionID(r)
+	if sessionID == "" {
+		writeError(w, http.StatusBadRequest, "session_id required")
+		return
+	}
+
+	ctx := h.cartContext(r)
+	cart, err := h.cartService.GetCart(ctx, sessionID)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	tax, err := h.taxFor(ctx, r.URL.Query().Get("country"))
+	if errors.Is(err, service.ErrInvalidCountry) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	quote, err := h.cartService.Quote(ctx, cart, tax)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, quote)
+}
+
+// cartContext returns the request context, marked with the authenticated
+// user when the request carries a valid token, so the user's cart is used,
+// and with the currency of their default billing address
+func (h *CartHandler) cartContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	token := getToken(r)
+	if token == "" || h.auth == nil {
+		return ctx
+	}
+	user, _, err := h.auth.AuthenticateSession(ctx, token)
+	if err != nil {
+		return ctx
+	}
+	ctx = service.WithUserID(ctx, string(user.ID))
+	return service.WithProfileCurrency(ctx, h.profileCurrency(ctx))
+}
+
+// taxFor returns the VAT to quote: by the authenticated user's default
+// billing address if there is one, else by country or HomeCountry
+func (h *CartHandler) taxFor(ctx context.Context, country string) (model.TaxDecision, error) {
+	if h.taxes == nil {
+		return model.TaxDecision{}, nil
+	}
+	if userID := service.UserIDFrom(ctx); userID != "" && h.addressService != nil {
+		addr, err := h.addressService.DefaultAddress(ctx, userID)
+		if err != nil {
+			return model.TaxDecision{}, err
+		}
+		if addr != nil {
+			return h.taxes.Decide(addr)
+		}
+	}
+	if country == "" {
+		country = service.HomeCountry
+	}
+	return h.taxes.ForCountry(country)
+}
+
+// profileCurrency returns the currency for the authenticated user's default
+// billing address, or "" for anonymous users and users without one
+func (h *CartHandler) profileCurrency(ctx context.Context) string {
+	userID := service.UserIDFrom(ctx)
+	if userID == "" || h.addressService == nil {
+		return ""
+	}
+	addr, err := h.addressService.DefaultAddress(ctx, userID)
+	if err != nil || addr == nil {
+		return ""
+	}
+	return service.CurrencyForCountry(addr.Country)
+}
+
+// SetCurrencyRequest is the request body for setting the cart currency
+type SetCurrencyRequest struct {
+	Currency string `json:"currency"`
+}
+
+// SetCurrency handles POST /api/cart/currency
+func (h *CartHandler) SetCurrency(w http.ResponseWriter, r *http.Request) {
+	sessionID := getSessionID(r)
+	if sessionID == "" {
+		writeError(w, http.StatusBadRequest, "session_id required")
+		return
+	}
+
+	var req SetCurrencyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	cart, err := h.cartService.SetCurrency(h.cartContext(r), sessionID, req.Currency, true)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	h.writeCart(w, r, cart)
 }
 
 // AddPlanRequest is the request body for adding a plan
@@ -88,25 +218,14 @@ func (h *CartHandler) AddPlan(w http.ResponseWriter, r *http.Request) {
 		qty = 1
 	}
 
-	cart, err := h.cartService.AddPlan(r.Context(), sessionID, req.PlanID, qty)
+	cart, err := h.cartService.AddPlan(h.cartContext(r), sessionID, req.PlanID, qty)
 	if err != nil {
 		fmt.Printf("Handler: AddPlan Error: %v\n", err)
-		if errors.Is(err, service.ErrInvalidPlan) {
-			writeError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeCartError(w, err)
 		return
 	}
 
-	monthly, yearly := h.cartService.GetCartTotal(cart)
-	resp := CartResponse{
-		Cart:         cart,
-		MonthlyTotal: monthly,
-		YearlyTotal:  yearly,
-	}
-
-	writeJSON(w, http.StatusOK, resp)
+	h.writeCart(w, r, cart)
 }
 
 // UpdateItemRequest is the request body for updating item quantity
@@ -134,20 +253,44 @@ func (h *CartHandler) UpdateItemQuantity(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	cart, err := h.cartService.UpdateItemQuantity(r.Context(), sessionID, itemID, req.Quantity)
+	cart, err := h.cartService.UpdateItemQuantity(h.cartContext(r), sessionID, itemID, req.Quantity)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeCartError(w, err)
 		return
 	}
 
-	monthly, yearly := h.cartService.GetCartTotal(cart)
-	resp := CartResponse{
-		Cart:         cart,
-		MonthlyTotal: monthly,
-		YearlyTotal:  yearly,
+	h.writeCart(w, r, cart)
+}
+
+// ConfigureSite handles PUT /api/cart/item/{itemId}/sites/{index} with a
+// model.SiteConfig body; index is 0-based
+func (h *CartHandler) ConfigureSite(w http.ResponseWriter, r *http.Request) {
+	sessionID := getSessionID(r)
+	if sessionID == "" {
+		writeError(w, http.StatusBadRequest, "session_id required")
+		return
+	}
+
+	itemID := r.PathValue("itemId")
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if itemID == "" || err != nil {
+		writeError(w, http.StatusBadRequest, "itemId and numeric index required")
+		return
+	}
+
+	var req model.SiteConfig
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	cart, err := h.cartService.ConfigureSite(h.cartContext(r), sessionID, itemID, index, req)
+	if err != nil {
+		writeCartError(w, err)
+		return
 	}
 
-	writeJSON(w, http.StatusOK, resp)
+	h.writeCart(w, r, cart)
 }
 
 // AddAddonRequest is the request body for adding an addon
@@ -169,24 +312,13 @@ func (h *CartHandler) AddAddon(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cart, err := h.cartService.AddAddon(r.Context(), sessionID, req.AddonID)
+	cart, err := h.cartService.AddAddon(h.cartContext(r), sessionID, req.AddonID)
 	if err != nil {
-		if errors.Is(err, service.ErrInvalidAddon) {
-			writeError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeCartError(w, err)
 		return
 	}
 
-	monthly, yearly := h.cartService.GetCartTotal(cart)
-	resp := CartResponse{
-		Cart:         cart,
-		MonthlyTotal: monthly,
-		YearlyTotal:  yearly,
-	}
-
-	writeJSON(w, http.StatusOK, resp)
+	h.writeCart(w, r, cart)
 }
 
 // RemoveItem handles DELETE /api/cart/item/{itemId}
@@ -203,20 +335,13 @@ func (h *CartHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cart, err := h.cartService.RemoveItem(r.Context(), sessionID, itemID)
+	cart, err := h.cartService.RemoveItem(h.cartContext(r), sessionID, itemID)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeCartError(w, err)
 		return
 	}
 
-	monthly, yearly := h.cartService.GetCartTotal(cart)
-	resp := CartResponse{
-		Cart:         cart,
-		MonthlyTotal: monthly,
-		YearlyTotal:  yearly,
-	}
-
-	writeJSON(w, http.StatusOK, resp)
+	h.writeCart(w, r, cart)
 }
 
 // SetBillingCycleRequest is the request body for setting billing cycle
@@ -245,37 +370,184 @@ func (h *CartHandler) SetBillingCycle(w http.ResponseWriter, r *http.Request) {
 	spew.Dump("Handler Request Body", req)
 	fmt.Printf("Handler: SetBillingCycle to %s for %s\n", req.BillingCycle, sessionID)
 
-	if req.BillingCycle != model.BillingMonthly && req.BillingCycle != model.BillingYearly {
-		writeError(w, http.StatusBadRequest, "invalid billing cycle")
-		return
-	}
-	fmt.Println("BillingCycle checked successfully")
-	cart, err := h.cartService.SetBillingCycle(r.Context(), sessionID, req.BillingCycle)
+	cart, err := h.cartService.SetBillingCycle(h.cartContext(r), sessionID, req.BillingCycle)
 	if err != nil {
 		fmt.Printf("Handler: SetBillingCycle Error: %v\n", err)
-		writeError(w, http.StatusInternalServerError, "SetBillingCycle failed: "+err.Error())
+		if errors.Is(err, service.ErrInvalidBillingCycle) {
+			writeError(w, http.StatusBadRequest, "invalid billing cycle")
+			return
+		}
+		writeCartError(w, err)
 		return
 	}
 	spew.Dump("cart:", cart)
 	fmt.Println("BillingCycle set successfully")
 
-	monthly, yearly := h.cartService.GetCartTotal(cart)
-	resp := CartResponse{
-		Cart:         cart,
-		MonthlyTotal: monthly,
-		YearlyTotal:  yearly,
+	h.writeCart(w, r, cart)
+	fmt.Println("SetBillingCycle end")
+}
+
+// ApplyCouponRequest is the request body for applying a coupon
+type ApplyCouponRequest struct {
+	Code string `json:"code"`
+}
+
+// ApplyCoupon handles POST /api/cart/coupon
+func (h *CartHandler) ApplyCoupon(w http.ResponseWriter, r *http.Request) {
+	sessionID := getSessionID(r)
+	if sessionID == "" {
+		writeError(w, http.StatusBadRequest, "session_id required")
+		return
 	}
-	spew.Dump("monthly, yearly:", monthly, yearly)
 
-	writeJSON(w, http.StatusOK, resp)
-	fmt.Println("SetBillingCycle end")
+	var req ApplyCouponRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		writeError(w, http.StatusBadRequest, "code required")
+		return
+	}
+
+	cart, err := h.cartService.ApplyCoupon(h.cartContext(r), sessionID, req.Code)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	h.writeCart(w, r, cart)
+}
+
+// RemoveCoupon handles DELETE /api/cart/coupon
+func (h *CartHandler) RemoveCoupon(w http.ResponseWriter, r *http.Request) {
+	sessionID := getSessionID(r)
+	if sessionID == "" {
+		writeError(w, http.StatusBadRequest, "session_id required")
+		return
+	}
+
+	cart, err := h.cartService.RemoveCoupon(h.cartContext(r), sessionID)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	h.writeCart(w, r, cart)
+}
+
+// SetRemindersRequest is the request body for abandoned-cart reminders
+type SetRemindersRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// SetReminders handles POST /api/cart/reminders. Reminders go to the
+// logged-in user's account email.
+func (h *CartHandler) SetReminders(w http.ResponseWriter, r *http.Request) {
+	sessionID := getSessionID(r)
+	if sessionID == "" {
+		writeError(w, http.StatusBadRequest, "session_id required")
+		return
+	}
+
+	token := getToken(r)
+	if token == "" || h.auth == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	user, _, err := h.auth.AuthenticateSession(r.Context(), token)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	var req SetRemindersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	ctx := service.WithUserID(r.Context(), string(user.ID))
+	cart, err := h.cartService.SetReminders(ctx, sessionID, user.Email, req.Enabled)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	h.writeCart(w, r, cart)
+}
+
+// RestoreCartRequest is the request body for restoring a cart
+type RestoreCartRequest struct {
+	Token string `json:"token"`
+}
+
+// RestoreCart handles POST /api/cart/restore with the token from a reminder link
+func (h *CartHandler) RestoreCart(w http.ResponseWriter, r *http.Request) {
+	sessionID := getSessionID(r)
+	if sessionID == "" {
+		writeError(w, http.StatusBadRequest, "session_id required")
+		return
+	}
+
+	var req RestoreCartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		writeError(w, http.StatusBadRequest, "token required")
+		return
+	}
+
+	cart, err := h.cartService.RestoreCart(h.cartContext(r), sessionID, req.Token)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	h.writeCart(w, r, cart)
 }
 
 // CartResponse is the response for cart endpoints
 type CartResponse struct {
 	Cart         *model.Cart `json:"cart"`
-	MonthlyTotal float64     `json:"monthlyTotal"`
-	YearlyTotal  float64     `json:"yearlyTotal"`
+	MonthlyTotal model.Money `json:"monthlyTotal"`
+	CycleTotal   model.Money `json:"cycleTotal"` // invoiced per billing cycle
+}
+
+// writeCart writes the cart together with its totals
+func (h *CartHandler) writeCart(w http.ResponseWriter, r *http.Request, cart *model.Cart) {
+	monthly, cycleTotal, err := h.cartService.GetCartTotal(h.cartContext(r), cart)
+	if err != nil {
+		fmt.Printf("Handler: GetCartTotal Error: %v\n", err)
+		writeError(w, http.StatusInternalServerError, "failed to calculate cart total")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, CartResponse{
+		Cart:         cart,
+		MonthlyTotal: monthly,
+		CycleTotal:   cycleTotal,
+	})
+}
+
+// writeCartError maps cart service errors to HTTP responses
+func writeCartError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidPlan),
+		errors.Is(err, service.ErrInvalidAddon),
+		errors.Is(err, service.ErrUnsupportedCurrency),
+		errors.Is(err, service.ErrAddonRequiresPlan),
+		errors.Is(err, service.ErrAddonLimitExceeded),
+		errors.Is(err, service.ErrAddonConflict),
+		errors.Is(err, service.ErrInvalidReminder),
+		errors.Is(err, service.ErrInvalidSite),
+		errors.Is(err, service.ErrInvalidCoupon),
+		errors.Is(err, service.ErrCouponNotApplicable),
+		errors.Is(err, service.ErrCouponLimitReached):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrCartConflict):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrLoginRequired):
+		writeError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, service.ErrInvalidRestoreToken):
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
 }
 
 // Placeholder for dependency injection
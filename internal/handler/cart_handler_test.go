@@ -179,8 +179,8 @@ var _ = Describe("CORS Middleware", func() {
 // CartResponse mirrors the handler CartResponse for testing
 type CartResponse struct {
 	Cart         *model.Cart `json:"cart"`
-	MonthlyTotal float64     `json:"monthlyTotal"`
-	YearlyTotal  float64     `json:"yearlyTotal"`
+	MonthlyTotal model.Money `json:"monthlyTotal"`
+	YearlyTotal  model.Money `json:"yearlyTotal"`
 }
 
 // ErrorResponse mirrors the handler ErrorResponse for testing
@@ -0,0 +1,306 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/deicod/auth"
+	"github.com/deicod/auth/core"
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/service"
+)
+
+// CatalogHandler serves the public catalog and the admin catalog endpoints
+type CatalogHandler struct {
+	catalogService *service.CatalogService
+	auth           auth.Service
+}
+
+// NewCatalogHandler creates a new catalog handler
+func NewCatalogHandler(catalogService *service.CatalogService, auth auth.Service) *CatalogHandler {
+	return &CatalogHandler{
+		catalogService: catalogService,
+		auth:           auth,
+	}
+}
+
+// requireAdmin authenticates the request and checks for the admin role.
+// It writes the error response itself and reports whether to continue.
+func (h *CatalogHandler) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	_, ok := authenticateAdmin(w, r, h.auth)
+	return ok
+}
+
+// authenticateAdmin returns the authenticated admin user. Otherwise it
+// writes a 401 or 403 response and returns false.
+func authenticateAdmin(w http.ResponseWriter, r *http.Request, svc auth.Service) (core.UserPublic, bool) {
+	token := getToken(r)
+	if token == "" || svc == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return core.UserPublic{}, false
+	}
+	user, _, err := svc.AuthenticateSession(r.Context(), token)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "authentication failed")
+		return core.UserPublic{}, false
+	}
+	if user.Role != "admin" {
+		writeError(w, http.StatusForbidden, "forbidden")
+		return core.UserPublic{}, false
+	}
+	return user, true
+}
+
+// PlanResponse is a catalog plan rendered in one language
+type PlanResponse struct {
+	ID             string             `json:"id"`
+	Name           string             `json:"name"`
+	TargetAudience string             `json:"targetAudience"`
+	Features       []string           `json:"features"`
+	Limits         string             `json:"limits"`
+	MonthlyPrices  model.PriceTable   `json:"monthlyPrices"`
+	Resources      model.ResourceSpec `json:"resources"`
+	Frameworks     []string           `json:"frameworks"`
+	SortOrder      int                `json:"sortOrder"`
+}
+
+// ListPlans handles GET /api/plans (language from ?lang= or Accept-Language)
+func (h *CatalogHandler) ListPlans(w http.ResponseWriter, r *http.Request) {
+	plans, err := h.catalogService.ListPlans(r.Context())
+	if err != nil {
+		log.Printf("CatalogHandler: ListPlans Error: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to list plans")
+		return
+	}
+
+	lang := requestLanguage(r)
+	resp := make([]PlanResponse, 0, len(plans))
+	for _, plan := range plans {
+		content := plan.Localized(lang)
+		resp = append(resp, PlanResponse{
+			ID:             plan.ID,
+			Name:           content.Name,
+			TargetAudience: content.TargetAudience,
+			Features:       content.Features,
+			Limits:         plan.Resources.Describe(lang),
+			MonthlyPrices:  plan.MonthlyPrices,
+			Resources:      plan.Resources,
+			Frameworks:     plan.Frameworks,
+			SortOrder:      plan.SortOrder,
+		})
+	}
+
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept-Language")
+	writeJSON(w, http.StatusOK, map[string]interface{}{"lang": lang, "plans": resp})
+}
+
+// ListAddons handles GET /api/addons
+func (h *CatalogHandler) ListAddons(w http.ResponseWriter, r *http.Request) {
+	addons, err := h.catalogService.ListAddons(r.Context())
+	if err != nil {
+		log.Printf("CatalogHandler: ListAddons Error: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to list addons")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"addons": addons})
+}
+
+// CreatePlan handles POST /api/admin/plans
+func (h *CatalogHandler) CreatePlan(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	var plan model.Plan
+	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	plan.StripeProductID, plan.StripePrices = "", nil
+
+	if _, err := h.catalogService.GetPlan(r.Context(), plan.ID); err == nil {
+		writeError(w, http.StatusConflict, "plan already exists")
+		return
+	}
+
+	h.savePlan(w, r, &plan, http.StatusCreated)
+}
+
+// UpdatePlan handles PUT /api/admin/plans/{id}
+func (h *CatalogHandler) UpdatePlan(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	id := r.PathValue("id")
+	existing, err := h.catalogService.GetPlan(r.Context(), id)
+	if err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+
+	var plan model.Plan
+	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	plan.ID = id
+	// Stripe IDs are owned by `dysv catalog sync`
+	plan.StripeProductID, plan.StripePrices = existing.StripeProductID, existing.StripePrices
+
+	h.savePlan(w, r, &plan, http.StatusOK)
+}
+
+func (h *CatalogHandler) savePlan(w http.ResponseWriter, r *http.Request, plan *model.Plan, status int) {
+	if err := h.catalogService.SavePlan(r.Context(), plan); err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, status, plan)
+}
+
+// DeletePlan handles DELETE /api/admin/plans/{id}
+func (h *CatalogHandler) DeletePlan(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	if err := h.catalogService.DeletePlan(r.Context(), r.PathValue("id")); err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// CreateAddon handles POST /api/admin/addons
+func (h *CatalogHandler) CreateAddon(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	var addon model.Addon
+	if err := json.NewDecoder(r.Body).Decode(&addon); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	addon.StripeProductID, addon.StripePrices = "", nil
+
+	if _, err := h.catalogService.GetAddon(r.Context(), addon.ID); err == nil {
+		writeError(w, http.StatusConflict, "addon already exists")
+		return
+	}
+
+	h.saveAddon(w, r, &addon, http.StatusCreated)
+}
+
+// UpdateAddon handles PUT /api/admin/addons/{id}
+func (h *CatalogHandler) UpdateAddon(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	id := r.PathValue("id")
+	existing, err := h.catalogService.GetAddon(r.Context(), id)
+	if err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+
+	var addon model.Addon
+	if err := json.NewDecoder(r.Body).Decode(&addon); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	addon.ID = id
+	// Stripe IDs are owned by `dysv catalog sync`
+	addon.StripeProductID, addon.StripePrices = existing.StripeProductID, existing.StripePrices
+
+	h.saveAddon(w, r, &addon, http.StatusOK)
+}
+
+func (h *CatalogHandler) saveAddon(w http.ResponseWriter, r *http.Request, addon *model.Addon, status int) {
+	if err := h.catalogService.SaveAddon(r.Context(), addon); err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, status, addon)
+}
+
+// DeleteAddon handles DELETE /api/admin/addons/{id}
+func (h *CatalogHandler) DeleteAddon(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	if err := h.catalogService.DeleteAddon(r.Context(), r.PathValue("id")); err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// ListCycles handles GET /api/billing-cycles
+func (h *CatalogHandler) ListCycles(w http.ResponseWriter, r *http.Request) {
+	cycles, err := h.catalogService.ListCycles(r.Context())
+	if err != nil {
+		log.Printf("CatalogHandler: ListCycles Error: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to list billing cycles")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"billingCycles": cycles})
+}
+
+// SaveCycle handles PUT /api/admin/billing-cycles/{id} (create or replace)
+func (h *CatalogHandler) SaveCycle(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	var cycle model.BillingCycleDef
+	if err := json.NewDecoder(r.Body).Decode(&cycle); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	cycle.ID = model.BillingCycle(r.PathValue("id"))
+
+	if err := h.catalogService.SaveCycle(r.Context(), &cycle); err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, cycle)
+}
+
+// DeleteCycle handles DELETE /api/admin/billing-cycles/{id}
+func (h *CatalogHandler) DeleteCycle(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	if err := h.catalogService.DeleteCycle(r.Context(), model.BillingCycle(r.PathValue("id"))); err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// writeCatalogError maps catalog service errors to HTTP responses
+func writeCatalogError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidPlan), errors.Is(err, service.ErrInvalidAddon),
+		errors.Is(err, service.ErrInvalidBillingCycle), errors.Is(err, service.ErrInvalidCoupon):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidCatalogEntry):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Printf("CatalogHandler: Error: %v", err)
+		writeError(w, http.StatusInternalServerError, "catalog operation failed")
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/deicod/auth/core"
+	"github.com/deicod/dysv/internal/handler"
+	"github.com/deicod/dysv/internal/mocks"
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/deicod/dysv/internal/service"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CatalogHandler", func() {
+	var (
+		catalogService *service.CatalogService
+		catalogHandler *handler.CatalogHandler
+		mux            *http.ServeMux
+	)
+
+	BeforeEach(func() {
+		catalogService = service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(context.Background())).To(Succeed())
+
+		mockAuth := &mocks.MockAuthService{
+			AuthenticateSessionFunc: func(ctx context.Context, token string) (core.UserPublic, core.SessionPublic, error) {
+				switch token {
+				case "admin-token":
+					return core.UserPublic{ID: "admin_1", Role: "admin"}, core.SessionPublic{}, nil
+				case "user-token":
+					return core.UserPublic{ID: "user_1", Role: "user"}, core.SessionPublic{}, nil
+				}
+				return core.UserPublic{}, core.SessionPublic{}, errors.New("invalid token")
+			},
+		}
+		catalogHandler = handler.NewCatalogHandler(catalogService, mockAuth)
+
+		mux = http.NewServeMux()
+		mux.HandleFunc("GET /api/plans", catalogHandler.ListPlans)
+		mux.HandleFunc("POST /api/admin/plans", catalogHandler.CreatePlan)
+		mux.HandleFunc("PUT /api/admin/plans/{id}", catalogHandler.UpdatePlan)
+		mux.HandleFunc("DELETE /api/admin/plans/{id}", catalogHandler.DeletePlan)
+	})
+
+	Describe("GET /api/plans", func() {
+		It("should list the seeded plans in order", func() {
+			req := httptest.NewRequest(http.MethodGet, "/api/plans", nil)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			var response plansResponse
+			Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.Plans).To(HaveLen(3))
+			Expect(response.Plans[0].ID).To(Equal("static-micro"))
+		})
+
+		It("should render limits from the resource spec", func() {
+			req := httptest.NewRequest(http.MethodGet, "/api/plans?lang=de", nil)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			var response plansResponse
+			Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.Plans[2].Limits).To(Equal("2 vCPU (Dediziert), 4GB RAM, 20GB Speicher"))
+			Expect(response.Plans[2].Resources.CPULimitMillis).To(Equal(int64(2000)))
+		})
+
+		It("should localize content from ?lang=", func() {
+			req := httptest.NewRequest(http.MethodGet, "/api/plans?lang=hr", nil)
+			req.Header.Set("Accept-Language", "de")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			var response plansResponse
+			Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.Lang).To(Equal("hr"))
+			Expect(response.Plans[1].TargetAudience).To(Equal("Osobni blogovi"))
+			Expect(response.Plans[1].Features).To(ContainElement("Podrška za Next.js / Nuxt"))
+		})
+
+		It("should negotiate Accept-Language by weight", func() {
+			req := httptest.NewRequest(http.MethodGet, "/api/plans", nil)
+			req.Header.Set("Accept-Language", "fr-FR, en;q=0.5, de-AT;q=0.8")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			var response plansResponse
+			Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.Lang).To(Equal("de"))
+			Expect(rec.Header().Get("Content-Language")).To(Equal("de"))
+			Expect(response.Plans[1].TargetAudience).To(Equal("Persönliche Blogs"))
+		})
+
+		It("should fall back to English", func() {
+			req := httptest.NewRequest(http.MethodGet, "/api/plans?lang=fr", nil)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			var response plansResponse
+			Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.Lang).To(Equal("en"))
+			Expect(response.Plans[0].Features).To(ContainElement("Static site hosting"))
+		})
+	})
+
+	Describe("admin endpoints", func() {
+		It("should reject anonymous requests", func() {
+			req := httptest.NewRequest(http.MethodDelete, "/api/admin/plans/node-pro", nil)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should reject non-admin users", func() {
+			req := httptest.NewRequest(http.MethodDelete, "/api/admin/plans/node-pro", nil)
+			req.Header.Set("Authorization", "Bearer user-token")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusForbidden))
+		})
+
+		It("should create a plan", func() {
+			body := `{"id": "node-max", "name": "Node Max", "monthlyPrices": {"EUR": {"amount": 7990, "currency": "EUR"}}, "sortOrder": 4}`
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/plans", bytes.NewBufferString(body))
+			req.Header.Set("Authorization", "Bearer admin-token")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusCreated))
+			plan, err := catalogService.GetPlan(context.Background(), "node-max")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.MonthlyPrices["EUR"]).To(Equal(model.NewMoney(7990, "EUR")))
+		})
+
+		It("should reject creating an existing plan", func() {
+			body := `{"id": "node-pro", "name": "Node Pro", "monthlyPrices": {"EUR": {"amount": 3990, "currency": "EUR"}}}`
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/plans", bytes.NewBufferString(body))
+			req.Header.Set("Authorization", "Bearer admin-token")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusConflict))
+		})
+
+		It("should update a plan price", func() {
+			body := `{"name": "Node Pro", "monthlyPrices": {"EUR": {"amount": 4290, "currency": "EUR"}}}`
+			req := httptest.NewRequest(http.MethodPut, "/api/admin/plans/node-pro", bytes.NewBufferString(body))
+			req.Header.Set("Authorization", "Bearer admin-token")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			plan, _ := catalogService.GetPlan(context.Background(), "node-pro")
+			Expect(plan.MonthlyPrices["EUR"]).To(Equal(model.NewMoney(4290, "EUR")))
+		})
+
+		It("should return 404 when updating an unknown plan", func() {
+			body := `{"name": "Ghost", "monthlyPrices": {"EUR": {"amount": 100, "currency": "EUR"}}}`
+			req := httptest.NewRequest(http.MethodPut, "/api/admin/plans/ghost", bytes.NewBufferString(body))
+			req.Header.Set("Authorization", "Bearer admin-token")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+})
+
+type plansResponse struct {
+	Lang  string                 `json:"lang"`
+	Plans []handler.PlanResponse `json:"plans"`
+}
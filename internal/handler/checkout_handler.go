@@ -9,30 +9,39 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/deicod/auth"
+	"github.com/deicod/dysv/internal/model"
 	"github.com/deicod/dysv/internal/service"
+	"github.com/stripe/stripe-go/v82"
 	"github.com/stripe/stripe-go/v82/webhook"
 )
 
 // CheckoutHandler handles checkout-related HTTP requests
 type CheckoutHandler struct {
 	checkoutService  *service.CheckoutService
+	subscriptions    *service.SubscriptionService
 	auth             auth.Service
 	webhookSecret    string
 	stripeAPIVersion string
 }
 
-// NewCheckoutHandler creates a new checkout handler
-func NewCheckoutHandler(checkoutService *service.CheckoutService, auth auth.Service, webhookSecret, stripeAPIVersion string) *CheckoutHandler {
+// NewCheckoutHandler creates a new checkout handler.
+// subscriptions is optional; without it subscription events are only logged.
+func NewCheckoutHandler(checkoutService *service.CheckoutService, subscriptions *service.SubscriptionService, auth auth.Service, webhookSecret, stripeAPIVersion string) *CheckoutHandler {
 	return &CheckoutHandler{
 		checkoutService:  checkoutService,
+		subscriptions:    subscriptions,
 		auth:             auth,
 		webhookSecret:    webhookSecret,
 		stripeAPIVersion: stripeAPIVersion,
 	}
 }
 
+// maxIdempotencyKeyLen matches the longest key Stripe accepts
+const maxIdempotencyKeyLen = 255
+
 type CreateCheckoutSessionRequest struct {
 	AddressID string `json:"addressId"`
 }
@@ -49,7 +58,7 @@ func (h *CheckoutHandler) CreateCheckoutSession(w http.ResponseWriter, r *http.R
 	token := getToken(r) // helper from auth_handler (need to make it shared or duplicate)
 	// getToken is likely in utils or same package if handlers are in same package.
 	// They are in `package handler`, so `getToken` is shared if valid.
-	if token == "" {
+	if token == "" || h.auth == nil {
 		writeError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
@@ -70,13 +79,35 @@ func (h *CheckoutHandler) CreateCheckoutSession(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	checkoutURL, err := h.checkoutService.CreateCheckoutSession(r.Context(), sessionID, string(user.ID), req.AddressID)
+	// Clients send the same key when retrying a checkout they started
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if len(idempotencyKey) > maxIdempotencyKeyLen {
+		writeError(w, http.StatusBadRequest, "Idempotency-Key too long")
+		return
+	}
+
+	checkoutURL, err := h.checkoutService.CreateCheckoutSession(r.Context(), sessionID, string(user.ID), user.Email, req.AddressID, idempotencyKey)
 	if err != nil {
+		if errors.Is(err, service.ErrCheckoutInProgress) || errors.Is(err, service.ErrCreditChanged) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
 		if errors.Is(err, service.ErrEmptyCart) {
 			log.Printf("CheckoutHandler: CreateCheckoutSession EmptyCart: %v", err)
 			writeError(w, http.StatusBadRequest, err.Error())
 			return
 		}
+		if errors.Is(err, service.ErrAddonRequiresPlan) ||
+			errors.Is(err, service.ErrAddonLimitExceeded) ||
+			errors.Is(err, service.ErrAddonConflict) ||
+			errors.Is(err, service.ErrInvalidSite) ||
+			errors.Is(err, service.ErrInvalidCountry) ||
+			errors.Is(err, service.ErrInvalidCoupon) ||
+			errors.Is(err, service.ErrCouponNotApplicable) ||
+			errors.Is(err, service.ErrCouponLimitReached) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		log.Printf("CheckoutHandler: CreateCheckoutSession Error: %v", err)
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -159,7 +190,8 @@ func (h *CheckoutHandler) Webhook(w http.ResponseWriter, r *http.Request) {
 			// Payment mode determines status
 			paymentStatus, _ := event.Data.Object["payment_status"].(string)
 			status := "pending"
-			if paymentStatus == "paid" {
+			// Nothing due now, e.g. during a trial, completes the order as well
+			if paymentStatus == "paid" || paymentStatus == "no_payment_required" {
 				status = "paid"
 			}
 			if err := h.checkoutService.HandleWebhook(r.Context(), session, status); err != nil {
@@ -194,28 +226,40 @@ func (h *CheckoutHandler) Webhook(w http.ResponseWriter, r *http.Request) {
 	// Subscription lifecycle events (for ongoing subscription management)
 	case "customer.subscription.created":
 		log.Printf("Webhook: subscription created %s", event.ID)
-		// TODO: Link subscription to customer account
+		h.syncSubscription(r, event)
 
 	case "customer.subscription.updated":
 		log.Printf("Webhook: subscription updated %s", event.ID)
+		h.syncSubscription(r, event)
 		// TODO: Handle plan changes, quantity updates
 
 	case "customer.subscription.deleted":
 		log.Printf("Webhook: subscription canceled %s", event.ID)
+		h.syncSubscription(r, event)
 		// TODO: Deprovision resources
 
 	case "customer.subscription.paused":
 		log.Printf("Webhook: subscription paused %s", event.ID)
+		h.syncSubscription(r, event)
 		// TODO: Suspend service
 
 	case "customer.subscription.resumed":
 		log.Printf("Webhook: subscription resumed %s", event.ID)
+		h.syncSubscription(r, event)
 		// TODO: Resume service
 
+	case "customer.subscription.trial_will_end":
+		log.Printf("Webhook: subscription trial ending %s", event.ID)
+		if sub, ok := h.subscription(event); ok {
+			if err := h.subscriptions.TrialWillEnd(r.Context(), sub); err != nil {
+				log.Printf("Webhook: error sending trial reminder: %v", err)
+			}
+		}
+
 	// Invoice events (for payment tracking)
 	case "invoice.paid":
 		log.Printf("Webhook: invoice paid %s", event.ID)
-		// TODO: Record successful payment
+		h.invoicePaid(r, event)
 
 	case "invoice.payment_failed":
 		log.Printf("Webhook: invoice payment failed %s", event.ID)
@@ -227,3 +271,48 @@ func (h *CheckoutHandler) Webhook(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// subscription decodes the subscription of a customer.subscription.* event.
+// Reports false without a subscription service or for malformed data.
+func (h *CheckoutHandler) subscription(event stripe.Event) (*stripe.Subscription, bool) {
+	if h.subscriptions == nil {
+		return nil, false
+	}
+	var sub stripe.Subscription
+	if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
+		log.Printf("Webhook: invalid subscription in %s: %v", event.ID, err)
+		return nil, false
+	}
+	return &sub, true
+}
+
+// syncSubscription stores the subscription of event; failures are logged
+func (h *CheckoutHandler) syncSubscription(r *http.Request, event stripe.Event) {
+	if sub, ok := h.subscription(event); ok {
+		if _, err := h.subscriptions.Sync(r.Context(), sub); err != nil {
+			log.Printf("Webhook: error syncing subscription: %v", err)
+		}
+	}
+}
+
+// invoicePaid passes a paid subscription invoice on to the order that created
+// the subscription; failures are logged
+func (h *CheckoutHandler) invoicePaid(r *http.Request, event stripe.Event) {
+	var invoice stripe.Invoice
+	if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
+		log.Printf("Webhook: invalid invoice in %s: %v", event.ID, err)
+		return
+	}
+	if invoice.Parent == nil || invoice.Parent.SubscriptionDetails == nil {
+		return
+	}
+	// Subscription metadata is snapshotted on the invoice
+	orderID := invoice.Parent.SubscriptionDetails.Metadata["order_id"]
+	if orderID == "" {
+		return
+	}
+	paid := model.NewMoney(invoice.AmountPaid, strings.ToUpper(string(invoice.Currency)))
+	if err := h.checkoutService.InvoicePaid(r.Context(), orderID, paid); err != nil {
+		log.Printf("Webhook: error handling paid invoice: %v", err)
+	}
+}
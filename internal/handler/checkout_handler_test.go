@@ -4,43 +4,56 @@ Copyright © 2025 Darko Luketic <info@icod.de>
 package handler_test
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/deicod/auth/core"
 	"github.com/deicod/dysv/internal/handler"
+	"github.com/deicod/dysv/internal/mocks"
+	"github.com/deicod/dysv/internal/model"
 	"github.com/deicod/dysv/internal/repo"
 	"github.com/deicod/dysv/internal/service"
+	"github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/webhook"
 )
 
 var _ = Describe("Checkout Handler", func() {
 	var (
-		mockCartRepo  *repo.MockCartRepo
-		mockOrderRepo *repo.MockOrderRepo
-		cartService   *service.CartService
-		cartHandler   *handler.CartHandler
+		mockCartRepo    *repo.MockCartRepo
+		mockOrderRepo   *repo.MockOrderRepo
+		mockCatalogRepo *repo.MockCatalogRepo
+		cartService     *service.CartService
+		cartHandler     *handler.CartHandler
 	)
 
 	BeforeEach(func() {
 		mockCartRepo = repo.NewMockCartRepo()
 		mockOrderRepo = repo.NewMockOrderRepo()
-		cartService = service.NewCartService(mockCartRepo)
-		cartHandler = handler.NewCartHandler(cartService)
+		mockCatalogRepo = repo.NewMockCatalogRepo()
+		catalogService := service.NewCatalogService(mockCatalogRepo)
+		Expect(catalogService.Seed(context.Background())).To(Succeed())
+		cartService = service.NewCartService(mockCartRepo, catalogService, nil, nil)
+		cartHandler = handler.NewCartHandler(cartService, nil, nil, nil)
 		_ = mockOrderRepo // Will be used when we test checkout
 	})
 
 	AfterEach(func() {
 		mockCartRepo.Reset()
 		mockOrderRepo.Reset()
+		mockCatalogRepo.Reset()
 	})
 
 	Describe("GET /api/cart", func() {
 		It("should return empty cart for new session", func() {
 			req := httptest.NewRequest(http.MethodGet, "/api/cart", nil)
-			req.Header.Set("X-Session-ID", "new-session-123")
+			req = handler.WithSessionID(req, "new-session-123")
 			rec := httptest.NewRecorder()
 
 			cartHandler.GetCart(rec, req)
@@ -70,7 +83,7 @@ var _ = Describe("Checkout Handler", func() {
 		It("should add plan to cart", func() {
 			body := `{"planId": "node-starter"}`
 			req := httptest.NewRequest(http.MethodPost, "/api/cart/plan", stringReader(body))
-			req.Header.Set("X-Session-ID", "test-session")
+			req = handler.WithSessionID(req, "test-session")
 			req.Header.Set("Content-Type", "application/json")
 			rec := httptest.NewRecorder()
 
@@ -94,7 +107,7 @@ var _ = Describe("Checkout Handler", func() {
 		It("should reject invalid plan", func() {
 			body := `{"planId": "invalid-plan"}`
 			req := httptest.NewRequest(http.MethodPost, "/api/cart/plan", stringReader(body))
-			req.Header.Set("X-Session-ID", "test-session")
+			req = handler.WithSessionID(req, "test-session")
 			req.Header.Set("Content-Type", "application/json")
 			rec := httptest.NewRecorder()
 
@@ -107,7 +120,7 @@ var _ = Describe("Checkout Handler", func() {
 			// Add first plan
 			body := `{"planId": "static-micro"}`
 			req := httptest.NewRequest(http.MethodPost, "/api/cart/plan", stringReader(body))
-			req.Header.Set("X-Session-ID", "test-session")
+			req = handler.WithSessionID(req, "test-session")
 			req.Header.Set("Content-Type", "application/json")
 			rec := httptest.NewRecorder()
 			cartHandler.AddPlan(rec, req)
@@ -116,7 +129,7 @@ var _ = Describe("Checkout Handler", func() {
 			// Add second plan (append)
 			body = `{"planId": "node-pro"}`
 			req = httptest.NewRequest(http.MethodPost, "/api/cart/plan", stringReader(body))
-			req.Header.Set("X-Session-ID", "test-session")
+			req = handler.WithSessionID(req, "test-session")
 			req.Header.Set("Content-Type", "application/json")
 			rec = httptest.NewRecorder()
 			cartHandler.AddPlan(rec, req)
@@ -139,10 +152,20 @@ var _ = Describe("Checkout Handler", func() {
 	})
 
 	Describe("POST /api/cart/addon", func() {
+		BeforeEach(func() {
+			// de-domain requires a hosting plan in the cart
+			req := httptest.NewRequest(http.MethodPost, "/api/cart/plan", stringReader(`{"planId": "static-micro"}`))
+			req = handler.WithSessionID(req, "test-session")
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			cartHandler.AddPlan(rec, req)
+			Expect(rec.Code).To(Equal(http.StatusOK))
+		})
+
 		It("should add addon to cart", func() {
 			body := `{"addonId": "de-domain"}`
 			req := httptest.NewRequest(http.MethodPost, "/api/cart/addon", stringReader(body))
-			req.Header.Set("X-Session-ID", "test-session")
+			req = handler.WithSessionID(req, "test-session")
 			req.Header.Set("Content-Type", "application/json")
 			rec := httptest.NewRecorder()
 
@@ -156,9 +179,9 @@ var _ = Describe("Checkout Handler", func() {
 
 			cart := resp["cart"].(map[string]interface{})
 			items := cart["items"].([]interface{})
-			Expect(items).To(HaveLen(1))
+			Expect(items).To(HaveLen(2))
 
-			item := items[0].(map[string]interface{})
+			item := items[1].(map[string]interface{})
 			Expect(item["itemId"]).To(Equal("de-domain"))
 			Expect(item["itemType"]).To(Equal("addon"))
 		})
@@ -169,16 +192,16 @@ var _ = Describe("Checkout Handler", func() {
 			// Add addon twice
 			for i := 0; i < 2; i++ {
 				req := httptest.NewRequest(http.MethodPost, "/api/cart/addon", stringReader(body))
-				req.Header.Set("X-Session-ID", "test-session")
+				req = handler.WithSessionID(req, "test-session")
 				req.Header.Set("Content-Type", "application/json")
 				rec := httptest.NewRecorder()
 				cartHandler.AddAddon(rec, req)
 				Expect(rec.Code).To(Equal(http.StatusOK))
 			}
 
-			// Verify only one addon
+			// Verify only one addon next to the plan
 			req := httptest.NewRequest(http.MethodGet, "/api/cart", nil)
-			req.Header.Set("X-Session-ID", "test-session")
+			req = handler.WithSessionID(req, "test-session")
 			rec := httptest.NewRecorder()
 			cartHandler.GetCart(rec, req)
 
@@ -188,31 +211,243 @@ var _ = Describe("Checkout Handler", func() {
 
 			cart := resp["cart"].(map[string]interface{})
 			items := cart["items"].([]interface{})
-			Expect(items).To(HaveLen(1))
+			Expect(items).To(HaveLen(2))
+		})
+
+		It("should reject addons whose plan is missing", func() {
+			req := httptest.NewRequest(http.MethodPost, "/api/cart/addon", stringReader(`{"addonId": "de-domain"}`))
+			req = handler.WithSessionID(req, "no-plan-session")
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			cartHandler.AddAddon(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+			Expect(rec.Body.String()).To(ContainSubstring("addon requires a plan"))
+		})
+
+		It("should refuse to remove the last plan an addon depends on", func() {
+			req := httptest.NewRequest(http.MethodPost, "/api/cart/addon", stringReader(`{"addonId": "de-domain"}`))
+			req = handler.WithSessionID(req, "test-session")
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			cartHandler.AddAddon(rec, req)
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			req = httptest.NewRequest(http.MethodDelete, "/api/cart/item/static-micro", nil)
+			req.SetPathValue("itemId", "static-micro")
+			req = handler.WithSessionID(req, "test-session")
+			rec = httptest.NewRecorder()
+			cartHandler.RemoveItem(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("PUT /api/cart/item/{itemId}/sites/{index}", func() {
+		configure := func(index, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPut, "/api/cart/item/node-starter/sites/"+index, stringReader(body))
+			req.SetPathValue("itemId", "node-starter")
+			req.SetPathValue("index", index)
+			req = handler.WithSessionID(req, "test-session")
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			cartHandler.ConfigureSite(rec, req)
+			return rec
+		}
+
+		BeforeEach(func() {
+			req := httptest.NewRequest(http.MethodPost, "/api/cart/plan", stringReader(`{"planId": "node-starter"}`))
+			req = handler.WithSessionID(req, "test-session")
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			cartHandler.AddPlan(rec, req)
+			Expect(rec.Code).To(Equal(http.StatusOK))
+		})
+
+		It("should store the site configuration", func() {
+			rec := configure("0", `{"name": "shop", "framework": "nextjs", "region": "nbg"}`)
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			var resp handler.CartResponse
+			Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed())
+			Expect(resp.Cart.Items[0].Sites).To(Equal([]model.SiteConfig{{Name: "shop", Framework: "nextjs", Region: "nbg"}}))
+		})
+
+		It("should reject invalid configurations and indexes", func() {
+			Expect(configure("0", `{"region": "us-east"}`).Code).To(Equal(http.StatusBadRequest))
+			Expect(configure("1", `{"name": "shop"}`).Code).To(Equal(http.StatusBadRequest))
+			Expect(configure("first", `{"name": "shop"}`).Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("GET /api/cart/quote", func() {
+		It("should quote the cart for its billing cycle", func() {
+			req := httptest.NewRequest(http.MethodPost, "/api/cart/plan", stringReader(`{"planId": "node-pro"}`))
+			req = handler.WithSessionID(req, "test-session")
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			cartHandler.AddPlan(rec, req)
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			req = httptest.NewRequest(http.MethodPost, "/api/cart/billing-cycle", stringReader(`{"billingCycle": "yearly"}`))
+			req = handler.WithSessionID(req, "test-session")
+			req.Header.Set("Content-Type", "application/json")
+			rec = httptest.NewRecorder()
+			cartHandler.SetBillingCycle(rec, req)
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			req = httptest.NewRequest(http.MethodGet, "/api/cart/quote", nil)
+			req = handler.WithSessionID(req, "test-session")
+			rec = httptest.NewRecorder()
+			cartHandler.GetQuote(rec, req)
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			var quote model.Quote
+			Expect(json.Unmarshal(rec.Body.Bytes(), &quote)).To(Succeed())
+			Expect(quote.BillingCycle).To(Equal(model.BillingYearly))
+			Expect(quote.Lines).To(HaveLen(1))
+			Expect(quote.Net.Amount).To(Equal(int64(39900)))
+			Expect(quote.Discount.Amount).To(Equal(int64(7980)))
+			Expect(quote.Gross.Amount).To(Equal(int64(39900)))
+		})
+
+		It("should require a session", func() {
+			rec := httptest.NewRecorder()
+			cartHandler.GetQuote(rec, httptest.NewRequest(http.MethodGet, "/api/cart/quote", nil))
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("should add the VAT of the visitor's country", func() {
+			h := handler.NewCartHandler(cartService, nil, nil, service.NewTaxService(service.DefaultVATRates))
+			_, err := cartService.AddPlan(context.Background(), "vat-session", "node-pro", 1)
+			Expect(err).NotTo(HaveOccurred())
+
+			quoteFor := func(path string) (int, model.Quote) {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req = handler.WithSessionID(req, "vat-session")
+				rec := httptest.NewRecorder()
+				h.GetQuote(rec, req)
+				var quote model.Quote
+				_ = json.Unmarshal(rec.Body.Bytes(), &quote)
+				return rec.Code, quote
+			}
+
+			code, quote := quoteFor("/api/cart/quote")
+			Expect(code).To(Equal(http.StatusOK))
+			Expect(quote.TaxCountry).To(Equal("DE"))
+			Expect(quote.TaxRateBPS).To(Equal(int64(1900)))
+			Expect(quote.Tax.Amount).To(Equal(quote.Net.Amount * 19 / 100))
+
+			code, quote = quoteFor("/api/cart/quote?country=hr")
+			Expect(code).To(Equal(http.StatusOK))
+			Expect(quote.TaxTreatment).To(Equal(model.TaxOSS))
+			Expect(quote.TaxRateBPS).To(Equal(int64(2500)))
+
+			code, _ = quoteFor("/api/cart/quote?country=Croatia")
+			Expect(code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("Cart Currency", func() {
+		It("should switch currency via ?currency=", func() {
+			req := httptest.NewRequest(http.MethodGet, "/api/cart?currency=CHF", nil)
+			req = handler.WithSessionID(req, "test-session")
+			rec := httptest.NewRecorder()
+			cartHandler.GetCart(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			var resp map[string]interface{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed())
+			cart := resp["cart"].(map[string]interface{})
+			Expect(cart["currency"]).To(Equal("CHF"))
+			monthlyTotal := resp["monthlyTotal"].(map[string]interface{})
+			Expect(monthlyTotal["currency"]).To(Equal("CHF"))
+		})
+
+		It("should default to the currency of the user's billing country", func() {
+			addrRepo := mocks.NewMockAddressRepo()
+			Expect(addrRepo.Create(context.Background(), &model.Address{UserID: "user_ch", Country: "CH", IsDefault: true})).To(Succeed())
+			mockAuth := &mocks.MockAuthService{
+				AuthenticateSessionFunc: func(ctx context.Context, token string) (core.UserPublic, core.SessionPublic, error) {
+					return core.UserPublic{ID: core.ID("user_ch")}, core.SessionPublic{}, nil
+				},
+			}
+			h := handler.NewCartHandler(cartService, mockAuth, service.NewAddressService(addrRepo, nil), nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/cart", nil)
+			req = handler.WithSessionID(req, "profile-session")
+			req.Header.Set("Authorization", "Bearer valid-token")
+			rec := httptest.NewRecorder()
+			h.GetCart(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			var resp map[string]interface{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed())
+			cart := resp["cart"].(map[string]interface{})
+			Expect(cart["currency"]).To(Equal("CHF"))
+
+			// Reading the cart does not store it; the first plan is priced in CHF
+			stored, err := cartService.GetCart(context.Background(), "profile-session")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.Currency).To(Equal(model.DefaultCurrency))
+
+			req = httptest.NewRequest(http.MethodPost, "/api/cart/plan", stringReader(`{"planId": "node-starter"}`))
+			req = handler.WithSessionID(req, "profile-session")
+			req.Header.Set("Authorization", "Bearer valid-token")
+			rec = httptest.NewRecorder()
+			h.AddPlan(rec, req)
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			var added handler.CartResponse
+			Expect(json.Unmarshal(rec.Body.Bytes(), &added)).To(Succeed())
+			Expect(added.Cart.Currency).To(Equal("CHF"))
+			Expect(added.Cart.Items[0].Price.Currency).To(Equal("CHF"))
+		})
+
+		It("should reject unsupported currencies", func() {
+			body := `{"currency": "JPY"}`
+			req := httptest.NewRequest(http.MethodPost, "/api/cart/currency", stringReader(body))
+			req = handler.WithSessionID(req, "test-session")
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			cartHandler.SetCurrency(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
 		})
 	})
 
 	Describe("Cart Totals", func() {
 		It("should calculate correct yearly totals", func() {
-			// Add plan (€9.90/mo)
-			body := `{"planId": "node-starter"}`
-			req := httptest.NewRequest(http.MethodPost, "/api/cart/plan", stringReader(body))
-			req.Header.Set("X-Session-ID", "test-session")
+			// Switch to yearly billing
+			body := `{"billingCycle": "yearly"}`
+			req := httptest.NewRequest(http.MethodPost, "/api/cart/billing-cycle", stringReader(body))
+			req = handler.WithSessionID(req, "test-session")
 			req.Header.Set("Content-Type", "application/json")
 			rec := httptest.NewRecorder()
+			cartHandler.SetBillingCycle(rec, req)
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			// Add plan (€9.90/mo)
+			body = `{"planId": "node-starter"}`
+			req = httptest.NewRequest(http.MethodPost, "/api/cart/plan", stringReader(body))
+			req = handler.WithSessionID(req, "test-session")
+			req.Header.Set("Content-Type", "application/json")
+			rec = httptest.NewRecorder()
 			cartHandler.AddPlan(rec, req)
 
 			// Add addon (€1.00/mo)
 			body = `{"addonId": "de-domain"}`
 			req = httptest.NewRequest(http.MethodPost, "/api/cart/addon", stringReader(body))
-			req.Header.Set("X-Session-ID", "test-session")
+			req = handler.WithSessionID(req, "test-session")
 			req.Header.Set("Content-Type", "application/json")
 			rec = httptest.NewRecorder()
 			cartHandler.AddAddon(rec, req)
 
 			// Get cart totals
 			req = httptest.NewRequest(http.MethodGet, "/api/cart", nil)
-			req.Header.Set("X-Session-ID", "test-session")
+			req = handler.WithSessionID(req, "test-session")
 			rec = httptest.NewRecorder()
 			cartHandler.GetCart(rec, req)
 
@@ -220,15 +455,174 @@ var _ = Describe("Checkout Handler", func() {
 			err := json.Unmarshal(rec.Body.Bytes(), &resp)
 			Expect(err).NotTo(HaveOccurred())
 
-			monthlyTotal := resp["monthlyTotal"].(float64)
-			yearlyTotal := resp["yearlyTotal"].(float64)
+			monthlyTotal := resp["monthlyTotal"].(map[string]interface{})
+			cycleTotal := resp["cycleTotal"].(map[string]interface{})
 
 			// Monthly: 9.90 + 1.00 = 10.90
-			Expect(monthlyTotal).To(BeNumerically("~", 10.90, 0.01))
+			Expect(monthlyTotal["amount"]).To(BeNumerically("==", 1090))
+			Expect(monthlyTotal["currency"]).To(Equal("EUR"))
 
 			// Yearly: (9.90 * 10) + (1.00 * 12) = 99.00 + 12.00 = 111.00
-			Expect(yearlyTotal).To(BeNumerically("~", 111.00, 0.01))
+			Expect(cycleTotal["amount"]).To(BeNumerically("==", 11100))
+		})
+	})
+
+	Describe("POST /api/cart/billing-cycle", func() {
+		It("should accept cycles defined in the catalog", func() {
+			body := `{"billingCycle": "quarterly"}`
+			req := httptest.NewRequest(http.MethodPost, "/api/cart/billing-cycle", stringReader(body))
+			req = handler.WithSessionID(req, "test-session")
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			cartHandler.SetBillingCycle(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
 		})
+
+		It("should reject unknown cycles", func() {
+			body := `{"billingCycle": "weekly"}`
+			req := httptest.NewRequest(http.MethodPost, "/api/cart/billing-cycle", stringReader(body))
+			req = handler.WithSessionID(req, "test-session")
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			cartHandler.SetBillingCycle(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
+
+var _ = Describe("Checkout end to end", func() {
+	const webhookSecret = "whsec_test"
+
+	var (
+		gateway   *mocks.FakeGateway
+		orderRepo *repo.MockOrderRepo
+		mux       *http.ServeMux
+		addressID string
+	)
+
+	BeforeEach(func() {
+		ctx := context.Background()
+		catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		cartService := service.NewCartService(repo.NewMockCartRepo(), catalogService, nil, nil)
+		addressService := service.NewAddressService(mocks.NewMockAddressRepo(), nil)
+		taxService := service.NewTaxService(service.DefaultVATRates)
+		gateway = mocks.NewFakeGateway()
+		orderRepo = repo.NewMockOrderRepo()
+		customerService := service.NewCustomerService(repo.NewMockCustomerRepo(), gateway)
+		checkoutService := service.NewCheckoutService(cartService, orderRepo, addressService, taxService, customerService, gateway, "https://dysv.test/checkout/success", "https://dysv.test/cart")
+		subscriptionService := service.NewSubscriptionService(repo.NewMockSubscriptionRepo(), orderRepo, nil, "https://dysv.test")
+
+		mockAuth := &mocks.MockAuthService{
+			AuthenticateSessionFunc: func(ctx context.Context, token string) (core.UserPublic, core.SessionPublic, error) {
+				if token == "user-token" {
+					return core.UserPublic{ID: "user_1", Email: "user@example.com"}, core.SessionPublic{}, nil
+				}
+				return core.UserPublic{}, core.SessionPublic{}, errors.New("invalid token")
+			},
+		}
+		cartHandler := handler.NewCartHandler(cartService, mockAuth, addressService, taxService)
+		addressHandler := handler.NewAddressHandler(addressService, mockAuth)
+		checkoutHandler := handler.NewCheckoutHandler(checkoutService, subscriptionService, mockAuth, webhookSecret, "")
+
+		mux = http.NewServeMux()
+		mux.HandleFunc("POST /api/cart/plan", cartHandler.AddPlan)
+		mux.HandleFunc("PUT /api/cart/item/{itemId}/sites/{index}", cartHandler.ConfigureSite)
+		mux.HandleFunc("POST /api/user/addresses", addressHandler.Create)
+		mux.HandleFunc("POST /api/checkout", checkoutHandler.CreateCheckoutSession)
+		mux.HandleFunc("POST /api/webhook/stripe", checkoutHandler.Webhook)
+	})
+
+	request := func(method, path, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = handler.WithSessionID(req, "shop-session")
+		req.Header.Set("Authorization", "Bearer user-token")
+		for key := range header {
+			req.Header.Set(key, header.Get(key))
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	fillCart := func() {
+		GinkgoHelper()
+		Expect(request(http.MethodPost, "/api/cart/plan", `{"planId": "node-starter"}`, nil).Code).To(Equal(http.StatusOK))
+		Expect(request(http.MethodPut, "/api/cart/item/node-starter/sites/0", `{"name": "shop", "framework": "nuxt", "region": "nbg"}`, nil).Code).To(Equal(http.StatusOK))
+
+		rec := request(http.MethodPost, "/api/user/addresses", `{"label": "Home", "line1": "Hauptstr. 1", "city": "Berlin", "postalCode": "10115", "country": "DE"}`, nil)
+		Expect(rec.Code).To(Equal(http.StatusCreated))
+		var address model.Address
+		Expect(json.Unmarshal(rec.Body.Bytes(), &address)).To(Succeed())
+		addressID = address.ID
+	}
+
+	checkout := func(key string) *httptest.ResponseRecorder {
+		return request(http.MethodPost, "/api/checkout", `{"addressId": "`+addressID+`"}`, http.Header{"Idempotency-Key": {key}})
+	}
+
+	It("should check out the cart and complete the order", func() {
+		fillCart()
+
+		rec := checkout("click-1")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var resp handler.CheckoutResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed())
+		Expect(resp.URL).To(HavePrefix("https://checkout.example/pay/"))
+
+		// A double click gets the same session
+		replayed := checkout("click-1")
+		Expect(replayed.Code).To(Equal(http.StatusOK))
+		Expect(replayed.Body.String()).To(Equal(rec.Body.String()))
+		Expect(gateway.Sessions).To(HaveLen(1))
+
+		sessionID := strings.TrimPrefix(resp.URL, "https://checkout.example/pay/")
+		params := gateway.Sessions[sessionID]
+		Expect(params).NotTo(BeNil())
+		Expect(params.Lines).To(HaveLen(1))
+		Expect(params.Lines[0].Quantity).To(Equal(int64(1)))
+		Expect(gateway.TaxRates).To(HaveKeyWithValue(params.TaxRateID, model.TaxDecision{Country: "DE", Treatment: model.TaxDomestic, RateBPS: 1900}))
+		Expect(gateway.Customers).To(HaveKey(params.CustomerID))
+		Expect(gateway.Customers[params.CustomerID].Email).To(Equal("user@example.com"))
+		Expect(params.SubscriptionMetadata).To(HaveKey("order_id"))
+
+		order, err := orderRepo.FindByStripeSessionID(context.Background(), sessionID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(order.Status).To(Equal("pending"))
+		Expect(order.StripeCustomerID).To(Equal(params.CustomerID))
+		Expect(order.ID.Hex()).To(Equal(params.SubscriptionMetadata["order_id"]))
+
+		event := `{"id": "evt_1", "object": "event", "type": "checkout.session.completed", "api_version": "` + stripe.APIVersion + `",
+			"data": {"object": {"id": "` + sessionID + `", "object": "checkout.session", "payment_status": "paid"}}}`
+		signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{Payload: []byte(event), Secret: webhookSecret})
+		rec = request(http.MethodPost, "/api/webhook/stripe", event, http.Header{"Stripe-Signature": {signed.Header}})
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		paid, err := orderRepo.FindByID(context.Background(), order.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paid.Status).To(Equal("paid"))
+	})
+
+	It("should leave no order behind when the gateway fails", func() {
+		fillCart()
+		gateway.Err = errors.New("gateway down")
+
+		Expect(checkout("click-1").Code).To(Equal(http.StatusInternalServerError))
+		_, err := orderRepo.FindByIdempotencyKey(context.Background(), "user_1", "click-1")
+		Expect(err).To(MatchError(repo.ErrNotFound))
+
+		// The same key works once the gateway is back
+		gateway.Err = nil
+		Expect(checkout("click-1").Code).To(Equal(http.StatusOK))
+		Expect(gateway.Sessions).To(HaveLen(1))
+	})
+
+	It("should reject overlong idempotency keys", func() {
+		fillCart()
+		Expect(checkout(strings.Repeat("k", 256)).Code).To(Equal(http.StatusBadRequest))
+		Expect(gateway.Sessions).To(BeEmpty())
 	})
 })
 
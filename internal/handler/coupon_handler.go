@@ -0,0 +1,79 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/deicod/auth"
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/service"
+)
+
+// CouponHandler serves the admin coupon endpoints
+type CouponHandler struct {
+	couponService *service.CouponService
+	auth          auth.Service
+}
+
+// NewCouponHandler creates a new coupon handler
+func NewCouponHandler(couponService *service.CouponService, auth auth.Service) *CouponHandler {
+	return &CouponHandler{
+		couponService: couponService,
+		auth:          auth,
+	}
+}
+
+// List handles GET /api/admin/coupons
+func (h *CouponHandler) List(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authenticateAdmin(w, r, h.auth); !ok {
+		return
+	}
+
+	coupons, err := h.couponService.ListCoupons(r.Context())
+	if err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"coupons": coupons})
+}
+
+// Save handles PUT /api/admin/coupons/{code}, creating or replacing the coupon
+func (h *CouponHandler) Save(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authenticateAdmin(w, r, h.auth); !ok {
+		return
+	}
+
+	var coupon model.Coupon
+	if err := json.NewDecoder(r.Body).Decode(&coupon); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	coupon.Code = r.PathValue("code")
+
+	if err := h.couponService.SaveCoupon(r.Context(), &coupon); err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	saved, err := h.couponService.GetCoupon(r.Context(), coupon.Code)
+	if err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, saved)
+}
+
+// Delete handles DELETE /api/admin/coupons/{code}
+func (h *CouponHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authenticateAdmin(w, r, h.auth); !ok {
+		return
+	}
+
+	if err := h.couponService.DeleteCoupon(r.Context(), r.PathValue("code")); err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
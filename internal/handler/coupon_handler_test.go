@@ -0,0 +1,143 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/deicod/auth/core"
+	"github.com/deicod/dysv/internal/handler"
+	"github.com/deicod/dysv/internal/mocks"
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/deicod/dysv/internal/service"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var _ = Describe("Coupons", func() {
+	var (
+		cartService   *service.CartService
+		couponService *service.CouponService
+		mux           *http.ServeMux
+	)
+
+	BeforeEach(func() {
+		ctx := context.Background()
+		catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		couponService = service.NewCouponService(repo.NewMockCouponRepo(), catalogService)
+		cartService = service.NewCartService(repo.NewMockCartRepo(), catalogService, couponService, nil)
+
+		mockAuth := &mocks.MockAuthService{
+			AuthenticateSessionFunc: func(ctx context.Context, token string) (core.UserPublic, core.SessionPublic, error) {
+				switch token {
+				case "admin-token":
+					return core.UserPublic{ID: "admin_1", Role: "admin"}, core.SessionPublic{}, nil
+				case "user-token":
+					return core.UserPublic{ID: "user_1", Role: "user"}, core.SessionPublic{}, nil
+				}
+				return core.UserPublic{}, core.SessionPublic{}, errors.New("invalid token")
+			},
+		}
+		cartHandler := handler.NewCartHandler(cartService, mockAuth, nil, nil)
+		couponHandler := handler.NewCouponHandler(couponService, mockAuth)
+
+		mux = http.NewServeMux()
+		mux.HandleFunc("GET /api/cart", cartHandler.GetCart)
+		mux.HandleFunc("GET /api/cart/quote", cartHandler.GetQuote)
+		mux.HandleFunc("POST /api/cart/coupon", cartHandler.ApplyCoupon)
+		mux.HandleFunc("DELETE /api/cart/coupon", cartHandler.RemoveCoupon)
+		mux.HandleFunc("GET /api/admin/coupons", couponHandler.List)
+		mux.HandleFunc("PUT /api/admin/coupons/{code}", couponHandler.Save)
+		mux.HandleFunc("DELETE /api/admin/coupons/{code}", couponHandler.Delete)
+
+		_, err := cartService.AddPlan(ctx, "test-session", "node-starter", 1)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	request := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, stringReader(body))
+		req = handler.WithSessionID(req, "test-session")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("should let admins manage coupons", func() {
+		rec := request(http.MethodPut, "/api/admin/coupons/spring10", "user-token", `{"name": "Spring", "percentOffBps": 1000}`)
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+
+		rec = request(http.MethodPut, "/api/admin/coupons/spring10", "admin-token", `{"name": "Spring", "percentOffBps": 1000}`)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		rec = request(http.MethodPut, "/api/admin/coupons/bad", "admin-token", `{"name": "Bad", "percentOffBps": 20000}`)
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+
+		rec = request(http.MethodGet, "/api/admin/coupons", "admin-token", "")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var list struct {
+			Coupons []model.Coupon `json:"coupons"`
+		}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &list)).To(Succeed())
+		Expect(list.Coupons).To(HaveLen(1))
+		Expect(list.Coupons[0].Code).To(Equal("SPRING10"))
+
+		rec = request(http.MethodDelete, "/api/admin/coupons/spring10", "admin-token", "")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		rec = request(http.MethodDelete, "/api/admin/coupons/spring10", "admin-token", "")
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should apply and remove a coupon on the cart", func() {
+		Expect(request(http.MethodPut, "/api/admin/coupons/SPRING10", "admin-token", `{"name": "Spring", "percentOffBps": 1000}`).Code).To(Equal(http.StatusOK))
+
+		rec := request(http.MethodPost, "/api/cart/coupon", "", `{"code": "nope"}`)
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+
+		rec = request(http.MethodPost, "/api/cart/coupon", "", `{"code": "spring10"}`)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var resp handler.CartResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed())
+		Expect(resp.Cart.CouponCode).To(Equal("SPRING10"))
+		Expect(resp.CycleTotal).To(Equal(model.Money{Amount: 891, Currency: "EUR"}))
+
+		rec = request(http.MethodDelete, "/api/cart/coupon", "", "")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		resp = handler.CartResponse{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed())
+		Expect(resp.Cart.CouponCode).To(BeEmpty())
+		Expect(resp.CycleTotal).To(Equal(model.Money{Amount: 990, Currency: "EUR"}))
+	})
+
+	It("should total the cart for the user like the quote does", func() {
+		ctx := context.Background()
+		Expect(couponService.SaveCoupon(ctx, &model.Coupon{Code: "ONCE", Name: "Once", PercentOffBPS: 1000, MaxPerUser: 1})).To(Succeed())
+		Expect(couponService.Redeem(ctx, &model.Order{ID: bson.NewObjectID(), UserID: "user_1", CouponCode: "ONCE"})).To(Succeed())
+		Expect(request(http.MethodPost, "/api/cart/coupon", "", `{"code": "once"}`).Code).To(Equal(http.StatusOK))
+
+		// user_1 has used the coupon up, so neither total includes it
+		rec := request(http.MethodGet, "/api/cart", "user-token", "")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var resp handler.CartResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed())
+
+		rec = request(http.MethodGet, "/api/cart/quote", "user-token", "")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var quote model.Quote
+		Expect(json.Unmarshal(rec.Body.Bytes(), &quote)).To(Succeed())
+
+		Expect(quote.CouponCode).To(BeEmpty())
+		Expect(resp.CycleTotal).To(Equal(quote.Net))
+		Expect(resp.CycleTotal).To(Equal(model.Money{Amount: 990, Currency: "EUR"}))
+	})
+})
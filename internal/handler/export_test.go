@@ -0,0 +1,15 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package handler
+
+import (
+	"context"
+	"net/http"
+)
+
+// WithSessionID returns r carrying id as a cart session verified by
+// SessionManager.Wrap, for tests calling handlers directly
+func WithSessionID(r *http.Request, id string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), sessionIDKey{}, id))
+}
@@ -0,0 +1,53 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package handler
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/deicod/dysv/internal/model"
+)
+
+// requestLanguage picks the response language: a supported ?lang= wins,
+// then the highest-weighted supported Accept-Language entry, then English
+func requestLanguage(r *http.Request) string {
+	if lang := normalizeLanguage(r.URL.Query().Get("lang")); model.SupportedLanguage(lang) {
+		return lang
+	}
+
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if lang := normalizeLanguage(tag); q > 0 && model.SupportedLanguage(lang) {
+			candidates = append(candidates, candidate{lang: lang, q: q})
+		}
+	}
+	// Stable sort keeps header order for equal weights
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	if len(candidates) > 0 {
+		return candidates[0].lang
+	}
+	return model.DefaultLanguage
+}
+
+// normalizeLanguage reduces a language tag like "de-AT" to its primary subtag
+func normalizeLanguage(tag string) string {
+	primary, _, _ := strings.Cut(strings.TrimSpace(tag), "-")
+	return strings.ToLower(primary)
+}
@@ -0,0 +1,159 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/deicod/auth"
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/service"
+)
+
+// QuoteHandler serves saved quotes: sales freeze their own cart into a quote,
+// customers open its signed link and load it into their cart or check it out
+type QuoteHandler struct {
+	quoteService *service.QuoteService
+	auth         auth.Service
+	carts        *CartHandler
+	checkout     *CheckoutHandler
+}
+
+// NewQuoteHandler creates a new quote handler.
+// checkout is optional; without it quotes cannot be checked out directly.
+func NewQuoteHandler(quoteService *service.QuoteService, auth auth.Service, carts *CartHandler, checkout *CheckoutHandler) *QuoteHandler {
+	return &QuoteHandler{
+		quoteService: quoteService,
+		auth:         auth,
+		carts:        carts,
+		checkout:     checkout,
+	}
+}
+
+// maxQuoteValidDays bounds how long a quote's prices can be promised
+const maxQuoteValidDays = 365
+
+// CreateQuoteRequest is the request body for saving a quote
+type CreateQuoteRequest struct {
+	Note      string `json:"note"`
+	ValidDays int    `json:"validDays"` // 0 for service.DefaultQuoteValidity
+}
+
+// QuoteResponse is the response for quote endpoints
+type QuoteResponse struct {
+	Quote *model.SavedQuote `json:"quote"`
+	Token string            `json:"token,omitempty"`
+	URL   string            `json:"url,omitempty"`
+}
+
+// Create handles POST /api/admin/quotes: saves the admin's current cart as
+// a quote and returns its public link
+func (h *QuoteHandler) Create(w http.ResponseWriter, r *http.Request) {
+	user, ok := authenticateAdmin(w, r, h.auth)
+	if !ok {
+		return
+	}
+	sessionID := getSessionID(r)
+	if sessionID == "" {
+		writeError(w, http.StatusBadRequest, "session_id required")
+		return
+	}
+
+	var req CreateQuoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if req.ValidDays < 0 || req.ValidDays > maxQuoteValidDays {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("validDays must be between 0 and %d", maxQuoteValidDays))
+		return
+	}
+
+	validFor := time.Duration(req.ValidDays) * 24 * time.Hour
+	quote, token, err := h.quoteService.CreateQuote(h.carts.cartContext(r), sessionID, string(user.ID), req.Note, validFor)
+	if err != nil {
+		writeQuoteError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, QuoteResponse{
+		Quote: quote,
+		Token: token,
+		URL:   h.quoteService.URL(token),
+	})
+}
+
+// Get handles GET /api/quotes/{token}
+func (h *QuoteHandler) Get(w http.ResponseWriter, r *http.Request) {
+	quote, err := h.quoteService.GetQuote(r.Context(), r.PathValue("token"))
+	if err != nil {
+		writeQuoteError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, QuoteResponse{Quote: quote})
+}
+
+// Load handles POST /api/quotes/{token}/cart: replaces the visitor's cart
+// with the quote
+func (h *QuoteHandler) Load(w http.ResponseWriter, r *http.Request) {
+	sessionID := getSessionID(r)
+	if sessionID == "" {
+		writeError(w, http.StatusBadRequest, "session_id required")
+		return
+	}
+
+	cart, err := h.quoteService.LoadQuote(h.carts.cartContext(r), sessionID, r.PathValue("token"))
+	if err != nil {
+		writeQuoteError(w, err)
+		return
+	}
+
+	h.carts.writeCart(w, r, cart)
+}
+
+// Checkout handles POST /api/quotes/{token}/checkout: loads the quote into
+// the logged-in user's cart and continues as POST /api/checkout
+func (h *QuoteHandler) Checkout(w http.ResponseWriter, r *http.Request) {
+	if h.checkout == nil {
+		writeError(w, http.StatusServiceUnavailable, "checkout not available")
+		return
+	}
+	sessionID := getSessionID(r)
+	if sessionID == "" {
+		writeError(w, http.StatusBadRequest, "session_id required")
+		return
+	}
+
+	ctx := h.carts.cartContext(r)
+	if service.UserIDFrom(ctx) == "" {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if _, err := h.quoteService.LoadQuote(ctx, sessionID, r.PathValue("token")); err != nil {
+		writeQuoteError(w, err)
+		return
+	}
+
+	h.checkout.CreateCheckoutSession(w, r)
+}
+
+// writeQuoteError maps quote service errors to HTTP responses
+func writeQuoteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidQuote):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrQuoteExpired):
+		writeError(w, http.StatusGone, err.Error())
+	case errors.Is(err, service.ErrEmptyCart):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeCartError(w, err)
+	}
+}
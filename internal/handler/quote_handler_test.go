@@ -0,0 +1,130 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/deicod/auth/core"
+	"github.com/deicod/dysv/internal/handler"
+	"github.com/deicod/dysv/internal/mocks"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/deicod/dysv/internal/service"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("QuoteHandler", func() {
+	var (
+		cartService *service.CartService
+		mux         *http.ServeMux
+	)
+
+	BeforeEach(func() {
+		ctx := context.Background()
+		catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		cartService = service.NewCartService(repo.NewMockCartRepo(), catalogService, nil, nil)
+		quoteService := service.NewQuoteService(repo.NewMockQuoteRepo(), cartService, "quote-secret", "https://dysv.test")
+
+		mockAuth := &mocks.MockAuthService{
+			AuthenticateSessionFunc: func(ctx context.Context, token string) (core.UserPublic, core.SessionPublic, error) {
+				switch token {
+				case "admin-token":
+					return core.UserPublic{ID: "admin_1", Role: "admin"}, core.SessionPublic{}, nil
+				case "user-token":
+					return core.UserPublic{ID: "user_1", Role: "user"}, core.SessionPublic{}, nil
+				}
+				return core.UserPublic{}, core.SessionPublic{}, errors.New("invalid token")
+			},
+		}
+		cartHandler := handler.NewCartHandler(cartService, mockAuth, nil, nil)
+		quoteHandler := handler.NewQuoteHandler(quoteService, mockAuth, cartHandler, nil)
+
+		mux = http.NewServeMux()
+		mux.HandleFunc("POST /api/admin/quotes", quoteHandler.Create)
+		mux.HandleFunc("GET /api/quotes/{token}", quoteHandler.Get)
+		mux.HandleFunc("POST /api/quotes/{token}/cart", quoteHandler.Load)
+		mux.HandleFunc("POST /api/quotes/{token}/checkout", quoteHandler.Checkout)
+
+		_, err := cartService.AddPlan(service.WithUserID(ctx, "admin_1"), "sales-session", "node-starter", 2)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	request := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, stringReader(body))
+		req = handler.WithSessionID(req, "sales-session")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	createQuote := func() handler.QuoteResponse {
+		rec := request(http.MethodPost, "/api/admin/quotes", "admin-token", `{"note": "Agency bundle", "validDays": 30}`)
+		Expect(rec.Code).To(Equal(http.StatusCreated))
+		var resp handler.QuoteResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed())
+		return resp
+	}
+
+	It("should reject validities outside 0 to 365 days", func() {
+		rec := request(http.MethodPost, "/api/admin/quotes", "admin-token", `{"validDays": -1}`)
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		rec = request(http.MethodPost, "/api/admin/quotes", "admin-token", `{"validDays": 366}`)
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		rec = request(http.MethodPost, "/api/admin/quotes", "admin-token", `{"validDays": 365}`)
+		Expect(rec.Code).To(Equal(http.StatusCreated))
+	})
+
+	It("should save the admin's cart as a shareable quote", func() {
+		resp := createQuote()
+		Expect(resp.Quote.Items).To(HaveLen(1))
+		Expect(resp.Quote.Note).To(Equal("Agency bundle"))
+		Expect(resp.URL).To(Equal("https://dysv.test/quote/" + resp.Token))
+
+		rec := request(http.MethodGet, "/api/quotes/"+resp.Token, "", "")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var got handler.QuoteResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &got)).To(Succeed())
+		Expect(got.Quote.ID).To(Equal(resp.Quote.ID))
+		Expect(got.Token).To(BeEmpty())
+	})
+
+	It("should only let admins create quotes", func() {
+		Expect(request(http.MethodPost, "/api/admin/quotes", "user-token", `{}`).Code).To(Equal(http.StatusForbidden))
+		Expect(request(http.MethodPost, "/api/admin/quotes", "", `{}`).Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should load the quote into the visitor's cart", func() {
+		resp := createQuote()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/quotes/"+resp.Token+"/cart", nil)
+		req = handler.WithSessionID(req, "customer-session")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		var cart handler.CartResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &cart)).To(Succeed())
+		Expect(cart.Cart.QuoteID).To(Equal(resp.Quote.ID.Hex()))
+		Expect(cart.Cart.Items[0].Quantity).To(Equal(2))
+	})
+
+	It("should reject unknown quote links", func() {
+		Expect(request(http.MethodGet, "/api/quotes/abc.def", "", "").Code).To(Equal(http.StatusNotFound))
+		Expect(request(http.MethodPost, "/api/quotes/abc.def/cart", "", "").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should report direct checkout as unavailable without Stripe", func() {
+		resp := createQuote()
+		Expect(request(http.MethodPost, "/api/quotes/"+resp.Token+"/checkout", "user-token", `{"addressId": "a"}`).Code).To(Equal(http.StatusServiceUnavailable))
+	})
+})
@@ -0,0 +1,88 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/deicod/auth"
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/service"
+)
+
+// ReferralHandler serves a user's referral code, referrals and credit
+type ReferralHandler struct {
+	referrals *service.ReferralService
+	auth      auth.Service
+}
+
+// NewReferralHandler creates a new referral handler
+func NewReferralHandler(referrals *service.ReferralService, auth auth.Service) *ReferralHandler {
+	return &ReferralHandler{referrals: referrals, auth: auth}
+}
+
+// ReferralResponse is the response for GET /api/referrals
+type ReferralResponse struct {
+	Code     string        `json:"code,omitempty"` // empty until the email address is verified
+	Pending  int           `json:"pending"`        // referees without a paid order yet
+	Rewarded int           `json:"rewarded"`
+	Credit   []model.Money `json:"credit"` // balance per currency
+}
+
+// Get handles GET /api/referrals
+func (h *ReferralHandler) Get(w http.ResponseWriter, r *http.Request) {
+	token := getToken(r)
+	if token == "" || h.auth == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	user, _, err := h.auth.AuthenticateSession(r.Context(), token)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+	userID := string(user.ID)
+
+	var resp ReferralResponse
+	code, err := h.referrals.CodeFor(r.Context(), userID, user.Email, user.IsVerified)
+	switch {
+	case err == nil:
+		resp.Code = code.Code
+	case !errors.Is(err, service.ErrEmailNotVerified):
+		writeError(w, http.StatusInternalServerError, "failed to get referral code")
+		return
+	}
+
+	referrals, err := h.referrals.Referrals(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list referrals")
+		return
+	}
+	for _, referral := range referrals {
+		switch referral.Status {
+		case model.ReferralPending:
+			resp.Pending++
+		case model.ReferralRewarded:
+			resp.Rewarded++
+		}
+	}
+
+	if resp.Credit, err = h.referrals.Credits(r.Context(), userID); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get credit")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// writeReferralError maps referral service errors to HTTP responses
+func writeReferralError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidReferralCode), errors.Is(err, service.ErrReferralNotAllowed):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "failed to check referral code")
+	}
+}
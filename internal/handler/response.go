@@ -10,7 +10,8 @@ import (
 
 // ErrorResponse is a standard error response
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields,omitempty"` // problems by request field
 }
 
 // writeJSON writes a JSON response
@@ -7,6 +7,7 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/MadAppGang/httplog"
@@ -38,10 +39,16 @@ func NewRouter(cfg *config.Config) http.Handler {
 		}
 	}
 
+	sessions := NewSessionManager(cfg.CartSessionSecret, cfg.CartSessionPrevious, strings.HasPrefix(cfg.BaseURL, "https://"), cfg.CartTTL)
+
+	var catalogHandler *CatalogHandler
 	var cartHandler *CartHandler
 	var checkoutHandler *CheckoutHandler
 	var authHandler *AuthHandler
 	var addressHandler *AddressHandler
+	var quoteHandler *QuoteHandler
+	var couponHandler *CouponHandler
+	var referralHandler *ReferralHandler
 
 	if client != nil {
 		db := client.Database("dysv")
@@ -50,10 +57,34 @@ func NewRouter(cfg *config.Config) http.Handler {
 		cartRepo := repo.NewCartRepo(db, cfg.MongoTimeout)
 		orderRepo := repo.NewOrderRepo(db, cfg.MongoTimeout)
 		addressRepo := repo.NewAddressRepo(db, cfg.MongoTimeout)
+		catalogRepo := repo.NewCatalogRepo(db, cfg.MongoTimeout)
+		quoteRepo := repo.NewQuoteRepo(db, cfg.MongoTimeout)
+		couponRepo := repo.NewCouponRepo(db, cfg.MongoTimeout)
+		referralRepo := repo.NewReferralRepo(db, cfg.MongoTimeout)
+		subscriptionRepo := repo.NewSubscriptionRepo(db, cfg.MongoTimeout)
+		customerRepo := repo.NewCustomerRepo(db, cfg.MongoTimeout)
+
+		if err := cartRepo.EnsureIndexes(context.Background(), cfg.CartTTL); err != nil {
+			log.Printf("Warning: Failed to create cart indexes: %v", err)
+		}
+		if err := referralRepo.EnsureIndexes(context.Background()); err != nil {
+			log.Printf("Warning: Failed to create referral indexes: %v", err)
+		}
+		if err := orderRepo.EnsureIndexes(context.Background()); err != nil {
+			log.Printf("Warning: Failed to create order indexes: %v", err)
+		}
 
 		// Services
-		cartService := service.NewCartService(cartRepo)
-		addressService := service.NewAddressService(addressRepo)
+		catalogService := service.NewCatalogService(catalogRepo)
+		if err := catalogService.Seed(context.Background()); err != nil {
+			log.Printf("Warning: Failed to seed catalog: %v", err)
+		}
+		couponService := service.NewCouponService(couponRepo, catalogService)
+		referralService := service.NewReferralService(referralRepo, nil)
+		cartService := service.NewCartService(cartRepo, catalogService, couponService, referralService)
+		addressService := service.NewAddressService(addressRepo, service.NewVIESClient(cfg.VIESURL, cfg.SellerVATID))
+		taxService := service.NewTaxService(service.DefaultVATRates)
+		quoteService := service.NewQuoteService(quoteRepo, cartService, cfg.QuoteSecret, cfg.BaseURL)
 
 		// Auth Service Initialization
 		ac := auth.DefaultConfig()
@@ -75,32 +106,47 @@ func NewRouter(cfg *config.Config) http.Handler {
 			ac.Email.From = cfg.AuthEmailFrom
 		}
 
+		// authSvc stays nil without a working Auth Service; the handlers
+		// below then answer authenticated requests with 401
 		var authSvc auth.Service
-		authSvc, err := auth.NewService(context.Background(), ac)
-		if err != nil {
+		if svc, err := auth.NewService(context.Background(), ac); err != nil || svc == nil {
 			log.Printf("Error: Failed to initialize Auth Service: %v", err)
 		} else {
-			authHandler = NewAuthHandler(authSvc)
+			authSvc = svc
+			authHandler = NewAuthHandler(authSvc, cartService, referralService)
 			addressHandler = NewAddressHandler(addressService, authSvc)
+			referralHandler = NewReferralHandler(referralService, authSvc)
 		}
+		catalogHandler = NewCatalogHandler(catalogService, authSvc)
+		couponHandler = NewCouponHandler(couponService, authSvc)
 
 		// Handlers & Checkout Service
-		cartHandler = NewCartHandler(cartService)
+		cartHandler = NewCartHandler(cartService, authSvc, addressService, taxService)
 
 		if cfg.StripeSecret != "" {
 			successURL := cfg.BaseURL + "/checkout/success"
 			cancelURL := cfg.BaseURL + "/cart"
 			// CheckoutService needs AddressService
-			checkoutService := service.NewCheckoutService(cartService, orderRepo, addressService, cfg.StripeSecret, successURL, cancelURL)
+			gateway := service.NewStripeGateway(service.NewStripeClient(cfg.StripeSecret, cfg.StripeAPIURL))
+			customerService := service.NewCustomerService(customerRepo, gateway)
+			checkoutService := service.NewCheckoutService(cartService, orderRepo, addressService, taxService, customerService, gateway, successURL, cancelURL)
+
+			// Trial reminders need a mail relay
+			var mailer service.Mailer
+			if cfg.AuthEmailHost != "" && cfg.AuthEmailFrom != "" {
+				mailer = service.NewSMTPMailer(cfg.AuthEmailHost, cfg.AuthEmailPort, cfg.AuthEmailUser, cfg.AuthEmailPass, cfg.AuthEmailFrom, cfg.AuthEmailUseSSL)
+			}
+			subscriptionService := service.NewSubscriptionService(subscriptionRepo, orderRepo, mailer, cfg.BaseURL)
 
 			// CheckoutHandler needs Auth Service (authSvc)
 			// Ensure authSvc is not nil
 			if authSvc != nil {
-				checkoutHandler = NewCheckoutHandler(checkoutService, authSvc, cfg.StripeWebhookSecret, cfg.StripeAPIVersion)
+				checkoutHandler = NewCheckoutHandler(checkoutService, subscriptionService, authSvc, cfg.StripeWebhookSecret, cfg.StripeAPIVersion)
 			} else {
 				log.Println("Warning: CheckoutHandler disabled because Auth Service failed to initialize")
 			}
 		}
+		quoteHandler = NewQuoteHandler(quoteService, authSvc, cartHandler, checkoutHandler)
 	}
 
 	// Health check
@@ -108,31 +154,46 @@ func NewRouter(cfg *config.Config) http.Handler {
 		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 	})
 
-	// Plans endpoint (static data)
-	mux.HandleFunc("GET /api/plans", func(w http.ResponseWriter, r *http.Request) {
-		plans := make([]map[string]interface{}, 0, len(service.Plans))
-		for _, plan := range service.Plans {
-			plans = append(plans, map[string]interface{}{
-				"id":             plan.ID,
-				"name":           plan.Name,
-				"monthlyPrice":   plan.MonthlyPrice,
-				"targetAudience": plan.TargetAudience,
-				"limits":         plan.Limits,
-			})
+	// Catalog endpoints (require MongoDB)
+	if catalogHandler != nil {
+		mux.HandleFunc("GET /api/plans", catalogHandler.ListPlans)
+		mux.HandleFunc("GET /api/addons", catalogHandler.ListAddons)
+		mux.HandleFunc("POST /api/admin/plans", catalogHandler.CreatePlan)
+		mux.HandleFunc("PUT /api/admin/plans/{id}", catalogHandler.UpdatePlan)
+		mux.HandleFunc("DELETE /api/admin/plans/{id}", catalogHandler.DeletePlan)
+		mux.HandleFunc("POST /api/admin/addons", catalogHandler.CreateAddon)
+		mux.HandleFunc("PUT /api/admin/addons/{id}", catalogHandler.UpdateAddon)
+		mux.HandleFunc("DELETE /api/admin/addons/{id}", catalogHandler.DeleteAddon)
+		mux.HandleFunc("GET /api/billing-cycles", catalogHandler.ListCycles)
+		mux.HandleFunc("PUT /api/admin/billing-cycles/{id}", catalogHandler.SaveCycle)
+		mux.HandleFunc("DELETE /api/admin/billing-cycles/{id}", catalogHandler.DeleteCycle)
+		mux.HandleFunc("GET /api/admin/coupons", couponHandler.List)
+		mux.HandleFunc("PUT /api/admin/coupons/{code}", couponHandler.Save)
+		mux.HandleFunc("DELETE /api/admin/coupons/{code}", couponHandler.Delete)
+	} else {
+		catalogRequired := func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusServiceUnavailable, "database not available")
 		}
-		writeJSON(w, http.StatusOK, map[string]interface{}{"plans": plans})
-	})
+		mux.HandleFunc("GET /api/plans", catalogRequired)
+		mux.HandleFunc("GET /api/addons", catalogRequired)
+		mux.HandleFunc("GET /api/billing-cycles", catalogRequired)
+	}
 
 	// Auth endpoints
 	if authHandler != nil {
 		mux.HandleFunc("POST /api/auth/register", authHandler.Register)
-		mux.HandleFunc("POST /api/auth/login", authHandler.Login)
+		mux.HandleFunc("POST /api/auth/login", sessions.Wrap(authHandler.Login))
 		mux.HandleFunc("POST /api/auth/verify", authHandler.VerifyEmail)
 		mux.HandleFunc("POST /api/auth/forgot-password", authHandler.ForgotPassword)
 		mux.HandleFunc("POST /api/auth/reset-password", authHandler.ResetPassword)
 		mux.HandleFunc("GET /api/auth/me", authHandler.Me)
 	}
 
+	// Referral endpoints
+	if referralHandler != nil {
+		mux.HandleFunc("GET /api/referrals", referralHandler.Get)
+	}
+
 	// Address endpoints
 	if addressHandler != nil {
 		mux.HandleFunc("GET /api/user/addresses", addressHandler.List)
@@ -143,27 +204,57 @@ func NewRouter(cfg *config.Config) http.Handler {
 
 	// Cart endpoints (require MongoDB)
 	if cartHandler != nil {
-		mux.HandleFunc("GET /api/cart", cartHandler.GetCart)
-		mux.HandleFunc("POST /api/cart/plan", cartHandler.AddPlan)
-		mux.HandleFunc("POST /api/cart/addon", cartHandler.AddAddon)
-		mux.HandleFunc("DELETE /api/cart/item/{itemId}", cartHandler.RemoveItem)
-		mux.HandleFunc("PUT /api/cart/item/{itemId}", cartHandler.UpdateItemQuantity)
-		mux.HandleFunc("POST /api/cart/billing-cycle", cartHandler.SetBillingCycle)
+		mux.HandleFunc("GET /api/cart", sessions.Wrap(cartHandler.GetCart))
+		mux.HandleFunc("GET /api/cart/quote", sessions.Wrap(cartHandler.GetQuote))
+		mux.HandleFunc("POST /api/cart/plan", sessions.Wrap(cartHandler.AddPlan))
+		mux.HandleFunc("POST /api/cart/addon", sessions.Wrap(cartHandler.AddAddon))
+		mux.HandleFunc("DELETE /api/cart/item/{itemId}", sessions.Wrap(cartHandler.RemoveItem))
+		mux.HandleFunc("PUT /api/cart/item/{itemId}", sessions.Wrap(cartHandler.UpdateItemQuantity))
+		mux.HandleFunc("PUT /api/cart/item/{itemId}/sites/{index}", sessions.Wrap(cartHandler.ConfigureSite))
+		mux.HandleFunc("POST /api/cart/billing-cycle", sessions.Wrap(cartHandler.SetBillingCycle))
+		mux.HandleFunc("POST /api/cart/currency", sessions.Wrap(cartHandler.SetCurrency))
+		mux.HandleFunc("POST /api/cart/coupon", sessions.Wrap(cartHandler.ApplyCoupon))
+		mux.HandleFunc("DELETE /api/cart/coupon", sessions.Wrap(cartHandler.RemoveCoupon))
+		mux.HandleFunc("POST /api/cart/reminders", sessions.Wrap(cartHandler.SetReminders))
+		mux.HandleFunc("POST /api/cart/restore", sessions.Wrap(cartHandler.RestoreCart))
 	} else {
 		// Return error if MongoDB not available
 		mongoRequired := func(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusServiceUnavailable, "database not available")
 		}
 		mux.HandleFunc("GET /api/cart", mongoRequired)
+		mux.HandleFunc("GET /api/cart/quote", mongoRequired)
 		mux.HandleFunc("POST /api/cart/plan", mongoRequired)
 		mux.HandleFunc("POST /api/cart/addon", mongoRequired)
 		mux.HandleFunc("DELETE /api/cart/item/{itemId}", mongoRequired)
+		mux.HandleFunc("PUT /api/cart/item/{itemId}/sites/{index}", mongoRequired)
 		mux.HandleFunc("POST /api/cart/billing-cycle", mongoRequired)
+		mux.HandleFunc("POST /api/cart/currency", mongoRequired)
+		mux.HandleFunc("POST /api/cart/coupon", mongoRequired)
+		mux.HandleFunc("DELETE /api/cart/coupon", mongoRequired)
+		mux.HandleFunc("POST /api/cart/reminders", mongoRequired)
+		mux.HandleFunc("POST /api/cart/restore", mongoRequired)
+	}
+
+	// Saved quote endpoints (require MongoDB)
+	if quoteHandler != nil {
+		mux.HandleFunc("POST /api/admin/quotes", sessions.Wrap(quoteHandler.Create))
+		mux.HandleFunc("GET /api/quotes/{token}", quoteHandler.Get)
+		mux.HandleFunc("POST /api/quotes/{token}/cart", sessions.Wrap(quoteHandler.Load))
+		mux.HandleFunc("POST /api/quotes/{token}/checkout", sessions.Wrap(quoteHandler.Checkout))
+	} else {
+		quotesRequired := func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusServiceUnavailable, "database not available")
+		}
+		mux.HandleFunc("POST /api/admin/quotes", quotesRequired)
+		mux.HandleFunc("GET /api/quotes/{token}", quotesRequired)
+		mux.HandleFunc("POST /api/quotes/{token}/cart", quotesRequired)
+		mux.HandleFunc("POST /api/quotes/{token}/checkout", quotesRequired)
 	}
 
 	// Checkout endpoints (require MongoDB + Stripe)
 	if checkoutHandler != nil {
-		mux.HandleFunc("POST /api/checkout", checkoutHandler.CreateCheckoutSession)
+		mux.HandleFunc("POST /api/checkout", sessions.Wrap(checkoutHandler.CreateCheckoutSession))
 		mux.HandleFunc("POST /api/webhook/stripe", checkoutHandler.Webhook)
 	} else {
 		stripeRequired := func(w http.ResponseWriter, r *http.Request) {
@@ -186,7 +277,8 @@ func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Session-ID")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Session-ID, Idempotency-Key")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Session-ID")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
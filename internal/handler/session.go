@@ -0,0 +1,147 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sessionCookie carries the signed cart session ID
+const sessionCookie = "session_id"
+
+// ErrInvalidSession is returned for session IDs with a bad signature
+var ErrInvalidSession = errors.New("invalid session")
+
+type sessionIDKey struct{}
+
+// SessionManager issues random cart session IDs signed with HMAC-SHA256 as
+// "<id>.<signature>". IDs signed with a previous secret are still accepted
+// and re-issued under the current one, so secrets can be rotated without
+// emptying every cart.
+type SessionManager struct {
+	current  []byte
+	previous [][]byte
+	secure   bool
+	maxAge   time.Duration
+}
+
+// NewSessionManager creates a session manager. secret signs new IDs;
+// previous secrets are only used to verify. Without a secret a random one
+// is generated, so sessions do not survive a restart. secure marks the
+// cookie Secure (HTTPS only); maxAge is the cookie lifetime.
+func NewSessionManager(secret string, previous []string, secure bool, maxAge time.Duration) *SessionManager {
+	m := &SessionManager{current: []byte(secret), secure: secure, maxAge: maxAge}
+	if secret == "" {
+		log.Println("Warning: CART_SESSION_SECRET not set, using a random secret")
+		m.current = make([]byte, 32)
+		if _, err := rand.Read(m.current); err != nil {
+			panic(err)
+		}
+	}
+	for _, p := range previous {
+		if p = strings.TrimSpace(p); p != "" {
+			m.previous = append(m.previous, []byte(p))
+		}
+	}
+	return m
+}
+
+// Sign returns the signed form of id
+func (m *SessionManager) Sign(id string) string {
+	return id + "." + signature(m.current, id)
+}
+
+// Verify checks a signed value and returns its ID. rotated reports a
+// signature by a previous secret.
+func (m *SessionManager) Verify(value string) (id string, rotated bool, err error) {
+	id, sig, ok := strings.Cut(value, ".")
+	if !ok || id == "" {
+		return "", false, ErrInvalidSession
+	}
+	if hmac.Equal([]byte(sig), []byte(signature(m.current, id))) {
+		return id, false, nil
+	}
+	for _, secret := range m.previous {
+		if hmac.Equal([]byte(sig), []byte(signature(secret, id))) {
+			return id, true, nil
+		}
+	}
+	return "", false, ErrInvalidSession
+}
+
+// Wrap resolves the cart session before calling next:
+//   - a valid signed ID from the cookie or X-Session-ID header is used
+//   - a signed ID with a bad signature is rejected with 401
+//   - without a signed ID (including legacy client-generated ones) a new
+//     session is issued
+//
+// New and rotated IDs are set as an HttpOnly, SameSite=Lax cookie and
+// echoed in the X-Session-ID response header for non-browser clients.
+func (m *SessionManager) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		value := ""
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			value = cookie.Value
+		}
+		if !strings.Contains(value, ".") {
+			value = r.Header.Get("X-Session-ID")
+		}
+
+		var id string
+		issue := false
+		if strings.Contains(value, ".") {
+			var err error
+			var rotated bool
+			id, rotated, err = m.Verify(value)
+			if err != nil {
+				writeError(w, http.StatusUnauthorized, ErrInvalidSession.Error())
+				return
+			}
+			issue = rotated
+		} else {
+			id = newSessionID()
+			issue = true
+		}
+
+		if issue {
+			signed := m.Sign(id)
+			http.SetCookie(w, &http.Cookie{
+				Name:     sessionCookie,
+				Value:    signed,
+				Path:     "/",
+				MaxAge:   int(m.maxAge / time.Second),
+				HttpOnly: true,
+				Secure:   m.secure,
+				SameSite: http.SameSiteLaxMode,
+			})
+			w.Header().Set("X-Session-ID", signed)
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), sessionIDKey{}, id)))
+	}
+}
+
+// newSessionID returns 256 random bits, URL-safe encoded
+func newSessionID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signature(secret []byte, id string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
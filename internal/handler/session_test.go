@@ -0,0 +1,142 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/deicod/dysv/internal/handler"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/deicod/dysv/internal/service"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Session Manager", func() {
+	var (
+		sessions *handler.SessionManager
+		echo     http.HandlerFunc
+	)
+
+	BeforeEach(func() {
+		sessions = handler.NewSessionManager("current-secret", []string{"old-secret"}, true, time.Hour)
+		echo = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		sessions.Wrap(echo)(rec, req)
+		return rec
+	}
+
+	sessionCookie := func(rec *httptest.ResponseRecorder) *http.Cookie {
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == "session_id" {
+				return c
+			}
+		}
+		return nil
+	}
+
+	It("should verify IDs it signed", func() {
+		id, rotated, err := sessions.Verify(sessions.Sign("abc"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("abc"))
+		Expect(rotated).To(BeFalse())
+	})
+
+	It("should issue a signed HttpOnly cookie to new visitors", func() {
+		rec := serve(httptest.NewRequest(http.MethodGet, "/api/cart", nil))
+
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		cookie := sessionCookie(rec)
+		Expect(cookie).NotTo(BeNil())
+		Expect(cookie.HttpOnly).To(BeTrue())
+		Expect(cookie.Secure).To(BeTrue())
+		Expect(cookie.SameSite).To(Equal(http.SameSiteLaxMode))
+		Expect(cookie.MaxAge).To(Equal(3600))
+		Expect(rec.Header().Get("X-Session-ID")).To(Equal(cookie.Value))
+
+		_, _, err := sessions.Verify(cookie.Value)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should replace unsigned client-generated IDs", func() {
+		req := httptest.NewRequest(http.MethodGet, "/api/cart", nil)
+		req.Header.Set("X-Session-ID", "guessed-uuid")
+		rec := serve(req)
+
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		cookie := sessionCookie(rec)
+		Expect(cookie).NotTo(BeNil())
+		Expect(cookie.Value).NotTo(HavePrefix("guessed-uuid."))
+	})
+
+	It("should reject tampered IDs", func() {
+		signed := sessions.Sign("victim")
+		req := httptest.NewRequest(http.MethodGet, "/api/cart", nil)
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: "attacker" + signed[strings.Index(signed, "."):]})
+		rec := serve(req)
+
+		Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should accept and re-issue IDs signed with a previous secret", func() {
+		old := handler.NewSessionManager("old-secret", nil, true, time.Hour)
+		req := httptest.NewRequest(http.MethodGet, "/api/cart", nil)
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: old.Sign("abc")})
+		rec := serve(req)
+
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		cookie := sessionCookie(rec)
+		Expect(cookie).NotTo(BeNil())
+		Expect(cookie.Value).To(Equal(sessions.Sign("abc")))
+	})
+
+	It("should hand the verified ID to the cart handler", func() {
+		catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(context.Background())).To(Succeed())
+		cartHandler := handler.NewCartHandler(service.NewCartService(repo.NewMockCartRepo(), catalogService, nil, nil), nil, nil, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/cart", nil)
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: sessions.Sign("abc")})
+		rec := httptest.NewRecorder()
+		sessions.Wrap(cartHandler.GetCart)(rec, req)
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var resp map[string]map[string]interface{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed())
+		Expect(resp["cart"]["sessionId"]).To(Equal("abc"))
+	})
+
+	It("should not trust raw IDs without the middleware", func() {
+		catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(context.Background())).To(Succeed())
+		cartHandler := handler.NewCartHandler(service.NewCartService(repo.NewMockCartRepo(), catalogService, nil, nil), nil, nil, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/cart", nil)
+		req.Header.Set("X-Session-ID", "guessed-uuid")
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: "guessed-uuid"})
+		rec := httptest.NewRecorder()
+		cartHandler.GetCart(rec, req)
+
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should not re-issue a current cookie", func() {
+		req := httptest.NewRequest(http.MethodGet, "/api/cart", nil)
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: sessions.Sign("abc")})
+		rec := serve(req)
+
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(sessionCookie(rec)).To(BeNil())
+	})
+})
@@ -0,0 +1,164 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+
+// Package k8s generates the Kubernetes objects that enforce plan limits
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/deicod/dysv/internal/model"
+	"go.yaml.in/yaml/v3"
+)
+
+// ObjectMeta is the subset of metav1.ObjectMeta we set
+type ObjectMeta struct {
+	Name      string            `yaml:"name" json:"name"`
+	Namespace string            `yaml:"namespace" json:"namespace"`
+	Labels    map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// ResourceQuota mirrors core/v1 ResourceQuota
+type ResourceQuota struct {
+	APIVersion string            `yaml:"apiVersion" json:"apiVersion"`
+	Kind       string            `yaml:"kind" json:"kind"`
+	Metadata   ObjectMeta        `yaml:"metadata" json:"metadata"`
+	Spec       ResourceQuotaSpec `yaml:"spec" json:"spec"`
+}
+
+// ResourceQuotaSpec mirrors core/v1 ResourceQuotaSpec
+type ResourceQuotaSpec struct {
+	Hard map[string]string `yaml:"hard" json:"hard"`
+}
+
+// LimitRange mirrors core/v1 LimitRange
+type LimitRange struct {
+	APIVersion string         `yaml:"apiVersion" json:"apiVersion"`
+	Kind       string         `yaml:"kind" json:"kind"`
+	Metadata   ObjectMeta     `yaml:"metadata" json:"metadata"`
+	Spec       LimitRangeSpec `yaml:"spec" json:"spec"`
+}
+
+// LimitRangeSpec mirrors core/v1 LimitRangeSpec
+type LimitRangeSpec struct {
+	Limits []LimitRangeItem `yaml:"limits" json:"limits"`
+}
+
+// LimitRangeItem mirrors core/v1 LimitRangeItem
+type LimitRangeItem struct {
+	Type           string            `yaml:"type" json:"type"`
+	Default        map[string]string `yaml:"default,omitempty" json:"default,omitempty"`
+	DefaultRequest map[string]string `yaml:"defaultRequest,omitempty" json:"defaultRequest,omitempty"`
+	Max            map[string]string `yaml:"max,omitempty" json:"max,omitempty"`
+}
+
+// planLabel marks generated objects with the plan they enforce
+const planLabel = "dysv.de/plan"
+
+// Quota builds the namespace ResourceQuota for a plan. spec is per replica,
+// so CPU and memory are multiplied by replicas; storage is shared.
+func Quota(namespace, planID string, spec model.ResourceSpec, replicas int64) ResourceQuota {
+	hard := map[string]string{}
+	if spec.CPULimitMillis > 0 {
+		hard["requests.cpu"] = CPU(spec.CPURequestMillis * replicas)
+		hard["limits.cpu"] = CPU(spec.CPULimitMillis * replicas)
+	}
+	if spec.MemoryLimitBytes > 0 {
+		hard["requests.memory"] = Bytes(spec.MemoryRequestBytes * replicas)
+		hard["limits.memory"] = Bytes(spec.MemoryLimitBytes * replicas)
+	}
+	if spec.StorageBytes > 0 {
+		hard["requests.storage"] = Bytes(spec.StorageBytes)
+	}
+
+	return ResourceQuota{
+		APIVersion: "v1",
+		Kind:       "ResourceQuota",
+		Metadata:   meta(namespace, planID, "plan-quota"),
+		Spec:       ResourceQuotaSpec{Hard: hard},
+	}
+}
+
+// ContainerLimits builds a LimitRange that gives every container the plan's
+// per-replica requests and limits by default and caps it at the limits
+func ContainerLimits(namespace, planID string, spec model.ResourceSpec) LimitRange {
+	limits := map[string]string{}
+	requests := map[string]string{}
+	if spec.CPULimitMillis > 0 {
+		limits["cpu"] = CPU(spec.CPULimitMillis)
+		requests["cpu"] = CPU(spec.CPURequestMillis)
+	}
+	if spec.MemoryLimitBytes > 0 {
+		limits["memory"] = Bytes(spec.MemoryLimitBytes)
+		requests["memory"] = Bytes(spec.MemoryRequestBytes)
+	}
+
+	return LimitRange{
+		APIVersion: "v1",
+		Kind:       "LimitRange",
+		Metadata:   meta(namespace, planID, "plan-limits"),
+		Spec: LimitRangeSpec{Limits: []LimitRangeItem{{
+			Type:           "Container",
+			Default:        limits,
+			DefaultRequest: requests,
+			Max:            limits,
+		}}},
+	}
+}
+
+// Manifests renders the quota objects for a plan as a multi-document YAML
+// stream ready for kubectl apply. Shared plans without CPU or memory limits
+// only get the ResourceQuota.
+func Manifests(namespace, planID string, spec model.ResourceSpec, replicas int64) ([]byte, error) {
+	objects := []interface{}{Quota(namespace, planID, spec, replicas)}
+	if spec.CPULimitMillis > 0 || spec.MemoryLimitBytes > 0 {
+		objects = append(objects, ContainerLimits(namespace, planID, spec))
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, obj := range objects {
+		if err := enc.Encode(obj); err != nil {
+			return nil, fmt.Errorf("encode %T: %w", obj, err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// CPU formats millicores as a Kubernetes quantity ("100m", "2")
+func CPU(millis int64) string {
+	if millis%1000 == 0 {
+		return strconv.FormatInt(millis/1000, 10)
+	}
+	return strconv.FormatInt(millis, 10) + "m"
+}
+
+// Bytes formats a byte count as a Kubernetes quantity using the largest
+// exact binary suffix ("512Mi", "4Gi")
+func Bytes(n int64) string {
+	switch {
+	case n != 0 && n%model.GiB == 0:
+		return strconv.FormatInt(n/model.GiB, 10) + "Gi"
+	case n != 0 && n%model.MiB == 0:
+		return strconv.FormatInt(n/model.MiB, 10) + "Mi"
+	case n != 0 && n%1024 == 0:
+		return strconv.FormatInt(n/1024, 10) + "Ki"
+	default:
+		return strconv.FormatInt(n, 10)
+	}
+}
+
+func meta(namespace, planID, name string) ObjectMeta {
+	return ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		Labels:    map[string]string{planLabel: planID},
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package k8s_test
+
+import (
+	"github.com/deicod/dysv/internal/k8s"
+	"github.com/deicod/dysv/internal/model"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Quota", func() {
+	starter := model.ResourceSpec{
+		CPURequestMillis:   100,
+		CPULimitMillis:     1000,
+		MemoryRequestBytes: 256 * model.MiB,
+		MemoryLimitBytes:   512 * model.MiB,
+		StorageBytes:       5 * model.GiB,
+	}
+
+	It("should scale CPU and memory by replica count", func() {
+		quota := k8s.Quota("site-1", "node-starter", starter, 3)
+
+		Expect(quota.Kind).To(Equal("ResourceQuota"))
+		Expect(quota.Metadata.Namespace).To(Equal("site-1"))
+		Expect(quota.Metadata.Labels).To(HaveKeyWithValue("dysv.de/plan", "node-starter"))
+		Expect(quota.Spec.Hard).To(Equal(map[string]string{
+			"requests.cpu":     "300m",
+			"limits.cpu":       "3",
+			"requests.memory":  "768Mi",
+			"limits.memory":    "1536Mi",
+			"requests.storage": "5Gi",
+		}))
+	})
+
+	It("should only cap storage for shared plans", func() {
+		quota := k8s.Quota("site-2", "static-micro", model.ResourceSpec{StorageBytes: model.GiB}, 3)
+		Expect(quota.Spec.Hard).To(Equal(map[string]string{"requests.storage": "1Gi"}))
+	})
+
+	It("should default containers to the per-replica profile", func() {
+		lr := k8s.ContainerLimits("site-1", "node-starter", starter)
+
+		Expect(lr.Spec.Limits).To(HaveLen(1))
+		Expect(lr.Spec.Limits[0].DefaultRequest).To(Equal(map[string]string{"cpu": "100m", "memory": "256Mi"}))
+		Expect(lr.Spec.Limits[0].Default).To(Equal(map[string]string{"cpu": "1", "memory": "512Mi"}))
+	})
+
+	It("should render both objects as YAML", func() {
+		out, err := k8s.Manifests("site-1", "node-starter", starter, 3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(out)).To(ContainSubstring("kind: ResourceQuota"))
+		Expect(string(out)).To(ContainSubstring("kind: LimitRange"))
+		Expect(string(out)).To(ContainSubstring("---"))
+	})
+
+	Describe("quantities", func() {
+		It("should format CPU", func() {
+			Expect(k8s.CPU(100)).To(Equal("100m"))
+			Expect(k8s.CPU(2000)).To(Equal("2"))
+		})
+
+		It("should format bytes", func() {
+			Expect(k8s.Bytes(4 * model.GiB)).To(Equal("4Gi"))
+			Expect(k8s.Bytes(512 * model.MiB)).To(Equal("512Mi"))
+			Expect(k8s.Bytes(1000)).To(Equal("1000"))
+		})
+	})
+})
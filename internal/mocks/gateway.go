@@ -0,0 +1,212 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package mocks
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/service"
+)
+
+// Ensure FakeGateway implements service.PaymentGateway
+var _ service.PaymentGateway = (*FakeGateway)(nil)
+
+// FakeGateway is an in-memory payment gateway. It keeps everything checkout
+// creates for inspection and honors idempotency keys like Stripe. Err, if
+// set, fails every call.
+type FakeGateway struct {
+	mu         sync.Mutex
+	seq        int
+	Sessions   map[string]*service.CheckoutSessionParams // by session ID
+	Discounts  map[string]*service.DiscountParams        // by discount ID
+	TaxRates   map[string]model.TaxDecision              // by tax rate ID
+	Customers  map[string]service.CustomerParams         // by customer ID, as last created or updated
+	Subs       map[string]*service.GatewaySubscription   // by subscription ID
+	Refunds    map[string]*service.RefundParams          // by refund ID
+	Err        error
+	sessions   map[string]*service.CheckoutSession
+	idempotent map[string]string // object ID by idempotency key
+}
+
+// NewFakeGateway creates an empty fake gateway
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{
+		Sessions:   make(map[string]*service.CheckoutSessionParams),
+		Discounts:  make(map[string]*service.DiscountParams),
+		TaxRates:   make(map[string]model.TaxDecision),
+		Customers:  make(map[string]service.CustomerParams),
+		Subs:       make(map[string]*service.GatewaySubscription),
+		Refunds:    make(map[string]*service.RefundParams),
+		sessions:   make(map[string]*service.CheckoutSession),
+		idempotent: make(map[string]string),
+	}
+}
+
+// nextID returns a new ID with prefix; callers hold mu
+func (f *FakeGateway) nextID(prefix string) string {
+	f.seq++
+	return fmt.Sprintf("%s_fake_%d", prefix, f.seq)
+}
+
+// CreateCheckoutSession implements service.PaymentGateway
+func (f *FakeGateway) CreateCheckoutSession(ctx context.Context, params *service.CheckoutSessionParams) (*service.CheckoutSession, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	if id, ok := f.idempotent[params.IdempotencyKey]; ok && params.IdempotencyKey != "" {
+		return f.sessions[id], nil
+	}
+	id := f.nextID("cs")
+	session := &service.CheckoutSession{
+		ID:        id,
+		URL:       "https://checkout.example/pay/" + id,
+		ExpiresAt: time.Now().Add(24 * time.Hour),
+	}
+	f.Sessions[id] = params
+	f.sessions[id] = session
+	if params.IdempotencyKey != "" {
+		f.idempotent[params.IdempotencyKey] = id
+	}
+	return session, nil
+}
+
+// CreateDiscount implements service.PaymentGateway
+func (f *FakeGateway) CreateDiscount(ctx context.Context, params *service.DiscountParams) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return "", f.Err
+	}
+
+	if id, ok := f.idempotent[params.IdempotencyKey]; ok && params.IdempotencyKey != "" {
+		return id, nil
+	}
+	id := f.nextID("coupon")
+	f.Discounts[id] = params
+	if params.IdempotencyKey != "" {
+		f.idempotent[params.IdempotencyKey] = id
+	}
+	return id, nil
+}
+
+// TaxRate implements service.PaymentGateway
+func (f *FakeGateway) TaxRate(ctx context.Context, tax model.TaxDecision) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return "", f.Err
+	}
+
+	for id, rate := range f.TaxRates {
+		if rate == tax {
+			return id, nil
+		}
+	}
+	id := f.nextID("txr")
+	f.TaxRates[id] = tax
+	return id, nil
+}
+
+// CreateCustomer implements service.PaymentGateway
+func (f *FakeGateway) CreateCustomer(ctx context.Context, params *service.CustomerParams) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return "", f.Err
+	}
+
+	if id, ok := f.idempotent[params.IdempotencyKey]; ok && params.IdempotencyKey != "" {
+		return id, nil
+	}
+	id := f.nextID("cus")
+	f.Customers[id] = *params
+	if params.IdempotencyKey != "" {
+		f.idempotent[params.IdempotencyKey] = id
+	}
+	return id, nil
+}
+
+// UpdateCustomer implements service.PaymentGateway
+func (f *FakeGateway) UpdateCustomer(ctx context.Context, id string, params *service.CustomerParams) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+
+	customer, ok := f.Customers[id]
+	if !ok {
+		return fmt.Errorf("no such customer: %s", id)
+	}
+	if params.Email != "" {
+		customer.Email = params.Email
+	}
+	if params.Address != nil {
+		customer.Address = params.Address
+	}
+	f.Customers[id] = customer
+	return nil
+}
+
+// GetSubscription implements service.PaymentGateway
+func (f *FakeGateway) GetSubscription(ctx context.Context, id string) (*service.GatewaySubscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	sub, ok := f.Subs[id]
+	if !ok {
+		return nil, fmt.Errorf("no such subscription: %s", id)
+	}
+	found := *sub
+	return &found, nil
+}
+
+// CancelSubscription implements service.PaymentGateway
+func (f *FakeGateway) CancelSubscription(ctx context.Context, id string, atPeriodEnd bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+
+	sub, ok := f.Subs[id]
+	if !ok {
+		return fmt.Errorf("no such subscription: %s", id)
+	}
+	if atPeriodEnd {
+		sub.CancelAtPeriodEnd = true
+	} else {
+		sub.Status = "canceled"
+	}
+	return nil
+}
+
+// Refund implements service.PaymentGateway
+func (f *FakeGateway) Refund(ctx context.Context, params *service.RefundParams) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return "", f.Err
+	}
+
+	if id, ok := f.idempotent[params.IdempotencyKey]; ok && params.IdempotencyKey != "" {
+		return id, nil
+	}
+	id := f.nextID("re")
+	f.Refunds[id] = params
+	if params.IdempotencyKey != "" {
+		f.idempotent[params.IdempotencyKey] = id
+	}
+	return id, nil
+}
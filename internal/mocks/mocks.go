@@ -215,6 +215,8 @@ func (m *MockAddressRepo) UnsetDefaults(ctx context.Context, userID string) erro
 // MockAuthService is a partial mock of auth.Service needed for handlers
 type MockAuthService struct {
 	AuthenticateSessionFunc func(ctx context.Context, token string) (core.UserPublic, core.SessionPublic, error)
+	RegisterFunc            func(ctx context.Context, cmd core.RegisterCommand) (core.AuthResult, error)
+	LoginFunc               func(ctx context.Context, cmd core.LoginCommand) (core.AuthResult, error)
 }
 
 func (m *MockAuthService) AuthenticateSession(ctx context.Context, token string) (core.UserPublic, core.SessionPublic, error) {
@@ -225,10 +227,16 @@ func (m *MockAuthService) AuthenticateSession(ctx context.Context, token string)
 }
 
 func (m *MockAuthService) Register(ctx context.Context, cmd core.RegisterCommand) (core.AuthResult, error) {
+	if m.RegisterFunc != nil {
+		return m.RegisterFunc(ctx, cmd)
+	}
 	return core.AuthResult{}, nil
 }
 
 func (m *MockAuthService) Login(ctx context.Context, cmd core.LoginCommand) (core.AuthResult, error) {
+	if m.LoginFunc != nil {
+		return m.LoginFunc(ctx, cmd)
+	}
 	return core.AuthResult{}, nil
 }
 
@@ -263,3 +271,22 @@ func (m *MockAuthService) Logout(ctx context.Context, token string) error {
 // where the full interface is expected.
 // AddressHandler uses `auth.Service`. We need to know what `auth.Service` looks like.
 // It is likely an interface. If it has more methods, we need to stub them.
+
+// MockMail is a message captured by MockMailer
+type MockMail struct {
+	To, Subject, Body string
+}
+
+// MockMailer records sent mail instead of delivering it
+type MockMailer struct {
+	Sent    []MockMail
+	SendErr error
+}
+
+func (m *MockMailer) Send(ctx context.Context, to, subject, body string) error {
+	if m.SendErr != nil {
+		return m.SendErr
+	}
+	m.Sent = append(m.Sent, MockMail{To: to, Subject: subject, Body: body})
+	return nil
+}
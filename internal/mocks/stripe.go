@@ -0,0 +1,268 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package mocks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StripeObject is a stored Stripe API object as returned to the client
+type StripeObject map[string]interface{}
+
+// StripeServer is a local stand-in for the Stripe API. It implements the
+// endpoints dysv uses, keeps created objects in memory and records every
+// request. Point a client at URL via service.NewStripeClient.
+type StripeServer struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	seq        int
+	Objects    map[string]StripeObject // by ID
+	Requests   []string                // "METHOD /path" in call order
+	idempotent map[string]string       // object ID by Idempotency-Key
+	keyParams  map[string]string       // encoded params by Idempotency-Key
+}
+
+// NewStripeServer starts a Stripe stand-in; call Close when done
+func NewStripeServer() *StripeServer {
+	s := &StripeServer{Objects: make(map[string]StripeObject), idempotent: make(map[string]string), keyParams: make(map[string]string)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/products", s.create("prod", "product"))
+	mux.HandleFunc("POST /v1/products/{id}", s.update)
+	mux.HandleFunc("GET /v1/products/{id}", s.retrieve)
+	mux.HandleFunc("POST /v1/prices", s.create("price", "price"))
+	mux.HandleFunc("POST /v1/prices/{id}", s.update)
+	mux.HandleFunc("GET /v1/prices/{id}", s.retrieve)
+	mux.HandleFunc("POST /v1/customers", s.create("cus", "customer"))
+	mux.HandleFunc("POST /v1/customers/{id}", s.update)
+	mux.HandleFunc("GET /v1/customers/{id}", s.retrieve)
+	mux.HandleFunc("POST /v1/checkout/sessions", s.create("cs", "checkout.session"))
+	mux.HandleFunc("GET /v1/subscriptions/{id}", s.retrieve)
+	mux.HandleFunc("POST /v1/subscriptions/{id}", s.update)
+	mux.HandleFunc("DELETE /v1/subscriptions/{id}", s.cancel)
+	mux.HandleFunc("POST /v1/refunds", s.create("re", "refund"))
+	mux.HandleFunc("POST /v1/coupons", s.create("coupon", "coupon"))
+	mux.HandleFunc("GET /v1/tax_rates", s.list("tax_rate"))
+	mux.HandleFunc("POST /v1/tax_rates", s.create("txr", "tax_rate"))
+	s.Server = httptest.NewServer(s.record(mux))
+	return s
+}
+
+// Count returns how many stored objects have the given object type
+func (s *StripeServer) Count(object string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, obj := range s.Objects {
+		if obj["object"] == object {
+			n++
+		}
+	}
+	return n
+}
+
+// Object returns a stored object by ID
+func (s *StripeServer) Object(id string) StripeObject {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Objects[id]
+}
+
+func (s *StripeServer) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.Requests = append(s.Requests, r.Method+" "+r.URL.Path)
+		s.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *StripeServer) create(prefix, object string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			writeStripeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		s.mu.Lock()
+		// Like Stripe, a repeated Idempotency-Key gets the first response,
+		// unless it comes with different params
+		key := r.Header.Get("Idempotency-Key")
+		if id, ok := s.idempotent[key]; ok && key != "" {
+			obj, sameParams := s.Objects[id], s.keyParams[key] == r.PostForm.Encode()
+			s.mu.Unlock()
+			if !sameParams {
+				writeStripeError(w, http.StatusBadRequest, "Keys for idempotent requests can only be used with the same parameters they were first used with.")
+				return
+			}
+			writeStripeJSON(w, obj)
+			return
+		}
+		s.seq++
+		id := fmt.Sprintf("%s_%d", prefix, s.seq)
+		obj := StripeObject{
+			"id":     id,
+			"object": object,
+			"active": true,
+		}
+		if object == "checkout.session" {
+			obj["url"] = "https://checkout.stripe.com/c/pay/" + id
+			obj["expires_at"] = time.Now().Add(24 * time.Hour).Unix()
+		}
+		mergeForm(obj, r.PostForm)
+		if discounts, ok := obj["discounts"].(map[string]interface{}); ok {
+			// Stripe answers with the list of applied discounts
+			list := make([]interface{}, len(discounts))
+			for i := range list {
+				list[i] = discounts[strconv.Itoa(i)]
+			}
+			obj["discounts"] = list
+		}
+		s.Objects[id] = obj
+		if key != "" {
+			s.idempotent[key] = id
+			s.keyParams[key] = r.PostForm.Encode()
+		}
+		s.mu.Unlock()
+
+		writeStripeJSON(w, obj)
+	}
+}
+
+func (s *StripeServer) update(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeStripeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	obj, ok := s.Objects[r.PathValue("id")]
+	if ok {
+		mergeForm(obj, r.PostForm)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeStripeError(w, http.StatusNotFound, "No such object: "+r.PathValue("id"))
+		return
+	}
+	writeStripeJSON(w, obj)
+}
+
+// cancel marks a subscription canceled
+func (s *StripeServer) cancel(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	obj, ok := s.Objects[r.PathValue("id")]
+	if ok {
+		obj["status"] = "canceled"
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeStripeError(w, http.StatusNotFound, "No such object: "+r.PathValue("id"))
+		return
+	}
+	writeStripeJSON(w, obj)
+}
+
+func (s *StripeServer) retrieve(w http.ResponseWriter, r *http.Request) {
+	obj := s.Object(r.PathValue("id"))
+	if obj == nil {
+		writeStripeError(w, http.StatusNotFound, "No such object: "+r.PathValue("id"))
+		return
+	}
+	writeStripeJSON(w, obj)
+}
+
+// list returns all stored objects of the given type on a single page
+func (s *StripeServer) list(object string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		data := make([]StripeObject, 0)
+		for _, obj := range s.Objects {
+			if obj["object"] == object {
+				data = append(data, obj)
+			}
+		}
+		s.mu.Unlock()
+
+		sort.Slice(data, func(i, j int) bool { return data[i]["id"].(string) < data[j]["id"].(string) })
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"object":   "list",
+			"url":      r.URL.Path,
+			"has_more": false,
+			"data":     data,
+		})
+	}
+}
+
+// mergeForm copies form-encoded params into obj, expanding "a[b]" keys into
+// nested objects and "true"/"false"/numbers into their JSON types. Metadata
+// values stay strings.
+func mergeForm(obj StripeObject, form map[string][]string) {
+	for key, values := range form {
+		if len(values) == 0 {
+			continue
+		}
+		target := map[string]interface{}(obj)
+		parts := strings.Split(strings.ReplaceAll(key, "]", ""), "[")
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := target[part].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				target[part] = next
+			}
+			target = next
+		}
+		leaf := parts[len(parts)-1]
+		if stringParams[leaf] || (len(parts) > 1 && parts[len(parts)-2] == "metadata") {
+			target[leaf] = values[0]
+			continue
+		}
+		target[leaf] = formValue(values[0])
+	}
+}
+
+// stringParams are string fields whose values may look like numbers
+var stringParams = map[string]bool{"postal_code": true, "phone": true}
+
+func formValue(v string) interface{} {
+	switch v {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil && strings.Trim(v, "0123456789.") == "" {
+		return f
+	}
+	return v
+}
+
+func writeStripeJSON(w http.ResponseWriter, obj StripeObject) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(obj)
+}
+
+func writeStripeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"type": "invalid_request_error", "message": message},
+	})
+}
@@ -0,0 +1,39 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package mocks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/service"
+)
+
+// Ensure FakeVATValidator implements service.VATValidator
+var _ service.VATValidator = (*FakeVATValidator)(nil)
+
+// FakeVATValidator is a local VAT register. IDs in Registered are valid,
+// all others invalid; Unavailable simulates an outage of the register.
+type FakeVATValidator struct {
+	Registered  map[string]string // VAT ID -> trader name
+	Unavailable bool
+	Checked     []string // VAT IDs in call order
+}
+
+// Validate implements service.VATValidator
+func (f *FakeVATValidator) Validate(ctx context.Context, vatID string) (*model.VATCheck, error) {
+	f.Checked = append(f.Checked, vatID)
+	if f.Unavailable {
+		return nil, fmt.Errorf("%w: MS_UNAVAILABLE", service.ErrVATCheckUnavailable)
+	}
+	check := &model.VATCheck{VATID: vatID, Status: model.VATInvalid, CheckedAt: time.Now()}
+	if name, ok := f.Registered[vatID]; ok {
+		check.Status = model.VATValid
+		check.Name = name
+		check.ConsultationNumber = fmt.Sprintf("WAPI%08d", len(f.Checked))
+	}
+	return check, nil
+}
@@ -4,16 +4,27 @@ import "time"
 
 // Address represents a customer's physical address.
 type Address struct {
-	ID         string    `json:"id" bson:"_id,omitempty"`
-	UserID     string    `json:"userId" bson:"user_id"`
-	Label      string    `json:"label" bson:"label"` // e.g. "Home", "Office"
-	Line1      string    `json:"line1" bson:"line1"`
-	Line2      string    `json:"line2,omitempty" bson:"line2,omitempty"`
-	City       string    `json:"city" bson:"city"`
-	PostalCode string    `json:"postalCode" bson:"postal_code"`
-	State      string    `json:"state,omitempty" bson:"state,omitempty"`
-	Country    string    `json:"country" bson:"country"` // ISO 3166-1 alpha-2
-	IsDefault  bool      `json:"isDefault" bson:"is_default"`
-	CreatedAt  time.Time `json:"createdAt" bson:"created_at"`
-	UpdatedAt  time.Time `json:"updatedAt" bson:"updated_at"`
+	ID           string       `json:"id" bson:"_id,omitempty"`
+	UserID       string       `json:"userId" bson:"user_id"`
+	Label        string       `json:"label" bson:"label"`                         // e.g. "Home", "Office"
+	Company      string       `json:"company,omitempty" bson:"company,omitempty"` // required for business customers
+	Line1        string       `json:"line1" bson:"line1"`
+	Line2        string       `json:"line2,omitempty" bson:"line2,omitempty"`
+	City         string       `json:"city" bson:"city"`
+	PostalCode   string       `json:"postalCode" bson:"postal_code"`
+	State        string       `json:"state,omitempty" bson:"state,omitempty"`
+	Country      string       `json:"country" bson:"country"`                                // ISO 3166-1 alpha-2
+	CustomerType CustomerType `json:"customerType,omitempty" bson:"customer_type,omitempty"` // private if empty
+	VATID        string       `json:"vatId,omitempty" bson:"vat_id,omitempty"`               // business customers in the EU
+	VATCheck     *VATCheck    `json:"vatCheck,omitempty" bson:"vat_check,omitempty"`         // set by AddressService, not by clients
+	Email        string       `json:"email,omitempty" bson:"email,omitempty"`                // contact for invoices
+	Phone        string       `json:"phone,omitempty" bson:"phone,omitempty"`
+	IsDefault    bool         `json:"isDefault" bson:"is_default"`
+	CreatedAt    time.Time    `json:"createdAt" bson:"created_at"`
+	UpdatedAt    time.Time    `json:"updatedAt" bson:"updated_at"`
+}
+
+// VATIDVerified reports whether the address's VAT ID was found valid
+func (a *Address) VATIDVerified() bool {
+	return a.VATID != "" && a.VATCheck != nil && a.VATCheck.Status == VATValid && a.VATCheck.VATID == a.VATID
 }
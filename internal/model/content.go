@@ -0,0 +1,39 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package model
+
+// DefaultLanguage is used when a plan has no copy in the requested language
+const DefaultLanguage = "en"
+
+// SupportedLanguages are the locales shipped by the frontend
+var SupportedLanguages = []string{"de", "en", "hr"}
+
+// SupportedLanguage reports whether lang is one of SupportedLanguages
+func SupportedLanguage(lang string) bool {
+	for _, l := range SupportedLanguages {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// PlanContent is the customer-facing copy of a plan in one language
+type PlanContent struct {
+	Name           string   `bson:"name" json:"name"`
+	TargetAudience string   `bson:"target_audience" json:"targetAudience"`
+	Features       []string `bson:"features" json:"features"`
+}
+
+// Localized returns the plan copy for lang, falling back to DefaultLanguage
+// and finally to the canonical plan name
+func (p Plan) Localized(lang string) PlanContent {
+	if c, ok := p.Content[lang]; ok {
+		return c
+	}
+	if c, ok := p.Content[DefaultLanguage]; ok {
+		return c
+	}
+	return PlanContent{Name: p.Name, Features: []string{}}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Coupon is a promotion code giving either a percentage or a fixed amount
+// off the eligible lines of an invoice
+type Coupon struct {
+	Code           string         `bson:"_id" json:"code"` // upper case, entered by the customer
+	Name           string         `bson:"name" json:"name"`
+	PercentOffBPS  int64          `bson:"percent_off_bps,omitempty" json:"percentOffBps,omitempty"` // percent off in basis points
+	AmountOff      PriceTable     `bson:"amount_off,omitempty" json:"amountOff,omitempty"`          // fixed amount off per invoice, per currency
+	Plans          []string       `bson:"plans,omitempty" json:"plans,omitempty"`                   // only these plans are discounted; empty for every line
+	Cycles         []BillingCycle `bson:"cycles,omitempty" json:"cycles,omitempty"`                 // only valid with these billing cycles; empty for all
+	Recurring      bool           `bson:"recurring" json:"recurring"`                               // every invoice instead of the first only
+	ValidFrom      *time.Time     `bson:"valid_from,omitempty" json:"validFrom,omitempty"`
+	ValidUntil     *time.Time     `bson:"valid_until,omitempty" json:"validUntil,omitempty"`
+	MaxRedemptions int            `bson:"max_redemptions" json:"maxRedemptions"` // across all customers; 0 for unlimited
+	MaxPerUser     int            `bson:"max_per_user" json:"maxPerUser"`        // 0 for unlimited
+	Redemptions    int            `bson:"redemptions" json:"redemptions"`        // paid orders so far
+	Reserved       int            `bson:"reserved" json:"reserved"`              // held by open checkouts
+	CreatedAt      time.Time      `bson:"created_at" json:"createdAt"`
+	UpdatedAt      time.Time      `bson:"updated_at" json:"updatedAt"`
+}
+
+// ActiveAt reports whether now lies within the coupon's validity window
+func (c *Coupon) ActiveAt(now time.Time) bool {
+	if c.ValidFrom != nil && now.Before(*c.ValidFrom) {
+		return false
+	}
+	return c.ValidUntil == nil || now.Before(*c.ValidUntil)
+}
+
+// AllowsCycle reports whether the coupon is valid with billing cycle
+func (c *Coupon) AllowsCycle(cycle BillingCycle) bool {
+	if len(c.Cycles) == 0 {
+		return true
+	}
+	for _, allowed := range c.Cycles {
+		if allowed == cycle {
+			return true
+		}
+	}
+	return false
+}
+
+// Discounts reports whether the coupon applies to item. Coupons limited to
+// plans never discount addons.
+func (c *Coupon) Discounts(item LineItem) bool {
+	if len(c.Plans) == 0 {
+		return true
+	}
+	if item.ItemType != "plan" {
+		return false
+	}
+	for _, id := range c.Plans {
+		if id == item.ItemID {
+			return true
+		}
+	}
+	return false
+}
+
+// Coupon redemption statuses
+const (
+	RedemptionReserved = "reserved" // held by an open checkout
+	RedemptionRedeemed = "redeemed" // used by a paid order
+)
+
+// CouponRedemption records the use of a coupon by an order, reserved while
+// its checkout is open and redeemed once paid
+type CouponRedemption struct {
+	OrderID    bson.ObjectID `bson:"_id" json:"orderId"` // one redemption per order
+	Code       string        `bson:"code" json:"code"`
+	UserID     string        `bson:"user_id" json:"userId"`
+	Status     string        `bson:"status,omitempty" json:"status"` // empty for redemptions recorded before reservations
+	ReservedAt *time.Time    `bson:"reserved_at,omitempty" json:"reservedAt,omitempty"`
+	RedeemedAt time.Time     `bson:"redeemed_at,omitempty" json:"redeemedAt"`
+}
@@ -0,0 +1,18 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package model
+
+import "time"
+
+// Customer links a user to their Stripe customer, under which Stripe keeps
+// all subscriptions and payment methods of the account
+type Customer struct {
+	UserID           string    `bson:"_id" json:"userId"`
+	StripeCustomerID string    `bson:"stripe_customer_id" json:"stripeCustomerId"`
+	Email            string    `bson:"email" json:"email"`                              // last synced to Stripe
+	AddressID        string    `bson:"address_id,omitempty" json:"addressId,omitempty"` // billing address last synced to Stripe
+	AddressHash      string    `bson:"address_hash,omitempty" json:"-"`                 // fingerprint of its synced fields
+	CreatedAt        time.Time `bson:"created_at" json:"createdAt"`
+	UpdatedAt        time.Time `bson:"updated_at" json:"updatedAt"`
+}
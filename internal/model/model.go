@@ -9,61 +9,139 @@ import (
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
-// BillingCycle represents monthly or yearly billing
+// BillingCycle identifies a billing cycle defined in the catalog
 type BillingCycle string
 
 const (
-	BillingMonthly BillingCycle = "monthly"
-	BillingYearly  BillingCycle = "yearly"
+	BillingMonthly   BillingCycle = "monthly"
+	BillingQuarterly BillingCycle = "quarterly"
+	BillingYearly    BillingCycle = "yearly"
+	BillingBiennial  BillingCycle = "biennial"
 )
 
 // LineItem represents a single item in a cart or order
 type LineItem struct {
-	ItemID   string  `bson:"item_id" json:"itemId"`
-	ItemType string  `bson:"item_type" json:"itemType"` // "plan" or "addon"
-	Name     string  `bson:"name" json:"name"`
-	Price    float64 `bson:"price" json:"price"` // Monthly price
-	Quantity int     `bson:"quantity" json:"quantity"`
+	ItemID   string       `bson:"item_id" json:"itemId"`
+	ItemType string       `bson:"item_type" json:"itemType"` // "plan" or "addon"
+	Name     string       `bson:"name" json:"name"`
+	Price    Money        `bson:"price" json:"price"` // Monthly unit price
+	Quantity int          `bson:"quantity" json:"quantity"`
+	Sites    []SiteConfig `bson:"sites,omitempty" json:"sites,omitempty"` // plans only: one per unit
 }
 
 // Cart represents a shopping cart
 type Cart struct {
-	ID           bson.ObjectID `bson:"_id,omitempty" json:"id"`
-	SessionID    string        `bson:"session_id" json:"sessionId"`
-	Items        []LineItem    `bson:"items" json:"items"`
-	BillingCycle BillingCycle  `bson:"billing_cycle" json:"billingCycle"`
-	CreatedAt    time.Time     `bson:"created_at" json:"createdAt"`
-	UpdatedAt    time.Time     `bson:"updated_at" json:"updatedAt"`
+	ID             bson.ObjectID    `bson:"_id,omitempty" json:"id"`
+	SessionID      string           `bson:"session_id" json:"sessionId"`
+	UserID         string           `bson:"user_id,omitempty" json:"userId,omitempty"` // set once a logged-in user owns the cart
+	Version        int64            `bson:"version" json:"version"`                    // incremented on every write, for optimistic concurrency
+	Items          []LineItem       `bson:"items" json:"items"`
+	BillingCycle   BillingCycle     `bson:"billing_cycle" json:"billingCycle"`
+	Currency       string           `bson:"currency" json:"currency"`
+	CurrencyChosen bool             `bson:"currency_chosen" json:"-"`                                // set once picked explicitly
+	ReminderEmail  string           `bson:"reminder_email,omitempty" json:"reminderEmail,omitempty"` // opted in to abandoned-cart reminders
+	ReminderSentAt *time.Time       `bson:"reminder_sent_at,omitempty" json:"-"`                     // cleared on every change
+	RestoreToken   string           `bson:"restore_token,omitempty" json:"-"`                        // from the last reminder link
+	QuoteID        string           `bson:"quote_id,omitempty" json:"quoteId,omitempty"`             // saved quote whose prices the items carry
+	QuoteExpiresAt *time.Time       `bson:"quote_expires_at,omitempty" json:"quoteExpiresAt,omitempty"`
+	QuoteCycle     *BillingCycleDef `bson:"quote_cycle,omitempty" json:"-"`  // the quote's billing cycle terms
+	QuoteCoupon    *Coupon          `bson:"quote_coupon,omitempty" json:"-"` // the quote's coupon terms
+	CouponCode     string           `bson:"coupon_code,omitempty" json:"couponCode,omitempty"`
+	CreatedAt      time.Time        `bson:"created_at" json:"createdAt"`
+	UpdatedAt      time.Time        `bson:"updated_at" json:"updatedAt"` // carts expire CART_TTL after this
 }
 
 // Order represents a completed order
 type Order struct {
-	ID              bson.ObjectID `bson:"_id,omitempty" json:"id"`
-	CartID          bson.ObjectID `bson:"cart_id" json:"cartId"`
-	StripeSessionID string        `bson:"stripe_session_id" json:"stripeSessionId"`
-	CustomerEmail   string        `bson:"customer_email" json:"customerEmail"`
-	Items           []LineItem    `bson:"items" json:"items"`
-	BillingCycle    BillingCycle  `bson:"billing_cycle" json:"billingCycle"`
-	BillingAddress  Address       `bson:"billing_address" json:"billingAddress"`
-	TotalAmount     float64       `bson:"total_amount" json:"totalAmount"`
-	Status          string        `bson:"status" json:"status"` // pending, paid, cancelled
-	CreatedAt       time.Time     `bson:"created_at" json:"createdAt"`
-	PaidAt          *time.Time    `bson:"paid_at,omitempty" json:"paidAt,omitempty"`
+	ID                bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	CartID            bson.ObjectID `bson:"cart_id" json:"cartId"`
+	StripeSessionID   string        `bson:"stripe_session_id" json:"stripeSessionId"`
+	UserID            string        `bson:"user_id" json:"userId"`
+	CustomerEmail     string        `bson:"customer_email" json:"customerEmail"`
+	StripeCustomerID  string        `bson:"stripe_customer_id,omitempty" json:"-"` // Stripe customer of the user, if linked
+	Items             []LineItem    `bson:"items" json:"items"`
+	BillingCycle      BillingCycle  `bson:"billing_cycle" json:"billingCycle"`
+	BillingAddress    Address       `bson:"billing_address" json:"billingAddress"`
+	TotalAmount       Money         `bson:"total_amount" json:"totalAmount"` // gross of the first invoice
+	NetAmount         Money         `bson:"net_amount" json:"netAmount"`
+	TaxAmount         Money         `bson:"tax_amount" json:"taxAmount"`
+	Tax               TaxDecision   `bson:"tax" json:"tax"`
+	CouponCode        string        `bson:"coupon_code,omitempty" json:"couponCode,omitempty"` // redeemed once paid
+	Credit            Money         `bson:"credit,omitempty" json:"credit"`                    // account credit used, booked once paid
+	Status            string        `bson:"status" json:"status"`                              // pending, paid, cancelled
+	TrialDays         int           `bson:"trial_days,omitempty" json:"trialDays,omitempty"`   // trial granted at checkout; 0 for none
+	TrialStart        *time.Time    `bson:"trial_start,omitempty" json:"trialStart,omitempty"` // set once the order is completed
+	TrialEnd          *time.Time    `bson:"trial_end,omitempty" json:"trialEnd,omitempty"`
+	IdempotencyKey    string        `bson:"idempotency_key,omitempty" json:"-"`     // Idempotency-Key of the checkout request
+	CheckoutHash      string        `bson:"checkout_hash,omitempty" json:"-"`       // cart contents the Stripe session was created for
+	CheckoutURL       string        `bson:"checkout_url,omitempty" json:"-"`        // set once the Stripe session exists
+	CheckoutExpiresAt *time.Time    `bson:"checkout_expires_at,omitempty" json:"-"` // when the Stripe session closes
+	CreatedAt         time.Time     `bson:"created_at" json:"createdAt"`
+	PaidAt            *time.Time    `bson:"paid_at,omitempty" json:"paidAt,omitempty"`
 }
 
-// Plan represents a hosting plan (for reference, not stored in DB)
+// Plan represents a hosting plan stored in the catalog.
+// Name is the canonical product name used on orders and invoices;
+// display copy lives in Content, keyed by language.
 type Plan struct {
-	ID             string   `json:"id"`
-	Name           string   `json:"name"`
-	MonthlyPrice   float64  `json:"monthlyPrice"`
-	TargetAudience string   `json:"targetAudience"`
-	Limits         string   `json:"limits"`
-	Features       []string `json:"features"`
+	ID              string                 `bson:"_id" json:"id"`
+	Name            string                 `bson:"name" json:"name"`
+	MonthlyPrices   PriceTable             `bson:"monthly_prices" json:"monthlyPrices"`
+	Content         map[string]PlanContent `bson:"content" json:"content"`
+	Resources       ResourceSpec           `bson:"resources" json:"resources"`
+	Frameworks      []string               `bson:"frameworks" json:"frameworks"`                    // frameworks a site on this plan may use
+	TrialDays       int                    `bson:"trial_days,omitempty" json:"trialDays,omitempty"` // free trial for first-time subscribers; 0 for none
+	SortOrder       int                    `bson:"sort_order" json:"sortOrder"`
+	StripeProductID string                 `bson:"stripe_product_id,omitempty" json:"stripeProductId,omitempty"`
+	StripePrices    map[string]StripePrice `bson:"stripe_prices,omitempty" json:"stripePrices,omitempty"` // keyed by StripePriceKey
+	UpdatedAt       time.Time              `bson:"updated_at" json:"updatedAt"`
 }
 
-// Addon represents an add-on product
+// Addon represents an add-on product stored in the catalog
 type Addon struct {
-	ID           string  `json:"id"`
-	Name         string  `json:"name"`
-	MonthlyPrice float64 `json:"monthlyPrice"`
+	ID              string                 `bson:"_id" json:"id"`
+	Name            string                 `bson:"name" json:"name"`
+	MonthlyPrices   PriceTable             `bson:"monthly_prices" json:"monthlyPrices"`
+	Rules           AddonRules             `bson:"rules" json:"rules"`
+	SortOrder       int                    `bson:"sort_order" json:"sortOrder"`
+	StripeProductID string                 `bson:"stripe_product_id,omitempty" json:"stripeProductId,omitempty"`
+	StripePrices    map[string]StripePrice `bson:"stripe_prices,omitempty" json:"stripePrices,omitempty"` // keyed by StripePriceKey
+	UpdatedAt       time.Time              `bson:"updated_at" json:"updatedAt"`
+}
+
+// AddonRules declares how an addon combines with plans and other addons.
+// The zero value allows the addon on its own, once per cart.
+type AddonRules struct {
+	RequiresPlan  bool     `bson:"requires_plan" json:"requiresPlan"`                       // at least one plan must be in the cart
+	RequiredPlans []string `bson:"required_plans,omitempty" json:"requiredPlans,omitempty"` // only these plans qualify; implies RequiresPlan
+	MaxPerPlan    int      `bson:"max_per_plan" json:"maxPerPlan"`                          // quantity cap per qualifying plan; 0 allows a single unit
+	ExclusiveWith []string `bson:"exclusive_with,omitempty" json:"exclusiveWith,omitempty"` // addon IDs that cannot share a cart with this one
+}
+
+// StripePrice is a Stripe Price created by `dysv catalog sync`. UnitAmount
+// is what the price charges per invoice; checkout only reuses the price
+// while it still matches the catalog.
+type StripePrice struct {
+	PriceID    string `bson:"price_id" json:"priceId"`
+	UnitAmount int64  `bson:"unit_amount" json:"unitAmount"`
+}
+
+// StripePriceKey identifies the Stripe price of an item per billing cycle and currency
+func StripePriceKey(cycle BillingCycle, currency string) string {
+	return string(cycle) + ":" + currency
+}
+
+// BillingCycleDef defines a billing cycle stored in the catalog: how often
+// Stripe invoices and which discount rule applies per invoice
+type BillingCycleDef struct {
+	ID             BillingCycle `bson:"_id" json:"id"`
+	Name           string       `bson:"name" json:"name"`
+	Interval       string       `bson:"interval" json:"interval"` // Stripe recurring interval: "month" or "year"
+	IntervalCount  int64        `bson:"interval_count" json:"intervalCount"`
+	Months         int64        `bson:"months" json:"months"`                  // months covered by one invoice
+	FreeMonths     int64        `bson:"free_months" json:"freeMonths"`         // discount rule: months not charged
+	DiscountBPS    int64        `bson:"discount_bps" json:"discountBps"`       // discount rule: percent off in basis points
+	DiscountAddons bool         `bson:"discount_addons" json:"discountAddons"` // addon policy: addons get the discount too
+	SortOrder      int          `bson:"sort_order" json:"sortOrder"`
+	UpdatedAt      time.Time    `bson:"updated_at" json:"updatedAt"`
 }
@@ -0,0 +1,234 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// DefaultCurrency is the currency used when none is specified
+const DefaultCurrency = "EUR"
+
+var (
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrInvalidCurrency  = errors.New("invalid currency code")
+	ErrMoneyOverflow    = errors.New("money amount overflow")
+)
+
+// Money is an amount in minor units (cents) of an ISO 4217 currency.
+// All supported currencies have two decimal places.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// moneyDoc is the wire shape of Money in JSON and BSON
+type moneyDoc struct {
+	Amount   int64  `json:"amount" bson:"amount"`
+	Currency string `json:"currency" bson:"currency"`
+}
+
+// NewMoney creates a Money value, normalizing the currency code to upper case
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// ValidCurrency reports whether code looks like an ISO 4217 alphabetic code
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// IsZero reports whether the amount is zero
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Add returns m + o. A zero value without currency adopts the other side's currency.
+func (m Money) Add(o Money) (Money, error) {
+	cur, err := m.commonCurrency(o)
+	if err != nil {
+		return Money{}, err
+	}
+	sum := m.Amount + o.Amount
+	if (o.Amount > 0 && sum < m.Amount) || (o.Amount < 0 && sum > m.Amount) {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Amount: sum, Currency: cur}, nil
+}
+
+// Sub returns m - o
+func (m Money) Sub(o Money) (Money, error) {
+	if o.Amount == math.MinInt64 {
+		return Money{}, ErrMoneyOverflow
+	}
+	return m.Add(Money{Amount: -o.Amount, Currency: o.Currency})
+}
+
+// Mul returns m multiplied by n
+func (m Money) Mul(n int64) (Money, error) {
+	if m.Amount == 0 || n == 0 {
+		return Money{Amount: 0, Currency: m.Currency}, nil
+	}
+	product := m.Amount * n
+	if product/n != m.Amount || (m.Amount == -1 && n == math.MinInt64) || (n == -1 && m.Amount == math.MinInt64) {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// Percent returns basisPoints/10000 of m, rounded half away from zero
+// (1550 basis points = 15.5%).
+func (m Money) Percent(basisPoints int64) (Money, error) {
+	scaled, err := m.Mul(basisPoints)
+	if err != nil {
+		return Money{}, err
+	}
+	amount := scaled.Amount / 10000
+	if rem := scaled.Amount % 10000; rem >= 5000 {
+		amount++
+	} else if rem <= -5000 {
+		amount--
+	}
+	return Money{Amount: amount, Currency: m.Currency}, nil
+}
+
+// ApplyDiscount returns m reduced by basisPoints/10000 of itself
+func (m Money) ApplyDiscount(basisPoints int64) (Money, error) {
+	discount, err := m.Percent(basisPoints)
+	if err != nil {
+		return Money{}, err
+	}
+	return m.Sub(discount)
+}
+
+// Sum adds all amounts; the result is in currency even when amounts is empty
+func Sum(currency string, amounts ...Money) (Money, error) {
+	total := NewMoney(0, currency)
+	for _, a := range amounts {
+		var err error
+		if total, err = total.Add(a); err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// Decimal formats the amount in major units, e.g. "3.90"
+func (m Money) Decimal() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+// String formats the amount with its currency, e.g. "3.90 EUR"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+func (m Money) commonCurrency(o Money) (string, error) {
+	switch {
+	case m.Currency == o.Currency:
+		return m.Currency, nil
+	case m.Currency == "" && m.Amount == 0:
+		return o.Currency, nil
+	case o.Currency == "" && o.Amount == 0:
+		return m.Currency, nil
+	}
+	return "", fmt.Errorf("%w: %s vs %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+}
+
+// MarshalJSON encodes Money as {"amount": 390, "currency": "EUR"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyDoc{Amount: m.Amount, Currency: m.Currency})
+}
+
+// UnmarshalJSON decodes {"amount": 390, "currency": "EUR"} and validates the currency
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var doc moneyDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	return m.fromDoc(doc)
+}
+
+// MarshalBSONValue encodes Money as an embedded {amount, currency} document
+func (m Money) MarshalBSONValue() (byte, []byte, error) {
+	data, err := bson.Marshal(moneyDoc{Amount: m.Amount, Currency: m.Currency})
+	return byte(bson.TypeEmbeddedDocument), data, err
+}
+
+// UnmarshalBSONValue decodes an {amount, currency} document. Legacy documents
+// that stored euro prices as doubles are converted to cents.
+func (m *Money) UnmarshalBSONValue(typ byte, data []byte) error {
+	switch bson.Type(typ) {
+	case bson.TypeEmbeddedDocument:
+		var doc moneyDoc
+		if err := bson.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		return m.fromDoc(doc)
+	case bson.TypeDouble:
+		legacy, ok := bson.RawValue{Type: bson.TypeDouble, Value: data}.DoubleOK()
+		if !ok {
+			return fmt.Errorf("invalid legacy money value")
+		}
+		*m = Money{Amount: int64(math.Round(legacy * 100)), Currency: DefaultCurrency}
+		return nil
+	case bson.TypeNull:
+		*m = Money{}
+		return nil
+	}
+	return fmt.Errorf("cannot decode BSON type %v into Money", bson.Type(typ))
+}
+
+func (m *Money) fromDoc(doc moneyDoc) error {
+	cur := strings.ToUpper(doc.Currency)
+	if cur == "" && doc.Amount == 0 {
+		*m = Money{}
+		return nil
+	}
+	if !ValidCurrency(cur) {
+		return fmt.Errorf("%w: %q", ErrInvalidCurrency, doc.Currency)
+	}
+	*m = Money{Amount: doc.Amount, Currency: cur}
+	return nil
+}
+
+// PriceTable holds one price point per currency, keyed by ISO 4217 code
+type PriceTable map[string]Money
+
+// In returns the price point for currency
+func (t PriceTable) In(currency string) (Money, bool) {
+	price, ok := t[strings.ToUpper(currency)]
+	return price, ok
+}
+
+// Currencies returns the currency codes of the table in sorted order
+func (t PriceTable) Currencies() []string {
+	codes := make([]string, 0, len(t))
+	for code := range t {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
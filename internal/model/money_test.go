@@ -0,0 +1,136 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package model_test
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/deicod/dysv/internal/model"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var _ = Describe("Money", func() {
+	eur := func(cents int64) model.Money { return model.NewMoney(cents, "EUR") }
+
+	Describe("arithmetic", func() {
+		It("should add amounts of the same currency", func() {
+			sum, err := eur(990).Add(eur(100))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sum).To(Equal(eur(1090)))
+		})
+
+		It("should refuse to mix currencies", func() {
+			_, err := eur(990).Add(model.NewMoney(100, "CHF"))
+			Expect(err).To(MatchError(model.ErrCurrencyMismatch))
+		})
+
+		It("should treat the zero value as neutral", func() {
+			sum, err := model.Money{}.Add(eur(390))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sum).To(Equal(eur(390)))
+		})
+
+		It("should detect overflow", func() {
+			_, err := eur(math.MaxInt64).Add(eur(1))
+			Expect(err).To(MatchError(model.ErrMoneyOverflow))
+
+			_, err = eur(math.MaxInt64 / 2).Mul(3)
+			Expect(err).To(MatchError(model.ErrMoneyOverflow))
+		})
+
+		It("should multiply exactly", func() {
+			yearly, err := eur(990).Mul(10)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(yearly).To(Equal(eur(9900)))
+		})
+
+		It("should sum a list of amounts", func() {
+			total, err := model.Sum("EUR", eur(390), eur(990), eur(3990))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(Equal(eur(5370)))
+
+			empty, err := model.Sum("EUR")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(empty).To(Equal(eur(0)))
+		})
+	})
+
+	Describe("discounts", func() {
+		It("should round percentages half away from zero", func() {
+			part, err := eur(990).Percent(1550) // 15.5% of 9.90 = 1.5345
+			Expect(err).NotTo(HaveOccurred())
+			Expect(part).To(Equal(eur(153)))
+
+			part, err = eur(10).Percent(5000) // 50% of 0.10
+			Expect(err).NotTo(HaveOccurred())
+			Expect(part).To(Equal(eur(5)))
+
+			part, err = eur(-15).Percent(5000) // -0.075 rounds to -0.08
+			Expect(err).NotTo(HaveOccurred())
+			Expect(part).To(Equal(eur(-8)))
+		})
+
+		It("should apply a discount", func() {
+			discounted, err := eur(3990).ApplyDiscount(2000)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(discounted).To(Equal(eur(3192)))
+		})
+	})
+
+	Describe("formatting", func() {
+		It("should format major units", func() {
+			Expect(eur(390).String()).To(Equal("3.90 EUR"))
+			Expect(eur(-5).Decimal()).To(Equal("-0.05"))
+		})
+	})
+
+	Describe("JSON", func() {
+		It("should round-trip", func() {
+			data, err := json.Marshal(eur(390))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(MatchJSON(`{"amount": 390, "currency": "EUR"}`))
+
+			var m model.Money
+			Expect(json.Unmarshal([]byte(`{"amount": 990, "currency": "chf"}`), &m)).To(Succeed())
+			Expect(m).To(Equal(model.NewMoney(990, "CHF")))
+		})
+
+		It("should reject invalid currencies", func() {
+			var m model.Money
+			err := json.Unmarshal([]byte(`{"amount": 990, "currency": "EURO"}`), &m)
+			Expect(err).To(MatchError(model.ErrInvalidCurrency))
+		})
+	})
+
+	Describe("BSON", func() {
+		type doc struct {
+			Price model.Money `bson:"price"`
+		}
+
+		It("should round-trip as an embedded document", func() {
+			data, err := bson.Marshal(doc{Price: eur(3990)})
+			Expect(err).NotTo(HaveOccurred())
+
+			var raw bson.M
+			Expect(bson.Unmarshal(data, &raw)).To(Succeed())
+			Expect(raw["price"]).To(Equal(bson.D{{Key: "amount", Value: int64(3990)}, {Key: "currency", Value: "EUR"}}))
+
+			var decoded doc
+			Expect(bson.Unmarshal(data, &decoded)).To(Succeed())
+			Expect(decoded.Price).To(Equal(eur(3990)))
+		})
+
+		It("should decode legacy float prices as euro cents", func() {
+			data, err := bson.Marshal(bson.M{"price": 9.9})
+			Expect(err).NotTo(HaveOccurred())
+
+			var decoded doc
+			Expect(bson.Unmarshal(data, &decoded)).To(Succeed())
+			Expect(decoded.Price).To(Equal(eur(990)))
+		})
+	})
+})
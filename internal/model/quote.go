@@ -0,0 +1,68 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// QuoteLine is the price breakdown of one line item for one invoice
+type QuoteLine struct {
+	ItemID    string `bson:"item_id" json:"itemId"`
+	ItemType  string `bson:"item_type" json:"itemType"`
+	Name      string `bson:"name" json:"name"`
+	Quantity  int    `bson:"quantity" json:"quantity"`
+	UnitPrice Money  `bson:"unit_price" json:"unitPrice"` // net per unit and invoice, after discount
+	List      Money  `bson:"list" json:"list"`            // monthly price for every month of the cycle
+	Discount  Money  `bson:"discount" json:"discount"`    // billing cycle and coupon
+	Coupon    Money  `bson:"coupon" json:"coupon"`        // part of Discount from the coupon
+	Credit    Money  `bson:"credit" json:"credit"`        // account credit; Net is List - Discount - Credit
+	Net       Money  `bson:"net" json:"net"`
+	Tax       Money  `bson:"tax" json:"tax"`
+	Gross     Money  `bson:"gross" json:"gross"`
+}
+
+// Quote is the price breakdown of a cart for one invoice of its billing
+// cycle. Amounts are computed by the same rules that price the checkout.
+type Quote struct {
+	Currency     string       `bson:"currency" json:"currency"`
+	BillingCycle BillingCycle `bson:"billing_cycle" json:"billingCycle"`
+	Months       int64        `bson:"months" json:"months"`                              // months covered by one invoice
+	TaxRateBPS   int64        `bson:"tax_rate_bps" json:"taxRateBps"`                    // applied to every line
+	TaxCountry   string       `bson:"tax_country,omitempty" json:"taxCountry,omitempty"` // country whose VAT applies
+	TaxTreatment TaxTreatment `bson:"tax_treatment,omitempty" json:"taxTreatment,omitempty"`
+	CouponCode   string       `bson:"coupon_code,omitempty" json:"couponCode,omitempty"` // set if the coupon applied
+	Lines        []QuoteLine  `bson:"lines" json:"lines"`
+	List         Money        `bson:"list" json:"list"`
+	Discount     Money        `bson:"discount" json:"discount"`
+	Coupon       Money        `bson:"coupon" json:"coupon"`
+	Credit       Money        `bson:"credit" json:"credit"` // account credit taken off this invoice
+	Net          Money        `bson:"net" json:"net"`
+	Tax          Money        `bson:"tax" json:"tax"` // sum of the line taxes
+	Gross        Money        `bson:"gross" json:"gross"`
+}
+
+// SavedQuote is a cart frozen by sales into a quote that can be shared as a
+// signed link. Its item prices, billing cycle and coupon terms are honored
+// until ExpiresAt.
+type SavedQuote struct {
+	ID           bson.ObjectID    `bson:"_id,omitempty" json:"id"`
+	Items        []LineItem       `bson:"items" json:"items"`
+	BillingCycle BillingCycle     `bson:"billing_cycle" json:"billingCycle"`
+	Currency     string           `bson:"currency" json:"currency"`
+	Quote        Quote            `bson:"quote" json:"quote"`        // breakdown when the quote was saved
+	Cycle        *BillingCycleDef `bson:"cycle,omitempty" json:"-"`  // billing cycle terms when the quote was saved
+	Coupon       *Coupon          `bson:"coupon,omitempty" json:"-"` // coupon terms when the quote was saved
+	Note         string           `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedBy    string           `bson:"created_by" json:"createdBy"` // user ID of the sales person
+	ExpiresAt    time.Time        `bson:"expires_at" json:"expiresAt"`
+	CreatedAt    time.Time        `bson:"created_at" json:"createdAt"`
+}
+
+// Expired reports whether the quote's prices no longer apply at now
+func (q *SavedQuote) Expired(now time.Time) bool {
+	return !now.Before(q.ExpiresAt)
+}
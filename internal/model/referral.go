@@ -0,0 +1,50 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ReferralCode is the code a verified user shares to refer new customers
+type ReferralCode struct {
+	Code      string    `bson:"_id" json:"code"`
+	UserID    string    `bson:"user_id" json:"userId"` // one code per user
+	Email     string    `bson:"email" json:"-"`        // canonical email of the owner, to spot self-referrals
+	CreatedAt time.Time `bson:"created_at" json:"createdAt"`
+}
+
+// ReferralStatus is the state of a referral
+type ReferralStatus string
+
+const (
+	ReferralPending  ReferralStatus = "pending"  // waiting for the referee's first paid order
+	ReferralRewarded ReferralStatus = "rewarded" // both users got credit
+	ReferralRejected ReferralStatus = "rejected" // blocked as fraudulent, see Reason
+)
+
+// Referral records that a user registered with another user's code
+type Referral struct {
+	RefereeID  string         `bson:"_id" json:"refereeId"` // a user is referred at most once
+	ReferrerID string         `bson:"referrer_id" json:"referrerId"`
+	Code       string         `bson:"code" json:"code"`
+	Status     ReferralStatus `bson:"status" json:"status"`
+	Reason     string         `bson:"reason,omitempty" json:"reason,omitempty"`
+	OrderID    bson.ObjectID  `bson:"order_id,omitempty" json:"orderId,omitzero"` // first paid order of the referee
+	CreatedAt  time.Time      `bson:"created_at" json:"createdAt"`
+	ResolvedAt *time.Time     `bson:"resolved_at,omitempty" json:"resolvedAt,omitempty"`
+}
+
+// CreditEntry is a movement on a user's account credit: positive amounts are
+// credit granted, negative amounts credit spent on an invoice
+type CreditEntry struct {
+	ID        string    `bson:"_id" json:"id"` // derived from what caused it, so it is booked once
+	UserID    string    `bson:"user_id" json:"userId"`
+	Amount    Money     `bson:"amount" json:"amount"`
+	Reason    string    `bson:"reason" json:"reason"`                 // referral, order
+	Held      bool      `bson:"held,omitempty" json:"held,omitempty"` // spent by an open checkout, not paid yet
+	CreatedAt time.Time `bson:"created_at" json:"createdAt"`
+}
@@ -0,0 +1,93 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package model
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Byte sizes used for memory and storage
+const (
+	MiB int64 = 1 << 20
+	GiB int64 = 1 << 30
+)
+
+// ResourceSpec describes the per-replica resources of a plan. Requests are
+// reserved, limits are the ceiling a container may burst to (SPEC_PATCH_01).
+// A zero CPU and memory limit means the plan runs on shared infrastructure.
+type ResourceSpec struct {
+	CPURequestMillis   int64 `bson:"cpu_request_millis" json:"cpuRequestMillis"`
+	CPULimitMillis     int64 `bson:"cpu_limit_millis" json:"cpuLimitMillis"`
+	MemoryRequestBytes int64 `bson:"memory_request_bytes" json:"memoryRequestBytes"`
+	MemoryLimitBytes   int64 `bson:"memory_limit_bytes" json:"memoryLimitBytes"`
+	StorageBytes       int64 `bson:"storage_bytes" json:"storageBytes"`
+	Dedicated          bool  `bson:"dedicated" json:"dedicated"` // dedicated cores instead of shared burstable CPU
+}
+
+// Valid reports whether requests stay within limits and nothing is negative
+func (r ResourceSpec) Valid() bool {
+	if r.CPURequestMillis < 0 || r.MemoryRequestBytes < 0 || r.StorageBytes < 0 {
+		return false
+	}
+	return r.CPURequestMillis <= r.CPULimitMillis && r.MemoryRequestBytes <= r.MemoryLimitBytes
+}
+
+// resourceLabels holds the display words for one locale
+type resourceLabels struct {
+	shared, dedicated, sharedRAM, storage string
+	decimal                               string
+}
+
+var resourceLocales = map[string]resourceLabels{
+	"en": {shared: "Shared", dedicated: "Dedicated", sharedRAM: "Shared RAM", storage: "Storage", decimal: "."},
+	"de": {shared: "Geteilt", dedicated: "Dediziert", sharedRAM: "Geteilter RAM", storage: "Speicher", decimal: ","},
+	"hr": {shared: "Dijeljeni", dedicated: "Namjenski", sharedRAM: "Dijeljeni RAM", storage: "Pohrana", decimal: ","},
+}
+
+// Describe renders the marketing limits line for lang (de, en or hr; anything
+// else falls back to en), e.g. "2 vCPU (Dedicated), 4GB RAM, 20GB Storage".
+// CPU is advertised at its burst limit, memory at its hard limit.
+func (r ResourceSpec) Describe(lang string) string {
+	labels, ok := resourceLocales[lang]
+	if !ok {
+		labels = resourceLocales["en"]
+	}
+
+	var parts []string
+	if r.CPULimitMillis > 0 {
+		kind := labels.shared
+		if r.Dedicated {
+			kind = labels.dedicated
+		}
+		parts = append(parts, formatDecimal(r.CPULimitMillis, 1000, labels.decimal)+" vCPU ("+kind+")")
+	}
+	if r.MemoryLimitBytes > 0 {
+		parts = append(parts, formatBytes(r.MemoryLimitBytes, labels.decimal)+" RAM")
+	} else {
+		parts = append(parts, labels.sharedRAM)
+	}
+	if r.StorageBytes > 0 {
+		parts = append(parts, formatBytes(r.StorageBytes, labels.decimal)+" "+labels.storage)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatBytes renders sizes in binary units with the customary GB/MB labels
+func formatBytes(n int64, decimal string) string {
+	if n >= GiB {
+		return formatDecimal(n, GiB, decimal) + "GB"
+	}
+	return formatDecimal(n, MiB, decimal) + "MB"
+}
+
+// formatDecimal renders n/unit with at most one decimal place
+func formatDecimal(n, unit int64, decimal string) string {
+	tenths := (n*10 + unit/2) / unit
+	s := strconv.FormatInt(tenths/10, 10)
+	if frac := tenths % 10; frac != 0 {
+		s += decimal + strconv.FormatInt(frac, 10)
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package model_test
+
+import (
+	"github.com/deicod/dysv/internal/model"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ResourceSpec", func() {
+	starter := model.ResourceSpec{
+		CPURequestMillis:   100,
+		CPULimitMillis:     1000,
+		MemoryRequestBytes: 256 * model.MiB,
+		MemoryLimitBytes:   512 * model.MiB,
+		StorageBytes:       5 * model.GiB,
+	}
+
+	Describe("Describe", func() {
+		It("should advertise burst CPU and the memory limit", func() {
+			Expect(starter.Describe("en")).To(Equal("1 vCPU (Shared), 512MB RAM, 5GB Storage"))
+		})
+
+		It("should mark dedicated cores", func() {
+			pro := model.ResourceSpec{CPURequestMillis: 1000, CPULimitMillis: 2000, MemoryRequestBytes: 2 * model.GiB, MemoryLimitBytes: 4 * model.GiB, StorageBytes: 20 * model.GiB, Dedicated: true}
+			Expect(pro.Describe("en")).To(Equal("2 vCPU (Dedicated), 4GB RAM, 20GB Storage"))
+		})
+
+		It("should describe shared plans without CPU", func() {
+			micro := model.ResourceSpec{StorageBytes: model.GiB}
+			Expect(micro.Describe("en")).To(Equal("Shared RAM, 1GB Storage"))
+		})
+
+		It("should localize labels and decimals", func() {
+			spec := model.ResourceSpec{CPULimitMillis: 1500, MemoryLimitBytes: 1536 * model.MiB, StorageBytes: 5 * model.GiB}
+			Expect(spec.Describe("de")).To(Equal("1,5 vCPU (Geteilt), 1,5GB RAM, 5GB Speicher"))
+			Expect(spec.Describe("hr")).To(Equal("1,5 vCPU (Dijeljeni), 1,5GB RAM, 5GB Pohrana"))
+		})
+
+		It("should fall back to English", func() {
+			Expect(starter.Describe("fr")).To(Equal(starter.Describe("en")))
+		})
+	})
+
+	Describe("Valid", func() {
+		It("should accept requests within limits", func() {
+			Expect(starter.Valid()).To(BeTrue())
+		})
+
+		It("should reject requests above limits", func() {
+			spec := starter
+			spec.CPURequestMillis = 2000
+			Expect(spec.Valid()).To(BeFalse())
+		})
+	})
+})
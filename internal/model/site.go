@@ -0,0 +1,120 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Frameworks a site can be deployed with
+const (
+	FrameworkNextJS = "nextjs"
+	FrameworkNuxt   = "nuxt"
+	FrameworkStatic = "static"
+)
+
+// Frameworks lists the known frameworks with their display names
+var Frameworks = map[string]string{
+	FrameworkNextJS: "Next.js",
+	FrameworkNuxt:   "Nuxt",
+	FrameworkStatic: "Static",
+}
+
+// Regions lists the datacenter regions with their display names
+var Regions = map[string]string{
+	"fsn": "Falkenstein",
+	"nbg": "Nuremberg",
+}
+
+// DefaultRegion is preselected for new sites
+const DefaultRegion = "fsn"
+
+// SiteConfig configures one purchased unit of a plan: every unit is a
+// separate site with its own name, framework, region and optional domain
+type SiteConfig struct {
+	Name      string `bson:"name" json:"name"`           // DNS label, unique within the cart
+	Framework string `bson:"framework" json:"framework"` // one of Frameworks, allowed by the plan
+	Region    string `bson:"region" json:"region"`       // one of Regions
+	Domain    string `bson:"domain,omitempty" json:"domain,omitempty"`
+}
+
+var (
+	siteNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,38}[a-z0-9])?$`)
+	domainPattern   = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+)
+
+// ErrSiteIncomplete is returned by Complete for sites missing required fields
+var ErrSiteIncomplete = errors.New("site configuration incomplete")
+
+// Normalize lowercases and trims all fields
+func (s *SiteConfig) Normalize() {
+	s.Name = strings.ToLower(strings.TrimSpace(s.Name))
+	s.Framework = strings.ToLower(strings.TrimSpace(s.Framework))
+	s.Region = strings.ToLower(strings.TrimSpace(s.Region))
+	s.Domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s.Domain)), ".")
+}
+
+// Validate checks the format of every field that is set. Empty fields are
+// allowed while the cart is being filled; Complete checks for them.
+func (s SiteConfig) Validate() error {
+	if s.Name != "" && !siteNamePattern.MatchString(s.Name) {
+		return fmt.Errorf("name %q must be 1-40 lowercase letters, digits or dashes", s.Name)
+	}
+	if _, ok := Frameworks[s.Framework]; s.Framework != "" && !ok {
+		return fmt.Errorf("unknown framework %q", s.Framework)
+	}
+	if _, ok := Regions[s.Region]; s.Region != "" && !ok {
+		return fmt.Errorf("unknown region %q", s.Region)
+	}
+	if s.Domain != "" && (len(s.Domain) > 253 || !domainPattern.MatchString(s.Domain)) {
+		return fmt.Errorf("invalid domain %q", s.Domain)
+	}
+	return nil
+}
+
+// Complete reports whether the site can be provisioned
+func (s SiteConfig) Complete() error {
+	var missing []string
+	if s.Name == "" {
+		missing = append(missing, "name")
+	}
+	if s.Framework == "" {
+		missing = append(missing, "framework")
+	}
+	if s.Region == "" {
+		missing = append(missing, "region")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing %s", ErrSiteIncomplete, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// AllowsFramework reports whether sites on the plan may use framework. Plans
+// without a framework list allow all of them.
+func (p Plan) AllowsFramework(framework string) bool {
+	if len(p.Frameworks) == 0 {
+		_, ok := Frameworks[framework]
+		return ok
+	}
+	for _, f := range p.Frameworks {
+		if f == framework {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSite returns the initial configuration of a new unit of plan, with the
+// default region and the framework preselected if the plan allows only one
+func (p Plan) NewSite() SiteConfig {
+	site := SiteConfig{Region: DefaultRegion}
+	if len(p.Frameworks) == 1 {
+		site.Framework = p.Frameworks[0]
+	}
+	return site
+}
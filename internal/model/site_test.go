@@ -0,0 +1,65 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package model_test
+
+import (
+	"github.com/deicod/dysv/internal/model"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SiteConfig", func() {
+	Describe("Normalize", func() {
+		It("should lowercase and trim every field", func() {
+			site := model.SiteConfig{Name: " Shop ", Framework: "NextJS", Region: "FSN", Domain: "Example.DE."}
+			site.Normalize()
+			Expect(site).To(Equal(model.SiteConfig{Name: "shop", Framework: "nextjs", Region: "fsn", Domain: "example.de"}))
+		})
+	})
+
+	Describe("Validate", func() {
+		It("should accept partial configurations", func() {
+			Expect(model.SiteConfig{Region: model.DefaultRegion}.Validate()).To(Succeed())
+		})
+
+		It("should reject names that are not DNS labels", func() {
+			Expect(model.SiteConfig{Name: "-shop"}.Validate()).NotTo(Succeed())
+			Expect(model.SiteConfig{Name: "my_shop"}.Validate()).NotTo(Succeed())
+			Expect(model.SiteConfig{Name: "a234567890123456789012345678901234567890x"}.Validate()).NotTo(Succeed())
+			Expect(model.SiteConfig{Name: "my-shop-2"}.Validate()).To(Succeed())
+		})
+
+		It("should reject unknown frameworks, regions and bad domains", func() {
+			Expect(model.SiteConfig{Framework: "rails"}.Validate()).NotTo(Succeed())
+			Expect(model.SiteConfig{Region: "us-east"}.Validate()).NotTo(Succeed())
+			Expect(model.SiteConfig{Domain: "localhost"}.Validate()).NotTo(Succeed())
+			Expect(model.SiteConfig{Domain: "shop.example.de"}.Validate()).To(Succeed())
+		})
+	})
+
+	Describe("Complete", func() {
+		It("should list the missing fields", func() {
+			err := model.SiteConfig{Region: "nbg"}.Complete()
+			Expect(err).To(MatchError(model.ErrSiteIncomplete))
+			Expect(err.Error()).To(ContainSubstring("name, framework"))
+
+			Expect(model.SiteConfig{Name: "shop", Framework: "nuxt", Region: "nbg"}.Complete()).To(Succeed())
+		})
+	})
+
+	Describe("Plan", func() {
+		It("should allow only the listed frameworks", func() {
+			plan := model.Plan{Frameworks: []string{model.FrameworkStatic}}
+			Expect(plan.AllowsFramework(model.FrameworkStatic)).To(BeTrue())
+			Expect(plan.AllowsFramework(model.FrameworkNextJS)).To(BeFalse())
+			Expect(model.Plan{}.AllowsFramework(model.FrameworkNuxt)).To(BeTrue())
+			Expect(model.Plan{}.AllowsFramework("rails")).To(BeFalse())
+		})
+
+		It("should preselect the only allowed framework for new sites", func() {
+			Expect(model.Plan{Frameworks: []string{model.FrameworkStatic}}.NewSite()).To(Equal(model.SiteConfig{Framework: model.FrameworkStatic, Region: model.DefaultRegion}))
+			Expect(model.Plan{Frameworks: []string{model.FrameworkNextJS, model.FrameworkNuxt}}.NewSite().Framework).To(BeEmpty())
+		})
+	})
+})
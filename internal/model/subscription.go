@@ -0,0 +1,24 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Subscription mirrors a Stripe subscription created by checkout
+type Subscription struct {
+	ID                  string        `bson:"_id" json:"id"` // Stripe subscription ID
+	OrderID             bson.ObjectID `bson:"order_id" json:"orderId"`
+	UserID              string        `bson:"user_id" json:"userId"`
+	Email               string        `bson:"email,omitempty" json:"email,omitempty"`
+	Status              string        `bson:"status" json:"status"` // Stripe status: trialing, active, past_due, canceled, ...
+	TrialStart          *time.Time    `bson:"trial_start,omitempty" json:"trialStart,omitempty"`
+	TrialEnd            *time.Time    `bson:"trial_end,omitempty" json:"trialEnd,omitempty"`
+	TrialReminderSentAt *time.Time    `bson:"trial_reminder_sent_at,omitempty" json:"-"`
+	CreatedAt           time.Time     `bson:"created_at" json:"createdAt"`
+	UpdatedAt           time.Time     `bson:"updated_at" json:"updatedAt"`
+}
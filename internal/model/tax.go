@@ -0,0 +1,49 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package model
+
+import "time"
+
+// CustomerType tells private customers from businesses for VAT
+type CustomerType string
+
+const (
+	CustomerPrivate  CustomerType = "private"
+	CustomerBusiness CustomerType = "business"
+)
+
+// TaxTreatment is the VAT rule a sale falls under
+type TaxTreatment string
+
+const (
+	TaxDomestic      TaxTreatment = "domestic"       // customer in the seller's country, its VAT applies
+	TaxOSS           TaxTreatment = "oss"            // EU private customer, destination VAT declared under OSS
+	TaxReverseCharge TaxTreatment = "reverse_charge" // EU business with a VAT ID, the customer accounts for VAT
+	TaxOutsideEU     TaxTreatment = "outside_eu"     // customer outside the EU, no EU VAT
+)
+
+// TaxDecision is the VAT applied to a sale. The zero value charges no tax.
+type TaxDecision struct {
+	Country   string       `bson:"country" json:"country"` // ISO 3166-1 alpha-2 of the billing address
+	Treatment TaxTreatment `bson:"treatment" json:"treatment"`
+	RateBPS   int64        `bson:"rate_bps" json:"rateBps"`
+}
+
+// VATStatus is the outcome of checking a VAT ID with the tax authorities
+type VATStatus string
+
+const (
+	VATValid   VATStatus = "valid"
+	VATInvalid VATStatus = "invalid"
+	VATPending VATStatus = "pending" // the register could not be reached; checked again at checkout
+)
+
+// VATCheck records the check of an address's VAT ID, kept for the tax audit
+type VATCheck struct {
+	VATID              string    `bson:"vat_id" json:"vatId"` // the normalized ID that was checked
+	Status             VATStatus `bson:"status" json:"status"`
+	ConsultationNumber string    `bson:"consultation_number,omitempty" json:"consultationNumber,omitempty"` // VIES request identifier
+	Name               string    `bson:"name,omitempty" json:"name,omitempty"`                              // trader name as registered
+	CheckedAt          time.Time `bson:"checked_at" json:"checkedAt"`
+}
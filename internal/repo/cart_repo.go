@@ -13,6 +13,7 @@ import (
 	"github.com/deicod/dysv/internal/model"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 // Ensure CartRepo implements CartRepository
@@ -32,13 +33,54 @@ func NewCartRepo(db *mongo.Database, timeout time.Duration) *CartRepo {
 	}
 }
 
-// FindBySessionID finds a cart by session ID
+// ttlIndexName names the index that expires idle carts
+const ttlIndexName = "updated_at_ttl"
+
+// EnsureIndexes creates the cart lookup indexes and, for ttl > 0, a TTL
+// index that lets MongoDB delete carts ttl after their last change. An
+// existing TTL index is adjusted to ttl.
+func (r *CartRepo) EnsureIndexes(ctx context.Context, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "session_id", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "restore_token", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	if err != nil {
+		return fmt.Errorf("create cart indexes: %w", err)
+	}
+	if ttl <= 0 {
+		return nil
+	}
+
+	seconds := int32(ttl / time.Second)
+	_, err = r.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "updated_at", Value: 1}},
+		Options: options.Index().SetName(ttlIndexName).SetExpireAfterSeconds(seconds),
+	})
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Name == "IndexOptionsConflict" {
+		err = r.coll.Database().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: r.coll.Name()},
+			{Key: "index", Value: bson.D{{Key: "name", Value: ttlIndexName}, {Key: "expireAfterSeconds", Value: seconds}}},
+		}).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("create cart TTL index: %w", err)
+	}
+	return nil
+}
+
+// FindBySessionID finds the anonymous cart of a session. Carts that belong
+// to a user are only found through FindByUserID.
 func (r *CartRepo) FindBySessionID(ctx context.Context, sessionID string) (*model.Cart, error) {
 	ctx, cancel := context.WithTimeout(ctx, r.timeout)
 	defer cancel()
 
 	var cart model.Cart
-	err := r.coll.FindOne(ctx, bson.M{"session_id": sessionID}).Decode(&cart)
+	err := r.coll.FindOne(ctx, bson.M{"session_id": sessionID, "user_id": bson.M{"$exists": false}}).Decode(&cart)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, ErrNotFound
@@ -49,6 +91,24 @@ func (r *CartRepo) FindBySessionID(ctx context.Context, sessionID string) (*mode
 	return &cart, nil
 }
 
+// FindByUserID finds the most recently updated cart of a user
+func (r *CartRepo) FindByUserID(ctx context.Context, userID string) (*model.Cart, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+	var cart model.Cart
+	err := r.coll.FindOne(ctx, bson.M{"user_id": userID}, opts).Decode(&cart)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		fmt.Printf("Repo: FindByUserID error: %v\n", err)
+		return nil, err
+	}
+	return &cart, nil
+}
+
 // Create inserts a new cart
 func (r *CartRepo) Create(ctx context.Context, cart *model.Cart) error {
 	ctx, cancel := context.WithTimeout(ctx, r.timeout)
@@ -63,18 +123,118 @@ func (r *CartRepo) Create(ctx context.Context, cart *model.Cart) error {
 	return nil
 }
 
-// Update replaces an existing cart
+// Update replaces an existing cart if it still has the version it was read
+// with, and increments the version. Returns ErrConflict if another write got
+// there first; reload and retry in that case.
 func (r *CartRepo) Update(ctx context.Context, cart *model.Cart) error {
 	ctx, cancel := context.WithTimeout(ctx, r.timeout)
 	defer cancel()
 
 	spew.Dump("Repo Update Cart", cart)
-	// fmt.Printf("Repo: Updating cart %s\n", cart.ID.Hex())
-	_, err := r.coll.ReplaceOne(ctx, bson.M{"_id": cart.ID}, cart)
+	filter := bson.M{"_id": cart.ID, "version": cart.Version}
+	if cart.Version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}} // carts stored before versioning
+	}
+
+	cart.Version++
+	result, err := r.coll.ReplaceOne(ctx, filter, cart)
 	if err != nil {
+		cart.Version--
 		fmt.Printf("Repo: ReplaceOne error: %v\n", err)
+		return err
 	}
-	return err
+	if result.MatchedCount == 0 {
+		cart.Version--
+		return ErrConflict
+	}
+	return nil
+}
+
+// Delete removes a cart
+func (r *CartRepo) Delete(ctx context.Context, cartID bson.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.coll.DeleteOne(ctx, bson.M{"_id": cartID})
+	if err != nil {
+		fmt.Printf("Repo: Delete error: %v\n", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteStale removes carts last updated before updatedBefore
+func (r *CartRepo) DeleteStale(ctx context.Context, updatedBefore time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.coll.DeleteMany(ctx, bson.M{"updated_at": bson.M{"$lt": updatedBefore}})
+	if err != nil {
+		fmt.Printf("Repo: DeleteStale error: %v\n", err)
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// FindReminderDue finds non-empty user carts opted in to reminders that were
+// last updated before updatedBefore and have not been reminded since
+func (r *CartRepo) FindReminderDue(ctx context.Context, updatedBefore time.Time) ([]model.Cart, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cursor, err := r.coll.Find(ctx, bson.M{
+		"user_id":          bson.M{"$exists": true},
+		"reminder_email":   bson.M{"$exists": true},
+		"reminder_sent_at": bson.M{"$exists": false},
+		"items.0":          bson.M{"$exists": true},
+		"updated_at":       bson.M{"$lt": updatedBefore},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var carts []model.Cart
+	if err := cursor.All(ctx, &carts); err != nil {
+		return nil, err
+	}
+	return carts, nil
+}
+
+// MarkReminded records a sent reminder and its restore token without
+// touching updated_at, so the cart keeps its expiry
+func (r *CartRepo) MarkReminded(ctx context.Context, cartID bson.ObjectID, restoreToken string, at time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.coll.UpdateOne(ctx,
+		bson.M{"_id": cartID},
+		bson.M{"$set": bson.M{"reminder_sent_at": at, "restore_token": restoreToken}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// FindByRestoreToken finds the cart a reminder link points to
+func (r *CartRepo) FindByRestoreToken(ctx context.Context, token string) (*model.Cart, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var cart model.Cart
+	err := r.coll.FindOne(ctx, bson.M{"restore_token": token}).Decode(&cart)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &cart, nil
 }
 
 // DeleteItem removes an item from a cart by item ID
@@ -84,7 +244,7 @@ func (r *CartRepo) DeleteItem(ctx context.Context, cartID bson.ObjectID, itemID
 
 	_, err := r.coll.UpdateOne(ctx,
 		bson.M{"_id": cartID},
-		bson.M{"$pull": bson.M{"items": bson.M{"item_id": itemID}}},
+		bson.M{"$pull": bson.M{"items": bson.M{"item_id": itemID}}, "$inc": bson.M{"version": 1}},
 	)
 	if err != nil {
 		fmt.Printf("Repo: DeleteItem error: %v\n", err)
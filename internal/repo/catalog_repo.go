@@ -0,0 +1,229 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Ensure CatalogRepo implements CatalogRepository
+var _ CatalogRepository = (*CatalogRepo)(nil)
+
+// CatalogRepo is the MongoDB implementation of CatalogRepository
+type CatalogRepo struct {
+	plans   *mongo.Collection
+	addons  *mongo.Collection
+	cycles  *mongo.Collection
+	timeout time.Duration
+}
+
+// NewCatalogRepo creates a new catalog repository
+func NewCatalogRepo(db *mongo.Database, timeout time.Duration) *CatalogRepo {
+	return &CatalogRepo{
+		plans:   db.Collection("plans"),
+		addons:  db.Collection("addons"),
+		cycles:  db.Collection("billing_cycles"),
+		timeout: timeout,
+	}
+}
+
+// ListPlans returns all plans ordered by sort order
+func (r *CatalogRepo) ListPlans(ctx context.Context) ([]model.Plan, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "sort_order", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.plans.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		fmt.Printf("CatalogRepo: ListPlans error: %v\n", err)
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	plans := []model.Plan{}
+	if err := cursor.All(ctx, &plans); err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+// FindPlan finds a plan by ID
+func (r *CatalogRepo) FindPlan(ctx context.Context, id string) (*model.Plan, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var plan model.Plan
+	err := r.plans.FindOne(ctx, bson.M{"_id": id}).Decode(&plan)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		fmt.Printf("CatalogRepo: FindPlan error: %v\n", err)
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// UpsertPlan inserts or replaces a plan
+func (r *CatalogRepo) UpsertPlan(ctx context.Context, plan *model.Plan) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.plans.ReplaceOne(ctx, bson.M{"_id": plan.ID}, plan, options.Replace().SetUpsert(true))
+	if err != nil {
+		fmt.Printf("CatalogRepo: UpsertPlan error: %v\n", err)
+	}
+	return err
+}
+
+// DeletePlan removes a plan by ID
+func (r *CatalogRepo) DeletePlan(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.plans.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListAddons returns all addons ordered by sort order
+func (r *CatalogRepo) ListAddons(ctx context.Context) ([]model.Addon, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "sort_order", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.addons.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		fmt.Printf("CatalogRepo: ListAddons error: %v\n", err)
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	addons := []model.Addon{}
+	if err := cursor.All(ctx, &addons); err != nil {
+		return nil, err
+	}
+	return addons, nil
+}
+
+// FindAddon finds an addon by ID
+func (r *CatalogRepo) FindAddon(ctx context.Context, id string) (*model.Addon, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var addon model.Addon
+	err := r.addons.FindOne(ctx, bson.M{"_id": id}).Decode(&addon)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		fmt.Printf("CatalogRepo: FindAddon error: %v\n", err)
+		return nil, err
+	}
+	return &addon, nil
+}
+
+// UpsertAddon inserts or replaces an addon
+func (r *CatalogRepo) UpsertAddon(ctx context.Context, addon *model.Addon) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.addons.ReplaceOne(ctx, bson.M{"_id": addon.ID}, addon, options.Replace().SetUpsert(true))
+	if err != nil {
+		fmt.Printf("CatalogRepo: UpsertAddon error: %v\n", err)
+	}
+	return err
+}
+
+// DeleteAddon removes an addon by ID
+func (r *CatalogRepo) DeleteAddon(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.addons.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListCycles returns all billing cycles ordered by sort order
+func (r *CatalogRepo) ListCycles(ctx context.Context) ([]model.BillingCycleDef, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "sort_order", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.cycles.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		fmt.Printf("CatalogRepo: ListCycles error: %v\n", err)
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	cycles := []model.BillingCycleDef{}
+	if err := cursor.All(ctx, &cycles); err != nil {
+		return nil, err
+	}
+	return cycles, nil
+}
+
+// FindCycle finds a billing cycle by ID
+func (r *CatalogRepo) FindCycle(ctx context.Context, id model.BillingCycle) (*model.BillingCycleDef, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var cycle model.BillingCycleDef
+	err := r.cycles.FindOne(ctx, bson.M{"_id": id}).Decode(&cycle)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		fmt.Printf("CatalogRepo: FindCycle error: %v\n", err)
+		return nil, err
+	}
+	return &cycle, nil
+}
+
+// UpsertCycle inserts or replaces a billing cycle
+func (r *CatalogRepo) UpsertCycle(ctx context.Context, cycle *model.BillingCycleDef) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.cycles.ReplaceOne(ctx, bson.M{"_id": cycle.ID}, cycle, options.Replace().SetUpsert(true))
+	if err != nil {
+		fmt.Printf("CatalogRepo: UpsertCycle error: %v\n", err)
+	}
+	return err
+}
+
+// DeleteCycle removes a billing cycle by ID
+func (r *CatalogRepo) DeleteCycle(ctx context.Context, id model.BillingCycle) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.cycles.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
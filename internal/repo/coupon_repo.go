@@ -0,0 +1,233 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Ensure CouponRepo implements CouponRepository
+var _ CouponRepository = (*CouponRepo)(nil)
+
+// CouponRepo is the MongoDB implementation of CouponRepository
+type CouponRepo struct {
+	coupons     *mongo.Collection
+	redemptions *mongo.Collection
+	timeout     time.Duration
+}
+
+// NewCouponRepo creates a new coupon repository
+func NewCouponRepo(db *mongo.Database, timeout time.Duration) *CouponRepo {
+	return &CouponRepo{
+		coupons:     db.Collection("coupons"),
+		redemptions: db.Collection("coupon_redemptions"),
+		timeout:     timeout,
+	}
+}
+
+// ListCoupons returns all coupons ordered by code
+func (r *CouponRepo) ListCoupons(ctx context.Context) ([]model.Coupon, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cursor, err := r.coupons.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		fmt.Printf("CouponRepo: ListCoupons error: %v\n", err)
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	coupons := []model.Coupon{}
+	if err := cursor.All(ctx, &coupons); err != nil {
+		return nil, err
+	}
+	return coupons, nil
+}
+
+// FindCoupon finds a coupon by code
+func (r *CouponRepo) FindCoupon(ctx context.Context, code string) (*model.Coupon, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var coupon model.Coupon
+	err := r.coupons.FindOne(ctx, bson.M{"_id": code}).Decode(&coupon)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		fmt.Printf("CouponRepo: FindCoupon error: %v\n", err)
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// UpsertCoupon creates or replaces a coupon, keeping its redemption counts
+func (r *CouponRepo) UpsertCoupon(ctx context.Context, coupon *model.Coupon) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	doc, err := bson.Marshal(coupon)
+	if err != nil {
+		return err
+	}
+	var fields bson.M
+	if err := bson.Unmarshal(doc, &fields); err != nil {
+		return err
+	}
+	delete(fields, "_id")
+	delete(fields, "redemptions")
+	delete(fields, "reserved")
+
+	_, err = r.coupons.UpdateOne(ctx,
+		bson.M{"_id": coupon.Code},
+		bson.M{"$set": fields, "$setOnInsert": bson.M{"redemptions": 0, "reserved": 0}},
+		options.UpdateOne().SetUpsert(true),
+	)
+	if err != nil {
+		fmt.Printf("CouponRepo: UpsertCoupon error: %v\n", err)
+	}
+	return err
+}
+
+// DeleteCoupon removes a coupon by code; its redemptions are kept
+func (r *CouponRepo) DeleteCoupon(ctx context.Context, code string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.coupons.DeleteOne(ctx, bson.M{"_id": code})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CountRedemptions counts the paid redemptions of code by userID
+func (r *CouponRepo) CountRedemptions(ctx context.Context, code, userID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return r.redemptions.CountDocuments(ctx, bson.M{"code": code, "user_id": userID, "status": bson.M{"$ne": model.RedemptionReserved}})
+}
+
+// ReserveRedemption holds a redemption for the open checkout of an order.
+// Paid and reserved redemptions together stay within the coupon's
+// MaxRedemptions, and within maxPerUser (0 for unlimited) for the user;
+// reserved is false if a limit is reached. An order keeps a redemption it
+// already holds.
+func (r *CouponRepo) ReserveRedemption(ctx context.Context, redemption *model.CouponRedemption, maxPerUser int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	redemption.Status = model.RedemptionReserved
+	if _, err := r.redemptions.InsertOne(ctx, redemption); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return true, nil
+		}
+		fmt.Printf("CouponRepo: ReserveRedemption error: %v\n", err)
+		return false, err
+	}
+
+	// Counted after the insert, so concurrent reservations see each other
+	if maxPerUser > 0 {
+		n, err := r.redemptions.CountDocuments(ctx, bson.M{"code": redemption.Code, "user_id": redemption.UserID})
+		if err != nil || n > int64(maxPerUser) {
+			return false, errors.Join(err, r.dropReservation(ctx, redemption.OrderID))
+		}
+	}
+
+	// The limit is checked and the reservation counted in one update
+	result, err := r.coupons.UpdateOne(ctx, bson.M{
+		"_id": redemption.Code,
+		"$or": bson.A{
+			bson.M{"max_redemptions": 0},
+			bson.M{"$expr": bson.M{"$lt": bson.A{
+				bson.M{"$add": bson.A{"$redemptions", bson.M{"$ifNull": bson.A{"$reserved", 0}}}},
+				"$max_redemptions",
+			}}},
+		},
+	}, bson.M{"$inc": bson.M{"reserved": 1}})
+	if err != nil || result.MatchedCount == 0 {
+		return false, errors.Join(err, r.dropReservation(ctx, redemption.OrderID))
+	}
+	return true, nil
+}
+
+// dropReservation removes a reservation that was not counted on its coupon
+func (r *CouponRepo) dropReservation(ctx context.Context, orderID bson.ObjectID) error {
+	_, err := r.redemptions.DeleteOne(ctx, bson.M{"_id": orderID, "status": model.RedemptionReserved})
+	return err
+}
+
+// RecordRedemption redeems the reservation of a paid order, or records a
+// redemption if the order held none, and counts it on the coupon. An order
+// is only counted once; recorded reports whether this call counted it.
+func (r *CouponRepo) RecordRedemption(ctx context.Context, redemption *model.CouponRedemption) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.redemptions.UpdateOne(ctx,
+		bson.M{"_id": redemption.OrderID, "status": model.RedemptionReserved},
+		bson.M{"$set": bson.M{"status": model.RedemptionRedeemed, "redeemed_at": redemption.RedeemedAt}},
+	)
+	if err != nil {
+		fmt.Printf("CouponRepo: RecordRedemption error: %v\n", err)
+		return false, err
+	}
+	if result.ModifiedCount == 1 {
+		_, err := r.coupons.UpdateOne(ctx,
+			bson.M{"_id": redemption.Code},
+			bson.M{"$inc": bson.M{"reserved": -1, "redemptions": 1}},
+		)
+		return true, err
+	}
+
+	redemption.Status = model.RedemptionRedeemed
+	if _, err := r.redemptions.InsertOne(ctx, redemption); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		fmt.Printf("CouponRepo: RecordRedemption error: %v\n", err)
+		return false, err
+	}
+
+	_, err = r.coupons.UpdateOne(ctx,
+		bson.M{"_id": redemption.Code},
+		bson.M{"$inc": bson.M{"redemptions": 1}},
+	)
+	return true, err
+}
+
+// ReleaseRedemption gives back the reservation of an order whose checkout
+// ended unpaid; released reports whether it held one
+func (r *CouponRepo) ReleaseRedemption(ctx context.Context, orderID bson.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var released model.CouponRedemption
+	err := r.redemptions.FindOneAndDelete(ctx, bson.M{"_id": orderID, "status": model.RedemptionReserved}).Decode(&released)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		fmt.Printf("CouponRepo: ReleaseRedemption error: %v\n", err)
+		return false, err
+	}
+
+	_, err = r.coupons.UpdateOne(ctx,
+		bson.M{"_id": released.Code},
+		bson.M{"$inc": bson.M{"reserved": -1}},
+	)
+	return true, err
+}
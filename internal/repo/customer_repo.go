@@ -0,0 +1,84 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Ensure CustomerRepo implements CustomerRepository
+var _ CustomerRepository = (*CustomerRepo)(nil)
+
+// CustomerRepo is the MongoDB implementation of CustomerRepository
+type CustomerRepo struct {
+	coll    *mongo.Collection
+	timeout time.Duration
+}
+
+// NewCustomerRepo creates a new Stripe customer repository
+func NewCustomerRepo(db *mongo.Database, timeout time.Duration) *CustomerRepo {
+	return &CustomerRepo{
+		coll:    db.Collection("customers"),
+		timeout: timeout,
+	}
+}
+
+// FindByUserID finds the Stripe customer linked to a user
+func (r *CustomerRepo) FindByUserID(ctx context.Context, userID string) (*model.Customer, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var customer model.Customer
+	if err := r.coll.FindOne(ctx, bson.M{"_id": userID}).Decode(&customer); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		fmt.Printf("CustomerRepo: FindByUserID error: %v\n", err)
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// Create links a Stripe customer to a user. Returns ErrConflict if the user
+// already has one.
+func (r *CustomerRepo) Create(ctx context.Context, customer *model.Customer) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	if _, err := r.coll.InsertOne(ctx, customer); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrConflict
+		}
+		fmt.Printf("CustomerRepo: InsertOne error: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateSynced records the email and billing address last synced to Stripe
+func (r *CustomerRepo) UpdateSynced(ctx context.Context, customer *model.Customer) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.coll.UpdateOne(ctx,
+		bson.M{"_id": customer.UserID},
+		bson.M{"$set": bson.M{
+			"email":        customer.Email,
+			"address_id":   customer.AddressID,
+			"address_hash": customer.AddressHash,
+			"updated_at":   customer.UpdatedAt,
+		}},
+	)
+	if err != nil {
+		fmt.Printf("CustomerRepo: UpdateSynced error: %v\n", err)
+	}
+	return err
+}
@@ -5,5 +5,9 @@ package repo
 
 import "errors"
 
-// ErrNotFound is returned when a document is not found
-var ErrNotFound = errors.New("not found")
+var (
+	// ErrNotFound is returned when a document is not found
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a document changed since it was read
+	ErrConflict = errors.New("version conflict")
+)
@@ -5,6 +5,7 @@ package repo
 
 import (
 	"context"
+	"time"
 
 	"github.com/deicod/dysv/internal/model"
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -12,17 +13,79 @@ import (
 
 // CartRepository defines the interface for cart persistence
 type CartRepository interface {
-	FindBySessionID(ctx context.Context, sessionID string) (*model.Cart, error)
+	FindBySessionID(ctx context.Context, sessionID string) (*model.Cart, error) // anonymous carts only
+	FindByUserID(ctx context.Context, userID string) (*model.Cart, error)
 	Create(ctx context.Context, cart *model.Cart) error
 	Update(ctx context.Context, cart *model.Cart) error
+	Delete(ctx context.Context, cartID bson.ObjectID) error
 	DeleteItem(ctx context.Context, cartID bson.ObjectID, itemID string) error
+	DeleteStale(ctx context.Context, updatedBefore time.Time) (int64, error)
+	FindReminderDue(ctx context.Context, updatedBefore time.Time) ([]model.Cart, error)
+	MarkReminded(ctx context.Context, cartID bson.ObjectID, restoreToken string, at time.Time) error
+	FindByRestoreToken(ctx context.Context, token string) (*model.Cart, error)
 }
 
 // OrderRepository defines the interface for order persistence
 type OrderRepository interface {
 	Create(ctx context.Context, order *model.Order) error
 	FindByStripeSessionID(ctx context.Context, stripeSessionID string) (*model.Order, error)
+	FindByID(ctx context.Context, id bson.ObjectID) (*model.Order, error)
 	UpdateStatus(ctx context.Context, orderID bson.ObjectID, status string) error
+	HasTrial(ctx context.Context, userID, exceptCheckoutHash string, openAt time.Time) (bool, error)
+	StartTrial(ctx context.Context, orderID bson.ObjectID, start, end time.Time) error
+	FindByIdempotencyKey(ctx context.Context, userID, key string) (*model.Order, error)
+	FindOpenCheckout(ctx context.Context, userID, checkoutHash string, openUntil time.Time) (*model.Order, error)
+	AttachCheckout(ctx context.Context, orderID bson.ObjectID, stripeSessionID, url string, expiresAt time.Time) error
+	Delete(ctx context.Context, orderID bson.ObjectID) error
+	DeleteAbandoned(ctx context.Context, orderID bson.ObjectID, createdBefore time.Time) (bool, error)
+}
+
+// SubscriptionRepository defines the interface for subscription persistence
+type SubscriptionRepository interface {
+	Upsert(ctx context.Context, sub *model.Subscription) error
+	FindByID(ctx context.Context, id string) (*model.Subscription, error)
+	MarkTrialReminded(ctx context.Context, id string, at time.Time) (bool, error)
+	UnmarkTrialReminded(ctx context.Context, id string, at time.Time) error
+}
+
+// CustomerRepository defines the interface for the users' Stripe customer links
+type CustomerRepository interface {
+	FindByUserID(ctx context.Context, userID string) (*model.Customer, error)
+	Create(ctx context.Context, customer *model.Customer) error
+	UpdateSynced(ctx context.Context, customer *model.Customer) error
+}
+
+// QuoteRepository defines the interface for saved quote persistence
+type QuoteRepository interface {
+	Create(ctx context.Context, quote *model.SavedQuote) error
+	FindByID(ctx context.Context, id bson.ObjectID) (*model.SavedQuote, error)
+}
+
+// CouponRepository defines the interface for coupon and redemption persistence
+type CouponRepository interface {
+	ListCoupons(ctx context.Context) ([]model.Coupon, error)
+	FindCoupon(ctx context.Context, code string) (*model.Coupon, error)
+	UpsertCoupon(ctx context.Context, coupon *model.Coupon) error
+	DeleteCoupon(ctx context.Context, code string) error
+	CountRedemptions(ctx context.Context, code, userID string) (int64, error)
+	ReserveRedemption(ctx context.Context, redemption *model.CouponRedemption, maxPerUser int) (bool, error)
+	RecordRedemption(ctx context.Context, redemption *model.CouponRedemption) (bool, error)
+	ReleaseRedemption(ctx context.Context, orderID bson.ObjectID) (bool, error)
+}
+
+// ReferralRepository defines the interface for referral and account credit persistence
+type ReferralRepository interface {
+	CreateCode(ctx context.Context, code *model.ReferralCode) error
+	FindCode(ctx context.Context, code string) (*model.ReferralCode, error)
+	FindCodeByUser(ctx context.Context, userID string) (*model.ReferralCode, error)
+	CreateReferral(ctx context.Context, referral *model.Referral) error
+	FindReferral(ctx context.Context, refereeID string) (*model.Referral, error)
+	ListReferrals(ctx context.Context, referrerID string) ([]model.Referral, error)
+	ResolveReferral(ctx context.Context, referral *model.Referral) (bool, error)
+	AddCredit(ctx context.Context, entry *model.CreditEntry) (bool, error)
+	CreditBalances(ctx context.Context, userID string) (model.PriceTable, error)
+	SettleCredit(ctx context.Context, id string) (bool, error)
+	ReleaseCredit(ctx context.Context, id string) (bool, error)
 }
 
 // AddressRepository defines the interface for address persistence
@@ -34,3 +97,19 @@ type AddressRepository interface {
 	Delete(ctx context.Context, id, userID string) error
 	UnsetDefaults(ctx context.Context, userID string) error
 }
+
+// CatalogRepository defines the interface for plan, addon and billing cycle persistence
+type CatalogRepository interface {
+	ListPlans(ctx context.Context) ([]model.Plan, error)
+	FindPlan(ctx context.Context, id string) (*model.Plan, error)
+	UpsertPlan(ctx context.Context, plan *model.Plan) error
+	DeletePlan(ctx context.Context, id string) error
+	ListAddons(ctx context.Context) ([]model.Addon, error)
+	FindAddon(ctx context.Context, id string) (*model.Addon, error)
+	UpsertAddon(ctx context.Context, addon *model.Addon) error
+	DeleteAddon(ctx context.Context, id string) error
+	ListCycles(ctx context.Context) ([]model.BillingCycleDef, error)
+	FindCycle(ctx context.Context, id model.BillingCycle) (*model.BillingCycleDef, error)
+	UpsertCycle(ctx context.Context, cycle *model.BillingCycleDef) error
+	DeleteCycle(ctx context.Context, id model.BillingCycle) error
+}
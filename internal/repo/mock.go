@@ -5,7 +5,9 @@ package repo
 
 import (
 	"context"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/deicod/dysv/internal/model"
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -17,25 +19,47 @@ var _ CartRepository = (*MockCartRepo)(nil)
 // MockCartRepo is an in-memory implementation for testing
 type MockCartRepo struct {
 	mu    sync.RWMutex
-	carts map[string]*model.Cart
+	carts map[bson.ObjectID]*model.Cart
 }
 
 // NewMockCartRepo creates a new mock cart repository
 func NewMockCartRepo() *MockCartRepo {
 	return &MockCartRepo{
-		carts: make(map[string]*model.Cart),
+		carts: make(map[bson.ObjectID]*model.Cart),
 	}
 }
 
 func (m *MockCartRepo) FindBySessionID(ctx context.Context, sessionID string) (*model.Cart, error) {
+	return m.find(func(cart *model.Cart) bool {
+		return cart.SessionID == sessionID && cart.UserID == ""
+	})
+}
+
+func (m *MockCartRepo) FindByUserID(ctx context.Context, userID string) (*model.Cart, error) {
+	return m.find(func(cart *model.Cart) bool {
+		return cart.UserID == userID
+	})
+}
+
+// find returns a copy of the most recently updated cart matching match
+func (m *MockCartRepo) find(match func(*model.Cart) bool) (*model.Cart, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	cart, ok := m.carts[sessionID]
-	if !ok {
+	var found *model.Cart
+	for _, cart := range m.carts {
+		if match(cart) && (found == nil || cart.UpdatedAt.After(found.UpdatedAt)) {
+			found = cart
+		}
+	}
+	if found == nil {
 		return nil, ErrNotFound
 	}
-	return cart, nil
+	c, err := bsonCopy(*found)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
 }
 
 func (m *MockCartRepo) Create(ctx context.Context, cart *model.Cart) error {
@@ -43,15 +67,42 @@ func (m *MockCartRepo) Create(ctx context.Context, cart *model.Cart) error {
 	defer m.mu.Unlock()
 
 	cart.ID = bson.NewObjectID()
-	m.carts[cart.SessionID] = cart
+	c, err := bsonCopy(*cart)
+	if err != nil {
+		return err
+	}
+	m.carts[cart.ID] = &c
 	return nil
 }
 
+// Update enforces the same version check as CartRepo.Update
 func (m *MockCartRepo) Update(ctx context.Context, cart *model.Cart) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.carts[cart.SessionID] = cart
+	stored, ok := m.carts[cart.ID]
+	if !ok || stored.Version != cart.Version {
+		return ErrConflict
+	}
+
+	c, err := bsonCopy(*cart)
+	if err != nil {
+		return err
+	}
+	c.Version++
+	cart.Version++
+	m.carts[cart.ID] = &c
+	return nil
+}
+
+func (m *MockCartRepo) Delete(ctx context.Context, cartID bson.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.carts[cartID]; !ok {
+		return ErrNotFound
+	}
+	delete(m.carts, cartID)
 	return nil
 }
 
@@ -68,17 +119,79 @@ func (m *MockCartRepo) DeleteItem(ctx context.Context, cartID bson.ObjectID, ite
 				}
 			}
 			cart.Items = newItems
+			cart.Version++
 			break
 		}
 	}
 	return nil
 }
 
+func (m *MockCartRepo) DeleteStale(ctx context.Context, updatedBefore time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int64
+	for id, cart := range m.carts {
+		if cart.UpdatedAt.Before(updatedBefore) {
+			delete(m.carts, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MockCartRepo) FindReminderDue(ctx context.Context, updatedBefore time.Time) ([]model.Cart, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var carts []model.Cart
+	for _, cart := range m.carts {
+		if cart.UserID != "" && cart.ReminderEmail != "" && cart.ReminderSentAt == nil &&
+			len(cart.Items) > 0 && cart.UpdatedAt.Before(updatedBefore) {
+			c, err := bsonCopy(*cart)
+			if err != nil {
+				return nil, err
+			}
+			carts = append(carts, c)
+		}
+	}
+	sort.Slice(carts, func(i, j int) bool { return carts[i].UpdatedAt.Before(carts[j].UpdatedAt) })
+	return carts, nil
+}
+
+func (m *MockCartRepo) MarkReminded(ctx context.Context, cartID bson.ObjectID, restoreToken string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cart, ok := m.carts[cartID]
+	if !ok {
+		return ErrNotFound
+	}
+	cart.ReminderSentAt = &at
+	cart.RestoreToken = restoreToken
+	return nil
+}
+
+func (m *MockCartRepo) FindByRestoreToken(ctx context.Context, token string) (*model.Cart, error) {
+	return m.find(func(cart *model.Cart) bool {
+		return token != "" && cart.RestoreToken == token
+	})
+}
+
+// Touch backdates a cart's last change (for expiry and reminder tests)
+func (m *MockCartRepo) Touch(cartID bson.ObjectID, updatedAt time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cart, ok := m.carts[cartID]; ok {
+		cart.UpdatedAt = updatedAt
+	}
+}
+
 // Reset clears all data (for test cleanup)
 func (m *MockCartRepo) Reset() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.carts = make(map[string]*model.Cart)
+	m.carts = make(map[bson.ObjectID]*model.Cart)
 }
 
 // Ensure MockOrderRepo implements OrderRepository
@@ -87,46 +200,158 @@ var _ OrderRepository = (*MockOrderRepo)(nil)
 // MockOrderRepo is an in-memory implementation for testing
 type MockOrderRepo struct {
 	mu     sync.RWMutex
-	orders map[string]*model.Order // keyed by StripeSessionID
+	orders map[bson.ObjectID]*model.Order
 }
 
 // NewMockOrderRepo creates a new mock order repository
 func NewMockOrderRepo() *MockOrderRepo {
 	return &MockOrderRepo{
-		orders: make(map[string]*model.Order),
+		orders: make(map[bson.ObjectID]*model.Order),
 	}
 }
 
+// Create enforces the same ID and idempotency key uniqueness as
+// OrderRepo.Create
 func (m *MockOrderRepo) Create(ctx context.Context, order *model.Order) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	order.ID = bson.NewObjectID()
-	m.orders[order.StripeSessionID] = order
+	if _, ok := m.orders[order.ID]; ok && !order.ID.IsZero() {
+		return ErrConflict
+	}
+	if order.IdempotencyKey != "" {
+		for _, existing := range m.orders {
+			if existing.UserID == order.UserID && existing.IdempotencyKey == order.IdempotencyKey {
+				return ErrConflict
+			}
+		}
+	}
+	if order.ID.IsZero() {
+		order.ID = bson.NewObjectID()
+	}
+	m.orders[order.ID] = order
 	return nil
 }
 
-func (m *MockOrderRepo) FindByStripeSessionID(ctx context.Context, stripeSessionID string) (*model.Order, error) {
+func (m *MockOrderRepo) FindByID(ctx context.Context, id bson.ObjectID) (*model.Order, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	order, ok := m.orders[stripeSessionID]
+	order, ok := m.orders[id]
 	if !ok {
 		return nil, ErrNotFound
 	}
 	return order, nil
 }
 
-func (m *MockOrderRepo) UpdateStatus(ctx context.Context, orderID bson.ObjectID, status string) error {
+func (m *MockOrderRepo) HasTrial(ctx context.Context, userID, exceptCheckoutHash string, openAt time.Time) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, order := range m.orders {
+		if order.UserID != userID {
+			continue
+		}
+		if order.TrialStart != nil {
+			return true, nil
+		}
+		if order.Status == "pending" && order.TrialDays > 0 && order.CheckoutHash != exceptCheckoutHash &&
+			order.CheckoutExpiresAt != nil && order.CheckoutExpiresAt.After(openAt) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockOrderRepo) StartTrial(ctx context.Context, orderID bson.ObjectID, start, end time.Time) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if order, ok := m.orders[orderID]; ok && order.TrialStart == nil {
+		order.TrialStart, order.TrialEnd = &start, &end
+	}
+	return nil
+}
+
+func (m *MockOrderRepo) FindByStripeSessionID(ctx context.Context, stripeSessionID string) (*model.Order, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	for _, order := range m.orders {
-		if order.ID == orderID {
-			order.Status = status
-			break
+		if order.StripeSessionID == stripeSessionID {
+			return order, nil
 		}
 	}
+	return nil, ErrNotFound
+}
+
+func (m *MockOrderRepo) FindByIdempotencyKey(ctx context.Context, userID, key string) (*model.Order, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, order := range m.orders {
+		if order.UserID == userID && order.IdempotencyKey == key {
+			return order, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MockOrderRepo) FindOpenCheckout(ctx context.Context, userID, checkoutHash string, openUntil time.Time) (*model.Order, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var found *model.Order
+	for _, order := range m.orders {
+		if order.UserID == userID && order.CheckoutHash == checkoutHash && order.Status == "pending" &&
+			order.CheckoutURL != "" && order.CheckoutExpiresAt != nil && order.CheckoutExpiresAt.After(openUntil) &&
+			(found == nil || order.CreatedAt.After(found.CreatedAt)) {
+			found = order
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
+
+func (m *MockOrderRepo) AttachCheckout(ctx context.Context, orderID bson.ObjectID, stripeSessionID, url string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if order, ok := m.orders[orderID]; ok {
+		order.StripeSessionID, order.CheckoutURL, order.CheckoutExpiresAt = stripeSessionID, url, &expiresAt
+	}
+	return nil
+}
+
+func (m *MockOrderRepo) Delete(ctx context.Context, orderID bson.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.orders, orderID)
+	return nil
+}
+
+func (m *MockOrderRepo) DeleteAbandoned(ctx context.Context, orderID bson.ObjectID, createdBefore time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.orders[orderID]
+	if !ok || order.CheckoutURL != "" || !order.CreatedAt.Before(createdBefore) {
+		return false, nil
+	}
+	delete(m.orders, orderID)
+	return true, nil
+}
+
+func (m *MockOrderRepo) UpdateStatus(ctx context.Context, orderID bson.ObjectID, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if order, ok := m.orders[orderID]; ok {
+		order.Status = status
+	}
 	return nil
 }
 
@@ -134,5 +359,717 @@ func (m *MockOrderRepo) UpdateStatus(ctx context.Context, orderID bson.ObjectID,
 func (m *MockOrderRepo) Reset() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.orders = make(map[string]*model.Order)
+	m.orders = make(map[bson.ObjectID]*model.Order)
+}
+
+// Ensure MockSubscriptionRepo implements SubscriptionRepository
+var _ SubscriptionRepository = (*MockSubscriptionRepo)(nil)
+
+// MockSubscriptionRepo is an in-memory implementation for testing
+type MockSubscriptionRepo struct {
+	mu   sync.RWMutex
+	subs map[string]model.Subscription
+}
+
+// NewMockSubscriptionRepo creates a new mock subscription repository
+func NewMockSubscriptionRepo() *MockSubscriptionRepo {
+	return &MockSubscriptionRepo{
+		subs: make(map[string]model.Subscription),
+	}
+}
+
+func (m *MockSubscriptionRepo) Upsert(ctx context.Context, sub *model.Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, err := bsonCopy(*sub)
+	if err != nil {
+		return err
+	}
+	if existing, ok := m.subs[sub.ID]; ok {
+		s.CreatedAt = existing.CreatedAt
+		s.TrialReminderSentAt = existing.TrialReminderSentAt
+	}
+	m.subs[sub.ID] = s
+	return nil
+}
+
+func (m *MockSubscriptionRepo) FindByID(ctx context.Context, id string) (*model.Subscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sub, ok := m.subs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	s, err := bsonCopy(sub)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (m *MockSubscriptionRepo) MarkTrialReminded(ctx context.Context, id string, at time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sub, ok := m.subs[id]
+	if !ok || sub.TrialReminderSentAt != nil {
+		return false, nil
+	}
+	sub.TrialReminderSentAt = &at
+	m.subs[id] = sub
+	return true, nil
+}
+
+func (m *MockSubscriptionRepo) UnmarkTrialReminded(ctx context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sub, ok := m.subs[id]
+	if ok && sub.TrialReminderSentAt != nil && sub.TrialReminderSentAt.Equal(at) {
+		sub.TrialReminderSentAt = nil
+		m.subs[id] = sub
+	}
+	return nil
+}
+
+// Ensure MockCustomerRepo implements CustomerRepository
+var _ CustomerRepository = (*MockCustomerRepo)(nil)
+
+// MockCustomerRepo is an in-memory implementation for testing
+type MockCustomerRepo struct {
+	mu        sync.RWMutex
+	customers map[string]model.Customer
+}
+
+// NewMockCustomerRepo creates a new mock Stripe customer repository
+func NewMockCustomerRepo() *MockCustomerRepo {
+	return &MockCustomerRepo{
+		customers: make(map[string]model.Customer),
+	}
+}
+
+func (m *MockCustomerRepo) FindByUserID(ctx context.Context, userID string) (*model.Customer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	customer, ok := m.customers[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &customer, nil
+}
+
+func (m *MockCustomerRepo) Create(ctx context.Context, customer *model.Customer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.customers[customer.UserID]; ok {
+		return ErrConflict
+	}
+	m.customers[customer.UserID] = *customer
+	return nil
+}
+
+func (m *MockCustomerRepo) UpdateSynced(ctx context.Context, customer *model.Customer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.customers[customer.UserID]
+	if !ok {
+		return nil
+	}
+	stored.Email, stored.AddressID, stored.AddressHash = customer.Email, customer.AddressID, customer.AddressHash
+	stored.UpdatedAt = customer.UpdatedAt
+	m.customers[customer.UserID] = stored
+	return nil
+}
+
+// Ensure MockQuoteRepo implements QuoteRepository
+var _ QuoteRepository = (*MockQuoteRepo)(nil)
+
+// MockQuoteRepo is an in-memory implementation for testing
+type MockQuoteRepo struct {
+	mu     sync.RWMutex
+	quotes map[bson.ObjectID]model.SavedQuote
+}
+
+// NewMockQuoteRepo creates a new mock saved quote repository
+func NewMockQuoteRepo() *MockQuoteRepo {
+	return &MockQuoteRepo{
+		quotes: make(map[bson.ObjectID]model.SavedQuote),
+	}
+}
+
+func (m *MockQuoteRepo) Create(ctx context.Context, quote *model.SavedQuote) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	quote.ID = bson.NewObjectID()
+	stored, err := bsonCopy(*quote)
+	if err != nil {
+		return err
+	}
+	m.quotes[quote.ID] = stored
+	return nil
+}
+
+func (m *MockQuoteRepo) FindByID(ctx context.Context, id bson.ObjectID) (*model.SavedQuote, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	quote, ok := m.quotes[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found, err := bsonCopy(quote)
+	if err != nil {
+		return nil, err
+	}
+	return &found, nil
+}
+
+// Ensure MockCouponRepo implements CouponRepository
+var _ CouponRepository = (*MockCouponRepo)(nil)
+
+// MockCouponRepo is an in-memory implementation for testing
+type MockCouponRepo struct {
+	mu          sync.RWMutex
+	coupons     map[string]model.Coupon
+	redemptions map[bson.ObjectID]model.CouponRedemption
+}
+
+// NewMockCouponRepo creates a new mock coupon repository
+func NewMockCouponRepo() *MockCouponRepo {
+	return &MockCouponRepo{
+		coupons:     make(map[string]model.Coupon),
+		redemptions: make(map[bson.ObjectID]model.CouponRedemption),
+	}
+}
+
+func (m *MockCouponRepo) ListCoupons(ctx context.Context) ([]model.Coupon, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	coupons := make([]model.Coupon, 0, len(m.coupons))
+	for _, coupon := range m.coupons {
+		c, err := bsonCopy(coupon)
+		if err != nil {
+			return nil, err
+		}
+		coupons = append(coupons, c)
+	}
+	sort.Slice(coupons, func(i, j int) bool { return coupons[i].Code < coupons[j].Code })
+	return coupons, nil
+}
+
+func (m *MockCouponRepo) FindCoupon(ctx context.Context, code string) (*model.Coupon, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	coupon, ok := m.coupons[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c, err := bsonCopy(coupon)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (m *MockCouponRepo) UpsertCoupon(ctx context.Context, coupon *model.Coupon) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, err := bsonCopy(*coupon)
+	if err != nil {
+		return err
+	}
+	c.Redemptions = m.coupons[coupon.Code].Redemptions
+	c.Reserved = m.coupons[coupon.Code].Reserved
+	m.coupons[coupon.Code] = c
+	return nil
+}
+
+func (m *MockCouponRepo) DeleteCoupon(ctx context.Context, code string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.coupons[code]; !ok {
+		return ErrNotFound
+	}
+	delete(m.coupons, code)
+	return nil
+}
+
+func (m *MockCouponRepo) CountRedemptions(ctx context.Context, code, userID string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var n int64
+	for _, r := range m.redemptions {
+		if r.Code == code && r.UserID == userID && r.Status != model.RedemptionReserved {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MockCouponRepo) ReserveRedemption(ctx context.Context, redemption *model.CouponRedemption, maxPerUser int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.redemptions[redemption.OrderID]; ok {
+		return true, nil
+	}
+	if maxPerUser > 0 {
+		n := 0
+		for _, r := range m.redemptions {
+			if r.Code == redemption.Code && r.UserID == redemption.UserID {
+				n++
+			}
+		}
+		if n >= maxPerUser {
+			return false, nil
+		}
+	}
+	coupon, ok := m.coupons[redemption.Code]
+	if !ok || (coupon.MaxRedemptions > 0 && coupon.Redemptions+coupon.Reserved >= coupon.MaxRedemptions) {
+		return false, nil
+	}
+	coupon.Reserved++
+	m.coupons[redemption.Code] = coupon
+	redemption.Status = model.RedemptionReserved
+	m.redemptions[redemption.OrderID] = *redemption
+	return true, nil
+}
+
+func (m *MockCouponRepo) RecordRedemption(ctx context.Context, redemption *model.CouponRedemption) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.redemptions[redemption.OrderID]
+	if ok && existing.Status != model.RedemptionReserved {
+		return false, nil
+	}
+	coupon, found := m.coupons[redemption.Code]
+	if ok {
+		existing.Status, existing.RedeemedAt = model.RedemptionRedeemed, redemption.RedeemedAt
+		m.redemptions[redemption.OrderID] = existing
+		coupon.Reserved--
+	} else {
+		redemption.Status = model.RedemptionRedeemed
+		m.redemptions[redemption.OrderID] = *redemption
+	}
+	if found {
+		coupon.Redemptions++
+		m.coupons[redemption.Code] = coupon
+	}
+	return true, nil
+}
+
+func (m *MockCouponRepo) ReleaseRedemption(ctx context.Context, orderID bson.ObjectID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	released, ok := m.redemptions[orderID]
+	if !ok || released.Status != model.RedemptionReserved {
+		return false, nil
+	}
+	delete(m.redemptions, orderID)
+	if coupon, ok := m.coupons[released.Code]; ok {
+		coupon.Reserved--
+		m.coupons[released.Code] = coupon
+	}
+	return true, nil
+}
+
+// Ensure MockReferralRepo implements ReferralRepository
+var _ ReferralRepository = (*MockReferralRepo)(nil)
+
+// MockReferralRepo is an in-memory implementation for testing
+type MockReferralRepo struct {
+	mu        sync.RWMutex
+	codes     map[string]model.ReferralCode
+	referrals map[string]model.Referral
+	credits   map[string]model.CreditEntry
+}
+
+// NewMockReferralRepo creates a new mock referral repository
+func NewMockReferralRepo() *MockReferralRepo {
+	return &MockReferralRepo{
+		codes:     make(map[string]model.ReferralCode),
+		referrals: make(map[string]model.Referral),
+		credits:   make(map[string]model.CreditEntry),
+	}
+}
+
+func (m *MockReferralRepo) CreateCode(ctx context.Context, code *model.ReferralCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.codes[code.Code]; ok {
+		return ErrConflict
+	}
+	for _, existing := range m.codes {
+		if existing.UserID == code.UserID {
+			return ErrConflict
+		}
+	}
+	m.codes[code.Code] = *code
+	return nil
+}
+
+func (m *MockReferralRepo) FindCode(ctx context.Context, code string) (*model.ReferralCode, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.codes[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &c, nil
+}
+
+func (m *MockReferralRepo) FindCodeByUser(ctx context.Context, userID string) (*model.ReferralCode, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, c := range m.codes {
+		if c.UserID == userID {
+			return &c, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MockReferralRepo) CreateReferral(ctx context.Context, referral *model.Referral) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.referrals[referral.RefereeID]; ok {
+		return ErrConflict
+	}
+	m.referrals[referral.RefereeID] = *referral
+	return nil
+}
+
+func (m *MockReferralRepo) FindReferral(ctx context.Context, refereeID string) (*model.Referral, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	referral, ok := m.referrals[refereeID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	r, err := bsonCopy(referral)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (m *MockReferralRepo) ListReferrals(ctx context.Context, referrerID string) ([]model.Referral, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	referrals := []model.Referral{}
+	for _, referral := range m.referrals {
+		if referral.ReferrerID == referrerID {
+			referrals = append(referrals, referral)
+		}
+	}
+	sort.Slice(referrals, func(i, j int) bool {
+		return referrals[i].CreatedAt.After(referrals[j].CreatedAt)
+	})
+	return referrals, nil
+}
+
+func (m *MockReferralRepo) ResolveReferral(ctx context.Context, referral *model.Referral) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.referrals[referral.RefereeID]
+	if !ok || existing.Status != model.ReferralPending {
+		return false, nil
+	}
+	existing.Status = referral.Status
+	existing.Reason = referral.Reason
+	existing.ResolvedAt = referral.ResolvedAt
+	if !referral.OrderID.IsZero() {
+		existing.OrderID = referral.OrderID
+	}
+	m.referrals[referral.RefereeID] = existing
+	return true, nil
+}
+
+func (m *MockReferralRepo) AddCredit(ctx context.Context, entry *model.CreditEntry) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.credits[entry.ID]; ok {
+		return false, nil
+	}
+	m.credits[entry.ID] = *entry
+	return true, nil
+}
+
+func (m *MockReferralRepo) SettleCredit(ctx context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.credits[id]
+	if !ok || !entry.Held {
+		return false, nil
+	}
+	entry.Held = false
+	m.credits[id] = entry
+	return true, nil
+}
+
+func (m *MockReferralRepo) ReleaseCredit(ctx context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.credits[id]
+	if !ok || !entry.Held {
+		return false, nil
+	}
+	delete(m.credits, id)
+	return true, nil
+}
+
+func (m *MockReferralRepo) CreditBalances(ctx context.Context, userID string) (model.PriceTable, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	balances := model.PriceTable{}
+	for _, entry := range m.credits {
+		if entry.UserID != userID {
+			continue
+		}
+		balance := balances[entry.Amount.Currency]
+		balances[entry.Amount.Currency] = model.NewMoney(balance.Amount+entry.Amount.Amount, entry.Amount.Currency)
+	}
+	return balances, nil
+}
+
+// Ensure MockCatalogRepo implements CatalogRepository
+var _ CatalogRepository = (*MockCatalogRepo)(nil)
+
+// MockCatalogRepo is an in-memory implementation for testing
+type MockCatalogRepo struct {
+	mu     sync.RWMutex
+	plans  map[string]model.Plan
+	addons map[string]model.Addon
+	cycles map[model.BillingCycle]model.BillingCycleDef
+}
+
+// NewMockCatalogRepo creates a new mock catalog repository
+func NewMockCatalogRepo() *MockCatalogRepo {
+	return &MockCatalogRepo{
+		plans:  make(map[string]model.Plan),
+		addons: make(map[string]model.Addon),
+		cycles: make(map[model.BillingCycle]model.BillingCycleDef),
+	}
+}
+
+func (m *MockCatalogRepo) ListPlans(ctx context.Context) ([]model.Plan, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	plans := make([]model.Plan, 0, len(m.plans))
+	for _, plan := range m.plans {
+		c, err := bsonCopy(plan)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, c)
+	}
+	sort.Slice(plans, func(i, j int) bool {
+		if plans[i].SortOrder != plans[j].SortOrder {
+			return plans[i].SortOrder < plans[j].SortOrder
+		}
+		return plans[i].ID < plans[j].ID
+	})
+	return plans, nil
+}
+
+func (m *MockCatalogRepo) FindPlan(ctx context.Context, id string) (*model.Plan, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	plan, ok := m.plans[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c, err := bsonCopy(plan)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (m *MockCatalogRepo) UpsertPlan(ctx context.Context, plan *model.Plan) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, err := bsonCopy(*plan)
+	if err != nil {
+		return err
+	}
+	m.plans[plan.ID] = c
+	return nil
+}
+
+func (m *MockCatalogRepo) DeletePlan(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.plans[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.plans, id)
+	return nil
+}
+
+func (m *MockCatalogRepo) ListAddons(ctx context.Context) ([]model.Addon, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	addons := make([]model.Addon, 0, len(m.addons))
+	for _, addon := range m.addons {
+		c, err := bsonCopy(addon)
+		if err != nil {
+			return nil, err
+		}
+		addons = append(addons, c)
+	}
+	sort.Slice(addons, func(i, j int) bool {
+		if addons[i].SortOrder != addons[j].SortOrder {
+			return addons[i].SortOrder < addons[j].SortOrder
+		}
+		return addons[i].ID < addons[j].ID
+	})
+	return addons, nil
+}
+
+func (m *MockCatalogRepo) FindAddon(ctx context.Context, id string) (*model.Addon, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	addon, ok := m.addons[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c, err := bsonCopy(addon)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (m *MockCatalogRepo) UpsertAddon(ctx context.Context, addon *model.Addon) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, err := bsonCopy(*addon)
+	if err != nil {
+		return err
+	}
+	m.addons[addon.ID] = c
+	return nil
+}
+
+func (m *MockCatalogRepo) DeleteAddon(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.addons[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.addons, id)
+	return nil
+}
+
+func (m *MockCatalogRepo) ListCycles(ctx context.Context) ([]model.BillingCycleDef, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cycles := make([]model.BillingCycleDef, 0, len(m.cycles))
+	for _, cycle := range m.cycles {
+		c, err := bsonCopy(cycle)
+		if err != nil {
+			return nil, err
+		}
+		cycles = append(cycles, c)
+	}
+	sort.Slice(cycles, func(i, j int) bool {
+		if cycles[i].SortOrder != cycles[j].SortOrder {
+			return cycles[i].SortOrder < cycles[j].SortOrder
+		}
+		return cycles[i].ID < cycles[j].ID
+	})
+	return cycles, nil
+}
+
+func (m *MockCatalogRepo) FindCycle(ctx context.Context, id model.BillingCycle) (*model.BillingCycleDef, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cycle, ok := m.cycles[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c, err := bsonCopy(cycle)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (m *MockCatalogRepo) UpsertCycle(ctx context.Context, cycle *model.BillingCycleDef) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, err := bsonCopy(*cycle)
+	if err != nil {
+		return err
+	}
+	m.cycles[cycle.ID] = c
+	return nil
+}
+
+func (m *MockCatalogRepo) DeleteCycle(ctx context.Context, id model.BillingCycle) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.cycles[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.cycles, id)
+	return nil
+}
+
+// Reset clears all data (for test cleanup)
+func (m *MockCatalogRepo) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.plans = make(map[string]model.Plan)
+	m.addons = make(map[string]model.Addon)
+	m.cycles = make(map[model.BillingCycle]model.BillingCycleDef)
+}
+
+// bsonCopy deep-copies v through BSON like a MongoDB round trip, so callers
+// never share maps or slices with stored values
+func bsonCopy[T any](v T) (T, error) {
+	var out T
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return out, err
+	}
+	err = bson.Unmarshal(data, &out)
+	return out, err
 }
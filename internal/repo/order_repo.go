@@ -12,6 +12,7 @@ import (
 	"github.com/deicod/dysv/internal/model"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 // Ensure OrderRepo implements OrderRepository
@@ -31,13 +32,37 @@ func NewOrderRepo(db *mongo.Database, timeout time.Duration) *OrderRepo {
 	}
 }
 
-// Create inserts a new order
+// EnsureIndexes creates the indexes checkout lookups rely on
+func (r *OrderRepo) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "idempotency_key", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"idempotency_key": bson.M{"$exists": true}}),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "checkout_hash", Value: 1}}},
+		{Keys: bson.D{{Key: "stripe_session_id", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("create order indexes: %w", err)
+	}
+	return nil
+}
+
+// Create inserts a new order. Returns ErrConflict if the user already has
+// an order with the same idempotency key.
 func (r *OrderRepo) Create(ctx context.Context, order *model.Order) error {
 	ctx, cancel := context.WithTimeout(ctx, r.timeout)
 	defer cancel()
 
 	result, err := r.coll.InsertOne(ctx, order)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrConflict
+		}
 		fmt.Printf("OrderRepo: InsertOne Error: %v\n", err)
 		return err
 	}
@@ -62,6 +87,61 @@ func (r *OrderRepo) FindByStripeSessionID(ctx context.Context, stripeSessionID s
 	return &order, nil
 }
 
+// FindByID finds an order by ID
+func (r *OrderRepo) FindByID(ctx context.Context, id bson.ObjectID) (*model.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var order model.Order
+	err := r.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&order)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		fmt.Printf("OrderRepo: FindByID Error: %v\n", err)
+		return nil, err
+	}
+	return &order, nil
+}
+
+// HasTrial reports whether one of the user's orders ever started a trial, or
+// offers one in a Stripe session still open at openAt. Orders of the checkout
+// exceptCheckoutHash are not counted.
+func (r *OrderRepo) HasTrial(ctx context.Context, userID, exceptCheckoutHash string, openAt time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	n, err := r.coll.CountDocuments(ctx, bson.M{
+		"user_id": userID,
+		"$or": bson.A{
+			bson.M{"trial_start": bson.M{"$ne": nil}},
+			bson.M{
+				"status":              "pending",
+				"trial_days":          bson.M{"$gt": 0},
+				"checkout_hash":       bson.M{"$ne": exceptCheckoutHash},
+				"checkout_expires_at": bson.M{"$gt": openAt},
+			},
+		},
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		fmt.Printf("OrderRepo: HasTrial Error: %v\n", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// StartTrial records the trial period of an order, unless already recorded
+func (r *OrderRepo) StartTrial(ctx context.Context, orderID bson.ObjectID, start, end time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.coll.UpdateOne(ctx,
+		bson.M{"_id": orderID, "trial_start": nil},
+		bson.M{"$set": bson.M{"trial_start": start, "trial_end": end}},
+	)
+	return err
+}
+
 // UpdateStatus updates the status of an order
 func (r *OrderRepo) UpdateStatus(ctx context.Context, orderID bson.ObjectID, status string) error {
 	ctx, cancel := context.WithTimeout(ctx, r.timeout)
@@ -73,3 +153,83 @@ func (r *OrderRepo) UpdateStatus(ctx context.Context, orderID bson.ObjectID, sta
 	)
 	return err
 }
+
+// FindByIdempotencyKey finds the user's order created with key
+func (r *OrderRepo) FindByIdempotencyKey(ctx context.Context, userID, key string) (*model.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var order model.Order
+	err := r.coll.FindOne(ctx, bson.M{"user_id": userID, "idempotency_key": key}).Decode(&order)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		fmt.Printf("OrderRepo: FindByIdempotencyKey Error: %v\n", err)
+		return nil, err
+	}
+	return &order, nil
+}
+
+// FindOpenCheckout finds the user's latest pending order for the same cart
+// contents whose Stripe session is still open at openUntil
+func (r *OrderRepo) FindOpenCheckout(ctx context.Context, userID, checkoutHash string, openUntil time.Time) (*model.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var order model.Order
+	err := r.coll.FindOne(ctx, bson.M{
+		"user_id":             userID,
+		"checkout_hash":       checkoutHash,
+		"status":              "pending",
+		"checkout_url":        bson.M{"$exists": true},
+		"checkout_expires_at": bson.M{"$gt": openUntil},
+	}, options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})).Decode(&order)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		fmt.Printf("OrderRepo: FindOpenCheckout Error: %v\n", err)
+		return nil, err
+	}
+	return &order, nil
+}
+
+// AttachCheckout records the Stripe session created for an order
+func (r *OrderRepo) AttachCheckout(ctx context.Context, orderID bson.ObjectID, stripeSessionID, url string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.coll.UpdateOne(ctx,
+		bson.M{"_id": orderID},
+		bson.M{"$set": bson.M{"stripe_session_id": stripeSessionID, "checkout_url": url, "checkout_expires_at": expiresAt}},
+	)
+	return err
+}
+
+// Delete removes an order, used for orders whose Stripe session failed
+func (r *OrderRepo) Delete(ctx context.Context, orderID bson.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.coll.DeleteOne(ctx, bson.M{"_id": orderID})
+	return err
+}
+
+// DeleteAbandoned removes an order created before createdBefore that never
+// got a Stripe session, left behind by a checkout that did not finish.
+// deleted reports whether the order was still abandoned.
+func (r *OrderRepo) DeleteAbandoned(ctx context.Context, orderID bson.ObjectID, createdBefore time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.coll.DeleteOne(ctx, bson.M{
+		"_id":          orderID,
+		"checkout_url": bson.M{"$exists": false},
+		"created_at":   bson.M{"$lt": createdBefore},
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount == 1, nil
+}
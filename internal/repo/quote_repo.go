@@ -0,0 +1,63 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Ensure QuoteRepo implements QuoteRepository
+var _ QuoteRepository = (*QuoteRepo)(nil)
+
+// QuoteRepo is the MongoDB implementation of QuoteRepository
+type QuoteRepo struct {
+	coll    *mongo.Collection
+	timeout time.Duration
+}
+
+// NewQuoteRepo creates a new saved quote repository
+func NewQuoteRepo(db *mongo.Database, timeout time.Duration) *QuoteRepo {
+	return &QuoteRepo{
+		coll:    db.Collection("quotes"),
+		timeout: timeout,
+	}
+}
+
+// Create inserts a new saved quote
+func (r *QuoteRepo) Create(ctx context.Context, quote *model.SavedQuote) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.coll.InsertOne(ctx, quote)
+	if err != nil {
+		fmt.Printf("QuoteRepo: InsertOne Error: %v\n", err)
+		return err
+	}
+	quote.ID = result.InsertedID.(bson.ObjectID)
+	return nil
+}
+
+// FindByID finds a saved quote by ID
+func (r *QuoteRepo) FindByID(ctx context.Context, id bson.ObjectID) (*model.SavedQuote, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var quote model.SavedQuote
+	err := r.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&quote)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		fmt.Printf("QuoteRepo: FindOne Error: %v\n", err)
+		return nil, err
+	}
+	return &quote, nil
+}
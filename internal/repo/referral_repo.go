@@ -0,0 +1,257 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Ensure ReferralRepo implements ReferralRepository
+var _ ReferralRepository = (*ReferralRepo)(nil)
+
+// ReferralRepo is the MongoDB implementation of ReferralRepository
+type ReferralRepo struct {
+	codes     *mongo.Collection
+	referrals *mongo.Collection
+	credits   *mongo.Collection
+	timeout   time.Duration
+}
+
+// NewReferralRepo creates a new referral repository
+func NewReferralRepo(db *mongo.Database, timeout time.Duration) *ReferralRepo {
+	return &ReferralRepo{
+		codes:     db.Collection("referral_codes"),
+		referrals: db.Collection("referrals"),
+		credits:   db.Collection("credit_entries"),
+		timeout:   timeout,
+	}
+}
+
+// EnsureIndexes creates the indexes referral lookups rely on
+func (r *ReferralRepo) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	if _, err := r.codes.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}); err != nil {
+		return fmt.Errorf("create referral code indexes: %w", err)
+	}
+	if _, err := r.referrals.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "referrer_id", Value: 1}},
+	}); err != nil {
+		return fmt.Errorf("create referral indexes: %w", err)
+	}
+	if _, err := r.credits.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}},
+	}); err != nil {
+		return fmt.Errorf("create credit indexes: %w", err)
+	}
+	return nil
+}
+
+// CreateCode stores a referral code. Returns ErrConflict if the code or the
+// user's code already exists.
+func (r *ReferralRepo) CreateCode(ctx context.Context, code *model.ReferralCode) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	if _, err := r.codes.InsertOne(ctx, code); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrConflict
+		}
+		fmt.Printf("ReferralRepo: CreateCode error: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// FindCode finds a referral code
+func (r *ReferralRepo) FindCode(ctx context.Context, code string) (*model.ReferralCode, error) {
+	return r.findCode(ctx, bson.M{"_id": code})
+}
+
+// FindCodeByUser finds the referral code of a user
+func (r *ReferralRepo) FindCodeByUser(ctx context.Context, userID string) (*model.ReferralCode, error) {
+	return r.findCode(ctx, bson.M{"user_id": userID})
+}
+
+func (r *ReferralRepo) findCode(ctx context.Context, filter bson.M) (*model.ReferralCode, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var code model.ReferralCode
+	if err := r.codes.FindOne(ctx, filter).Decode(&code); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		fmt.Printf("ReferralRepo: FindCode error: %v\n", err)
+		return nil, err
+	}
+	return &code, nil
+}
+
+// CreateReferral stores a referral. Returns ErrConflict if the referee was
+// already referred.
+func (r *ReferralRepo) CreateReferral(ctx context.Context, referral *model.Referral) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	if _, err := r.referrals.InsertOne(ctx, referral); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrConflict
+		}
+		fmt.Printf("ReferralRepo: CreateReferral error: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// FindReferral finds the referral of a referee
+func (r *ReferralRepo) FindReferral(ctx context.Context, refereeID string) (*model.Referral, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var referral model.Referral
+	if err := r.referrals.FindOne(ctx, bson.M{"_id": refereeID}).Decode(&referral); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		fmt.Printf("ReferralRepo: FindReferral error: %v\n", err)
+		return nil, err
+	}
+	return &referral, nil
+}
+
+// ListReferrals returns the referrals made by a referrer, newest first
+func (r *ReferralRepo) ListReferrals(ctx context.Context, referrerID string) ([]model.Referral, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cursor, err := r.referrals.Find(ctx, bson.M{"referrer_id": referrerID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		fmt.Printf("ReferralRepo: ListReferrals error: %v\n", err)
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	referrals := []model.Referral{}
+	if err := cursor.All(ctx, &referrals); err != nil {
+		return nil, err
+	}
+	return referrals, nil
+}
+
+// ResolveReferral stores the outcome of a pending referral. Only one caller
+// resolves a referral; resolved reports whether it was this one.
+func (r *ReferralRepo) ResolveReferral(ctx context.Context, referral *model.Referral) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	set := bson.M{
+		"status":      referral.Status,
+		"reason":      referral.Reason,
+		"resolved_at": referral.ResolvedAt,
+	}
+	if !referral.OrderID.IsZero() {
+		set["order_id"] = referral.OrderID
+	}
+	result, err := r.referrals.UpdateOne(ctx,
+		bson.M{"_id": referral.RefereeID, "status": model.ReferralPending},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		fmt.Printf("ReferralRepo: ResolveReferral error: %v\n", err)
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// AddCredit books a credit entry. Entries are booked once per ID; added
+// reports whether this call booked it.
+func (r *ReferralRepo) AddCredit(ctx context.Context, entry *model.CreditEntry) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	if _, err := r.credits.InsertOne(ctx, entry); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		fmt.Printf("ReferralRepo: AddCredit error: %v\n", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// SettleCredit turns the held entry id into a booked one; settled reports
+// whether there was one
+func (r *ReferralRepo) SettleCredit(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.credits.UpdateOne(ctx,
+		bson.M{"_id": id, "held": true},
+		bson.M{"$unset": bson.M{"held": ""}},
+	)
+	if err != nil {
+		fmt.Printf("ReferralRepo: SettleCredit error: %v\n", err)
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// ReleaseCredit deletes the held entry id; released reports whether there
+// was one. Booked entries are kept.
+func (r *ReferralRepo) ReleaseCredit(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.credits.DeleteOne(ctx, bson.M{"_id": id, "held": true})
+	if err != nil {
+		fmt.Printf("ReferralRepo: ReleaseCredit error: %v\n", err)
+		return false, err
+	}
+	return result.DeletedCount == 1, nil
+}
+
+// CreditBalances sums the credit entries of a user per currency
+func (r *ReferralRepo) CreditBalances(ctx context.Context, userID string) (model.PriceTable, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cursor, err := r.credits.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    "$amount.currency",
+			"amount": bson.M{"$sum": "$amount.amount"},
+		}}},
+	})
+	if err != nil {
+		fmt.Printf("ReferralRepo: CreditBalances error: %v\n", err)
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var sums []struct {
+		Currency string `bson:"_id"`
+		Amount   int64  `bson:"amount"`
+	}
+	if err := cursor.All(ctx, &sums); err != nil {
+		return nil, err
+	}
+	balances := model.PriceTable{}
+	for _, sum := range sums {
+		balances[sum.Currency] = model.NewMoney(sum.Amount, sum.Currency)
+	}
+	return balances, nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Ensure SubscriptionRepo implements SubscriptionRepository
+var _ SubscriptionRepository = (*SubscriptionRepo)(nil)
+
+// SubscriptionRepo is the MongoDB implementation of SubscriptionRepository
+type SubscriptionRepo struct {
+	coll    *mongo.Collection
+	timeout time.Duration
+}
+
+// NewSubscriptionRepo creates a new subscription repository
+func NewSubscriptionRepo(db *mongo.Database, timeout time.Duration) *SubscriptionRepo {
+	return &SubscriptionRepo{
+		coll:    db.Collection("subscriptions"),
+		timeout: timeout,
+	}
+}
+
+// Upsert creates or updates a subscription. CreatedAt and the trial
+// reminder are kept from the stored record.
+func (r *SubscriptionRepo) Upsert(ctx context.Context, sub *model.Subscription) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.coll.UpdateOne(ctx,
+		bson.M{"_id": sub.ID},
+		bson.M{
+			"$set": bson.M{
+				"order_id":    sub.OrderID,
+				"user_id":     sub.UserID,
+				"email":       sub.Email,
+				"status":      sub.Status,
+				"trial_start": sub.TrialStart,
+				"trial_end":   sub.TrialEnd,
+				"updated_at":  sub.UpdatedAt,
+			},
+			"$setOnInsert": bson.M{"created_at": sub.CreatedAt},
+		},
+		options.UpdateOne().SetUpsert(true),
+	)
+	if err != nil {
+		fmt.Printf("SubscriptionRepo: Upsert error: %v\n", err)
+	}
+	return err
+}
+
+// FindByID finds a subscription by its Stripe ID
+func (r *SubscriptionRepo) FindByID(ctx context.Context, id string) (*model.Subscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var sub model.Subscription
+	if err := r.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&sub); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		fmt.Printf("SubscriptionRepo: FindByID error: %v\n", err)
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// MarkTrialReminded records that the trial reminder was sent. Only the first
+// call marks it; marked reports whether it was this one.
+func (r *SubscriptionRepo) MarkTrialReminded(ctx context.Context, id string, at time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "trial_reminder_sent_at": nil},
+		bson.M{"$set": bson.M{"trial_reminder_sent_at": at}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// UnmarkTrialReminded takes back the mark MarkTrialReminded set at at, e.g.
+// when the reminder could not be sent
+func (r *SubscriptionRepo) UnmarkTrialReminded(ctx context.Context, id string, at time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "trial_reminder_sent_at": at},
+		bson.M{"$unset": bson.M{"trial_reminder_sent_at": ""}},
+	)
+	return err
+}
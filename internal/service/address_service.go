@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/deicod/dysv/internal/model"
@@ -10,13 +12,19 @@ import (
 
 type AddressService struct {
 	repo repo.AddressRepository
+	vat  VATValidator
 }
 
-func NewAddressService(repo repo.AddressRepository) *AddressService {
-	return &AddressService{repo: repo}
+// NewAddressService creates a new address service.
+// vat is optional; without it VAT IDs stay unchecked and reverse charge never applies.
+func NewAddressService(repo repo.AddressRepository, vat VATValidator) *AddressService {
+	return &AddressService{repo: repo, vat: vat}
 }
 
 func (s *AddressService) CreateAddress(ctx context.Context, addr *model.Address) error {
+	if err := ValidateAddress(addr); err != nil {
+		return err
+	}
 	addr.CreatedAt = time.Now()
 	addr.UpdatedAt = time.Now()
 
@@ -27,14 +35,30 @@ func (s *AddressService) CreateAddress(ctx context.Context, addr *model.Address)
 		}
 	}
 
-	// Validation logic could go here (e.g. check country code)
+	if err := s.checkVATID(ctx, addr, nil); err != nil {
+		return err
+	}
 
 	return s.repo.Create(ctx, addr)
 }
 
 func (s *AddressService) UpdateAddress(ctx context.Context, addr *model.Address) error {
+	if err := ValidateAddress(addr); err != nil {
+		return err
+	}
 	addr.UpdatedAt = time.Now()
 
+	previous, err := s.repo.Get(ctx, addr.ID, addr.UserID)
+	if err != nil {
+		return err
+	}
+	if previous == nil {
+		return ErrAddressNotFound
+	}
+	if err := s.checkVATID(ctx, addr, previous); err != nil {
+		return err
+	}
+
 	if addr.IsDefault {
 		if err := s.repo.UnsetDefaults(ctx, addr.UserID); err != nil {
 			return err
@@ -52,6 +76,81 @@ func (s *AddressService) GetAddress(ctx context.Context, id, userID string) (*mo
 	return s.repo.Get(ctx, id, userID)
 }
 
+// DefaultAddress returns the user's default address, or nil if none is marked default
+func (s *AddressService) DefaultAddress(ctx context.Context, userID string) (*model.Address, error) {
+	addresses, err := s.repo.ListByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range addresses {
+		if addresses[i].IsDefault {
+			return &addresses[i], nil
+		}
+	}
+	return nil, nil
+}
+
 func (s *AddressService) DeleteAddress(ctx context.Context, id, userID string) error {
 	return s.repo.Delete(ctx, id, userID)
 }
+
+// checkVATID normalizes the VAT ID of addr and checks it with the register.
+// A check of the same ID that already passed is kept from previous. IDs the
+// register rejects are refused; while it is unreachable the check is pending.
+func (s *AddressService) checkVATID(ctx context.Context, addr, previous *model.Address) error {
+	addr.VATID = NormalizeVATID(addr.VATID)
+	addr.VATCheck = nil // only ever set here
+	if addr.VATID == "" {
+		return nil
+	}
+	if _, eu := vatIDPatterns[addr.Country]; !eu {
+		return nil // no EU VAT ID, nothing to check
+	}
+	if !ValidVATIDFormat(addr.Country, addr.VATID) {
+		return fmt.Errorf("%w: %s is not a VAT ID of %s", ErrInvalidVATID, addr.VATID, addr.Country)
+	}
+	if previous != nil && previous.VATID == addr.VATID && previous.VATIDVerified() {
+		addr.VATCheck = previous.VATCheck
+		return nil
+	}
+	if s.vat == nil {
+		return nil
+	}
+
+	check, err := s.validateVATID(ctx, addr.VATID)
+	if err != nil {
+		return err
+	}
+	if check.Status == model.VATInvalid {
+		return fmt.Errorf("%w: %s is not registered", ErrInvalidVATID, addr.VATID)
+	}
+	addr.VATCheck = check
+	return nil
+}
+
+// validateVATID asks the register about vatID. An outage gives a pending
+// check, so saving an address never waits for the register.
+func (s *AddressService) validateVATID(ctx context.Context, vatID string) (*model.VATCheck, error) {
+	check, err := s.vat.Validate(ctx, vatID)
+	if errors.Is(err, ErrVATCheckUnavailable) {
+		fmt.Printf("AddressService: VAT ID %s pending: %v\n", vatID, err)
+		return &model.VATCheck{VATID: vatID, Status: model.VATPending, CheckedAt: time.Now()}, nil
+	}
+	return check, err
+}
+
+// RecheckVATID retries a pending VAT ID check of a stored address and saves
+// the outcome. A check that is still pending is no error: checkout goes on
+// and charges VAT as for a private customer.
+func (s *AddressService) RecheckVATID(ctx context.Context, addr *model.Address) error {
+	if s.vat == nil || addr.VATCheck == nil || addr.VATCheck.Status != model.VATPending {
+		return nil
+	}
+	check, err := s.validateVATID(ctx, addr.VATID)
+	if err != nil || check.Status == model.VATPending {
+		return err
+	}
+	addr.VATCheck = check
+	addr.UpdatedAt = time.Now()
+	return s.repo.Update(ctx, addr)
+}
@@ -3,6 +3,7 @@ package service_test
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/deicod/dysv/internal/mocks"
@@ -22,7 +23,7 @@ var _ = Describe("AddressService", func() {
 
 	BeforeEach(func() {
 		mockRepo = mocks.NewMockAddressRepo()
-		addrService = service.NewAddressService(mockRepo)
+		addrService = service.NewAddressService(mockRepo, nil)
 		ctx = context.Background()
 		userID = "user_123"
 	})
@@ -63,9 +64,13 @@ var _ = Describe("AddressService", func() {
 
 			// Create new default address
 			newAddr := &model.Address{
-				UserID:    userID,
-				IsDefault: true,
-				Label:     "New Default",
+				UserID:     userID,
+				IsDefault:  true,
+				Label:      "New Default",
+				Line1:      "Hauptstr. 1",
+				City:       "Berlin",
+				PostalCode: "10115",
+				Country:    "DE",
 			}
 
 			err = addrService.CreateAddress(ctx, newAddr)
@@ -84,7 +89,7 @@ var _ = Describe("AddressService", func() {
 
 		It("should fail if repo create fails", func() {
 			mockRepo.CreateError = errors.New("db error")
-			addr := &model.Address{UserID: userID}
+			addr := &model.Address{UserID: userID, Line1: "Hauptstr. 1", City: "Berlin", PostalCode: "10115", Country: "DE"}
 
 			err := addrService.CreateAddress(ctx, addr)
 			Expect(err).To(HaveOccurred())
@@ -97,9 +102,12 @@ var _ = Describe("AddressService", func() {
 
 		BeforeEach(func() {
 			existingAddr = &model.Address{
-				UserID: userID,
-				Label:  "Work",
-				Line1:  "Work Place",
+				UserID:     userID,
+				Label:      "Work",
+				Line1:      "Work Place",
+				City:       "Wien",
+				PostalCode: "1010",
+				Country:    "AT",
 			}
 			err := mockRepo.Create(ctx, existingAddr)
 			Expect(err).NotTo(HaveOccurred())
@@ -116,6 +124,29 @@ var _ = Describe("AddressService", func() {
 			Expect(stored.Line1).To(Equal("New Work Place"))
 		})
 
+		It("should apply the same validation as on create", func() {
+			existingAddr.PostalCode = "10115"
+			err := addrService.UpdateAddress(ctx, existingAddr)
+			Expect(err).To(MatchError(service.ErrInvalidAddress))
+
+			var addrErr *service.AddressError
+			Expect(errors.As(err, &addrErr)).To(BeTrue())
+			Expect(addrErr.Fields).To(HaveKey("postalCode"))
+			stored, _ := mockRepo.Get(ctx, existingAddr.ID, userID)
+			Expect(stored.PostalCode).To(Equal("1010"))
+		})
+
+		It("should not update a missing or foreign address", func() {
+			foreign := *existingAddr
+			foreign.UserID = "other_user"
+			foreign.Line1 = "Taken Over"
+			Expect(addrService.UpdateAddress(ctx, &foreign)).To(MatchError(service.ErrAddressNotFound))
+
+			stored, err := mockRepo.Get(ctx, existingAddr.ID, userID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.Line1).To(Equal("Work Place"))
+		})
+
 		It("should unset defaults if updated address becomes default", func() {
 			// Create another default address
 			otherDefault := &model.Address{
@@ -138,6 +169,73 @@ var _ = Describe("AddressService", func() {
 		})
 	})
 
+	Describe("ValidateAddress", func() {
+		address := func(country, postalCode string) *model.Address {
+			return &model.Address{Line1: "Main Street 1", City: "Town", Country: country, PostalCode: postalCode}
+		}
+
+		DescribeTable("postal codes",
+			func(country, postalCode string, valid bool) {
+				err := service.ValidateAddress(address(country, postalCode))
+				if valid {
+					Expect(err).NotTo(HaveOccurred())
+				} else {
+					Expect(err).To(MatchError(service.ErrInvalidAddress))
+				}
+			},
+			Entry("DE", "DE", "10115", true),
+			Entry("DE with four digits", "DE", "1011", false),
+			Entry("AT", "AT", "1010", true),
+			Entry("CH", "CH", "8001", true),
+			Entry("CH with five digits", "CH", "80010", false),
+			Entry("LI", "LI", "9490", true),
+			Entry("HR", "HR", "10000", true),
+			Entry("HR with letters", "HR", "HR-10000", false),
+			Entry("NL", "NL", "1012 ab", true),
+			Entry("PL", "PL", "00-950", true),
+			Entry("PL without dash", "PL", "00950", false),
+			Entry("PT", "PT", "1100-148", true),
+			Entry("IE", "IE", "D02 X285", true),
+			Entry("MT", "MT", "VLT 1117", true),
+			Entry("SE with space", "SE", "114 55", true),
+			Entry("GB", "GB", "SW1A 1AA", true),
+			Entry("US ZIP+4", "US", "10001-1234", true),
+			Entry("other countries", "JP", "100-0001", true),
+			Entry("country without postal codes", "HK", "", true),
+			Entry("missing postal code", "FR", "", false),
+		)
+
+		It("should name every invalid field", func() {
+			addr := &model.Address{Label: strings.Repeat("x", 51), Country: "XX", CustomerType: "reseller"}
+			err := service.ValidateAddress(addr)
+
+			var addrErr *service.AddressError
+			Expect(errors.As(err, &addrErr)).To(BeTrue())
+			Expect(addrErr.Fields).To(HaveKey("label"))
+			Expect(addrErr.Fields).To(HaveKey("line1"))
+			Expect(addrErr.Fields).To(HaveKey("city"))
+			Expect(addrErr.Fields).To(HaveKeyWithValue("country", "must be an ISO 3166-1 alpha-2 country code"))
+			Expect(addrErr.Fields).To(HaveKey("customerType"))
+		})
+
+		It("should normalize the address", func() {
+			addr := address(" hr ", " 10000 ")
+			addr.Line1 = "  Ilica 1 "
+			Expect(service.ValidateAddress(addr)).To(Succeed())
+			Expect(addr.Country).To(Equal("HR"))
+			Expect(addr.PostalCode).To(Equal("10000"))
+			Expect(addr.Line1).To(Equal("Ilica 1"))
+			Expect(addr.CustomerType).To(Equal(model.CustomerPrivate))
+		})
+
+		It("should reject unknown countries on create", func() {
+			addr := address("EU", "10115")
+			addr.UserID = userID
+			Expect(addrService.CreateAddress(ctx, addr)).To(MatchError(service.ErrInvalidAddress))
+			Expect(mockRepo.Addresses).To(BeEmpty())
+		})
+	})
+
 	Describe("ListAddresses", func() {
 		It("should list addresses for user", func() {
 			mockRepo.Create(ctx, &model.Address{UserID: userID, Label: "A1"})
@@ -0,0 +1,194 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/deicod/dysv/internal/model"
+)
+
+// countryCodes are the officially assigned ISO 3166-1 alpha-2 codes
+var countryCodes = codeSet(`
+	AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ
+	BA BB BD BE BF BG BH BI BJ BL BM BN BO BQ BR BS BT BV BW BY BZ
+	CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV CW CX CY CZ
+	DE DJ DK DM DO DZ EC EE EG EH ER ES ET FI FJ FK FM FO FR
+	GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY
+	HK HM HN HR HT HU ID IE IL IM IN IO IQ IR IS IT JE JM JO JP
+	KE KG KH KI KM KN KP KR KW KY KZ LA LB LC LI LK LR LS LT LU LV LY
+	MA MC MD ME MF MG MH MK ML MM MN MO MP MQ MR MS MT MU MV MW MX MY MZ
+	NA NC NE NF NG NI NL NO NP NR NU NZ OM PA PE PF PG PH PK PL PM PN PR PS PT PW PY
+	QA RE RO RS RU RW SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS ST SV SX SY SZ
+	TC TD TF TG TH TJ TK TL TM TN TO TR TT TV TW TZ UA UG UM US UY UZ
+	VA VC VE VG VI VN VU WF WS YE YT ZA ZM ZW`)
+
+// noPostalCodes are countries without a postal code system
+var noPostalCodes = codeSet(`
+	AE AG AO AW BF BI BJ BO BS BW BZ CD CF CG CI CK CM DJ DM ER FJ GA GD GH GM GQ GY
+	HK JM KI KM KN KP LC ML MO MR MW NR NU QA RW SB SC SL SR ST SY TD TF TG TK TL TO
+	TT TV UG VU YE ZW`)
+
+// postalCodePatterns are the postal code formats of the DACH region, the EU
+// and the other countries we quote a currency for, on the upper-cased code
+var postalCodePatterns = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^\d{4}$`),
+	"BE": regexp.MustCompile(`^\d{4}$`),
+	"BG": regexp.MustCompile(`^\d{4}$`),
+	"CH": regexp.MustCompile(`^\d{4}$`),
+	"CY": regexp.MustCompile(`^\d{4}$`),
+	"CZ": regexp.MustCompile(`^\d{3} ?\d{2}$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"DK": regexp.MustCompile(`^\d{4}$`),
+	"EE": regexp.MustCompile(`^\d{5}$`),
+	"ES": regexp.MustCompile(`^\d{5}$`),
+	"FI": regexp.MustCompile(`^\d{5}$`),
+	"FR": regexp.MustCompile(`^\d{5}$`),
+	"GB": regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`),
+	"GR": regexp.MustCompile(`^\d{3} ?\d{2}$`),
+	"HR": regexp.MustCompile(`^\d{5}$`),
+	"HU": regexp.MustCompile(`^\d{4}$`),
+	"IE": regexp.MustCompile(`^([AC-FHKNPRTV-Y]\d{2}|D6W) ?[0-9AC-FHKNPRTV-Y]{4}$`),
+	"IT": regexp.MustCompile(`^\d{5}$`),
+	"LI": regexp.MustCompile(`^94\d{2}$`),
+	"LT": regexp.MustCompile(`^(LT-)?\d{5}$`),
+	"LU": regexp.MustCompile(`^(L-)?\d{4}$`),
+	"LV": regexp.MustCompile(`^(LV-)?\d{4}$`),
+	"MT": regexp.MustCompile(`^[A-Z]{3} ?\d{4}$`),
+	"NL": regexp.MustCompile(`^\d{4} ?[A-Z]{2}$`),
+	"PL": regexp.MustCompile(`^\d{2}-\d{3}$`),
+	"PT": regexp.MustCompile(`^\d{4}-\d{3}$`),
+	"RO": regexp.MustCompile(`^\d{6}$`),
+	"SE": regexp.MustCompile(`^\d{3} ?\d{2}$`),
+	"SI": regexp.MustCompile(`^(SI-)?\d{4}$`),
+	"SK": regexp.MustCompile(`^\d{3} ?\d{2}$`),
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+}
+
+// genericPostalCode is the format accepted for all other countries
+var genericPostalCode = regexp.MustCompile(`^[A-Z0-9][A-Z0-9 -]{1,11}$`)
+
+// phonePattern accepts international numbers with common separators
+var phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 ()/.-]{5,24}$`)
+
+// Length limits of address fields, in characters
+const (
+	maxLabelLen   = 50
+	maxLineLen    = 100
+	maxCompanyLen = 100
+	maxEmailLen   = 254
+)
+
+func codeSet(codes string) map[string]bool {
+	set := make(map[string]bool)
+	for _, code := range strings.Fields(codes) {
+		set[code] = true
+	}
+	return set
+}
+
+// ValidCountry reports whether code is an ISO 3166-1 alpha-2 country code
+func ValidCountry(code string) bool {
+	return countryCodes[code]
+}
+
+// AddressError lists what is wrong with an address, by JSON field name
+type AddressError struct {
+	Fields map[string]string
+}
+
+func (e *AddressError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field, problem := range e.Fields {
+		fields = append(fields, field+" "+problem)
+	}
+	sort.Strings(fields)
+	return ErrInvalidAddress.Error() + ": " + strings.Join(fields, ", ")
+}
+
+func (e *AddressError) Unwrap() error {
+	return ErrInvalidAddress
+}
+
+// ValidateAddress trims and normalizes addr and checks it. It returns an
+// *AddressError naming every invalid field, or nil.
+func ValidateAddress(addr *model.Address) error {
+	for _, field := range []*string{&addr.Label, &addr.Company, &addr.Line1, &addr.Line2, &addr.City,
+		&addr.PostalCode, &addr.State, &addr.Country, &addr.VATID, &addr.Email, &addr.Phone} {
+		*field = strings.TrimSpace(*field)
+	}
+	addr.Country = strings.ToUpper(addr.Country)
+	addr.PostalCode = strings.ToUpper(strings.Join(strings.Fields(addr.PostalCode), " "))
+	if addr.CustomerType == "" {
+		addr.CustomerType = model.CustomerPrivate
+	}
+
+	fields := make(map[string]string)
+	required := func(name, value string) {
+		if value == "" {
+			fields[name] = "is required"
+		}
+	}
+	limit := func(name, value string, max int) {
+		if len([]rune(value)) > max {
+			fields[name] = fmt.Sprintf("must be at most %d characters", max)
+		}
+	}
+
+	required("line1", addr.Line1)
+	required("city", addr.City)
+	limit("label", addr.Label, maxLabelLen)
+	limit("company", addr.Company, maxCompanyLen)
+	limit("line1", addr.Line1, maxLineLen)
+	limit("line2", addr.Line2, maxLineLen)
+	limit("city", addr.City, maxLineLen)
+	limit("state", addr.State, maxLineLen)
+
+	switch {
+	case addr.Country == "":
+		fields["country"] = "is required"
+	case !ValidCountry(addr.Country):
+		fields["country"] = "must be an ISO 3166-1 alpha-2 country code"
+	case addr.PostalCode == "" && !noPostalCodes[addr.Country]:
+		fields["postalCode"] = "is required"
+	case addr.PostalCode != "":
+		pattern, ok := postalCodePatterns[addr.Country]
+		if !ok {
+			pattern = genericPostalCode
+		}
+		if !pattern.MatchString(addr.PostalCode) {
+			fields["postalCode"] = "is not a valid postal code for " + addr.Country
+		}
+	}
+
+	switch addr.CustomerType {
+	case model.CustomerPrivate:
+		if addr.VATID != "" {
+			fields["vatId"] = "is only accepted for business customers"
+		}
+	case model.CustomerBusiness:
+		required("company", addr.Company)
+	default:
+		fields["customerType"] = fmt.Sprintf("must be %q or %q", model.CustomerPrivate, model.CustomerBusiness)
+	}
+
+	if addr.Email != "" {
+		parsed, err := mail.ParseAddress(addr.Email)
+		if err != nil || parsed.Address != addr.Email || len(addr.Email) > maxEmailLen {
+			fields["email"] = "is not a valid email address"
+		}
+	}
+	if addr.Phone != "" && !phonePattern.MatchString(addr.Phone) {
+		fields["phone"] = "is not a valid phone number"
+	}
+
+	if len(fields) > 0 {
+		return &AddressError{Fields: fields}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+)
+
+// CartReminder emails users who opted in when their cart sits unchanged.
+// Each idle period gets one reminder; any change to the cart re-arms it.
+type CartReminder struct {
+	carts   repo.CartRepository
+	mailer  Mailer
+	baseURL string
+	after   time.Duration
+}
+
+// NewCartReminder creates a reminder job for carts idle longer than after.
+// Restore links point to baseURL + "/cart?restore=<token>".
+func NewCartReminder(carts repo.CartRepository, mailer Mailer, baseURL string, after time.Duration) *CartReminder {
+	return &CartReminder{
+		carts:   carts,
+		mailer:  mailer,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		after:   after,
+	}
+}
+
+// Run sends all due reminders and returns how many were sent. A failed send
+// is reported but does not stop the others; the cart stays due.
+func (r *CartReminder) Run(ctx context.Context) (int, error) {
+	carts, err := r.carts.FindReminderDue(ctx, time.Now().Add(-r.after))
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var errs []string
+	for _, cart := range carts {
+		token, err := restoreToken()
+		if err != nil {
+			return sent, err
+		}
+		if err := r.mailer.Send(ctx, cart.ReminderEmail, "Your dysv cart is waiting", r.body(&cart, token)); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", cart.ID.Hex(), err))
+			continue
+		}
+		if err := r.carts.MarkReminded(ctx, cart.ID, token, time.Now()); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	if len(errs) > 0 {
+		return sent, fmt.Errorf("failed to send %d reminders: %s", len(errs), strings.Join(errs, "; "))
+	}
+	return sent, nil
+}
+
+// body renders the plain-text reminder
+func (r *CartReminder) body(cart *model.Cart, token string) string {
+	var b strings.Builder
+	b.WriteString("Hello,\n\nyou left these items in your cart:\n\n")
+	for _, item := range cart.Items {
+		fmt.Fprintf(&b, "  %d × %s (%s / month)\n", item.Quantity, item.Name, item.Price)
+	}
+	fmt.Fprintf(&b, "\nPick up where you left off:\n%s/cart?restore=%s\n", r.baseURL, url.QueryEscape(token))
+	b.WriteString("\nYou get this email because you asked for cart reminders. Turn them off in your cart.\n")
+	return b.String()
+}
+
+// restoreToken returns a random, URL-safe token for a restore link
+func restoreToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
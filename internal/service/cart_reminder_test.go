@@ -0,0 +1,122 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service_test
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/deicod/dysv/internal/mocks"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/deicod/dysv/internal/service"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cart Expiry and Reminders", func() {
+	var (
+		ctx         context.Context
+		userCtx     context.Context
+		cartRepo    *repo.MockCartRepo
+		cartService *service.CartService
+		mailer      *mocks.MockMailer
+		reminder    *service.CartReminder
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		userCtx = service.WithUserID(ctx, "user_1")
+		catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		cartRepo = repo.NewMockCartRepo()
+		cartService = service.NewCartService(cartRepo, catalogService, nil, nil)
+		mailer = &mocks.MockMailer{}
+		reminder = service.NewCartReminder(cartRepo, mailer, "https://dysv.de/", 24*time.Hour)
+	})
+
+	// idleCart stores a user cart opted in to reminders and backdates it
+	idleCart := func(idle time.Duration) {
+		cart, err := cartService.AddPlan(userCtx, "sess", "node-starter", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.SetReminders(userCtx, "sess", "user@example.com", true)
+		Expect(err).NotTo(HaveOccurred())
+		cartRepo.Touch(cart.ID, time.Now().Add(-idle))
+	}
+
+	It("should not store a cart for a plain GET", func() {
+		cart, err := cartService.GetCart(ctx, "visitor")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.Items).To(BeEmpty())
+
+		_, err = cartRepo.FindBySessionID(ctx, "visitor")
+		Expect(err).To(MatchError(repo.ErrNotFound))
+	})
+
+	It("should purge carts older than the TTL", func() {
+		old, err := cartService.AddPlan(ctx, "old", "static-micro", 1)
+		Expect(err).NotTo(HaveOccurred())
+		cartRepo.Touch(old.ID, time.Now().Add(-31*24*time.Hour))
+		_, err = cartService.AddPlan(ctx, "fresh", "static-micro", 1)
+		Expect(err).NotTo(HaveOccurred())
+
+		n, err := cartService.PurgeExpired(ctx, 30*24*time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(int64(1)))
+
+		_, err = cartRepo.FindBySessionID(ctx, "old")
+		Expect(err).To(MatchError(repo.ErrNotFound))
+		_, err = cartRepo.FindBySessionID(ctx, "fresh")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should require a login to opt in", func() {
+		_, err := cartService.SetReminders(ctx, "sess", "user@example.com", true)
+		Expect(err).To(MatchError(service.ErrLoginRequired))
+	})
+
+	It("should remind opted-in users once per idle period", func() {
+		idleCart(25 * time.Hour)
+
+		sent, err := reminder.Run(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sent).To(Equal(1))
+		Expect(mailer.Sent).To(HaveLen(1))
+		Expect(mailer.Sent[0].To).To(Equal("user@example.com"))
+		Expect(mailer.Sent[0].Body).To(ContainSubstring("1 × Node Starter"))
+		Expect(mailer.Sent[0].Body).To(ContainSubstring("https://dysv.de/cart?restore="))
+
+		sent, err = reminder.Run(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sent).To(BeZero())
+	})
+
+	It("should skip carts that are recent, empty or not opted in", func() {
+		idleCart(time.Hour)
+		_, err := cartService.AddPlan(service.WithUserID(ctx, "user_2"), "other", "static-micro", 1)
+		Expect(err).NotTo(HaveOccurred())
+
+		sent, err := reminder.Run(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sent).To(BeZero())
+	})
+
+	It("should restore the reminded cart into another session", func() {
+		idleCart(25 * time.Hour)
+		_, err := reminder.Run(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		body := mailer.Sent[0].Body
+		token := strings.Fields(body[strings.Index(body, "restore=")+len("restore="):])[0]
+
+		cart, err := cartService.RestoreCart(ctx, "new-device", token)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.UserID).To(BeEmpty())
+		Expect(cart.Items).To(HaveLen(1))
+		Expect(cart.Items[0].ItemID).To(Equal("node-starter"))
+
+		_, err = cartService.RestoreCart(ctx, "new-device", "bogus")
+		Expect(err).To(MatchError(service.ErrInvalidRestoreToken))
+	})
+})
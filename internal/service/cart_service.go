@@ -7,6 +7,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
@@ -14,73 +15,81 @@ import (
 	"github.com/deicod/dysv/internal/repo"
 )
 
-// Pricing constants (must match frontend pricing-data.ts)
-var Plans = map[string]model.Plan{
-	"static-micro": {
-		ID:             "static-micro",
-		Name:           "Static Micro",
-		MonthlyPrice:   3.90,
-		TargetAudience: "React/Vue SPAs",
-		Limits:         "Shared RAM, 1GB Storage",
-	},
-	"node-starter": {
-		ID:             "node-starter",
-		Name:           "Node Starter",
-		MonthlyPrice:   9.90,
-		TargetAudience: "Personal Blogs",
-		Limits:         "1 vCPU (Shared), 512MB RAM, 5GB Storage",
-	},
-	"node-pro": {
-		ID:             "node-pro",
-		Name:           "Node Pro",
-		MonthlyPrice:   39.90,
-		TargetAudience: "E-commerce/SaaS",
-		Limits:         "2 vCPU (Dedicated), 4GB RAM, 20GB Storage",
-	},
-}
-
-var Addons = map[string]model.Addon{
-	"de-domain": {
-		ID:           "de-domain",
-		Name:         ".de Domain",
-		MonthlyPrice: 1.00,
-	},
-}
-
-const YearlyDiscountMonths = 2
-
 // CartService handles cart business logic
 type CartService struct {
 	cartRepo repo.CartRepository
+	catalog  *CatalogService
+	coupons  *CouponService
+	credits  *ReferralService
 }
 
-// NewCartService creates a new cart service
-func NewCartService(cartRepo repo.CartRepository) *CartService {
+// NewCartService creates a new cart service.
+// coupons is optional; without it carts cannot take coupon codes.
+// credits is optional; without it account credit is not applied.
+func NewCartService(cartRepo repo.CartRepository, catalog *CatalogService, coupons *CouponService, credits *ReferralService) *CartService {
 	return &CartService{
 		cartRepo: cartRepo,
+		catalog:  catalog,
+		coupons:  coupons,
+		credits:  credits,
+	}
+}
+
+type userIDKey struct{}
+
+// WithUserID marks ctx as belonging to an authenticated user. Cart lookups
+// then prefer the user's cart over the anonymous cart of the session.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	if userID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// UserIDFrom returns the user set by WithUserID, or "" for anonymous requests
+func UserIDFrom(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDKey{}).(string)
+	return userID
+}
+
+type profileCurrencyKey struct{}
+
+// WithProfileCurrency sets the currency of the user's billing profile. An
+// empty cart whose currency was never chosen takes it on.
+func WithProfileCurrency(ctx context.Context, currency string) context.Context {
+	if currency == "" {
+		return ctx
 	}
+	return context.WithValue(ctx, profileCurrencyKey{}, currency)
 }
 
-// GetOrCreateCart gets existing cart or creates a new one
+// applyProfileCurrency switches an untouched empty cart to the currency set
+// by WithProfileCurrency. Only changes the cart in memory; it is stored with
+// the cart's next change.
+func (s *CartService) applyProfileCurrency(ctx context.Context, cart *model.Cart) {
+	currency, _ := ctx.Value(profileCurrencyKey{}).(string)
+	if currency == "" || currency == cart.Currency || len(cart.Items) > 0 || cart.CurrencyChosen {
+		return
+	}
+	if supported, err := s.catalog.SupportsCurrency(ctx, currency); err != nil || !supported {
+		return
+	}
+	cart.Currency = currency
+}
+
+// GetOrCreateCart gets existing cart or creates a new one. For an
+// authenticated user (see WithUserID) this is the user's cart, which claims
+// the session's anonymous cart if the user has none yet.
 func (s *CartService) GetOrCreateCart(ctx context.Context, sessionID string) (*model.Cart, error) {
-	cart, err := s.cartRepo.FindBySessionID(ctx, sessionID)
+	cart, err := s.findCart(ctx, sessionID)
 	if err == nil {
 		return cart, nil
 	}
 	if !errors.Is(err, repo.ErrNotFound) {
-		fmt.Printf("Service: GetOrCreateCart Find Error: %v\n", err)
 		return nil, err
 	}
 
-	// Create new cart
-	cart = &model.Cart{
-		SessionID:    sessionID,
-		Items:        []model.LineItem{},
-		BillingCycle: model.BillingMonthly,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
-	}
-
+	cart = newCart(sessionID, UserIDFrom(ctx))
 	if err := s.cartRepo.Create(ctx, cart); err != nil {
 		fmt.Printf("Service: GetOrCreateCart Create Error: %v\n", err)
 		return nil, err
@@ -88,174 +97,878 @@ func (s *CartService) GetOrCreateCart(ctx context.Context, sessionID string) (*m
 	return cart, nil
 }
 
-// AddPlan adds a plan to the cart (increments quantity if exists)
-func (s *CartService) AddPlan(ctx context.Context, sessionID, planID string, quantity int) (*model.Cart, error) {
-	plan, ok := Plans[planID]
-	if !ok {
-		return nil, ErrInvalidPlan
+// GetCart is GetOrCreateCart for read-only requests: without a stored cart
+// it returns an empty one without saving it, so visits alone leave no carts
+// behind to expire
+func (s *CartService) GetCart(ctx context.Context, sessionID string) (*model.Cart, error) {
+	cart, err := s.findCart(ctx, sessionID)
+	if errors.Is(err, repo.ErrNotFound) {
+		cart, err = newCart(sessionID, UserIDFrom(ctx)), nil
 	}
-	if quantity < 1 {
-		quantity = 1
+	if err != nil {
+		return nil, err
+	}
+	s.applyProfileCurrency(ctx, cart)
+	return cart, nil
+}
+
+// findCart looks up the user's cart, then the session's anonymous cart,
+// which an authenticated user claims. Returns repo.ErrNotFound for neither.
+func (s *CartService) findCart(ctx context.Context, sessionID string) (*model.Cart, error) {
+	userID := UserIDFrom(ctx)
+	if userID != "" {
+		cart, err := s.cartRepo.FindByUserID(ctx, userID)
+		if err == nil {
+			return s.expireQuote(ctx, withDefaults(cart))
+		}
+		if !errors.Is(err, repo.ErrNotFound) {
+			fmt.Printf("Service: GetOrCreateCart FindByUserID Error: %v\n", err)
+			return nil, err
+		}
 	}
 
-	cart, err := s.GetOrCreateCart(ctx, sessionID)
+	cart, err := s.cartRepo.FindBySessionID(ctx, sessionID)
 	if err != nil {
+		if !errors.Is(err, repo.ErrNotFound) {
+			fmt.Printf("Service: GetOrCreateCart Find Error: %v\n", err)
+		}
 		return nil, err
 	}
+	if userID != "" {
+		cart.UserID = userID
+		if err := s.save(ctx, cart); err != nil {
+			return nil, err
+		}
+	}
+	return s.expireQuote(ctx, withDefaults(cart))
+}
+
+// newCart returns an empty cart with the default billing cycle and currency
+func newCart(sessionID, userID string) *model.Cart {
+	return &model.Cart{
+		SessionID:    sessionID,
+		UserID:       userID,
+		Items:        []model.LineItem{},
+		BillingCycle: model.BillingMonthly,
+		Currency:     model.DefaultCurrency,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+}
+
+// maxCartAttempts bounds the read-modify-write retries on version conflicts
+const maxCartAttempts = 5
+
+// errUnchanged tells modifyCart that change left the cart as it was
+var errUnchanged = errors.New("cart unchanged")
+
+// modifyCart loads the session's cart, applies change and saves it. When
+// another request saved the cart in between, the save fails with
+// repo.ErrConflict and modifyCart starts over with a fresh copy, so change
+// must be safe to run more than once.
+func (s *CartService) modifyCart(ctx context.Context, sessionID string, change func(*model.Cart) error) (*model.Cart, error) {
+	for attempt := 1; ; attempt++ {
+		cart, err := s.GetOrCreateCart(ctx, sessionID)
+		if err == nil {
+			s.applyProfileCurrency(ctx, cart)
+			err = change(cart)
+			if errors.Is(err, errUnchanged) {
+				return cart, nil
+			}
+			if err == nil {
+				err = s.save(ctx, cart)
+			}
+		}
+		if err == nil {
+			return cart, nil
+		}
+		if !errors.Is(err, repo.ErrConflict) {
+			return nil, err
+		}
+		if attempt == maxCartAttempts {
+			return nil, fmt.Errorf("%w: %v", ErrCartConflict, err)
+		}
+	}
+}
 
-	// Check if plan already exists
-	found := false
+// save stores a changed cart. Every change restarts the cart's expiry and
+// re-arms the abandoned-cart reminder.
+func (s *CartService) save(ctx context.Context, cart *model.Cart) error {
+	cart.UpdatedAt = time.Now()
+	cart.ReminderSentAt = nil
+	return s.cartRepo.Update(ctx, cart)
+}
+
+// withDefaults fills fields missing from carts stored by older versions
+func withDefaults(cart *model.Cart) *model.Cart {
+	if cart.Currency == "" {
+		cart.Currency = model.DefaultCurrency // carts created before multi-currency
+	}
 	for i, item := range cart.Items {
-		if item.ItemType == "plan" && item.ItemID == planID {
-			cart.Items[i].Quantity += quantity
-			found = true
-			break
+		if item.ItemType == "plan" && len(item.Sites) != item.Quantity {
+			cart.Items[i].Sites = resizeSites(item.Sites, item.Quantity, model.SiteConfig{Region: model.DefaultRegion}) // carts created before site configuration
 		}
 	}
+	return cart
+}
 
-	if !found {
-		cart.Items = append(cart.Items, model.LineItem{
-			ItemID:   plan.ID,
-			ItemType: "plan",
-			Name:     plan.Name,
-			Price:    plan.MonthlyPrice,
-			Quantity: quantity,
-		})
+// resizeSites grows sites to n entries with copies of blank, or drops the
+// last ones
+func resizeSites(sites []model.SiteConfig, n int, blank model.SiteConfig) []model.SiteConfig {
+	if len(sites) >= n {
+		return sites[:n]
+	}
+	resized := append([]model.SiteConfig(nil), sites...)
+	for len(resized) < n {
+		resized = append(resized, blank)
 	}
+	return resized
+}
 
-	cart.UpdatedAt = time.Now()
+// ApplyQuote replaces the cart's contents with a saved quote, whose prices,
+// billing cycle and coupon terms then apply until the quote expires or the
+// cart is changed
+func (s *CartService) ApplyQuote(ctx context.Context, sessionID string, quote *model.SavedQuote) (*model.Cart, error) {
+	if quote.Expired(time.Now()) {
+		return nil, ErrQuoteExpired
+	}
+	return s.modifyCart(ctx, sessionID, func(cart *model.Cart) error {
+		cart.Items = append([]model.LineItem(nil), quote.Items...)
+		cart.BillingCycle = quote.BillingCycle
+		cart.Currency = quote.Currency
+		cart.CurrencyChosen = true
+		cart.CouponCode = quote.Quote.CouponCode
+		cart.QuoteID = quote.ID.Hex()
+		expiresAt := quote.ExpiresAt
+		cart.QuoteExpiresAt = &expiresAt
+		cart.QuoteCycle = quote.Cycle
+		cart.QuoteCoupon = quote.Coupon
+		return nil
+	})
+}
 
-	if err := s.cartRepo.Update(ctx, cart); err != nil {
+// releaseQuote returns a quoted cart to catalog prices. Changing the items,
+// billing cycle or currency leaves the quoted bundle, so its prices no
+// longer apply.
+func (s *CartService) releaseQuote(ctx context.Context, cart *model.Cart) error {
+	if cart.QuoteID == "" {
+		return nil
+	}
+	cart.QuoteID = ""
+	cart.QuoteExpiresAt = nil
+	cart.QuoteCycle = nil
+	cart.QuoteCoupon = nil
+	return s.repriceItems(ctx, cart.Items, cart.Currency)
+}
+
+// expireQuote releases the cart's quote once it has expired. The change is
+// saved with the cart's next write.
+func (s *CartService) expireQuote(ctx context.Context, cart *model.Cart) (*model.Cart, error) {
+	if cart.QuoteExpiresAt == nil || time.Now().Before(*cart.QuoteExpiresAt) {
+		return cart, nil
+	}
+	if err := s.releaseQuote(ctx, cart); err != nil {
 		return nil, err
 	}
 	return cart, nil
 }
 
-// UpdateItemQuantity updates the quantity of an item
-func (s *CartService) UpdateItemQuantity(ctx context.Context, sessionID, itemID string, quantity int) (*model.Cart, error) {
-	cart, err := s.GetOrCreateCart(ctx, sessionID)
+// MergeCarts moves the anonymous cart of sessionID into the cart of userID,
+// e.g. on login. Rules:
+//   - without a user cart the session cart is simply claimed by the user
+//   - a plan or addon in both carts keeps the larger quantity, so building
+//     the same cart on two devices does not double the order
+//   - billing cycle and currency come from the cart updated last, the session
+//     cart on a tie; the other cart's items are repriced in that currency
+//   - addons from the session cart that would break an addon rule are dropped
+//
+// The session cart is deleted after a merge. Returns the user's cart.
+func (s *CartService) MergeCarts(ctx context.Context, sessionID, userID string) (*model.Cart, error) {
+	ctx = WithUserID(ctx, userID)
+	for attempt := 1; ; attempt++ {
+		cart, err := s.mergeCarts(ctx, sessionID, userID)
+		if !errors.Is(err, repo.ErrConflict) {
+			return cart, err
+		}
+		if attempt == maxCartAttempts {
+			return nil, fmt.Errorf("%w: %v", ErrCartConflict, err)
+		}
+	}
+}
+
+// mergeCarts is one attempt of MergeCarts
+func (s *CartService) mergeCarts(ctx context.Context, sessionID, userID string) (*model.Cart, error) {
+
+	anon, err := s.cartRepo.FindBySessionID(ctx, sessionID)
+	if errors.Is(err, repo.ErrNotFound) {
+		return s.GetOrCreateCart(ctx, sessionID)
+	}
 	if err != nil {
 		return nil, err
 	}
+	anon = withDefaults(anon)
 
-	if quantity <= 0 {
-		return s.RemoveItem(ctx, sessionID, itemID)
+	cart, err := s.cartRepo.FindByUserID(ctx, userID)
+	if errors.Is(err, repo.ErrNotFound) {
+		return s.GetOrCreateCart(ctx, sessionID) // claims anon
+	}
+	if err != nil {
+		return nil, err
+	}
+	cart = withDefaults(cart)
+
+	// A quote loaded before login carries over into an empty user cart;
+	// merged with other items its bundle is gone
+	if anon.QuoteID != "" && len(cart.Items) == 0 {
+		cart.Items = anon.Items
+		cart.BillingCycle = anon.BillingCycle
+		cart.Currency = anon.Currency
+		cart.CurrencyChosen = anon.CurrencyChosen
+		cart.QuoteID = anon.QuoteID
+		cart.QuoteExpiresAt = anon.QuoteExpiresAt
+		cart.QuoteCycle = anon.QuoteCycle
+		cart.QuoteCoupon = anon.QuoteCoupon
+		anon.Items = nil
+	}
+	if len(anon.Items) > 0 {
+		if err := s.releaseQuote(ctx, anon); err != nil {
+			return nil, err
+		}
+		if err := s.releaseQuote(ctx, cart); err != nil {
+			return nil, err
+		}
 	}
 
-	found := false
-	for i, item := range cart.Items {
-		if item.ItemID == itemID {
-			cart.Items[i].Quantity = quantity
-			found = true
-			break
+	if !anon.UpdatedAt.Before(cart.UpdatedAt) {
+		cart.BillingCycle = anon.BillingCycle
+		if anon.Currency != cart.Currency {
+			if err := s.repriceItems(ctx, cart.Items, anon.Currency); err != nil {
+				return nil, err
+			}
+			cart.Currency = anon.Currency
+		}
+		cart.CurrencyChosen = anon.CurrencyChosen
+	} else if anon.Currency != cart.Currency {
+		if err := s.repriceItems(ctx, anon.Items, cart.Currency); err != nil {
+			return nil, err
 		}
 	}
 
-	if !found {
-		return cart, nil // Item not found, do nothing or return error? Current logic: idempotent success
+	// Plans first so addons from the session cart see every plan
+	for _, itemType := range []string{"plan", "addon"} {
+		for _, item := range anon.Items {
+			if item.ItemType != itemType {
+				continue
+			}
+			merged := mergeItem(cart.Items, item)
+			if itemType == "addon" {
+				if err := s.ValidateCart(ctx, &model.Cart{Items: merged}); err != nil {
+					fmt.Printf("Service: MergeCarts dropping %s: %v\n", item.ItemID, err)
+					continue
+				}
+			}
+			cart.Items = merged
+		}
 	}
 
-	cart.UpdatedAt = time.Now()
+	// The session cart's coupon carries over into a user cart without one,
+	// if the user may still use it
+	if cart.CouponCode == "" && anon.CouponCode != "" {
+		cart.CouponCode = anon.CouponCode
+		coupon, err := s.couponFor(ctx, cart)
+		if err != nil {
+			return nil, err
+		}
+		if coupon == nil {
+			fmt.Printf("Service: MergeCarts dropping coupon %s\n", anon.CouponCode)
+			cart.CouponCode = ""
+		}
+	}
 
-	if err := s.cartRepo.Update(ctx, cart); err != nil {
+	if err := s.save(ctx, cart); err != nil {
+		return nil, err
+	}
+	if err := s.cartRepo.Delete(ctx, anon.ID); err != nil && !errors.Is(err, repo.ErrNotFound) {
 		return nil, err
 	}
 	return cart, nil
 }
 
-// AddAddon adds an addon to the cart
-func (s *CartService) AddAddon(ctx context.Context, sessionID, addonID string) (*model.Cart, error) {
-	addon, ok := Addons[addonID]
-	if !ok {
-		return nil, ErrInvalidAddon
+// mergeItem returns a copy of items with item added, or with the larger of
+// both quantities (and that line's sites) if it is already present
+func mergeItem(items []model.LineItem, item model.LineItem) []model.LineItem {
+	merged := append([]model.LineItem(nil), items...)
+	for i, existing := range merged {
+		if existing.ItemType == item.ItemType && existing.ItemID == item.ItemID {
+			if item.Quantity > existing.Quantity {
+				merged[i].Quantity = item.Quantity
+				merged[i].Sites = item.Sites
+			}
+			return merged
+		}
 	}
+	return append(merged, item)
+}
 
-	cart, err := s.GetOrCreateCart(ctx, sessionID)
+// AddPlan adds a plan to the cart (increments quantity if exists)
+func (s *CartService) AddPlan(ctx context.Context, sessionID, planID string, quantity int) (*model.Cart, error) {
+	plan, err := s.catalog.GetPlan(ctx, planID)
 	if err != nil {
 		return nil, err
 	}
+	if quantity < 1 {
+		quantity = 1
+	}
 
-	// Check if addon already exists
-	for _, item := range cart.Items {
-		if item.ItemID == addonID && item.ItemType == "addon" {
-			return cart, nil // Already added
+	return s.modifyCart(ctx, sessionID, func(cart *model.Cart) error {
+		if err := s.releaseQuote(ctx, cart); err != nil {
+			return err
+		}
+		price, ok := plan.MonthlyPrices.In(cart.Currency)
+		if !ok {
+			return fmt.Errorf("%w: %s is not available in %s", ErrUnsupportedCurrency, plan.ID, cart.Currency)
+		}
+
+		// Check if plan already exists; every unit gets its own site
+		for i, item := range cart.Items {
+			if item.ItemType == "plan" && item.ItemID == planID {
+				cart.Items[i].Quantity += quantity
+				cart.Items[i].Sites = resizeSites(item.Sites, cart.Items[i].Quantity, plan.NewSite())
+				return nil
+			}
 		}
+
+		cart.Items = append(cart.Items, model.LineItem{
+			ItemID:   plan.ID,
+			ItemType: "plan",
+			Name:     plan.Name,
+			Price:    price,
+			Quantity: quantity,
+			Sites:    resizeSites(nil, quantity, plan.NewSite()),
+		})
+		return nil
+	})
+}
+
+// UpdateItemQuantity updates the quantity of an item
+func (s *CartService) UpdateItemQuantity(ctx context.Context, sessionID, itemID string, quantity int) (*model.Cart, error) {
+	if quantity <= 0 {
+		return s.RemoveItem(ctx, sessionID, itemID)
 	}
 
-	cart.Items = append(cart.Items, model.LineItem{
-		ItemID:   addon.ID,
-		ItemType: "addon",
-		Name:     addon.Name,
-		Price:    addon.MonthlyPrice,
-		Quantity: 1,
+	return s.modifyCart(ctx, sessionID, func(cart *model.Cart) error {
+		if err := s.releaseQuote(ctx, cart); err != nil {
+			return err
+		}
+		found := false
+		for i, item := range cart.Items {
+			if item.ItemID == itemID {
+				cart.Items[i].Quantity = quantity
+				if item.ItemType == "plan" {
+					plan, err := s.catalog.GetPlan(ctx, item.ItemID)
+					if err != nil {
+						return err
+					}
+					cart.Items[i].Sites = resizeSites(item.Sites, quantity, plan.NewSite())
+				}
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return errUnchanged // Item not found, do nothing or return error? Current logic: idempotent success
+		}
+		return s.ValidateCart(ctx, cart)
 	})
-	cart.UpdatedAt = time.Now()
+}
 
-	if err := s.cartRepo.Update(ctx, cart); err != nil {
+// AddAddon adds an addon to the cart
+func (s *CartService) AddAddon(ctx context.Context, sessionID, addonID string) (*model.Cart, error) {
+	addon, err := s.catalog.GetAddon(ctx, addonID)
+	if err != nil {
 		return nil, err
 	}
-	return cart, nil
+
+	return s.modifyCart(ctx, sessionID, func(cart *model.Cart) error {
+		// Check if addon already exists
+		for _, item := range cart.Items {
+			if item.ItemID == addonID && item.ItemType == "addon" {
+				return errUnchanged // Already added
+			}
+		}
+		if err := s.releaseQuote(ctx, cart); err != nil {
+			return err
+		}
+
+		price, ok := addon.MonthlyPrices.In(cart.Currency)
+		if !ok {
+			return fmt.Errorf("%w: %s is not available in %s", ErrUnsupportedCurrency, addon.ID, cart.Currency)
+		}
+
+		cart.Items = append(cart.Items, model.LineItem{
+			ItemID:   addon.ID,
+			ItemType: "addon",
+			Name:     addon.Name,
+			Price:    price,
+			Quantity: 1,
+		})
+		return s.ValidateCart(ctx, cart)
+	})
 }
 
 // RemoveItem removes an item from the cart
 func (s *CartService) RemoveItem(ctx context.Context, sessionID, itemID string) (*model.Cart, error) {
-	cart, err := s.GetOrCreateCart(ctx, sessionID)
-	if err != nil {
-		return nil, err
+	return s.modifyCart(ctx, sessionID, func(cart *model.Cart) error {
+		if err := s.releaseQuote(ctx, cart); err != nil {
+			return err
+		}
+		var newItems []model.LineItem
+		for _, item := range cart.Items {
+			if item.ItemID != itemID {
+				newItems = append(newItems, item)
+			}
+		}
+
+		cart.Items = newItems
+		return s.ValidateCart(ctx, cart)
+	})
+}
+
+// ConfigureSite replaces the configuration of site index (0-based) of the
+// plan line itemID. Fields are checked as far as they are filled in;
+// ValidateSites requires them all before checkout.
+func (s *CartService) ConfigureSite(ctx context.Context, sessionID, itemID string, index int, site model.SiteConfig) (*model.Cart, error) {
+	site.Normalize()
+	if err := site.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSite, err)
 	}
 
-	var newItems []model.LineItem
+	return s.modifyCart(ctx, sessionID, func(cart *model.Cart) error {
+		for i, item := range cart.Items {
+			if item.ItemType != "plan" || item.ItemID != itemID {
+				continue
+			}
+			if index < 0 || index >= len(item.Sites) {
+				return fmt.Errorf("%w: %s has no site %d", ErrInvalidSite, item.Name, index+1)
+			}
+			plan, err := s.catalog.GetPlan(ctx, itemID)
+			if err != nil {
+				return err
+			}
+			if site.Framework != "" && !plan.AllowsFramework(site.Framework) {
+				return fmt.Errorf("%w: %s does not support %s", ErrInvalidSite, plan.Name, model.Frameworks[site.Framework])
+			}
+			cart.Items[i].Sites[index] = site
+			return checkSiteNames(cart)
+		}
+		return fmt.Errorf("%w: no plan %s in the cart", ErrInvalidSite, itemID)
+	})
+}
+
+// ValidateSites checks that every plan unit in the cart has a complete site
+// configuration its plan supports, with names unique within the cart
+func (s *CartService) ValidateSites(ctx context.Context, cart *model.Cart) error {
 	for _, item := range cart.Items {
-		if item.ItemID != itemID {
-			newItems = append(newItems, item)
+		if item.ItemType != "plan" {
+			continue
+		}
+		if len(item.Sites) != item.Quantity {
+			return fmt.Errorf("%w: %s needs %d sites, has %d", ErrInvalidSite, item.Name, item.Quantity, len(item.Sites))
+		}
+		plan, err := s.catalog.GetPlan(ctx, item.ItemID)
+		if err != nil {
+			return err
+		}
+		for i, site := range item.Sites {
+			if err := site.Validate(); err != nil {
+				return fmt.Errorf("%w: %s site %d: %v", ErrInvalidSite, item.Name, i+1, err)
+			}
+			if err := site.Complete(); err != nil {
+				return fmt.Errorf("%w: %s site %d: %w", ErrInvalidSite, item.Name, i+1, err)
+			}
+			if !plan.AllowsFramework(site.Framework) {
+				return fmt.Errorf("%w: %s does not support %s", ErrInvalidSite, plan.Name, model.Frameworks[site.Framework])
+			}
 		}
 	}
+	return checkSiteNames(cart)
+}
 
-	cart.Items = newItems
-	cart.UpdatedAt = time.Now()
+// checkSiteNames rejects site names used twice in the cart
+func checkSiteNames(cart *model.Cart) error {
+	seen := make(map[string]bool)
+	for _, item := range cart.Items {
+		for _, site := range item.Sites {
+			if site.Name == "" {
+				continue
+			}
+			if seen[site.Name] {
+				return fmt.Errorf("%w: site name %q is used twice", ErrInvalidSite, site.Name)
+			}
+			seen[site.Name] = true
+		}
+	}
+	return nil
+}
 
-	if err := s.cartRepo.Update(ctx, cart); err != nil {
+// SetBillingCycle sets the billing cycle; it must exist in the catalog
+func (s *CartService) SetBillingCycle(ctx context.Context, sessionID string, cycle model.BillingCycle) (*model.Cart, error) {
+	if _, err := s.catalog.GetCycle(ctx, cycle); err != nil {
+		return nil, err
+	}
+
+	cart, err := s.modifyCart(ctx, sessionID, func(cart *model.Cart) error {
+		if cart.BillingCycle != cycle {
+			if err := s.releaseQuote(ctx, cart); err != nil {
+				return err
+			}
+		}
+		cart.BillingCycle = cycle
+		fmt.Printf("SetBillingCycle: session=%s cycle=%s\n", sessionID, cycle)
+		spew.Dump("Service Cart Before Update", cart)
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("SetBillingCycle error: %v\n", err)
 		return nil, err
 	}
 	return cart, nil
 }
 
-// SetBillingCycle sets the billing cycle
-func (s *CartService) SetBillingCycle(ctx context.Context, sessionID string, cycle model.BillingCycle) (*model.Cart, error) {
-	cart, err := s.GetOrCreateCart(ctx, sessionID)
+// SetCurrency switches the cart to currency and reprices every item from the
+// catalog. chosen marks an explicit visitor choice (as opposed to a profile
+// default). Fails with ErrUnsupportedCurrency if any item has no price point.
+func (s *CartService) SetCurrency(ctx context.Context, sessionID, currency string, chosen bool) (*model.Cart, error) {
+	currency = strings.ToUpper(currency)
+	if !model.ValidCurrency(currency) {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, currency)
+	}
+	supported, err := s.catalog.SupportsCurrency(ctx, currency)
 	if err != nil {
 		return nil, err
 	}
+	if !supported {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, currency)
+	}
 
-	cart.BillingCycle = cycle
-	cart.UpdatedAt = time.Now()
+	return s.modifyCart(ctx, sessionID, func(cart *model.Cart) error {
+		if cart.Currency == currency && cart.QuoteID != "" {
+			return errUnchanged // keep the quoted prices
+		}
+		cart.QuoteID = ""
+		cart.QuoteExpiresAt = nil
+		cart.QuoteCycle = nil
+		cart.QuoteCoupon = nil
+		if err := s.repriceItems(ctx, cart.Items, currency); err != nil {
+			return err
+		}
+		cart.Currency = currency
+		cart.CurrencyChosen = cart.CurrencyChosen || chosen
+		return nil
+	})
+}
+
+// ApplyCoupon sets the cart's coupon code after checking that the cart may
+// use it
+func (s *CartService) ApplyCoupon(ctx context.Context, sessionID, code string) (*model.Cart, error) {
+	if s.coupons == nil {
+		return nil, ErrInvalidCoupon
+	}
+	return s.modifyCart(ctx, sessionID, func(cart *model.Cart) error {
+		coupon, err := s.coupons.Check(ctx, code, cart, UserIDFrom(ctx))
+		if err != nil {
+			return err
+		}
+		cart.CouponCode = coupon.Code
+		return nil
+	})
+}
 
-	fmt.Printf("SetBillingCycle: session=%s cycle=%s\n", sessionID, cycle)
-	spew.Dump("Service Cart Before Update", cart)
+// RemoveCoupon removes the cart's coupon code
+func (s *CartService) RemoveCoupon(ctx context.Context, sessionID string) (*model.Cart, error) {
+	return s.modifyCart(ctx, sessionID, func(cart *model.Cart) error {
+		if cart.CouponCode == "" {
+			return errUnchanged
+		}
+		cart.CouponCode = ""
+		return nil
+	})
+}
 
-	if err := s.cartRepo.Update(ctx, cart); err != nil {
-		fmt.Printf("SetBillingCycle error: %v\n", err)
+// CheckCoupon fails if the cart has a coupon code it may not use (any more).
+// The coupon of a saved quote stays valid until the quote expires; its
+// redemption limits are still enforced when checkout reserves it.
+func (s *CartService) CheckCoupon(ctx context.Context, cart *model.Cart) error {
+	if cart.CouponCode == "" {
+		return nil
+	}
+	if quotedCoupon(cart) != nil {
+		return nil
+	}
+	if s.coupons == nil {
+		return ErrInvalidCoupon
+	}
+	_, err := s.coupons.Check(ctx, cart.CouponCode, cart, UserIDFrom(ctx))
+	return err
+}
+
+// couponFor returns the coupon to price the cart with, or nil if it has
+// none or the coupon no longer applies. Checkout reports the latter through
+// CheckCoupon. A saved quote's coupon terms apply as quoted.
+func (s *CartService) couponFor(ctx context.Context, cart *model.Cart) (*model.Coupon, error) {
+	if coupon := quotedCoupon(cart); coupon != nil {
+		return coupon, nil
+	}
+	if cart.CouponCode == "" || s.coupons == nil {
+		return nil, nil
+	}
+	coupon, err := s.coupons.Check(ctx, cart.CouponCode, cart, UserIDFrom(ctx))
+	if errors.Is(err, ErrInvalidCoupon) || errors.Is(err, ErrCouponNotApplicable) || errors.Is(err, ErrCouponLimitReached) {
+		return nil, nil
+	}
+	return coupon, err
+}
+
+// quotedCoupon returns the coupon terms of the cart's saved quote while
+// they apply, or nil
+func quotedCoupon(cart *model.Cart) *model.Coupon {
+	if !quoteActive(cart) || cart.QuoteCoupon == nil || cart.QuoteCoupon.Code != cart.CouponCode {
+		return nil
+	}
+	return cart.QuoteCoupon
+}
+
+// quoteActive reports whether the cart carries a saved quote that has not
+// expired yet
+func quoteActive(cart *model.Cart) bool {
+	return cart.QuoteID != "" && cart.QuoteExpiresAt != nil && time.Now().Before(*cart.QuoteExpiresAt)
+}
+
+// SetReminders opts the user's cart in to abandoned-cart reminders sent to
+// email, or out again when enabled is false. Requires an authenticated user.
+func (s *CartService) SetReminders(ctx context.Context, sessionID, email string, enabled bool) (*model.Cart, error) {
+	if UserIDFrom(ctx) == "" {
+		return nil, ErrLoginRequired
+	}
+	email = strings.TrimSpace(email)
+	if enabled && email == "" {
+		return nil, fmt.Errorf("%w: no email address", ErrInvalidReminder)
+	}
+
+	return s.modifyCart(ctx, sessionID, func(cart *model.Cart) error {
+		cart.ReminderEmail = ""
+		if enabled {
+			cart.ReminderEmail = email
+		}
+		return nil
+	})
+}
+
+// RestoreCart brings back the cart a reminder link points to. Its owner
+// simply gets the cart again (restarting its expiry); anyone else gets its
+// items copied into their current cart, replacing what was there.
+func (s *CartService) RestoreCart(ctx context.Context, sessionID, token string) (*model.Cart, error) {
+	saved, err := s.cartRepo.FindByRestoreToken(ctx, token)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, ErrInvalidRestoreToken
+	}
+	if err != nil {
 		return nil, err
 	}
-	return cart, nil
+
+	// The owner's cart is the one GetOrCreateCart finds for them
+	return s.modifyCart(ctx, sessionID, func(cart *model.Cart) error {
+		if cart.ID == saved.ID {
+			return nil // only restart the expiry
+		}
+		cart.Items = saved.Items
+		cart.BillingCycle = saved.BillingCycle
+		cart.Currency = withDefaults(saved).Currency
+		cart.CurrencyChosen = saved.CurrencyChosen
+		return nil
+	})
 }
 
-// GetCartTotal calculates the cart total
-// For yearly: plans get 2 months free (×10), addons pay full 12 months
-func (s *CartService) GetCartTotal(cart *model.Cart) (monthly float64, yearly float64) {
-	var planMonthly, addonMonthly float64
+// PurgeExpired deletes carts unchanged for longer than ttl and returns how
+// many were deleted. It backs up the TTL index for deployments without it.
+func (s *CartService) PurgeExpired(ctx context.Context, ttl time.Duration) (int64, error) {
+	if ttl <= 0 {
+		return 0, nil
+	}
+	return s.cartRepo.DeleteStale(ctx, time.Now().Add(-ttl))
+}
+
+// ValidateCart checks every addon in the cart against its catalog rules:
+// required plans, the quantity cap per plan and mutually exclusive addons
+func (s *CartService) ValidateCart(ctx context.Context, cart *model.Cart) error {
+	planQty := make(map[string]int)
+	totalPlans := 0
+	addons := make(map[string]*model.Addon)
+	for _, item := range cart.Items {
+		switch item.ItemType {
+		case "plan":
+			planQty[item.ItemID] += item.Quantity
+			totalPlans += item.Quantity
+		case "addon":
+			addon, err := s.catalog.GetAddon(ctx, item.ItemID)
+			if err != nil {
+				return err
+			}
+			addons[addon.ID] = addon
+		}
+	}
 
 	for _, item := range cart.Items {
-		itemTotal := item.Price * float64(item.Quantity)
-		monthly += itemTotal
+		if item.ItemType != "addon" {
+			continue
+		}
+		addon := addons[item.ItemID]
+		rules := addon.Rules
+
+		plans := totalPlans
+		if len(rules.RequiredPlans) > 0 {
+			plans = 0
+			for _, planID := range rules.RequiredPlans {
+				plans += planQty[planID]
+			}
+			if plans == 0 {
+				return fmt.Errorf("%w: %s needs one of %s", ErrAddonRequiresPlan, addon.Name, strings.Join(rules.RequiredPlans, ", "))
+			}
+		} else if rules.RequiresPlan && plans == 0 {
+			return fmt.Errorf("%w: add a hosting plan before %s", ErrAddonRequiresPlan, addon.Name)
+		}
+
+		limit := 1
+		if rules.MaxPerPlan > 0 {
+			limit = rules.MaxPerPlan * max(plans, 1)
+		}
+		if item.Quantity > limit {
+			return fmt.Errorf("%w: at most %d × %s for the plans in this cart", ErrAddonLimitExceeded, limit, addon.Name)
+		}
+
+		for _, otherID := range rules.ExclusiveWith {
+			if other, ok := addons[otherID]; ok {
+				return fmt.Errorf("%w: %s and %s", ErrAddonConflict, addon.Name, other.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// repriceItems sets every item's unit price to its catalog price in currency
+func (s *CartService) repriceItems(ctx context.Context, items []model.LineItem, currency string) error {
+	for i, item := range items {
+		var prices model.PriceTable
 		if item.ItemType == "plan" {
-			planMonthly += itemTotal
+			plan, err := s.catalog.GetPlan(ctx, item.ItemID)
+			if err != nil {
+				return err
+			}
+			prices = plan.MonthlyPrices
 		} else {
-			addonMonthly += itemTotal
+			addon, err := s.catalog.GetAddon(ctx, item.ItemID)
+			if err != nil {
+				return err
+			}
+			prices = addon.MonthlyPrices
 		}
+		price, ok := prices.In(currency)
+		if !ok {
+			return fmt.Errorf("%w: %s is not available in %s", ErrUnsupportedCurrency, item.ItemID, currency)
+		}
+		items[i].Price = price
 	}
+	return nil
+}
 
-	// Yearly: plans get discount (10 months), addons pay full (12 months)
-	yearly = (planMonthly * float64(12-YearlyDiscountMonths)) + (addonMonthly * 12)
-	return
+// CycleFor returns the catalog definition of the cart's billing cycle, or
+// the one quoted while the cart carries a saved quote
+func (s *CartService) CycleFor(ctx context.Context, cart *model.Cart) (*model.BillingCycleDef, error) {
+	id := cart.BillingCycle
+	if id == "" {
+		id = model.BillingMonthly
+	}
+	if quoteActive(cart) && cart.QuoteCycle != nil && cart.QuoteCycle.ID == id {
+		return cart.QuoteCycle, nil
+	}
+	return s.catalog.GetCycle(ctx, id)
+}
+
+// Quote prices the cart for one invoice of its billing cycle, line by line,
+// after its coupon and the user's account credit, with VAT as decided by
+// TaxService. Checkout charges the same amounts. The zero tax decision
+// quotes net prices.
+func (s *CartService) Quote(ctx context.Context, cart *model.Cart, tax model.TaxDecision) (*model.Quote, error) {
+	return s.quote(ctx, cart, tax, true)
+}
+
+// QuoteWithoutCredit is Quote keeping the user's account credit for a later
+// order
+func (s *CartService) QuoteWithoutCredit(ctx context.Context, cart *model.Cart, tax model.TaxDecision) (*model.Quote, error) {
+	return s.quote(ctx, cart, tax, false)
+}
+
+func (s *CartService) quote(ctx context.Context, cart *model.Cart, tax model.TaxDecision, withCredit bool) (*model.Quote, error) {
+	cycle, err := s.CycleFor(ctx, cart)
+	if err != nil {
+		return nil, err
+	}
+	coupon, err := s.couponFor(ctx, cart)
+	if err != nil {
+		return nil, err
+	}
+	currency := cart.Currency
+	if currency == "" {
+		currency = model.DefaultCurrency
+	}
+	credit := model.Money{}
+	if withCredit {
+		if credit, err = s.creditFor(ctx, cart, currency, coupon); err != nil {
+			return nil, err
+		}
+	}
+	quote, err := BuildQuote(cycle, currency, cart.Items, coupon, credit, tax.RateBPS)
+	if err != nil {
+		return nil, err
+	}
+	quote.TaxCountry = tax.Country
+	quote.TaxTreatment = tax.Treatment
+	return quote, nil
+}
+
+// creditFor returns the account credit the cart's user can spend in currency.
+// Stripe takes one discount per checkout, so credit waits for a later order
+// while a recurring coupon is applied.
+func (s *CartService) creditFor(ctx context.Context, cart *model.Cart, currency string, coupon *model.Coupon) (model.Money, error) {
+	if s.credits == nil || cart.UserID == "" || (coupon != nil && coupon.Recurring) {
+		return model.Money{}, nil
+	}
+	return s.credits.Balance(ctx, cart.UserID, currency)
+}
+
+// GetCartTotal calculates the monthly list total and the amount invoiced per
+// billing cycle, after the cycle's discount rule and the coupon
+func (s *CartService) GetCartTotal(ctx context.Context, cart *model.Cart) (monthly model.Money, cycleTotal model.Money, err error) {
+	currency := cart.Currency
+	if currency == "" {
+		currency = model.DefaultCurrency
+	}
+
+	monthly = model.NewMoney(0, currency)
+	for _, item := range cart.Items {
+		itemMonthly, err := item.Price.Mul(int64(item.Quantity))
+		if err != nil {
+			return model.Money{}, model.Money{}, err
+		}
+		if monthly, err = monthly.Add(itemMonthly); err != nil {
+			return model.Money{}, model.Money{}, err
+		}
+	}
+
+	quote, err := s.Quote(ctx, cart, model.TaxDecision{})
+	if err != nil {
+		return model.Money{}, model.Money{}, err
+	}
+	return monthly, quote.Net, nil
 }
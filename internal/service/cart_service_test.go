@@ -4,56 +4,42 @@ Copyright © 2025 Darko Luketic <info@icod.de>
 package service_test
 
 import (
+	"context"
+
 	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
 	"github.com/deicod/dysv/internal/service"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
 var _ = Describe("Cart Service", func() {
-	Describe("Plans", func() {
-		It("should have static-micro plan", func() {
-			plan, ok := service.Plans["static-micro"]
-			Expect(ok).To(BeTrue())
-			Expect(plan.ID).To(Equal("static-micro"))
-			Expect(plan.Name).To(Equal("Static Micro"))
-			Expect(plan.MonthlyPrice).To(BeNumerically("==", 3.90))
-		})
-
-		It("should have node-starter plan", func() {
-			plan, ok := service.Plans["node-starter"]
-			Expect(ok).To(BeTrue())
-			Expect(plan.ID).To(Equal("node-starter"))
-			Expect(plan.Name).To(Equal("Node Starter"))
-			Expect(plan.MonthlyPrice).To(BeNumerically("==", 9.90))
-		})
-
-		It("should have node-pro plan", func() {
-			plan, ok := service.Plans["node-pro"]
-			Expect(ok).To(BeTrue())
-			Expect(plan.ID).To(Equal("node-pro"))
-			Expect(plan.Name).To(Equal("Node Pro"))
-			Expect(plan.MonthlyPrice).To(BeNumerically("==", 39.90))
-		})
-
-		It("should have 3 plans total", func() {
-			Expect(service.Plans).To(HaveLen(3))
-		})
+	var (
+		ctx            context.Context
+		catalogService *service.CatalogService
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		catalogService = service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
 	})
 
-	Describe("Addons", func() {
-		It("should have de-domain addon", func() {
-			addon, ok := service.Addons["de-domain"]
-			Expect(ok).To(BeTrue())
-			Expect(addon.ID).To(Equal("de-domain"))
-			Expect(addon.Name).To(Equal(".de Domain"))
-			Expect(addon.MonthlyPrice).To(BeNumerically("==", 1.00))
+	Describe("Default billing cycles", func() {
+		It("should give 2 months free on yearly billing", func() {
+			cycle, err := catalogService.GetCycle(ctx, model.BillingYearly)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cycle.FreeMonths).To(Equal(int64(2)))
+			Expect(cycle.Interval).To(Equal("year"))
+			Expect(cycle.IntervalCount).To(Equal(int64(1)))
 		})
-	})
 
-	Describe("YearlyDiscountMonths", func() {
-		It("should be 2 months discount", func() {
-			Expect(service.YearlyDiscountMonths).To(Equal(2))
+		It("should bill quarterly as three months", func() {
+			cycle, err := catalogService.GetCycle(ctx, model.BillingQuarterly)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cycle.Interval).To(Equal("month"))
+			Expect(cycle.IntervalCount).To(Equal(int64(3)))
 		})
 	})
 
@@ -61,51 +47,84 @@ var _ = Describe("Cart Service", func() {
 		var cartService *service.CartService
 
 		BeforeEach(func() {
-			// CartService with nil repo for total calculation tests
-			cartService = service.NewCartService(nil)
+			// CartService with nil cart repo for total calculation tests
+			cartService = service.NewCartService(nil, catalogService, nil, nil)
 		})
 
 		It("should calculate monthly total correctly for single plan", func() {
 			cart := &model.Cart{
 				Items: []model.LineItem{
-					{ItemID: "static-micro", ItemType: "plan", Name: "Static Micro", Price: 3.90, Quantity: 1},
+					{ItemID: "static-micro", ItemType: "plan", Name: "Static Micro", Price: eur(390), Quantity: 1},
 				},
 				BillingCycle: model.BillingMonthly,
 			}
 
-			monthly, yearly := cartService.GetCartTotal(cart)
+			monthly, cycleTotal, err := cartService.GetCartTotal(ctx, cart)
+			Expect(err).NotTo(HaveOccurred())
 
-			Expect(monthly).To(BeNumerically("~", 3.90, 0.01))
-			Expect(yearly).To(BeNumerically("~", 39.00, 0.01)) // 3.90 * 10 months
+			Expect(monthly.Amount).To(Equal(int64(390)))
+			Expect(cycleTotal.Amount).To(Equal(int64(390))) // billed every month
 		})
 
-		It("should calculate monthly total correctly for plan with addon", func() {
+		It("should calculate yearly total correctly for plan with addon", func() {
 			cart := &model.Cart{
 				Items: []model.LineItem{
-					{ItemID: "node-starter", ItemType: "plan", Name: "Node Starter", Price: 9.90, Quantity: 1},
-					{ItemID: "de-domain", ItemType: "addon", Name: ".de Domain", Price: 1.00, Quantity: 1},
+					{ItemID: "node-starter", ItemType: "plan", Name: "Node Starter", Price: eur(990), Quantity: 1},
+					{ItemID: "de-domain", ItemType: "addon", Name: ".de Domain", Price: eur(100), Quantity: 1},
 				},
-				BillingCycle: model.BillingMonthly,
+				BillingCycle: model.BillingYearly,
 			}
 
-			monthly, yearly := cartService.GetCartTotal(cart)
+			monthly, cycleTotal, err := cartService.GetCartTotal(ctx, cart)
+			Expect(err).NotTo(HaveOccurred())
 
-			Expect(monthly).To(BeNumerically("~", 10.90, 0.01)) // 9.90 + 1.00
-			Expect(yearly).To(BeNumerically("~", 111.00, 0.01)) // plan 9.90 * 10 months + addon 1.00 * 12 months
+			Expect(monthly.Amount).To(Equal(int64(1090)))     // 9.90 + 1.00
+			Expect(cycleTotal.Amount).To(Equal(int64(11100))) // plan 9.90 * 10 months + addon 1.00 * 12 months
 		})
 
 		It("should calculate yearly total with 2 months discount", func() {
 			cart := &model.Cart{
 				Items: []model.LineItem{
-					{ItemID: "node-pro", ItemType: "plan", Name: "Node Pro", Price: 39.90, Quantity: 1},
+					{ItemID: "node-pro", ItemType: "plan", Name: "Node Pro", Price: eur(3990), Quantity: 1},
 				},
 				BillingCycle: model.BillingYearly,
 			}
 
-			monthly, yearly := cartService.GetCartTotal(cart)
+			monthly, cycleTotal, err := cartService.GetCartTotal(ctx, cart)
+			Expect(err).NotTo(HaveOccurred())
 
-			Expect(monthly).To(BeNumerically("~", 39.90, 0.01))
-			Expect(yearly).To(BeNumerically("~", 399.00, 0.01)) // 39.90 * 10 months (2 free)
+			Expect(monthly.Amount).To(Equal(int64(3990)))
+			Expect(cycleTotal.Amount).To(Equal(int64(39900))) // 39.90 * 10 months (2 free)
+		})
+
+		It("should apply the quarterly percentage to plans only", func() {
+			cart := &model.Cart{
+				Items: []model.LineItem{
+					{ItemID: "node-starter", ItemType: "plan", Name: "Node Starter", Price: eur(990), Quantity: 1},
+					{ItemID: "de-domain", ItemType: "addon", Name: ".de Domain", Price: eur(100), Quantity: 1},
+				},
+				BillingCycle: model.BillingQuarterly,
+			}
+
+			_, cycleTotal, err := cartService.GetCartTotal(ctx, cart)
+			Expect(err).NotTo(HaveOccurred())
+
+			// plan 29.70 - 5% (1.49) = 28.21, addon 3.00
+			Expect(cycleTotal.Amount).To(Equal(int64(3121)))
+		})
+
+		It("should calculate two-year total with 6 months free", func() {
+			cart := &model.Cart{
+				Items: []model.LineItem{
+					{ItemID: "node-pro", ItemType: "plan", Name: "Node Pro", Price: eur(3990), Quantity: 1},
+				},
+				BillingCycle: model.BillingBiennial,
+			}
+
+			_, cycleTotal, err := cartService.GetCartTotal(ctx, cart)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cycleTotal.Amount).To(Equal(int64(71820))) // 39.90 * 18 months
 		})
 
 		It("should return zero for empty cart", func() {
@@ -114,25 +133,603 @@ var _ = Describe("Cart Service", func() {
 				BillingCycle: model.BillingMonthly,
 			}
 
-			monthly, yearly := cartService.GetCartTotal(cart)
+			monthly, cycleTotal, err := cartService.GetCartTotal(ctx, cart)
+			Expect(err).NotTo(HaveOccurred())
 
-			Expect(monthly).To(Equal(0.0))
-			Expect(yearly).To(Equal(0.0))
+			Expect(monthly.IsZero()).To(BeTrue())
+			Expect(cycleTotal.IsZero()).To(BeTrue())
 		})
 
 		It("should handle multiple quantity items", func() {
 			cart := &model.Cart{
 				Items: []model.LineItem{
-					{ItemID: "de-domain", ItemType: "addon", Name: ".de Domain", Price: 1.00, Quantity: 3},
+					{ItemID: "de-domain", ItemType: "addon", Name: ".de Domain", Price: eur(100), Quantity: 3},
 				},
-				BillingCycle: model.BillingMonthly,
+				BillingCycle: model.BillingYearly,
 			}
 
-			monthly, yearly := cartService.GetCartTotal(cart)
+			monthly, cycleTotal, err := cartService.GetCartTotal(ctx, cart)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(monthly.Amount).To(Equal(int64(300)))
+			Expect(cycleTotal.Amount).To(Equal(int64(3600))) // addons billed for 12 months
+		})
+
+		It("should reject cycles missing from the catalog", func() {
+			cart := &model.Cart{BillingCycle: model.BillingCycle("weekly")}
+
+			_, _, err := cartService.GetCartTotal(ctx, cart)
+			Expect(err).To(MatchError(service.ErrInvalidBillingCycle))
+		})
+	})
+})
+
+var _ = Describe("Quote", func() {
+	var (
+		ctx         context.Context
+		cartService *service.CartService
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		cartService = service.NewCartService(nil, catalogService, nil, nil)
+	})
+
+	It("should break the invoice down per line", func() {
+		cart := &model.Cart{
+			Items: []model.LineItem{
+				{ItemID: "node-starter", ItemType: "plan", Name: "Node Starter", Price: eur(990), Quantity: 2},
+				{ItemID: "de-domain", ItemType: "addon", Name: ".de Domain", Price: eur(100), Quantity: 1},
+			},
+			BillingCycle: model.BillingYearly,
+		}
+
+		quote, err := cartService.Quote(ctx, cart, model.TaxDecision{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quote.Currency).To(Equal("EUR"))
+		Expect(quote.Months).To(Equal(int64(12)))
+		Expect(quote.Lines).To(HaveLen(2))
+
+		plan := quote.Lines[0]
+		Expect(plan.UnitPrice).To(Equal(eur(9900))) // 10 of 12 months
+		Expect(plan.List).To(Equal(eur(23760)))
+		Expect(plan.Discount).To(Equal(eur(3960)))
+		Expect(plan.Net).To(Equal(eur(19800)))
+		Expect(plan.Gross).To(Equal(eur(19800)))
+
+		Expect(quote.Lines[1].Discount.IsZero()).To(BeTrue())
+		Expect(quote.Net).To(Equal(eur(21000)))
+		Expect(quote.Discount).To(Equal(eur(3960)))
+		Expect(quote.Tax.IsZero()).To(BeTrue())
+	})
+
+	It("should match the cycle total", func() {
+		cart := &model.Cart{
+			Items: []model.LineItem{
+				{ItemID: "node-starter", ItemType: "plan", Name: "Node Starter", Price: eur(990), Quantity: 1},
+				{ItemID: "de-domain", ItemType: "addon", Name: ".de Domain", Price: eur(100), Quantity: 1},
+			},
+			BillingCycle: model.BillingQuarterly,
+		}
+
+		quote, err := cartService.Quote(ctx, cart, model.TaxDecision{})
+		Expect(err).NotTo(HaveOccurred())
+		_, cycleTotal, err := cartService.GetCartTotal(ctx, cart)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quote.Net).To(Equal(cycleTotal))
+	})
+
+	It("should tax each line", func() {
+		cycle := &model.BillingCycleDef{ID: model.BillingMonthly, Months: 1}
+		items := []model.LineItem{
+			{ItemID: "static-micro", ItemType: "plan", Price: eur(390), Quantity: 1},
+			{ItemID: "de-domain", ItemType: "addon", Price: eur(100), Quantity: 1},
+		}
+
+		quote, err := service.BuildQuote(cycle, "EUR", items, nil, model.Money{}, 1900)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quote.Lines[0].Tax).To(Equal(eur(74))) // 74.1
+		Expect(quote.Lines[1].Tax).To(Equal(eur(19)))
+		Expect(quote.Tax).To(Equal(eur(93)))
+		Expect(quote.Gross).To(Equal(eur(583)))
+	})
+
+	It("should spread a coupon over the lines before tax like Stripe", func() {
+		cycle := &model.BillingCycleDef{ID: model.BillingMonthly, Months: 1}
+		coupon := &model.Coupon{Code: "OFF30", AmountOff: model.PriceTable{"EUR": eur(30)}}
+		items := []model.LineItem{
+			{ItemID: "static-micro", ItemType: "plan", Price: eur(390), Quantity: 1},
+			{ItemID: "de-domain", ItemType: "addon", Price: eur(100), Quantity: 1},
+		}
+
+		quote, err := service.BuildQuote(cycle, "EUR", items, coupon, model.Money{}, 1900)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quote.Lines[0].Coupon).To(Equal(eur(24))) // 23.88
+		Expect(quote.Lines[1].Coupon).To(Equal(eur(6)))  // 6.12
+		Expect(quote.Lines[0].Tax).To(Equal(eur(70)))    // 19% of 3.66
+		Expect(quote.Lines[1].Tax).To(Equal(eur(18)))    // 19% of 0.94
+		Expect(quote.Net).To(Equal(eur(460)))
+		Expect(quote.Tax).To(Equal(eur(88))) // not 87.4 rounded on the total
+		Expect(quote.Gross).To(Equal(eur(548)))
+
+		// Credit shares the same amount off
+		quote, err = service.BuildQuote(cycle, "EUR", items, coupon, eur(20), 1900)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quote.Coupon).To(Equal(eur(30)))
+		Expect(quote.Credit).To(Equal(eur(20)))
+		Expect(quote.Lines[0].Coupon.Amount + quote.Lines[0].Credit.Amount).To(Equal(int64(40)))
+		Expect(quote.Lines[1].Coupon.Amount + quote.Lines[1].Credit.Amount).To(Equal(int64(10)))
+		Expect(quote.Tax).To(Equal(eur(84))) // 66.5 and 17.1
+	})
+})
+
+var _ = Describe("Cart Currency", func() {
+	var (
+		ctx         context.Context
+		cartService *service.CartService
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		cartService = service.NewCartService(repo.NewMockCartRepo(), catalogService, nil, nil)
+	})
+
+	It("should default new carts to EUR", func() {
+		cart, err := cartService.GetOrCreateCart(ctx, "sess")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.Currency).To(Equal(model.DefaultCurrency))
+	})
+
+	It("should reprice existing items when the currency changes", func() {
+		_, err := cartService.AddPlan(ctx, "sess", "node-starter", 1)
+		Expect(err).NotTo(HaveOccurred())
+
+		cart, err := cartService.SetCurrency(ctx, "sess", "chf", true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.Currency).To(Equal("CHF"))
+		Expect(cart.CurrencyChosen).To(BeTrue())
+		Expect(cart.Items[0].Price.Currency).To(Equal("CHF"))
+
+		monthly, _, err := cartService.GetCartTotal(ctx, cart)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(monthly.Currency).To(Equal("CHF"))
+	})
+
+	It("should price new items in the cart currency", func() {
+		_, err := cartService.SetCurrency(ctx, "sess", "CHF", true)
+		Expect(err).NotTo(HaveOccurred())
+
+		cart, err := cartService.AddPlan(ctx, "sess", "static-micro", 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.Items[0].Price.Currency).To(Equal("CHF"))
+
+		cart, err = cartService.AddAddon(ctx, "sess", "de-domain")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.Items[1].Price.Currency).To(Equal("CHF"))
+	})
+
+	It("should reject currencies the catalog is not priced in", func() {
+		_, err := cartService.SetCurrency(ctx, "sess", "JPY", true)
+		Expect(err).To(MatchError(service.ErrUnsupportedCurrency))
+	})
+
+	Describe("CurrencyForCountry", func() {
+		It("should map Switzerland to CHF", func() {
+			Expect(service.CurrencyForCountry("ch")).To(Equal("CHF"))
+		})
+
+		It("should fall back to EUR", func() {
+			Expect(service.CurrencyForCountry("DE")).To(Equal("EUR"))
+			Expect(service.CurrencyForCountry("")).To(Equal("EUR"))
+		})
+	})
+})
+
+var _ = Describe("Addon Rules", func() {
+	var (
+		ctx            context.Context
+		catalogService *service.CatalogService
+		cartService    *service.CartService
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		catalogService = service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		cartService = service.NewCartService(repo.NewMockCartRepo(), catalogService, nil, nil)
+	})
+
+	It("should require a plan for de-domain", func() {
+		_, err := cartService.AddAddon(ctx, "sess", "de-domain")
+		Expect(err).To(MatchError(service.ErrAddonRequiresPlan))
+
+		cart, err := cartService.GetOrCreateCart(ctx, "sess")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.Items).To(BeEmpty())
+	})
+
+	It("should not remove the last plan an addon depends on", func() {
+		_, err := cartService.AddPlan(ctx, "sess", "node-starter", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.AddAddon(ctx, "sess", "de-domain")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = cartService.RemoveItem(ctx, "sess", "node-starter")
+		Expect(err).To(MatchError(service.ErrAddonRequiresPlan))
+		_, err = cartService.UpdateItemQuantity(ctx, "sess", "node-starter", 0)
+		Expect(err).To(MatchError(service.ErrAddonRequiresPlan))
 
-			Expect(monthly).To(BeNumerically("~", 3.00, 0.01))
-			Expect(yearly).To(BeNumerically("~", 36.00, 0.01)) // addons billed for 12 months
+		cart, err := cartService.RemoveItem(ctx, "sess", "de-domain")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.Items).To(HaveLen(1))
+	})
+
+	It("should cap the addon quantity per plan", func() {
+		_, err := cartService.AddPlan(ctx, "sess", "node-starter", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.AddAddon(ctx, "sess", "de-domain")
+		Expect(err).NotTo(HaveOccurred())
+
+		cart, err := cartService.UpdateItemQuantity(ctx, "sess", "de-domain", 5)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.Items[1].Quantity).To(Equal(5))
+
+		_, err = cartService.UpdateItemQuantity(ctx, "sess", "de-domain", 6)
+		Expect(err).To(MatchError(service.ErrAddonLimitExceeded))
+
+		_, err = cartService.UpdateItemQuantity(ctx, "sess", "node-starter", 2)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.UpdateItemQuantity(ctx, "sess", "de-domain", 10)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should only count the required plans", func() {
+		Expect(catalogService.SaveAddon(ctx, &model.Addon{
+			ID:            "node-backup",
+			Name:          "Node Backups",
+			MonthlyPrices: model.PriceTable{"EUR": eur(200)},
+			Rules:         model.AddonRules{RequiredPlans: []string{"node-starter", "node-pro"}},
+		})).To(Succeed())
+
+		_, err := cartService.AddPlan(ctx, "sess", "static-micro", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.AddAddon(ctx, "sess", "node-backup")
+		Expect(err).To(MatchError(service.ErrAddonRequiresPlan))
+
+		_, err = cartService.AddPlan(ctx, "sess", "node-pro", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.AddAddon(ctx, "sess", "node-backup")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject mutually exclusive addons", func() {
+		Expect(catalogService.SaveAddon(ctx, &model.Addon{
+			ID:            "ch-domain",
+			Name:          ".ch Domain",
+			MonthlyPrices: model.PriceTable{"EUR": eur(150)},
+			Rules:         model.AddonRules{RequiresPlan: true, ExclusiveWith: []string{"de-domain"}},
+		})).To(Succeed())
+
+		_, err := cartService.AddPlan(ctx, "sess", "static-micro", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.AddAddon(ctx, "sess", "de-domain")
+		Expect(err).NotTo(HaveOccurred())
+
+		// Only ch-domain declares the exclusion; it applies both ways
+		_, err = cartService.AddAddon(ctx, "sess", "ch-domain")
+		Expect(err).To(MatchError(service.ErrAddonConflict))
+	})
+
+	It("should reject rules that reference unknown catalog entries", func() {
+		err := catalogService.SaveAddon(ctx, &model.Addon{
+			ID:            "broken",
+			Name:          "Broken",
+			MonthlyPrices: model.PriceTable{"EUR": eur(100)},
+			Rules:         model.AddonRules{RequiredPlans: []string{"no-such-plan"}},
 		})
+		Expect(err).To(MatchError(service.ErrInvalidCatalogEntry))
+	})
+})
+
+var _ = Describe("Site Configuration", func() {
+	var (
+		ctx         context.Context
+		cartService *service.CartService
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		cartService = service.NewCartService(repo.NewMockCartRepo(), catalogService, nil, nil)
+	})
+
+	It("should add one site per plan unit", func() {
+		cart, err := cartService.AddPlan(ctx, "sess", "static-micro", 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.Items[0].Sites).To(Equal([]model.SiteConfig{
+			{Framework: model.FrameworkStatic, Region: model.DefaultRegion},
+			{Framework: model.FrameworkStatic, Region: model.DefaultRegion},
+		}))
+
+		cart, err = cartService.AddPlan(ctx, "sess", "static-micro", 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.Items[0].Sites).To(HaveLen(3))
+	})
+
+	It("should keep the configured sites when the quantity changes", func() {
+		_, err := cartService.AddPlan(ctx, "sess", "node-starter", 2)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.ConfigureSite(ctx, "sess", "node-starter", 0, model.SiteConfig{Name: "Shop", Framework: "nuxt", Region: "nbg"})
+		Expect(err).NotTo(HaveOccurred())
+
+		cart, err := cartService.UpdateItemQuantity(ctx, "sess", "node-starter", 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.Items[0].Sites).To(Equal([]model.SiteConfig{{Name: "shop", Framework: "nuxt", Region: "nbg"}}))
+
+		cart, err = cartService.UpdateItemQuantity(ctx, "sess", "node-starter", 3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.Items[0].Sites).To(HaveLen(3))
+		Expect(cart.Items[0].Sites[0].Name).To(Equal("shop"))
+		Expect(cart.Items[0].Sites[2]).To(Equal(model.SiteConfig{Region: model.DefaultRegion}))
+	})
+
+	It("should reject invalid site configurations", func() {
+		_, err := cartService.AddPlan(ctx, "sess", "static-micro", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.AddPlan(ctx, "sess", "node-starter", 1)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = cartService.ConfigureSite(ctx, "sess", "static-micro", 0, model.SiteConfig{Framework: "nextjs"})
+		Expect(err).To(MatchError(service.ErrInvalidSite))
+		_, err = cartService.ConfigureSite(ctx, "sess", "static-micro", 1, model.SiteConfig{Name: "blog"})
+		Expect(err).To(MatchError(service.ErrInvalidSite))
+		_, err = cartService.ConfigureSite(ctx, "sess", "static-micro", 0, model.SiteConfig{Name: "Not A Label"})
+		Expect(err).To(MatchError(service.ErrInvalidSite))
+		_, err = cartService.ConfigureSite(ctx, "sess", "de-domain", 0, model.SiteConfig{Name: "blog"})
+		Expect(err).To(MatchError(service.ErrInvalidSite))
+
+		_, err = cartService.ConfigureSite(ctx, "sess", "static-micro", 0, model.SiteConfig{Name: "blog"})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.ConfigureSite(ctx, "sess", "node-starter", 0, model.SiteConfig{Name: "blog"})
+		Expect(err).To(MatchError(service.ErrInvalidSite))
+	})
+
+	It("should require complete sites before checkout", func() {
+		_, err := cartService.AddPlan(ctx, "sess", "static-micro", 1)
+		Expect(err).NotTo(HaveOccurred())
+		cart, err := cartService.GetOrCreateCart(ctx, "sess")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cartService.ValidateSites(ctx, cart)
+		Expect(err).To(MatchError(service.ErrInvalidSite))
+		Expect(err).To(MatchError(model.ErrSiteIncomplete))
+
+		cart, err = cartService.ConfigureSite(ctx, "sess", "static-micro", 0, model.SiteConfig{Name: "blog", Framework: "static", Region: "fsn", Domain: "blog.example.de"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cartService.ValidateSites(ctx, cart)).To(Succeed())
+
+		metadata, err := service.SiteMetadata(cart.Items)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(metadata).To(Equal(map[string]string{
+			"site_1": `{"plan":"static-micro","name":"blog","framework":"static","region":"fsn","domain":"blog.example.de"}`,
+		}))
+	})
+})
+
+var _ = Describe("Cart Merge", func() {
+	var (
+		ctx            context.Context
+		catalogService *service.CatalogService
+		cartService    *service.CartService
+		userCtx        context.Context
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		catalogService = service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		cartService = service.NewCartService(repo.NewMockCartRepo(), catalogService, nil, nil)
+		userCtx = service.WithUserID(ctx, "user_1")
+	})
+
+	It("should let the user's cart follow them to another session", func() {
+		_, err := cartService.AddPlan(userCtx, "laptop", "node-pro", 1)
+		Expect(err).NotTo(HaveOccurred())
+
+		cart, err := cartService.GetOrCreateCart(userCtx, "phone")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.UserID).To(Equal("user_1"))
+		Expect(cart.Items).To(HaveLen(1))
+
+		// Logged out, the session no longer sees the user's cart
+		anon, err := cartService.GetOrCreateCart(ctx, "laptop")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(anon.Items).To(BeEmpty())
+	})
+
+	It("should claim the session cart when the user has none", func() {
+		_, err := cartService.AddPlan(ctx, "phone", "static-micro", 1)
+		Expect(err).NotTo(HaveOccurred())
+
+		cart, err := cartService.MergeCarts(ctx, "phone", "user_1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.UserID).To(Equal("user_1"))
+		Expect(cart.Items).To(HaveLen(1))
+	})
+
+	It("should keep the larger quantity of duplicate plans", func() {
+		_, err := cartService.AddPlan(userCtx, "laptop", "node-starter", 2)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.AddPlan(ctx, "phone", "node-starter", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.AddPlan(ctx, "phone", "static-micro", 1)
+		Expect(err).NotTo(HaveOccurred())
+
+		cart, err := cartService.MergeCarts(ctx, "phone", "user_1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.Items).To(HaveLen(2))
+		Expect(cart.Items[0].ItemID).To(Equal("node-starter"))
+		Expect(cart.Items[0].Quantity).To(Equal(2))
+		Expect(cart.Items[1].ItemID).To(Equal("static-micro"))
+
+		// The session cart is gone
+		anon, err := cartService.GetOrCreateCart(ctx, "phone")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(anon.Items).To(BeEmpty())
+	})
+
+	It("should take billing cycle and currency from the cart updated last", func() {
+		_, err := cartService.AddPlan(userCtx, "laptop", "node-starter", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.SetBillingCycle(userCtx, "laptop", model.BillingYearly)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = cartService.AddPlan(ctx, "phone", "static-micro", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.SetCurrency(ctx, "phone", "CHF", true)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.SetBillingCycle(ctx, "phone", model.BillingQuarterly)
+		Expect(err).NotTo(HaveOccurred())
+
+		cart, err := cartService.MergeCarts(ctx, "phone", "user_1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.BillingCycle).To(Equal(model.BillingQuarterly))
+		Expect(cart.Currency).To(Equal("CHF"))
+		for _, item := range cart.Items {
+			Expect(item.Price.Currency).To(Equal("CHF"))
+		}
+	})
+
+	It("should drop session addons that break addon rules", func() {
+		Expect(catalogService.SaveAddon(ctx, &model.Addon{
+			ID:            "ch-domain",
+			Name:          ".ch Domain",
+			MonthlyPrices: model.PriceTable{"EUR": eur(150)},
+			Rules:         model.AddonRules{RequiresPlan: true, ExclusiveWith: []string{"de-domain"}},
+		})).To(Succeed())
+
+		_, err := cartService.AddPlan(userCtx, "laptop", "node-pro", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.AddAddon(userCtx, "laptop", "de-domain")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = cartService.AddPlan(ctx, "phone", "static-micro", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.AddAddon(ctx, "phone", "ch-domain")
+		Expect(err).NotTo(HaveOccurred())
+
+		cart, err := cartService.MergeCarts(ctx, "phone", "user_1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.Items).To(HaveLen(3))
+		for _, item := range cart.Items {
+			Expect(item.ItemID).NotTo(Equal("ch-domain"))
+		}
+	})
+
+	It("should carry the session coupon over if the user may use it", func() {
+		couponService := service.NewCouponService(repo.NewMockCouponRepo(), catalogService)
+		cartService = service.NewCartService(repo.NewMockCartRepo(), catalogService, couponService, nil)
+		Expect(couponService.SaveCoupon(ctx, &model.Coupon{Code: "SPRING10", Name: "Spring", PercentOffBPS: 1000})).To(Succeed())
+		Expect(couponService.SaveCoupon(ctx, &model.Coupon{Code: "ONCE", Name: "Once", PercentOffBPS: 1000, MaxPerUser: 1})).To(Succeed())
+		Expect(couponService.Redeem(ctx, &model.Order{ID: bson.NewObjectID(), UserID: "user_1", CouponCode: "ONCE"})).To(Succeed())
+
+		_, err := cartService.AddPlan(userCtx, "laptop", "node-starter", 1)
+		Expect(err).NotTo(HaveOccurred())
+
+		// user_1 has used ONCE up
+		_, err = cartService.AddPlan(ctx, "phone", "static-micro", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.ApplyCoupon(ctx, "phone", "once")
+		Expect(err).NotTo(HaveOccurred())
+		cart, err := cartService.MergeCarts(ctx, "phone", "user_1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.CouponCode).To(BeEmpty())
+
+		_, err = cartService.AddPlan(ctx, "tablet", "static-micro", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.ApplyCoupon(ctx, "tablet", "spring10")
+		Expect(err).NotTo(HaveOccurred())
+		cart, err = cartService.MergeCarts(ctx, "tablet", "user_1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.CouponCode).To(Equal("SPRING10"))
+	})
+})
+
+// racingCartRepo lets another writer save the cart right before the first
+// racing Updates go through, like a second browser tab
+type racingCartRepo struct {
+	*repo.MockCartRepo
+	races int
+	other func(cart *model.Cart)
+}
+
+func (r *racingCartRepo) Update(ctx context.Context, cart *model.Cart) error {
+	if r.races > 0 {
+		r.races--
+		current, err := r.MockCartRepo.FindBySessionID(ctx, cart.SessionID)
+		Expect(err).NotTo(HaveOccurred())
+		r.other(current)
+		Expect(r.MockCartRepo.Update(ctx, current)).To(Succeed())
+	}
+	return r.MockCartRepo.Update(ctx, cart)
+}
+
+var _ = Describe("Cart Concurrency", func() {
+	var (
+		ctx         context.Context
+		cartRepo    *racingCartRepo
+		cartService *service.CartService
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		cartRepo = &racingCartRepo{
+			MockCartRepo: repo.NewMockCartRepo(),
+			other:        func(cart *model.Cart) { cart.BillingCycle = model.BillingYearly },
+		}
+		cartService = service.NewCartService(cartRepo, catalogService, nil, nil)
+		_, err := cartService.GetOrCreateCart(ctx, "sess")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject stale writes in the mock repository", func() {
+		first, err := cartRepo.FindBySessionID(ctx, "sess")
+		Expect(err).NotTo(HaveOccurred())
+		second, err := cartRepo.FindBySessionID(ctx, "sess")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(cartRepo.MockCartRepo.Update(ctx, first)).To(Succeed())
+		Expect(first.Version).To(Equal(second.Version + 1))
+		Expect(cartRepo.MockCartRepo.Update(ctx, second)).To(MatchError(repo.ErrConflict))
+	})
+
+	It("should retry and keep both concurrent changes", func() {
+		cartRepo.races = 1
+
+		cart, err := cartService.AddPlan(ctx, "sess", "node-starter", 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.Items).To(HaveLen(1))
+		Expect(cart.BillingCycle).To(Equal(model.BillingYearly))
+
+		stored, err := cartRepo.FindBySessionID(ctx, "sess")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.Items).To(HaveLen(1))
+		Expect(stored.Items[0].Quantity).To(Equal(1))
+		Expect(stored.BillingCycle).To(Equal(model.BillingYearly))
+	})
+
+	It("should give up with ErrCartConflict under constant contention", func() {
+		cartRepo.races = 100
+
+		_, err := cartService.AddPlan(ctx, "sess", "node-starter", 1)
+		Expect(err).To(MatchError(service.ErrCartConflict))
 	})
 })
 
@@ -165,6 +762,11 @@ var _ = Describe("Model Types", func() {
 		It("should have yearly constant", func() {
 			Expect(model.BillingYearly).To(Equal(model.BillingCycle("yearly")))
 		})
+
+		It("should have quarterly and two-year constants", func() {
+			Expect(model.BillingQuarterly).To(Equal(model.BillingCycle("quarterly")))
+			Expect(model.BillingBiennial).To(Equal(model.BillingCycle("biennial")))
+		})
 	})
 
 	Describe("LineItem", func() {
@@ -173,14 +775,14 @@ var _ = Describe("Model Types", func() {
 				ItemID:   "test-id",
 				ItemType: "plan",
 				Name:     "Test Plan",
-				Price:    9.99,
+				Price:    eur(999),
 				Quantity: 1,
 			}
 
 			Expect(item.ItemID).To(Equal("test-id"))
 			Expect(item.ItemType).To(Equal("plan"))
 			Expect(item.Name).To(Equal("Test Plan"))
-			Expect(item.Price).To(BeNumerically("==", 9.99))
+			Expect(item.Price).To(Equal(model.NewMoney(999, "EUR")))
 			Expect(item.Quantity).To(Equal(1))
 		})
 	})
@@ -212,3 +814,7 @@ var _ = Describe("Model Types", func() {
 		})
 	})
 })
+
+func eur(cents int64) model.Money {
+	return model.NewMoney(cents, model.DefaultCurrency)
+}
@@ -0,0 +1,442 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+)
+
+// MaxTrialDays is the longest trial Stripe accepts
+const MaxTrialDays = 730
+
+// DefaultPlans seeds an empty catalog (tiers from SPEC.md Section 2.A,
+// resources from SPEC_PATCH_01_CPU.md)
+var DefaultPlans = []model.Plan{
+	{
+		ID:            "static-micro",
+		Name:          "Static Micro",
+		MonthlyPrices: prices(390, 390),
+		Content: map[string]model.PlanContent{
+			"en": {Name: "Static Micro", TargetAudience: "React/Vue SPAs", Features: []string{
+				"Static site hosting", "Shared resources", "1GB NVMe storage", "SSL included", "German datacenter",
+			}},
+			"de": {Name: "Static Micro", TargetAudience: "React/Vue SPAs", Features: []string{
+				"Hosting für statische Websites", "Geteilte Ressourcen", "1GB NVMe-Speicher", "SSL inklusive", "Rechenzentrum in Deutschland",
+			}},
+			"hr": {Name: "Static Micro", TargetAudience: "React/Vue SPA aplikacije", Features: []string{
+				"Hosting statičkih stranica", "Dijeljeni resursi", "1GB NVMe pohrane", "SSL uključen", "Podatkovni centar u Njemačkoj",
+			}},
+		},
+		Resources: model.ResourceSpec{
+			StorageBytes: 1 * model.GiB,
+		},
+		Frameworks: []string{model.FrameworkStatic},
+		SortOrder:  1,
+	},
+	{
+		ID:            "node-starter",
+		Name:          "Node Starter",
+		MonthlyPrices: prices(990, 990),
+		Content: map[string]model.PlanContent{
+			"en": {Name: "Node Starter", TargetAudience: "Personal Blogs", Features: []string{
+				"Next.js / Nuxt support", "High-Performance Burstable CPU", "512MB RAM", "5GB NVMe storage", "SSL included", "German datacenter",
+			}},
+			"de": {Name: "Node Starter", TargetAudience: "Persönliche Blogs", Features: []string{
+				"Next.js / Nuxt Unterstützung", "Hochleistungs-Burst-CPU", "512MB RAM", "5GB NVMe-Speicher", "SSL inklusive", "Rechenzentrum in Deutschland",
+			}},
+			"hr": {Name: "Node Starter", TargetAudience: "Osobni blogovi", Features: []string{
+				"Podrška za Next.js / Nuxt", "Burstable CPU visokih performansi", "512MB RAM-a", "5GB NVMe pohrane", "SSL uključen", "Podatkovni centar u Njemačkoj",
+			}},
+		},
+		Resources: model.ResourceSpec{
+			CPURequestMillis:   100,
+			CPULimitMillis:     1000,
+			MemoryRequestBytes: 256 * model.MiB,
+			MemoryLimitBytes:   512 * model.MiB,
+			StorageBytes:       5 * model.GiB,
+		},
+		Frameworks: []string{model.FrameworkNextJS, model.FrameworkNuxt, model.FrameworkStatic},
+		TrialDays:  14,
+		SortOrder:  2,
+	},
+	{
+		ID:            "node-pro",
+		Name:          "Node Pro",
+		MonthlyPrices: prices(3990, 3990),
+		Content: map[string]model.PlanContent{
+			"en": {Name: "Node Pro", TargetAudience: "E-commerce/SaaS", Features: []string{
+				"Next.js / Nuxt support", "Dedicated Core Performance", "4GB RAM", "20GB NVMe storage", "SSL included", "German datacenter", "Priority support",
+			}},
+			"de": {Name: "Node Pro", TargetAudience: "E-Commerce/SaaS", Features: []string{
+				"Next.js / Nuxt Unterstützung", "Dedizierte Kernleistung", "4GB RAM", "20GB NVMe-Speicher", "SSL inklusive", "Rechenzentrum in Deutschland", "Priorisierter Support",
+			}},
+			"hr": {Name: "Node Pro", TargetAudience: "E-trgovina/SaaS", Features: []string{
+				"Podrška za Next.js / Nuxt", "Performanse namjenske jezgre", "4GB RAM-a", "20GB NVMe pohrane", "SSL uključen", "Podatkovni centar u Njemačkoj", "Prioritetna podrška",
+			}},
+		},
+		Resources: model.ResourceSpec{
+			CPURequestMillis:   1000,
+			CPULimitMillis:     2000,
+			MemoryRequestBytes: 2 * model.GiB,
+			MemoryLimitBytes:   4 * model.GiB,
+			StorageBytes:       20 * model.GiB,
+			Dedicated:          true,
+		},
+		Frameworks: []string{model.FrameworkNextJS, model.FrameworkNuxt, model.FrameworkStatic},
+		SortOrder:  3,
+	},
+}
+
+// DefaultAddons seeds an empty catalog
+var DefaultAddons = []model.Addon{
+	{
+		ID:            "de-domain",
+		Name:          ".de Domain",
+		MonthlyPrices: prices(100, 100),
+		Rules: model.AddonRules{
+			RequiresPlan: true,
+			MaxPerPlan:   5,
+		},
+		SortOrder: 1,
+	},
+}
+
+// DefaultBillingCycles seeds an empty catalog. Yearly keeps the original
+// "2 months free" rule; addons are only discounted where noted.
+var DefaultBillingCycles = []model.BillingCycleDef{
+	{
+		ID:            model.BillingMonthly,
+		Name:          "Monthly",
+		Interval:      "month",
+		IntervalCount: 1,
+		Months:        1,
+		SortOrder:     1,
+	},
+	{
+		ID:            model.BillingQuarterly,
+		Name:          "Quarterly",
+		Interval:      "month",
+		IntervalCount: 3,
+		Months:        3,
+		DiscountBPS:   500, // 5%
+		SortOrder:     2,
+	},
+	{
+		ID:            model.BillingYearly,
+		Name:          "Yearly",
+		Interval:      "year",
+		IntervalCount: 1,
+		Months:        12,
+		FreeMonths:    2,
+		SortOrder:     3,
+	},
+	{
+		ID:            model.BillingBiennial,
+		Name:          "Two years",
+		Interval:      "year",
+		IntervalCount: 2,
+		Months:        24,
+		FreeMonths:    6,
+		SortOrder:     4,
+	},
+}
+
+// CatalogService manages the plan, addon and billing cycle catalog
+type CatalogService struct {
+	repo repo.CatalogRepository
+}
+
+// NewCatalogService creates a new catalog service
+func NewCatalogService(repo repo.CatalogRepository) *CatalogService {
+	return &CatalogService{repo: repo}
+}
+
+// Seed fills an empty catalog with DefaultPlans, DefaultAddons and DefaultBillingCycles.
+// Existing entries are never overwritten.
+func (s *CatalogService) Seed(ctx context.Context) error {
+	plans, err := s.repo.ListPlans(ctx)
+	if err != nil {
+		return err
+	}
+	if len(plans) == 0 {
+		for _, plan := range DefaultPlans {
+			plan.UpdatedAt = time.Now()
+			if err := s.repo.UpsertPlan(ctx, &plan); err != nil {
+				return fmt.Errorf("seed plan %s: %w", plan.ID, err)
+			}
+		}
+	}
+
+	addons, err := s.repo.ListAddons(ctx)
+	if err != nil {
+		return err
+	}
+	if len(addons) == 0 {
+		for _, addon := range DefaultAddons {
+			addon.UpdatedAt = time.Now()
+			if err := s.repo.UpsertAddon(ctx, &addon); err != nil {
+				return fmt.Errorf("seed addon %s: %w", addon.ID, err)
+			}
+		}
+	}
+
+	cycles, err := s.repo.ListCycles(ctx)
+	if err != nil {
+		return err
+	}
+	if len(cycles) == 0 {
+		for _, cycle := range DefaultBillingCycles {
+			cycle.UpdatedAt = time.Now()
+			if err := s.repo.UpsertCycle(ctx, &cycle); err != nil {
+				return fmt.Errorf("seed billing cycle %s: %w", cycle.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ListPlans returns all plans in display order
+func (s *CatalogService) ListPlans(ctx context.Context) ([]model.Plan, error) {
+	return s.repo.ListPlans(ctx)
+}
+
+// GetPlan returns a plan by ID or ErrInvalidPlan
+func (s *CatalogService) GetPlan(ctx context.Context, id string) (*model.Plan, error) {
+	plan, err := s.repo.FindPlan(ctx, id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, ErrInvalidPlan
+	}
+	return plan, err
+}
+
+// SavePlan validates and stores a plan
+func (s *CatalogService) SavePlan(ctx context.Context, plan *model.Plan) error {
+	plan.ID = strings.TrimSpace(plan.ID)
+	if plan.ID == "" || strings.TrimSpace(plan.Name) == "" {
+		return fmt.Errorf("%w: id and name are required", ErrInvalidCatalogEntry)
+	}
+	if err := validatePrices(plan.MonthlyPrices); err != nil {
+		return err
+	}
+	for lang, content := range plan.Content {
+		if !model.SupportedLanguage(lang) {
+			return fmt.Errorf("%w: unsupported content language %q", ErrInvalidCatalogEntry, lang)
+		}
+		if strings.TrimSpace(content.Name) == "" {
+			return fmt.Errorf("%w: %s content needs a name", ErrInvalidCatalogEntry, lang)
+		}
+	}
+	if !plan.Resources.Valid() {
+		return fmt.Errorf("%w: resource requests must not exceed limits", ErrInvalidCatalogEntry)
+	}
+	for _, framework := range plan.Frameworks {
+		if _, ok := model.Frameworks[framework]; !ok {
+			return fmt.Errorf("%w: unknown framework %q", ErrInvalidCatalogEntry, framework)
+		}
+	}
+	if plan.TrialDays < 0 || plan.TrialDays > MaxTrialDays {
+		return fmt.Errorf("%w: trialDays must be between 0 and %d", ErrInvalidCatalogEntry, MaxTrialDays)
+	}
+	plan.UpdatedAt = time.Now()
+	return s.repo.UpsertPlan(ctx, plan)
+}
+
+// DeletePlan removes a plan from the catalog
+func (s *CatalogService) DeletePlan(ctx context.Context, id string) error {
+	err := s.repo.DeletePlan(ctx, id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return ErrInvalidPlan
+	}
+	return err
+}
+
+// ListAddons returns all addons in display order
+func (s *CatalogService) ListAddons(ctx context.Context) ([]model.Addon, error) {
+	return s.repo.ListAddons(ctx)
+}
+
+// GetAddon returns an addon by ID or ErrInvalidAddon
+func (s *CatalogService) GetAddon(ctx context.Context, id string) (*model.Addon, error) {
+	addon, err := s.repo.FindAddon(ctx, id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, ErrInvalidAddon
+	}
+	return addon, err
+}
+
+// SaveAddon validates and stores an addon
+func (s *CatalogService) SaveAddon(ctx context.Context, addon *model.Addon) error {
+	addon.ID = strings.TrimSpace(addon.ID)
+	if addon.ID == "" || strings.TrimSpace(addon.Name) == "" {
+		return fmt.Errorf("%w: id and name are required", ErrInvalidCatalogEntry)
+	}
+	if err := validatePrices(addon.MonthlyPrices); err != nil {
+		return err
+	}
+	if err := s.validateAddonRules(ctx, addon); err != nil {
+		return err
+	}
+	addon.UpdatedAt = time.Now()
+	return s.repo.UpsertAddon(ctx, addon)
+}
+
+// validateAddonRules checks that an addon's rules reference existing plans
+// and addons other than itself
+func (s *CatalogService) validateAddonRules(ctx context.Context, addon *model.Addon) error {
+	rules := addon.Rules
+	if rules.MaxPerPlan < 0 {
+		return fmt.Errorf("%w: maxPerPlan must not be negative", ErrInvalidCatalogEntry)
+	}
+	for _, planID := range rules.RequiredPlans {
+		if _, err := s.GetPlan(ctx, planID); err != nil {
+			return fmt.Errorf("%w: required plan %q does not exist", ErrInvalidCatalogEntry, planID)
+		}
+	}
+	for _, addonID := range rules.ExclusiveWith {
+		if addonID == addon.ID {
+			return fmt.Errorf("%w: addon cannot exclude itself", ErrInvalidCatalogEntry)
+		}
+		if _, err := s.GetAddon(ctx, addonID); err != nil {
+			return fmt.Errorf("%w: exclusive addon %q does not exist", ErrInvalidCatalogEntry, addonID)
+		}
+	}
+	return nil
+}
+
+// DeleteAddon removes an addon from the catalog
+func (s *CatalogService) DeleteAddon(ctx context.Context, id string) error {
+	err := s.repo.DeleteAddon(ctx, id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return ErrInvalidAddon
+	}
+	return err
+}
+
+// ListCycles returns all billing cycles in display order
+func (s *CatalogService) ListCycles(ctx context.Context) ([]model.BillingCycleDef, error) {
+	return s.repo.ListCycles(ctx)
+}
+
+// GetCycle returns a billing cycle by ID or ErrInvalidBillingCycle
+func (s *CatalogService) GetCycle(ctx context.Context, id model.BillingCycle) (*model.BillingCycleDef, error) {
+	cycle, err := s.repo.FindCycle(ctx, id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, ErrInvalidBillingCycle
+	}
+	return cycle, err
+}
+
+// SaveCycle validates and stores a billing cycle
+func (s *CatalogService) SaveCycle(ctx context.Context, cycle *model.BillingCycleDef) error {
+	cycle.ID = model.BillingCycle(strings.TrimSpace(string(cycle.ID)))
+	if cycle.ID == "" || strings.TrimSpace(cycle.Name) == "" {
+		return fmt.Errorf("%w: id and name are required", ErrInvalidCatalogEntry)
+	}
+	if cycle.Interval != "month" && cycle.Interval != "year" {
+		return fmt.Errorf("%w: interval must be month or year", ErrInvalidCatalogEntry)
+	}
+	if cycle.IntervalCount <= 0 {
+		return fmt.Errorf("%w: interval count must be positive", ErrInvalidCatalogEntry)
+	}
+	// Months must match the Stripe interval, otherwise the quote and the invoice diverge
+	months := cycle.IntervalCount
+	if cycle.Interval == "year" {
+		months *= 12
+	}
+	if cycle.Months != months {
+		return fmt.Errorf("%w: months must equal %d for %d %s", ErrInvalidCatalogEntry, months, cycle.IntervalCount, cycle.Interval)
+	}
+	if cycle.FreeMonths < 0 || cycle.FreeMonths >= cycle.Months {
+		return fmt.Errorf("%w: free months must be between 0 and %d", ErrInvalidCatalogEntry, cycle.Months-1)
+	}
+	if cycle.DiscountBPS < 0 || cycle.DiscountBPS >= 10000 {
+		return fmt.Errorf("%w: discount must be below 100%%", ErrInvalidCatalogEntry)
+	}
+	if cycle.FreeMonths > 0 && cycle.DiscountBPS > 0 {
+		return fmt.Errorf("%w: use either free months or a percentage discount", ErrInvalidCatalogEntry)
+	}
+	cycle.UpdatedAt = time.Now()
+	return s.repo.UpsertCycle(ctx, cycle)
+}
+
+// DeleteCycle removes a billing cycle from the catalog
+func (s *CatalogService) DeleteCycle(ctx context.Context, id model.BillingCycle) error {
+	err := s.repo.DeleteCycle(ctx, id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return ErrInvalidBillingCycle
+	}
+	return err
+}
+
+// StripePriceID returns the synced Stripe price for one unit of item billed
+// per cycle at unit, or "" if the item was never synced or its price has
+// changed since the last `dysv catalog sync`
+func (s *CatalogService) StripePriceID(ctx context.Context, item model.LineItem, cycle model.BillingCycle, unit model.Money) (string, error) {
+	var synced map[string]model.StripePrice
+	if item.ItemType == "plan" {
+		plan, err := s.GetPlan(ctx, item.ItemID)
+		if err != nil {
+			return "", err
+		}
+		synced = plan.StripePrices
+	} else {
+		addon, err := s.GetAddon(ctx, item.ItemID)
+		if err != nil {
+			return "", err
+		}
+		synced = addon.StripePrices
+	}
+
+	price, ok := synced[model.StripePriceKey(cycle, unit.Currency)]
+	if !ok || price.UnitAmount != unit.Amount {
+		return "", nil
+	}
+	return price.PriceID, nil
+}
+
+// validatePrices checks that a catalog price table has a positive price in
+// DefaultCurrency and that every entry is keyed by its own currency
+func validatePrices(prices model.PriceTable) error {
+	if _, ok := prices.In(model.DefaultCurrency); !ok {
+		return fmt.Errorf("%w: a %s price is required", ErrInvalidCatalogEntry, model.DefaultCurrency)
+	}
+	for code, price := range prices {
+		if !model.ValidCurrency(code) || price.Currency != code {
+			return fmt.Errorf("%w: price currency %q is invalid", ErrInvalidCatalogEntry, code)
+		}
+		if price.Amount <= 0 {
+			return fmt.Errorf("%w: monthly price must be positive", ErrInvalidCatalogEntry)
+		}
+	}
+	return nil
+}
+
+// SupportsCurrency reports whether at least one plan is priced in currency
+func (s *CatalogService) SupportsCurrency(ctx context.Context, currency string) (bool, error) {
+	plans, err := s.repo.ListPlans(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, plan := range plans {
+		if _, ok := plan.MonthlyPrices.In(currency); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// prices builds a seed price table from EUR and CHF cents
+func prices(eur, chf int64) model.PriceTable {
+	return model.PriceTable{
+		"EUR": model.NewMoney(eur, "EUR"),
+		"CHF": model.NewMoney(chf, "CHF"),
+	}
+}
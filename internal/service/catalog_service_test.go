@@ -0,0 +1,163 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service_test
+
+import (
+	"context"
+
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/deicod/dysv/internal/service"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Catalog Service", func() {
+	var (
+		mockRepo       *repo.MockCatalogRepo
+		catalogService *service.CatalogService
+		ctx            context.Context
+	)
+
+	BeforeEach(func() {
+		mockRepo = repo.NewMockCatalogRepo()
+		catalogService = service.NewCatalogService(mockRepo)
+		ctx = context.Background()
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+	})
+
+	Describe("Seed", func() {
+		It("should seed the three default tiers in order", func() {
+			plans, err := catalogService.ListPlans(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plans).To(HaveLen(3))
+			Expect(plans[0].ID).To(Equal("static-micro"))
+			Expect(plans[1].ID).To(Equal("node-starter"))
+			Expect(plans[2].ID).To(Equal("node-pro"))
+		})
+
+		It("should have static-micro plan", func() {
+			plan, err := catalogService.GetPlan(ctx, "static-micro")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Name).To(Equal("Static Micro"))
+			Expect(plan.MonthlyPrices["EUR"]).To(Equal(eur(390)))
+		})
+
+		It("should seed localized content", func() {
+			plan, err := catalogService.GetPlan(ctx, "node-pro")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Content).To(HaveKey("de"))
+			Expect(plan.Content).To(HaveKey("en"))
+			Expect(plan.Content).To(HaveKey("hr"))
+			Expect(plan.Localized("en").Features).To(ContainElement("Priority support"))
+		})
+
+		It("should have node-starter plan", func() {
+			plan, err := catalogService.GetPlan(ctx, "node-starter")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Name).To(Equal("Node Starter"))
+			Expect(plan.MonthlyPrices["EUR"]).To(Equal(eur(990)))
+		})
+
+		It("should have node-pro plan", func() {
+			plan, err := catalogService.GetPlan(ctx, "node-pro")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Name).To(Equal("Node Pro"))
+			Expect(plan.MonthlyPrices["EUR"]).To(Equal(eur(3990)))
+		})
+
+		It("should have de-domain addon", func() {
+			addon, err := catalogService.GetAddon(ctx, "de-domain")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addon.Name).To(Equal(".de Domain"))
+			Expect(addon.MonthlyPrices["EUR"]).To(Equal(eur(100)))
+		})
+
+		It("should not overwrite existing entries", func() {
+			plan, _ := catalogService.GetPlan(ctx, "node-pro")
+			plan.MonthlyPrices["EUR"] = eur(4490)
+			Expect(catalogService.SavePlan(ctx, plan)).To(Succeed())
+
+			Expect(catalogService.Seed(ctx)).To(Succeed())
+
+			plan, err := catalogService.GetPlan(ctx, "node-pro")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.MonthlyPrices["EUR"]).To(Equal(eur(4490)))
+		})
+	})
+
+	Describe("GetPlan", func() {
+		It("should return ErrInvalidPlan for unknown plans", func() {
+			_, err := catalogService.GetPlan(ctx, "unknown")
+			Expect(err).To(MatchError(service.ErrInvalidPlan))
+		})
+	})
+
+	Describe("SavePlan", func() {
+		It("should reject plans without a name", func() {
+			err := catalogService.SavePlan(ctx, &model.Plan{ID: "x", MonthlyPrices: model.PriceTable{"EUR": eur(100)}})
+			Expect(err).To(MatchError(service.ErrInvalidCatalogEntry))
+		})
+
+		It("should reject non-positive prices", func() {
+			err := catalogService.SavePlan(ctx, &model.Plan{ID: "x", Name: "X"})
+			Expect(err).To(MatchError(service.ErrInvalidCatalogEntry))
+		})
+
+		It("should reject content in unsupported languages", func() {
+			err := catalogService.SavePlan(ctx, &model.Plan{ID: "x", Name: "X", MonthlyPrices: model.PriceTable{"EUR": eur(100)},
+				Content: map[string]model.PlanContent{"fr": {Name: "X"}},
+			})
+			Expect(err).To(MatchError(service.ErrInvalidCatalogEntry))
+		})
+
+		It("should require a EUR price", func() {
+			err := catalogService.SavePlan(ctx, &model.Plan{ID: "x", Name: "X", MonthlyPrices: model.PriceTable{
+				"CHF": model.NewMoney(100, "CHF"),
+			}})
+			Expect(err).To(MatchError(service.ErrInvalidCatalogEntry))
+		})
+
+		It("should reject prices filed under the wrong currency", func() {
+			err := catalogService.SavePlan(ctx, &model.Plan{ID: "x", Name: "X", MonthlyPrices: model.PriceTable{
+				"EUR": eur(100),
+				"CHF": eur(100),
+			}})
+			Expect(err).To(MatchError(service.ErrInvalidCatalogEntry))
+		})
+	})
+
+	Describe("SaveCycle", func() {
+		It("should store a valid cycle", func() {
+			cycle := &model.BillingCycleDef{ID: "half-yearly", Name: "Half-yearly", Interval: "month", IntervalCount: 6, Months: 6, FreeMonths: 1}
+			Expect(catalogService.SaveCycle(ctx, cycle)).To(Succeed())
+
+			stored, err := catalogService.GetCycle(ctx, "half-yearly")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.FreeMonths).To(Equal(int64(1)))
+		})
+
+		It("should reject months that disagree with the Stripe interval", func() {
+			cycle := &model.BillingCycleDef{ID: "odd", Name: "Odd", Interval: "year", IntervalCount: 1, Months: 10}
+			Expect(catalogService.SaveCycle(ctx, cycle)).To(MatchError(service.ErrInvalidCatalogEntry))
+		})
+
+		It("should reject combining free months and a percentage", func() {
+			cycle := &model.BillingCycleDef{ID: "both", Name: "Both", Interval: "year", IntervalCount: 1, Months: 12, FreeMonths: 2, DiscountBPS: 500}
+			Expect(catalogService.SaveCycle(ctx, cycle)).To(MatchError(service.ErrInvalidCatalogEntry))
+		})
+	})
+
+	Describe("DeleteAddon", func() {
+		It("should remove the addon", func() {
+			Expect(catalogService.DeleteAddon(ctx, "de-domain")).To(Succeed())
+			_, err := catalogService.GetAddon(ctx, "de-domain")
+			Expect(err).To(MatchError(service.ErrInvalidAddon))
+		})
+
+		It("should return ErrInvalidAddon for unknown addons", func() {
+			Expect(catalogService.DeleteAddon(ctx, "unknown")).To(MatchError(service.ErrInvalidAddon))
+		})
+	})
+})
@@ -0,0 +1,252 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/deicod/dysv/internal/model"
+	"github.com/stripe/stripe-go/v82"
+)
+
+// Sync operations reported by CatalogSync
+const (
+	SyncCreateProduct = "create-product"
+	SyncUpdateProduct = "update-product"
+	SyncCreatePrice   = "create-price"
+	SyncArchivePrice  = "archive-price"
+)
+
+// SyncAction is one change CatalogSync made, or would make in a dry run
+type SyncAction struct {
+	Op       string
+	ItemType string // "plan" or "addon"
+	ItemID   string
+	PriceKey string      // StripePriceKey, for price operations
+	Amount   model.Money // per invoice, for created prices
+	StripeID string      // empty for objects not created in a dry run
+}
+
+// String renders the action for CLI output
+func (a SyncAction) String() string {
+	s := fmt.Sprintf("%-14s %s %s", a.Op, a.ItemType, a.ItemID)
+	if a.PriceKey != "" {
+		s += " " + a.PriceKey
+	}
+	if a.Op == SyncCreatePrice {
+		s += " " + a.Amount.String()
+	}
+	if a.StripeID != "" {
+		s += " (" + a.StripeID + ")"
+	}
+	return s
+}
+
+// CatalogSync pushes catalog plans and addons to Stripe Products and Prices,
+// one Price per billing cycle and currency, and stores the Stripe IDs back
+// in the catalog. Stripe prices are immutable: a changed amount creates a
+// new price, moves the lookup key over and archives the old one.
+type CatalogSync struct {
+	catalog *CatalogService
+	stripe  *stripe.Client
+}
+
+// NewCatalogSync creates a catalog sync
+func NewCatalogSync(catalog *CatalogService, client *stripe.Client) *CatalogSync {
+	return &CatalogSync{catalog: catalog, stripe: client}
+}
+
+// syncItem is the part of a plan or addon the sync reads and writes
+type syncItem struct {
+	itemType  string
+	id        string
+	name      string
+	monthly   model.PriceTable
+	productID string
+	prices    map[string]model.StripePrice
+}
+
+// Run syncs every plan and addon. With dryRun it only reports what it would
+// do and neither calls Stripe nor writes the catalog.
+func (s *CatalogSync) Run(ctx context.Context, dryRun bool) ([]SyncAction, error) {
+	cycles, err := s.catalog.ListCycles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []SyncAction
+
+	plans, err := s.catalog.ListPlans(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, plan := range plans {
+		item := &syncItem{itemType: "plan", id: plan.ID, name: plan.Name, monthly: plan.MonthlyPrices, productID: plan.StripeProductID, prices: plan.StripePrices}
+		done, syncErr := s.syncItem(ctx, item, cycles, dryRun)
+		actions = append(actions, done...)
+		if !dryRun && item.productID != "" {
+			plan.StripeProductID, plan.StripePrices = item.productID, item.prices
+			if err := s.catalog.SavePlan(ctx, &plan); err != nil {
+				return actions, fmt.Errorf("store stripe ids for plan %s: %w", plan.ID, err)
+			}
+		}
+		if syncErr != nil {
+			return actions, syncErr
+		}
+	}
+
+	addons, err := s.catalog.ListAddons(ctx)
+	if err != nil {
+		return actions, err
+	}
+	for _, addon := range addons {
+		item := &syncItem{itemType: "addon", id: addon.ID, name: addon.Name, monthly: addon.MonthlyPrices, productID: addon.StripeProductID, prices: addon.StripePrices}
+		done, syncErr := s.syncItem(ctx, item, cycles, dryRun)
+		actions = append(actions, done...)
+		if !dryRun && item.productID != "" {
+			addon.StripeProductID, addon.StripePrices = item.productID, item.prices
+			if err := s.catalog.SaveAddon(ctx, &addon); err != nil {
+				return actions, fmt.Errorf("store stripe ids for addon %s: %w", addon.ID, err)
+			}
+		}
+		if syncErr != nil {
+			return actions, syncErr
+		}
+	}
+	return actions, nil
+}
+
+func (s *CatalogSync) syncItem(ctx context.Context, item *syncItem, cycles []model.BillingCycleDef, dryRun bool) ([]SyncAction, error) {
+	var actions []SyncAction
+	metadata := map[string]string{"catalog_type": item.itemType, "catalog_id": item.id}
+
+	// Product
+	if item.productID == "" {
+		action := SyncAction{Op: SyncCreateProduct, ItemType: item.itemType, ItemID: item.id}
+		if !dryRun {
+			product, err := s.stripe.V1Products.Create(ctx, &stripe.ProductCreateParams{
+				Name:     stripe.String(item.name),
+				Metadata: metadata,
+			})
+			if err != nil {
+				return actions, fmt.Errorf("create product %s: %w", item.id, err)
+			}
+			item.productID = product.ID
+			action.StripeID = product.ID
+		}
+		actions = append(actions, action)
+	} else {
+		if !dryRun {
+			_, err := s.stripe.V1Products.Update(ctx, item.productID, &stripe.ProductUpdateParams{
+				Name:     stripe.String(item.name),
+				Active:   stripe.Bool(true),
+				Metadata: metadata,
+			})
+			if err != nil {
+				return actions, fmt.Errorf("update product %s: %w", item.id, err)
+			}
+		}
+		actions = append(actions, SyncAction{Op: SyncUpdateProduct, ItemType: item.itemType, ItemID: item.id, StripeID: item.productID})
+	}
+
+	// Prices the catalog wants, per cycle and currency
+	wanted := map[string]model.Money{}
+	recurring := map[string]model.BillingCycleDef{}
+	for _, cycle := range cycles {
+		for _, currency := range item.monthly.Currencies() {
+			monthly, _ := item.monthly.In(currency)
+			unit, err := CycleUnitPrice(&cycle, model.LineItem{ItemType: item.itemType, Price: monthly})
+			if err != nil {
+				return actions, err
+			}
+			key := model.StripePriceKey(cycle.ID, currency)
+			wanted[key] = unit
+			recurring[key] = cycle
+		}
+	}
+
+	// Work on a copy so a failure part-way still records what was created
+	prices := make(map[string]model.StripePrice, len(wanted))
+	for key, price := range item.prices {
+		prices[key] = price
+	}
+	defer func() { item.prices = prices }()
+
+	for _, key := range sortedKeys(wanted) {
+		unit := wanted[key]
+		existing, ok := item.prices[key]
+		if ok && existing.UnitAmount == unit.Amount {
+			continue
+		}
+
+		action := SyncAction{Op: SyncCreatePrice, ItemType: item.itemType, ItemID: item.id, PriceKey: key, Amount: unit}
+		if !dryRun {
+			cycle := recurring[key]
+			price, err := s.stripe.V1Prices.Create(ctx, &stripe.PriceCreateParams{
+				Product:    stripe.String(item.productID),
+				Currency:   stripe.String(strings.ToLower(unit.Currency)),
+				UnitAmount: stripe.Int64(unit.Amount),
+				Nickname:   stripe.String(fmt.Sprintf("%s (%s)", item.name, cycle.Name)),
+				Recurring: &stripe.PriceCreateRecurringParams{
+					Interval:      stripe.String(cycle.Interval),
+					IntervalCount: stripe.Int64(cycle.IntervalCount),
+				},
+				LookupKey:         stripe.String(item.id + ":" + key),
+				TransferLookupKey: stripe.Bool(true),
+				Metadata:          metadata,
+			})
+			if err != nil {
+				return actions, fmt.Errorf("create price %s %s: %w", item.id, key, err)
+			}
+			prices[key] = model.StripePrice{PriceID: price.ID, UnitAmount: unit.Amount}
+			action.StripeID = price.ID
+		}
+		actions = append(actions, action)
+
+		if ok {
+			archived, err := s.archivePrice(ctx, item, key, existing, dryRun)
+			actions = append(actions, archived)
+			if err != nil {
+				return actions, err
+			}
+		}
+	}
+
+	// Prices for cycles or currencies that left the catalog
+	for _, key := range sortedKeys(item.prices) {
+		if _, ok := wanted[key]; ok {
+			continue
+		}
+		archived, err := s.archivePrice(ctx, item, key, item.prices[key], dryRun)
+		actions = append(actions, archived)
+		if err != nil {
+			return actions, err
+		}
+		delete(prices, key)
+	}
+	return actions, nil
+}
+
+func (s *CatalogSync) archivePrice(ctx context.Context, item *syncItem, key string, price model.StripePrice, dryRun bool) (SyncAction, error) {
+	action := SyncAction{Op: SyncArchivePrice, ItemType: item.itemType, ItemID: item.id, PriceKey: key, StripeID: price.PriceID}
+	if dryRun {
+		return action, nil
+	}
+	if _, err := s.stripe.V1Prices.Update(ctx, price.PriceID, &stripe.PriceUpdateParams{Active: stripe.Bool(false)}); err != nil {
+		return action, fmt.Errorf("archive price %s: %w", price.PriceID, err)
+	}
+	return action, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
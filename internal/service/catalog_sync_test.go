@@ -0,0 +1,115 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service_test
+
+import (
+	"context"
+
+	"github.com/deicod/dysv/internal/mocks"
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/deicod/dysv/internal/service"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CatalogSync", func() {
+	var (
+		ctx            context.Context
+		stripeServer   *mocks.StripeServer
+		catalogService *service.CatalogService
+		catalogSync    *service.CatalogSync
+	)
+
+	// 3 plans + 1 addon, 4 cycles, 2 currencies
+	const productCount = 4
+	const priceCount = productCount * 4 * 2
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		stripeServer = mocks.NewStripeServer()
+		catalogService = service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		catalogSync = service.NewCatalogSync(catalogService, service.NewStripeClient("sk_test_123", stripeServer.URL))
+	})
+
+	AfterEach(func() {
+		stripeServer.Close()
+	})
+
+	It("should not touch Stripe or the catalog in a dry run", func() {
+		actions, err := catalogSync.Run(ctx, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actions).To(HaveLen(productCount + priceCount))
+		Expect(stripeServer.Requests).To(BeEmpty())
+
+		plan, _ := catalogService.GetPlan(ctx, "node-pro")
+		Expect(plan.StripeProductID).To(BeEmpty())
+	})
+
+	It("should create products and prices and store their IDs", func() {
+		_, err := catalogSync.Run(ctx, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stripeServer.Count("product")).To(Equal(productCount))
+		Expect(stripeServer.Count("price")).To(Equal(priceCount))
+
+		plan, _ := catalogService.GetPlan(ctx, "node-pro")
+		Expect(plan.StripeProductID).NotTo(BeEmpty())
+
+		yearly := plan.StripePrices[model.StripePriceKey(model.BillingYearly, "EUR")]
+		Expect(yearly.UnitAmount).To(Equal(int64(39900)))
+
+		price := stripeServer.Object(yearly.PriceID)
+		Expect(price["product"]).To(Equal(plan.StripeProductID))
+		Expect(price["currency"]).To(Equal("eur"))
+		Expect(price["recurring"]).To(HaveKeyWithValue("interval", "year"))
+	})
+
+	It("should be idempotent", func() {
+		_, err := catalogSync.Run(ctx, false)
+		Expect(err).NotTo(HaveOccurred())
+
+		actions, err := catalogSync.Run(ctx, false)
+		Expect(err).NotTo(HaveOccurred())
+		for _, action := range actions {
+			Expect(action.Op).To(Equal(service.SyncUpdateProduct))
+		}
+		Expect(stripeServer.Count("price")).To(Equal(priceCount))
+	})
+
+	It("should replace and archive prices whose amount changed", func() {
+		_, err := catalogSync.Run(ctx, false)
+		Expect(err).NotTo(HaveOccurred())
+
+		plan, _ := catalogService.GetPlan(ctx, "node-pro")
+		oldPrice := plan.StripePrices[model.StripePriceKey(model.BillingMonthly, "EUR")]
+		plan.MonthlyPrices["EUR"] = eur(4490)
+		Expect(catalogService.SavePlan(ctx, plan)).To(Succeed())
+
+		_, err = catalogSync.Run(ctx, false)
+		Expect(err).NotTo(HaveOccurred())
+
+		plan, _ = catalogService.GetPlan(ctx, "node-pro")
+		newPrice := plan.StripePrices[model.StripePriceKey(model.BillingMonthly, "EUR")]
+		Expect(newPrice.PriceID).NotTo(Equal(oldPrice.PriceID))
+		Expect(newPrice.UnitAmount).To(Equal(int64(4490)))
+		Expect(stripeServer.Object(oldPrice.PriceID)["active"]).To(BeFalse())
+	})
+
+	Describe("StripePriceID", func() {
+		It("should return the synced price only while the amount matches", func() {
+			_, err := catalogSync.Run(ctx, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			item := model.LineItem{ItemID: "node-starter", ItemType: "plan", Price: eur(990), Quantity: 1}
+			id, err := catalogService.StripePriceID(ctx, item, model.BillingMonthly, eur(990))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).NotTo(BeEmpty())
+
+			id, err = catalogService.StripePriceID(ctx, item, model.BillingMonthly, eur(1090))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).To(BeEmpty())
+		})
+	})
+})
@@ -5,38 +5,73 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/deicod/dysv/internal/model"
 	"github.com/deicod/dysv/internal/repo"
-	"github.com/stripe/stripe-go/v82"
-	"github.com/stripe/stripe-go/v82/checkout/session"
+	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
-// CheckoutService handles Stripe checkout
+// CheckoutService handles checkout through the payment gateway
 type CheckoutService struct {
 	cartService    *CartService
 	orderRepo      repo.OrderRepository
 	addressService *AddressService
+	taxes          *TaxService
+	customers      *CustomerService
+	gateway        PaymentGateway
 	successURL     string
 	cancelURL      string
 }
 
-// NewCheckoutService creates a new checkout service
-func NewCheckoutService(cartService *CartService, orderRepo repo.OrderRepository, addressService *AddressService, stripeKey, successURL, cancelURL string) *CheckoutService {
-	stripe.Key = stripeKey
+// NewCheckoutService creates a new checkout service.
+// taxes is optional; without it orders are charged net.
+// customers is optional; without it the gateway creates a customer per checkout.
+func NewCheckoutService(cartService *CartService, orderRepo repo.OrderRepository, addressService *AddressService, taxes *TaxService, customers *CustomerService, gateway PaymentGateway, successURL, cancelURL string) *CheckoutService {
 	return &CheckoutService{
 		cartService:    cartService,
 		orderRepo:      orderRepo,
 		addressService: addressService,
+		taxes:          taxes,
+		customers:      customers,
+		gateway:        gateway,
 		successURL:     successURL,
 		cancelURL:      cancelURL,
 	}
 }
 
-// CreateCheckoutSession creates a Stripe Checkout session for the cart
-func (s *CheckoutService) CreateCheckoutSession(ctx context.Context, sessionID, userID, addressID string) (string, error) {
+// checkoutReuseMargin is how long a checkout session must still be open to be
+// handed out again for the same cart
+const checkoutReuseMargin = 30 * time.Minute
+
+// checkoutReserveTimeout is how long an order may wait for its checkout
+// session before a request with the same idempotency key takes over
+const checkoutReserveTimeout = 2 * time.Minute
+
+// CreateCheckoutSession creates a checkout session for the cart and
+// returns its URL. A request repeating an earlier idempotencyKey (optional)
+// gets the URL of the first request; a still open session for the same cart
+// contents is reused instead of creating another order.
+func (s *CheckoutService) CreateCheckoutSession(ctx context.Context, sessionID, userID, email, addressID, idempotencyKey string) (string, error) {
+	ctx = WithUserID(ctx, userID)
+	if idempotencyKey != "" {
+		order, err := s.orderRepo.FindByIdempotencyKey(ctx, userID, idempotencyKey)
+		if err == nil {
+			if url, ok, err := s.replayCheckout(ctx, order); ok || err != nil {
+				return url, err
+			}
+		} else if !errors.Is(err, repo.ErrNotFound) {
+			return "", err
+		}
+	}
+
 	cart, err := s.cartService.GetOrCreateCart(ctx, sessionID)
 	if err != nil {
 		fmt.Printf("CheckoutService: GetOrCreateCart Error: %v\n", err)
@@ -46,6 +81,16 @@ func (s *CheckoutService) CreateCheckoutSession(ctx context.Context, sessionID,
 	if len(cart.Items) == 0 {
 		return "", ErrEmptyCart
 	}
+	// Rules may have changed in the catalog since the items were added
+	if err := s.cartService.ValidateCart(ctx, cart); err != nil {
+		return "", err
+	}
+	if err := s.cartService.ValidateSites(ctx, cart); err != nil {
+		return "", err
+	}
+	if err := s.cartService.CheckCoupon(ctx, cart); err != nil {
+		return "", err
+	}
 
 	// Fetch Address
 	// Using repo directly via interface or via service? Service!
@@ -70,87 +115,307 @@ func (s *CheckoutService) CreateCheckoutSession(ctx context.Context, sessionID,
 		return "", fmt.Errorf("address not found or does not belong to user")
 	}
 
-	// Build line items for Stripe
-	lineItems := make([]*stripe.CheckoutSessionLineItemParams, 0, len(cart.Items))
-	var totalCents int64
+	cycle, err := s.cartService.CycleFor(ctx, cart)
+	if err != nil {
+		return "", err
+	}
 
-	for _, item := range cart.Items {
-		var unitAmount int64
-		var interval stripe.PriceRecurringInterval
-
-		if cart.BillingCycle == model.BillingYearly {
-			interval = stripe.PriceRecurringIntervalYear
-			if item.ItemType == "plan" {
-				// Plans: charge 10 months worth (2 months free) once per year
-				yearlyPrice := item.Price * float64(12-YearlyDiscountMonths)
-				unitAmount = int64(math.Round(yearlyPrice * 100))
-			} else {
-				// Addons: no discount, pay full 12 months
-				yearlyPrice := item.Price * 12
-				unitAmount = int64(math.Round(yearlyPrice * 100))
+	trialDays, err := s.trialDays(ctx, cart)
+	if err != nil {
+		return "", err
+	}
+
+	tax := model.TaxDecision{}
+	if s.taxes != nil {
+		// A VAT ID the register could not check yet gets another try
+		if err := s.addressService.RecheckVATID(ctx, address); err != nil {
+			return "", err
+		}
+		if tax, err = s.taxes.Decide(address); err != nil {
+			return "", err
+		}
+	}
+	var taxRateID string
+	if tax.RateBPS > 0 {
+		if taxRateID, err = s.gateway.TaxRate(ctx, tax); err != nil {
+			return "", err
+		}
+	}
+
+	// Build the checkout lines from the quote shown in the cart
+	quote, checkoutHash, err := s.quoteCheckout(ctx, cart, tax, email, addressID, trialDays)
+	if err != nil {
+		return "", err
+	}
+	if trialDays > 0 {
+		// One trial per user: none after a trial started, nor while another
+		// checkout still offers one. The open checkout for this very cart
+		// does not count, so it is reused below with its trial.
+		used, err := s.orderRepo.HasTrial(ctx, userID, checkoutHash, time.Now())
+		if err != nil {
+			return "", err
+		}
+		if used {
+			trialDays = 0
+			if quote, checkoutHash, err = s.quoteCheckout(ctx, cart, tax, email, addressID, trialDays); err != nil {
+				return "", err
 			}
-		} else {
-			// Monthly billing: charge monthly price each month
-			unitAmount = int64(math.Round(item.Price * 100))
-			interval = stripe.PriceRecurringIntervalMonth
-		}
-
-		lineItems = append(lineItems, &stripe.CheckoutSessionLineItemParams{
-			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-				Currency: stripe.String("eur"),
-				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
-					Name:        stripe.String(item.Name),
-					Description: stripe.String(fmt.Sprintf("%s - %s billing", item.ItemType, cart.BillingCycle)),
-				},
-				UnitAmount: stripe.Int64(unitAmount),
-				Recurring: &stripe.CheckoutSessionLineItemPriceDataRecurringParams{
-					Interval: stripe.String(string(interval)),
-				},
-			},
-			Quantity: stripe.Int64(int64(item.Quantity)),
+		}
+	}
+
+	// Double clicks and retries without a key get the session already open
+	open, err := s.orderRepo.FindOpenCheckout(ctx, userID, checkoutHash, time.Now().Add(checkoutReuseMargin))
+	if err == nil {
+		fmt.Printf("CheckoutService: reusing checkout session %s of order %s\n", open.StripeSessionID, open.ID.Hex())
+		return open.CheckoutURL, nil
+	}
+	if !errors.Is(err, repo.ErrNotFound) {
+		return "", err
+	}
+
+	lines := make([]CheckoutLine, 0, len(cart.Items))
+	for i, item := range cart.Items {
+		unitPrice := quote.Lines[i].UnitPrice
+
+		// Prefer the synced catalog price; fall back to an inline price for
+		// items not (yet) pushed to Stripe
+		priceID, err := s.cartService.catalog.StripePriceID(ctx, item, cycle.ID, unitPrice)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, CheckoutLine{
+			PriceID:       priceID,
+			Name:          item.Name,
+			Description:   fmt.Sprintf("%s - %s billing", item.ItemType, cycle.Name),
+			UnitAmount:    unitPrice.Amount,
+			Interval:      cycle.Interval,
+			IntervalCount: cycle.IntervalCount,
+			Quantity:      int64(item.Quantity),
 		})
+	}
 
-		totalCents += unitAmount * int64(item.Quantity)
+	siteMetadata, err := SiteMetadata(cart.Items)
+	if err != nil {
+		return "", err
 	}
+	// The order ID links the subscription back to the order
+	orderID := checkoutOrderID(userID, idempotencyKey)
+	siteMetadata["order_id"] = orderID.Hex()
 
-	// Create Stripe Checkout session
-	params := &stripe.CheckoutSessionParams{
-		Mode:       stripe.String(string(stripe.CheckoutSessionModeSubscription)),
-		SuccessURL: stripe.String(s.successURL + "?session_id={CHECKOUT_SESSION_ID}"),
-		CancelURL:  stripe.String(s.cancelURL),
-		LineItems:  lineItems,
+	params := &CheckoutSessionParams{
+		SuccessURL: s.successURL + "?session_id={CHECKOUT_SESSION_ID}",
+		CancelURL:  s.cancelURL,
+		Currency:   cart.Currency,
+		Lines:      lines,
+		TaxRateID:  taxRateID,
 		Metadata: map[string]string{
 			"cart_session_id": sessionID,
 			"address_id":      addressID,
+			"quote_id":        cart.QuoteID,
+			"tax_treatment":   string(tax.Treatment),
 		},
-		// Optional: Pre-fill customer email if we knew it, or address from our DB?
-		// Stripe allows passing address collection fields.
+		SubscriptionMetadata: siteMetadata,
+		CustomerEmail:        email,
+		TrialDays:            trialDays,
 	}
-
-	stripeSession, err := session.New(params)
-	if err != nil {
-		fmt.Printf("CheckoutService: Stripe Session New Error: %v\n", err)
-		return "", fmt.Errorf("failed to create checkout session: %w", err)
+	// Purchases of an account are kept under one customer
+	if s.customers != nil {
+		if params.CustomerID, err = s.customers.CustomerID(ctx, userID, email, address); err != nil {
+			return "", err
+		}
 	}
 
-	// Create order record
-	orderTotal := float64(totalCents) / 100
+	// Create the order before the checkout session, so a concurrent request
+	// with the same idempotency key fails on the key instead of creating a
+	// second session
 	order := &model.Order{
-		CartID:          cart.ID,
-		StripeSessionID: stripeSession.ID,
-		Items:           cart.Items,
-		BillingCycle:    cart.BillingCycle,
-		BillingAddress:  *address, // Store snapshot
-		TotalAmount:     orderTotal,
-		Status:          "pending",
+		ID:               orderID,
+		CartID:           cart.ID,
+		UserID:           userID,
+		CustomerEmail:    email,
+		StripeCustomerID: params.CustomerID,
+		Items:            cart.Items,
+		BillingCycle:     cart.BillingCycle,
+		BillingAddress:   *address, // Store snapshot
+		TotalAmount:      quote.Gross,
+		NetAmount:        quote.Net,
+		TaxAmount:        quote.Tax,
+		Tax:              tax,
+		CouponCode:       quote.CouponCode,
+		Credit:           quote.Credit,
+		Status:           "pending",
+		TrialDays:        trialDays,
+		IdempotencyKey:   idempotencyKey,
+		CheckoutHash:     checkoutHash,
+		CreatedAt:        time.Now(),
 	}
-
 	if err := s.orderRepo.Create(ctx, order); err != nil {
+		if errors.Is(err, repo.ErrConflict) {
+			existing, err := s.orderRepo.FindByIdempotencyKey(ctx, userID, idempotencyKey)
+			if err != nil {
+				return "", err
+			}
+			url, ok, err := s.replayCheckout(ctx, existing)
+			if !ok && err == nil {
+				// Abandoned just now; the client retries
+				err = ErrCheckoutInProgress
+			}
+			return url, err
+		}
 		fmt.Printf("CheckoutService: OrderRepo Create Error: %v\n", err)
 		return "", fmt.Errorf("failed to create order: %w", err)
 	}
 
-	return stripeSession.URL, nil
+	// Coupon and credit are held for the order until it is paid or its
+	// session ends
+	if coupons := s.cartService.coupons; coupons != nil {
+		if err := coupons.Reserve(ctx, order); err != nil {
+			s.dropOrder(ctx, orderID)
+			return "", err
+		}
+	}
+	if credits := s.cartService.credits; credits != nil {
+		if err := credits.Hold(ctx, order); err != nil {
+			s.dropOrder(ctx, orderID)
+			return "", err
+		}
+	}
+
+	checkoutSession, err := s.newCheckoutSession(ctx, params, cart, quote, userID, idempotencyKey)
+	if err != nil {
+		// Without a session the order can never be paid; drop it so the
+		// key can be retried
+		s.dropOrder(ctx, orderID)
+		return "", err
+	}
+
+	if err := s.orderRepo.AttachCheckout(ctx, orderID, checkoutSession.ID, checkoutSession.URL, checkoutSession.ExpiresAt); err != nil {
+		fmt.Printf("CheckoutService: OrderRepo AttachCheckout Error: %v\n", err)
+		// A retry with the key gets the same session from the gateway
+		s.dropOrder(ctx, orderID)
+		return "", fmt.Errorf("failed to update order: %w", err)
+	}
+
+	return checkoutSession.URL, nil
+}
+
+// newCheckoutSession adds the quote's discount to params and creates the
+// checkout session. The idempotency key is scoped to the user, so the
+// gateway answers a retried request with the session it already created.
+//
+// The gateway rejects a key repeated with other params, so everything sent
+// must come out the same on a retry: the order ID is derived from the key
+// (see checkoutOrderID) and the discount is created under a key of its own.
+func (s *CheckoutService) newCheckoutSession(ctx context.Context, params *CheckoutSessionParams, cart *model.Cart, quote *model.Quote, userID, idempotencyKey string) (*CheckoutSession, error) {
+	var discountKey string
+	if idempotencyKey != "" {
+		params.IdempotencyKey = "checkout:" + userID + ":" + idempotencyKey
+		discountKey = "discount:" + userID + ":" + idempotencyKey
+	}
+
+	// Coupon and credit become a discount for exactly the amount the quote
+	// computed, so the customer is charged what the cart showed. Recurring
+	// percentages are passed on as such (see discount).
+	if !quote.Coupon.IsZero() || !quote.Credit.IsZero() {
+		discountID, err := s.discount(ctx, cart, quote, params.Lines, discountKey)
+		if err != nil {
+			return nil, err
+		}
+		params.DiscountID = discountID
+		if quote.CouponCode != "" {
+			params.Metadata["coupon_code"] = quote.CouponCode
+		}
+	}
+
+	checkoutSession, err := s.gateway.CreateCheckoutSession(ctx, params)
+	if err != nil {
+		fmt.Printf("CheckoutService: CreateCheckoutSession Error: %v\n", err)
+		return nil, fmt.Errorf("failed to create checkout session: %w", err)
+	}
+	return checkoutSession, nil
+}
+
+// checkoutOrderID returns the ID of a new checkout's order. With an
+// idempotency key it is derived from the key, so a retry sends the gateway
+// the same order_id as the request it repeats.
+func checkoutOrderID(userID, idempotencyKey string) bson.ObjectID {
+	if idempotencyKey == "" {
+		return bson.NewObjectID()
+	}
+	var id bson.ObjectID
+	sum := sha256.Sum256([]byte("order:" + userID + ":" + idempotencyKey))
+	copy(id[:], sum[:])
+	return id
+}
+
+// replayCheckout returns the checkout session URL of an order found by its
+// idempotency key. An order that got no session within
+// checkoutReserveTimeout was abandoned by a failed request; it is deleted and
+// ok is false, so the checkout starts over.
+func (s *CheckoutService) replayCheckout(ctx context.Context, order *model.Order) (url string, ok bool, err error) {
+	if order.CheckoutURL != "" {
+		return order.CheckoutURL, true, nil
+	}
+	createdBefore := time.Now().Add(-checkoutReserveTimeout)
+	if order.CreatedAt.After(createdBefore) {
+		// The first request is still talking to the gateway
+		return "", true, ErrCheckoutInProgress
+	}
+
+	fmt.Printf("CheckoutService: dropping abandoned order %s\n", order.ID.Hex())
+	deleted, err := s.orderRepo.DeleteAbandoned(ctx, order.ID, createdBefore)
+	if err != nil {
+		fmt.Printf("CheckoutService: OrderRepo DeleteAbandoned Error: %v\n", err)
+		return "", false, err
+	}
+	if deleted {
+		if err := s.releaseHolds(ctx, order.ID); err != nil {
+			return "", false, err
+		}
+	}
+	return "", false, nil
+}
+
+// dropOrder deletes an order that got no checkout session and gives back
+// its coupon and credit; failures are logged
+func (s *CheckoutService) dropOrder(ctx context.Context, orderID bson.ObjectID) {
+	if err := s.orderRepo.Delete(ctx, orderID); err != nil {
+		fmt.Printf("CheckoutService: OrderRepo Delete Error: %v\n", err)
+	}
+	if err := s.releaseHolds(ctx, orderID); err != nil {
+		fmt.Printf("CheckoutService: releaseHolds Error: %v\n", err)
+	}
+}
+
+// releaseHolds gives back the coupon redemption and the account credit held
+// by an unpaid order
+func (s *CheckoutService) releaseHolds(ctx context.Context, orderID bson.ObjectID) error {
+	var errs []error
+	if s.cartService.coupons != nil {
+		errs = append(errs, s.cartService.coupons.Release(ctx, orderID))
+	}
+	if s.cartService.credits != nil {
+		errs = append(errs, s.cartService.credits.Release(ctx, orderID))
+	}
+	return errors.Join(errs...)
+}
+
+// hashCheckout fingerprints everything a checkout session is created from, so
+// an open session is only reused for the very same purchase
+func hashCheckout(cart *model.Cart, quote *model.Quote, email, addressID string, trialDays int) (string, error) {
+	data, err := json.Marshal(struct {
+		Items     []model.LineItem
+		Cycle     model.BillingCycle
+		Quote     *model.Quote
+		Email     string
+		AddressID string
+		TrialDays int
+	}{cart.Items, cart.BillingCycle, quote, email, addressID, trialDays})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
 }
 
 // HandleWebhook processes Stripe webhook events
@@ -161,5 +426,213 @@ func (s *CheckoutService) HandleWebhook(ctx context.Context, stripeSessionID, st
 		return fmt.Errorf("order not found: %w", err)
 	}
 
-	return s.orderRepo.UpdateStatus(ctx, order.ID, status)
+	if err := s.orderRepo.UpdateStatus(ctx, order.ID, status); err != nil {
+		return err
+	}
+	if status == "expired" || status == "payment_failed" {
+		// The session ended unpaid
+		return s.releaseHolds(ctx, order.ID)
+	}
+	if status != "paid" {
+		return nil
+	}
+
+	// Each step books at most once per order, so webhook retries are safe
+	var errs []error
+	if order.TrialDays > 0 {
+		start := time.Now()
+		errs = append(errs, s.orderRepo.StartTrial(ctx, order.ID, start, start.AddDate(0, 0, order.TrialDays)))
+	}
+	if s.cartService.coupons != nil {
+		errs = append(errs, s.cartService.coupons.Redeem(ctx, order))
+	}
+	if credits := s.cartService.credits; credits != nil {
+		errs = append(errs, credits.Spend(ctx, order), credits.Reward(ctx, order))
+	}
+	return errors.Join(errs...)
+}
+
+// quoteCheckout prices the cart for checkout and fingerprints the checkout
+// (see hashCheckout). Nothing is invoiced during a trial, so account credit
+// is kept for a later order.
+func (s *CheckoutService) quoteCheckout(ctx context.Context, cart *model.Cart, tax model.TaxDecision, email, addressID string, trialDays int) (*model.Quote, string, error) {
+	quoteFor := s.cartService.Quote
+	if trialDays > 0 {
+		quoteFor = s.cartService.QuoteWithoutCredit
+	}
+	quote, err := quoteFor(ctx, cart, tax)
+	if err != nil {
+		return nil, "", err
+	}
+	checkoutHash, err := hashCheckout(cart, quote, email, addressID, trialDays)
+	if err != nil {
+		return nil, "", err
+	}
+	return quote, checkoutHash, nil
+}
+
+// InvoicePaid handles an invoice of amount paid charged for the subscription
+// of an order, found by the order_id (hex) in the subscription metadata.
+// Referrals still pending after a trial are rewarded here.
+func (s *CheckoutService) InvoicePaid(ctx context.Context, orderID string, paid model.Money) error {
+	id, err := bson.ObjectIDFromHex(orderID)
+	if err != nil {
+		return fmt.Errorf("invalid order ID %q: %w", orderID, err)
+	}
+	order, err := s.orderRepo.FindByID(ctx, id)
+	if err != nil {
+		fmt.Printf("CheckoutService: FindByID Error: %v\n", err)
+		return fmt.Errorf("order not found: %w", err)
+	}
+	if credits := s.cartService.credits; credits != nil {
+		return credits.RewardInvoice(ctx, order, paid)
+	}
+	return nil
+}
+
+// trialDays returns the trial the cart's plans offer: the shortest trial of
+// its plans if every plan offers one
+func (s *CheckoutService) trialDays(ctx context.Context, cart *model.Cart) (int, error) {
+	days := 0
+	for _, item := range cart.Items {
+		if item.ItemType != "plan" {
+			continue
+		}
+		plan, err := s.cartService.catalog.GetPlan(ctx, item.ItemID)
+		if err != nil {
+			return 0, err
+		}
+		if plan.TrialDays == 0 {
+			return 0, nil
+		}
+		if days == 0 || plan.TrialDays < days {
+			days = plan.TrialDays
+		}
+	}
+	return days, nil
+}
+
+// discount creates the gateway discount for the quote's coupon discount and
+// account credit and returns its ID. A recurring percentage coupon becomes
+// a percentage off; anything else is a fixed amount off, which for a
+// recurring fixed coupon repeats on every invoice. A recurring coupon never
+// comes with credit (see CartService.Quote). idempotencyKey is optional.
+func (s *CheckoutService) discount(ctx context.Context, cart *model.Cart, quote *model.Quote, lines []CheckoutLine, idempotencyKey string) (string, error) {
+	params := &DiscountParams{
+		Name:           "Account credit",
+		Currency:       quote.Currency,
+		IdempotencyKey: idempotencyKey,
+		Metadata: map[string]string{
+			"coupon_code": quote.CouponCode,
+			"credit":      strconv.FormatInt(quote.Credit.Amount, 10),
+		},
+	}
+	if quote.CouponCode != "" {
+		// The coupon the cart was priced with, as a saved quote may have fixed it
+		coupon, err := s.cartService.couponFor(ctx, cart)
+		if err != nil {
+			return "", err
+		}
+		if coupon == nil || coupon.Code != quote.CouponCode {
+			return "", fmt.Errorf("%w: %s", ErrCouponNotApplicable, quote.CouponCode)
+		}
+		params.Name = coupon.Name
+		params.Recurring = coupon.Recurring
+
+		// A recurring percentage stays a percentage, so later invoices are
+		// discounted by what they are worth rather than by the first one
+		if coupon.Recurring && coupon.PercentOffBPS > 0 && quote.Credit.IsZero() {
+			productIDs, ok, err := s.discountedProducts(ctx, coupon, quote, lines)
+			if err != nil {
+				return "", err
+			}
+			if ok {
+				params.PercentOffBPS = coupon.PercentOffBPS
+				params.ProductIDs = productIDs
+			} else {
+				fmt.Printf("CheckoutService: plans of coupon %s not synced to Stripe, discounting a fixed amount\n", coupon.Code)
+			}
+		}
+	}
+	if params.PercentOffBPS == 0 {
+		amount, err := quote.Coupon.Add(quote.Credit)
+		if err != nil {
+			return "", err
+		}
+		params.AmountOff = amount.Amount
+	}
+
+	id, err := s.gateway.CreateDiscount(ctx, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to create discount: %w", err)
+	}
+	return id, nil
+}
+
+// discountedProducts returns the Stripe products a coupon limited to plans
+// applies to, or nil for a coupon discounting every line. ok is false when
+// a discounted line is not billed at a synced catalog price, as the gateway
+// can only limit a coupon to products it knows.
+func (s *CheckoutService) discountedProducts(ctx context.Context, coupon *model.Coupon, quote *model.Quote, lines []CheckoutLine) ([]string, bool, error) {
+	if len(coupon.Plans) == 0 {
+		return nil, true, nil
+	}
+	var productIDs []string
+	for i, line := range quote.Lines {
+		if !coupon.Discounts(model.LineItem{ItemID: line.ItemID, ItemType: line.ItemType}) {
+			continue
+		}
+		if lines[i].PriceID == "" {
+			return nil, false, nil
+		}
+		plan, err := s.cartService.catalog.GetPlan(ctx, line.ItemID)
+		if err != nil {
+			return nil, false, err
+		}
+		if plan.StripeProductID == "" {
+			return nil, false, nil
+		}
+		if !slices.Contains(productIDs, plan.StripeProductID) {
+			productIDs = append(productIDs, plan.StripeProductID)
+		}
+	}
+	return productIDs, true, nil
+}
+
+// maxSiteMetadata keeps the site keys and order_id within Stripe's 50
+// metadata keys
+const maxSiteMetadata = 49
+
+// siteMetadataValue is the JSON stored per site in subscription metadata
+type siteMetadataValue struct {
+	Plan      string `json:"plan"`
+	Name      string `json:"name"`
+	Framework string `json:"framework"`
+	Region    string `json:"region"`
+	Domain    string `json:"domain,omitempty"`
+}
+
+// SiteMetadata encodes the site configurations of the cart's plan items as
+// Stripe metadata, one "site_N" key per site
+func SiteMetadata(items []model.LineItem) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, item := range items {
+		for _, site := range item.Sites {
+			if len(metadata) == maxSiteMetadata {
+				return nil, fmt.Errorf("%w: at most %d sites per checkout", ErrInvalidSite, maxSiteMetadata)
+			}
+			value, err := json.Marshal(siteMetadataValue{
+				Plan:      item.ItemID,
+				Name:      site.Name,
+				Framework: site.Framework,
+				Region:    site.Region,
+				Domain:    site.Domain,
+			})
+			if err != nil {
+				return nil, err
+			}
+			metadata[fmt.Sprintf("site_%d", len(metadata)+1)] = string(value)
+		}
+	}
+	return metadata, nil
 }
@@ -0,0 +1,256 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/deicod/dysv/internal/mocks"
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/deicod/dysv/internal/service"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Idempotent checkout", func() {
+	var (
+		ctx          context.Context
+		stripeServer *mocks.StripeServer
+		gateway      *lossyGateway
+		cartService  *service.CartService
+		checkout     *service.CheckoutService
+		orderRepo    *repo.MockOrderRepo
+		coupons      *service.CouponService
+		addresses    *service.AddressService
+		addressID    string
+	)
+
+	BeforeEach(func() {
+		ctx = service.WithUserID(context.Background(), "user_1")
+		stripeServer = mocks.NewStripeServer()
+		gateway = &lossyGateway{PaymentGateway: service.NewStripeGateway(service.NewStripeClient("sk_test_123", stripeServer.URL))}
+
+		catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		coupons = service.NewCouponService(repo.NewMockCouponRepo(), catalogService)
+		Expect(coupons.SaveCoupon(ctx, &model.Coupon{Code: "LAUNCH20", Name: "Launch", PercentOffBPS: 2000})).To(Succeed())
+		cartService = service.NewCartService(repo.NewMockCartRepo(), catalogService, coupons, nil)
+		addresses = service.NewAddressService(mocks.NewMockAddressRepo(), nil)
+		orderRepo = repo.NewMockOrderRepo()
+		checkout = service.NewCheckoutService(cartService, orderRepo, addresses, nil, nil, gateway, "https://dysv.test/success", "https://dysv.test/cart")
+
+		address := &model.Address{UserID: "user_1", Label: "Home", Line1: "Hauptstr. 1", City: "Berlin", PostalCode: "10115", Country: "DE"}
+		Expect(addresses.CreateAddress(ctx, address)).To(Succeed())
+		addressID = address.ID
+
+		addPlan(ctx, cartService, "node-starter")
+	})
+
+	AfterEach(func() {
+		stripeServer.Close()
+	})
+
+	create := func(key string) (string, error) {
+		return checkout.CreateCheckoutSession(ctx, "sess", "user_1", "user@example.com", addressID, key)
+	}
+
+	It("should answer a replayed request with the original URL", func() {
+		url, err := create("key-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(url).NotTo(BeEmpty())
+
+		// The cart changing in between does not matter to a replay
+		addPlan(ctx, cartService, "node-pro")
+		replayed, err := create("key-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replayed).To(Equal(url))
+		Expect(stripeServer.Count("checkout.session")).To(Equal(1))
+
+		order, err := orderRepo.FindByIdempotencyKey(ctx, "user_1", "key-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(order.CheckoutURL).To(Equal(url))
+		Expect(order.CheckoutExpiresAt).NotTo(BeNil())
+	})
+
+	It("should pass the key on to Stripe", func() {
+		url, err := create("key-1")
+		Expect(err).NotTo(HaveOccurred())
+
+		// Losing our order must not make Stripe create a second session
+		order, err := orderRepo.FindByIdempotencyKey(ctx, "user_1", "key-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orderRepo.Delete(ctx, order.ID)).To(Succeed())
+
+		retried, err := create("key-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retried).To(Equal(url))
+		Expect(stripeServer.Count("checkout.session")).To(Equal(1))
+	})
+
+	It("should get the original session when the gateway's response was lost", func() {
+		_, err := cartService.ApplyCoupon(ctx, "sess", "LAUNCH20")
+		Expect(err).NotTo(HaveOccurred())
+
+		gateway.loseNext = true
+		_, err = create("key-1")
+		Expect(err).To(HaveOccurred())
+		_, err = orderRepo.FindByIdempotencyKey(ctx, "user_1", "key-1")
+		Expect(err).To(MatchError(repo.ErrNotFound))
+
+		// The retry sends the same params, so the gateway replays instead
+		// of rejecting the key
+		url, err := create("key-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(url).To(Equal(gateway.lost.URL))
+		Expect(stripeServer.Count("checkout.session")).To(Equal(1))
+		Expect(stripeServer.Count("coupon")).To(Equal(1))
+
+		order, err := orderRepo.FindByIdempotencyKey(ctx, "user_1", "key-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(order.StripeSessionID).To(Equal(gateway.lost.ID))
+		session := stripeServer.Object(order.StripeSessionID)
+		Expect(session["subscription_data"]).To(HaveKeyWithValue("metadata", HaveKeyWithValue("order_id", order.ID.Hex())))
+	})
+
+	It("should hold limited coupons for open checkouts", func() {
+		Expect(coupons.SaveCoupon(ctx, &model.Coupon{Code: "FIRST1", Name: "First", PercentOffBPS: 5000, MaxRedemptions: 1})).To(Succeed())
+		_, err := cartService.ApplyCoupon(ctx, "sess", "FIRST1")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = create("key-1")
+		Expect(err).NotTo(HaveOccurred())
+
+		// A second customer cannot use the coupon while the first checkout is open
+		otherCtx := service.WithUserID(context.Background(), "user_2")
+		other := &model.Address{UserID: "user_2", Label: "Home", Line1: "Ilica 1", City: "Zagreb", PostalCode: "10000", Country: "HR"}
+		Expect(addresses.CreateAddress(otherCtx, other)).To(Succeed())
+		addPlan(otherCtx, cartService, "node-starter")
+		_, err = cartService.ApplyCoupon(otherCtx, "sess", "FIRST1")
+		Expect(err).NotTo(HaveOccurred())
+		checkoutOther := func() error {
+			_, err := checkout.CreateCheckoutSession(otherCtx, "sess", "user_2", "other@example.com", other.ID, "key-1")
+			return err
+		}
+		Expect(checkoutOther()).To(MatchError(service.ErrCouponLimitReached))
+		_, err = orderRepo.FindByIdempotencyKey(otherCtx, "user_2", "key-1")
+		Expect(err).To(MatchError(repo.ErrNotFound))
+
+		// The expired session gives the coupon back
+		order, err := orderRepo.FindByIdempotencyKey(ctx, "user_1", "key-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checkout.HandleWebhook(ctx, order.StripeSessionID, "expired")).To(Succeed())
+		Expect(checkoutOther()).To(Succeed())
+
+		order, err = orderRepo.FindByIdempotencyKey(otherCtx, "user_2", "key-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checkout.HandleWebhook(ctx, order.StripeSessionID, "paid")).To(Succeed())
+		coupon, err := coupons.GetCoupon(ctx, "FIRST1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(coupon.Redemptions).To(Equal(1))
+		Expect(coupon.Reserved).To(BeZero())
+	})
+
+	It("should keep recurring percentages a percentage on every invoice", func() {
+		Expect(coupons.SaveCoupon(ctx, &model.Coupon{Code: "EVERY20", Name: "Every 20", PercentOffBPS: 2000, Recurring: true})).To(Succeed())
+		_, err := cartService.ApplyCoupon(ctx, "sess", "EVERY20")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = create("key-1")
+		Expect(err).NotTo(HaveOccurred())
+
+		order, err := orderRepo.FindByIdempotencyKey(ctx, "user_1", "key-1")
+		Expect(err).NotTo(HaveOccurred())
+		discounts := stripeServer.Object(order.StripeSessionID)["discounts"].([]interface{})
+		Expect(discounts).To(HaveLen(1))
+		coupon := stripeServer.Object(discounts[0].(map[string]interface{})["coupon"].(string))
+		Expect(coupon).To(HaveKeyWithValue("percent_off", BeNumerically("==", 20)))
+		Expect(coupon).To(HaveKeyWithValue("duration", "forever"))
+		Expect(coupon).NotTo(HaveKey("amount_off"))
+	})
+
+	It("should reuse an open session for the same cart contents", func() {
+		url, err := create("")
+		Expect(err).NotTo(HaveOccurred())
+		again, err := create("key-2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(Equal(url))
+		Expect(stripeServer.Count("checkout.session")).To(Equal(1))
+
+		addPlan(ctx, cartService, "node-pro")
+		changed, err := create("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).NotTo(Equal(url))
+		Expect(stripeServer.Count("checkout.session")).To(Equal(2))
+	})
+
+	It("should not reuse sessions that are about to expire or were paid", func() {
+		url, err := create("key-1")
+		Expect(err).NotTo(HaveOccurred())
+		order, err := orderRepo.FindByIdempotencyKey(ctx, "user_1", "key-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orderRepo.AttachCheckout(ctx, order.ID, order.StripeSessionID, url, time.Now().Add(time.Minute))).To(Succeed())
+
+		next, err := create("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).NotTo(Equal(url))
+
+		order, err = orderRepo.FindOpenCheckout(ctx, "user_1", order.CheckoutHash, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checkout.HandleWebhook(ctx, order.StripeSessionID, "paid")).To(Succeed())
+		paidAgain, err := create("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paidAgain).NotTo(Equal(next))
+		Expect(stripeServer.Count("checkout.session")).To(Equal(3))
+	})
+
+	It("should report a request still being handled", func() {
+		Expect(orderRepo.Create(ctx, &model.Order{UserID: "user_1", IdempotencyKey: "key-1", Status: "pending", CreatedAt: time.Now()})).To(Succeed())
+
+		_, err := create("key-1")
+		Expect(err).To(MatchError(service.ErrCheckoutInProgress))
+		Expect(stripeServer.Count("checkout.session")).To(BeZero())
+	})
+
+	It("should take over a request that died before getting a session", func() {
+		stale := &model.Order{UserID: "user_1", IdempotencyKey: "key-1", Status: "pending", CreatedAt: time.Now().Add(-10 * time.Minute)}
+		Expect(orderRepo.Create(ctx, stale)).To(Succeed())
+
+		url, err := create("key-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(url).NotTo(BeEmpty())
+		_, err = orderRepo.FindByID(ctx, stale.ID)
+		Expect(err).To(MatchError(repo.ErrNotFound))
+
+		order, err := orderRepo.FindByIdempotencyKey(ctx, "user_1", "key-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(order.CheckoutURL).To(Equal(url))
+	})
+})
+
+// lossyGateway drops the response of a checkout session once loseNext is
+// set, like a connection reset after the gateway created the session
+type lossyGateway struct {
+	service.PaymentGateway
+	loseNext bool
+	lost     *service.CheckoutSession
+}
+
+func (g *lossyGateway) CreateCheckoutSession(ctx context.Context, params *service.CheckoutSessionParams) (*service.CheckoutSession, error) {
+	session, err := g.PaymentGateway.CreateCheckoutSession(ctx, params)
+	if err != nil || !g.loseNext {
+		return session, err
+	}
+	g.loseNext, g.lost = false, session
+	return nil, errors.New("connection reset by peer")
+}
+
+// addPlan adds a plan with a configured site to the cart of session "sess"
+func addPlan(ctx context.Context, cartService *service.CartService, planID string) {
+	GinkgoHelper()
+	_, err := cartService.AddPlan(ctx, "sess", planID, 1)
+	Expect(err).NotTo(HaveOccurred())
+	_, err = cartService.ConfigureSite(ctx, "sess", planID, 0, model.SiteConfig{Name: planID, Framework: "nuxt", Region: "nbg"})
+	Expect(err).NotTo(HaveOccurred())
+}
@@ -0,0 +1,211 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// couponCodePattern restricts codes to what customers can type reliably
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_-]{2,31}$`)
+
+// CouponService manages coupons and checks them against carts
+type CouponService struct {
+	repo    repo.CouponRepository
+	catalog *CatalogService
+}
+
+// NewCouponService creates a new coupon service
+func NewCouponService(couponRepo repo.CouponRepository, catalog *CatalogService) *CouponService {
+	return &CouponService{repo: couponRepo, catalog: catalog}
+}
+
+// NormalizeCode returns code as stored: trimmed and upper case
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ListCoupons returns all coupons
+func (s *CouponService) ListCoupons(ctx context.Context) ([]model.Coupon, error) {
+	return s.repo.ListCoupons(ctx)
+}
+
+// GetCoupon returns a coupon by code, or ErrInvalidCoupon
+func (s *CouponService) GetCoupon(ctx context.Context, code string) (*model.Coupon, error) {
+	coupon, err := s.repo.FindCoupon(ctx, NormalizeCode(code))
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCoupon, NormalizeCode(code))
+	}
+	return coupon, err
+}
+
+// SaveCoupon validates and stores a coupon. The redemption count is kept.
+func (s *CouponService) SaveCoupon(ctx context.Context, coupon *model.Coupon) error {
+	coupon.Code = NormalizeCode(coupon.Code)
+	if err := s.validateCoupon(ctx, coupon); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if existing, err := s.repo.FindCoupon(ctx, coupon.Code); err == nil {
+		coupon.CreatedAt = existing.CreatedAt
+	} else if errors.Is(err, repo.ErrNotFound) {
+		coupon.CreatedAt = now
+	} else {
+		return err
+	}
+	coupon.UpdatedAt = now
+	return s.repo.UpsertCoupon(ctx, coupon)
+}
+
+// DeleteCoupon removes a coupon; carts using it lose the discount
+func (s *CouponService) DeleteCoupon(ctx context.Context, code string) error {
+	err := s.repo.DeleteCoupon(ctx, NormalizeCode(code))
+	if errors.Is(err, repo.ErrNotFound) {
+		return fmt.Errorf("%w: %s", ErrInvalidCoupon, NormalizeCode(code))
+	}
+	return err
+}
+
+func (s *CouponService) validateCoupon(ctx context.Context, coupon *model.Coupon) error {
+	if !couponCodePattern.MatchString(coupon.Code) {
+		return fmt.Errorf("%w: code must be 3-32 letters, digits, dashes or underscores", ErrInvalidCatalogEntry)
+	}
+	if strings.TrimSpace(coupon.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidCatalogEntry)
+	}
+	if (coupon.PercentOffBPS > 0) == (len(coupon.AmountOff) > 0) {
+		return fmt.Errorf("%w: set either a percentage or an amount off", ErrInvalidCatalogEntry)
+	}
+	if coupon.PercentOffBPS < 0 || coupon.PercentOffBPS > 10000 {
+		return fmt.Errorf("%w: percentage must be between 0 and 100%%", ErrInvalidCatalogEntry)
+	}
+	for code, amount := range coupon.AmountOff {
+		if !model.ValidCurrency(code) || amount.Currency != code || amount.Amount <= 0 {
+			return fmt.Errorf("%w: invalid amount off in %s", ErrInvalidCatalogEntry, code)
+		}
+	}
+	if coupon.MaxRedemptions < 0 || coupon.MaxPerUser < 0 {
+		return fmt.Errorf("%w: redemption limits must not be negative", ErrInvalidCatalogEntry)
+	}
+	if coupon.ValidFrom != nil && coupon.ValidUntil != nil && !coupon.ValidFrom.Before(*coupon.ValidUntil) {
+		return fmt.Errorf("%w: validity ends before it starts", ErrInvalidCatalogEntry)
+	}
+	for _, id := range coupon.Plans {
+		if _, err := s.catalog.GetPlan(ctx, id); err != nil {
+			return fmt.Errorf("%w: unknown plan %s", ErrInvalidCatalogEntry, id)
+		}
+	}
+	for _, id := range coupon.Cycles {
+		if _, err := s.catalog.GetCycle(ctx, id); err != nil {
+			return fmt.Errorf("%w: unknown billing cycle %s", ErrInvalidCatalogEntry, id)
+		}
+	}
+	return nil
+}
+
+// Check returns the coupon for code if cart may use it now. userID is
+// checked against the per-user limit when set; checkout always sets it.
+// Limits are checked against paid orders here; checkout enforces them
+// including open checkouts with Reserve.
+func (s *CouponService) Check(ctx context.Context, code string, cart *model.Cart, userID string) (*model.Coupon, error) {
+	coupon, err := s.GetCoupon(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if !coupon.ActiveAt(time.Now()) {
+		return nil, fmt.Errorf("%w: %s is not valid at this time", ErrInvalidCoupon, coupon.Code)
+	}
+	if coupon.MaxRedemptions > 0 && coupon.Redemptions >= coupon.MaxRedemptions {
+		return nil, fmt.Errorf("%w: %s has been used up", ErrCouponLimitReached, coupon.Code)
+	}
+	if coupon.MaxPerUser > 0 && userID != "" {
+		used, err := s.repo.CountRedemptions(ctx, coupon.Code, userID)
+		if err != nil {
+			return nil, err
+		}
+		if used >= int64(coupon.MaxPerUser) {
+			return nil, fmt.Errorf("%w: you have already used %s", ErrCouponLimitReached, coupon.Code)
+		}
+	}
+
+	cycle := cart.BillingCycle
+	if cycle == "" {
+		cycle = model.BillingMonthly
+	}
+	if !coupon.AllowsCycle(cycle) {
+		return nil, fmt.Errorf("%w: %s is not valid for %s billing", ErrCouponNotApplicable, coupon.Code, cycle)
+	}
+	if len(coupon.AmountOff) > 0 {
+		if _, ok := coupon.AmountOff.In(cart.Currency); !ok {
+			return nil, fmt.Errorf("%w: %s is not available in %s", ErrCouponNotApplicable, coupon.Code, cart.Currency)
+		}
+	}
+	for _, item := range cart.Items {
+		if coupon.Discounts(item) {
+			return coupon, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s does not apply to any item in the cart", ErrCouponNotApplicable, coupon.Code)
+}
+
+// Reserve holds a redemption of the order's coupon until the order is paid
+// (Redeem) or its checkout ends unpaid (Release), so concurrent checkouts
+// cannot use a coupon beyond its limits
+func (s *CouponService) Reserve(ctx context.Context, order *model.Order) error {
+	if order.CouponCode == "" {
+		return nil
+	}
+	coupon, err := s.GetCoupon(ctx, order.CouponCode)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	reserved, err := s.repo.ReserveRedemption(ctx, &model.CouponRedemption{
+		OrderID:    order.ID,
+		Code:       coupon.Code,
+		UserID:     order.UserID,
+		ReservedAt: &now,
+	}, coupon.MaxPerUser)
+	if err != nil {
+		return err
+	}
+	if !reserved {
+		return fmt.Errorf("%w: %s has been used up", ErrCouponLimitReached, coupon.Code)
+	}
+	return nil
+}
+
+// Release gives back the redemption held by an order whose checkout ended
+// unpaid
+func (s *CouponService) Release(ctx context.Context, orderID bson.ObjectID) error {
+	released, err := s.repo.ReleaseRedemption(ctx, orderID)
+	if released {
+		fmt.Printf("CouponService: released the coupon of order %s\n", orderID.Hex())
+	}
+	return err
+}
+
+// Redeem records the coupon of a paid order. Webhook retries are counted once.
+func (s *CouponService) Redeem(ctx context.Context, order *model.Order) error {
+	if order.CouponCode == "" {
+		return nil
+	}
+	_, err := s.repo.RecordRedemption(ctx, &model.CouponRedemption{
+		OrderID:    order.ID,
+		Code:       order.CouponCode,
+		UserID:     order.UserID,
+		RedeemedAt: time.Now(),
+	})
+	return err
+}
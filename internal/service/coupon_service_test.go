@@ -0,0 +1,184 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/deicod/dysv/internal/service"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Coupons", func() {
+	var (
+		ctx           context.Context
+		couponService *service.CouponService
+		cartService   *service.CartService
+		orderRepo     *repo.MockOrderRepo
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		couponService = service.NewCouponService(repo.NewMockCouponRepo(), catalogService)
+		cartService = service.NewCartService(repo.NewMockCartRepo(), catalogService, couponService, nil)
+		orderRepo = repo.NewMockOrderRepo()
+
+		Expect(couponService.SaveCoupon(ctx, &model.Coupon{Code: "launch20", Name: "Launch", PercentOffBPS: 2000})).To(Succeed())
+		Expect(couponService.SaveCoupon(ctx, &model.Coupon{
+			Code:      "NODE5",
+			Name:      "Node 5 EUR",
+			AmountOff: model.PriceTable{"EUR": eur(500)},
+			Plans:     []string{"node-starter"},
+			Cycles:    []model.BillingCycle{model.BillingMonthly},
+		})).To(Succeed())
+
+		_, err := cartService.AddPlan(ctx, "sess", "node-starter", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.AddAddon(ctx, "sess", "de-domain")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	// pay checks out the cart as userID and marks the order paid
+	pay := func(sessionID, userID string) {
+		cart, err := cartService.GetOrCreateCart(service.WithUserID(ctx, userID), sessionID)
+		Expect(err).NotTo(HaveOccurred())
+		order := &model.Order{StripeSessionID: "cs_" + sessionID, UserID: userID, CouponCode: cart.CouponCode}
+		Expect(orderRepo.Create(ctx, order)).To(Succeed())
+
+		checkout := service.NewCheckoutService(cartService, orderRepo, nil, nil, nil, nil, "", "")
+		Expect(checkout.HandleWebhook(ctx, order.StripeSessionID, "paid")).To(Succeed())
+		Expect(checkout.HandleWebhook(ctx, order.StripeSessionID, "paid")).To(Succeed()) // retried
+	}
+
+	It("should take a percentage off every line", func() {
+		cart, err := cartService.ApplyCoupon(ctx, "sess", " Launch20 ")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.CouponCode).To(Equal("LAUNCH20"))
+
+		quote, err := cartService.Quote(ctx, cart, model.TaxDecision{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quote.CouponCode).To(Equal("LAUNCH20"))
+		Expect(quote.Lines[0].Coupon).To(Equal(eur(198))) // 20% of 9.90
+		Expect(quote.Lines[1].Coupon).To(Equal(eur(20)))
+		Expect(quote.Coupon).To(Equal(eur(218)))
+		Expect(quote.Net).To(Equal(eur(872)))
+		Expect(quote.Discount).To(Equal(eur(218)))
+
+		_, cycleTotal, err := cartService.GetCartTotal(ctx, cart)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cycleTotal).To(Equal(eur(872)))
+	})
+
+	It("should limit fixed amounts to the eligible plans", func() {
+		cart, err := cartService.ApplyCoupon(ctx, "sess", "node5")
+		Expect(err).NotTo(HaveOccurred())
+
+		quote, err := cartService.Quote(ctx, cart, model.TaxDecision{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quote.Coupon).To(Equal(eur(500)))
+		Expect(quote.Net).To(Equal(eur(590)))
+
+		// Like Stripe, the invoice spreads the amount over every line
+		Expect(quote.Lines[0].Coupon).To(Equal(eur(454)))
+		Expect(quote.Lines[1].Coupon).To(Equal(eur(46)))
+
+		// but never takes off more than the eligible plans are worth
+		cycle := &model.BillingCycleDef{ID: model.BillingMonthly, Months: 1}
+		coupon := &model.Coupon{Code: "MICRO5", AmountOff: model.PriceTable{"EUR": eur(500)}, Plans: []string{"static-micro"}}
+		items := []model.LineItem{
+			{ItemID: "static-micro", ItemType: "plan", Price: eur(390), Quantity: 1},
+			{ItemID: "de-domain", ItemType: "addon", Price: eur(100), Quantity: 1},
+		}
+		capped, err := service.BuildQuote(cycle, "EUR", items, coupon, model.Money{}, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(capped.Coupon).To(Equal(eur(390)))
+		Expect(capped.Net).To(Equal(eur(100)))
+	})
+
+	It("should never discount a line below zero", func() {
+		cycle := &model.BillingCycleDef{ID: model.BillingMonthly, Months: 1}
+		coupon := &model.Coupon{Code: "BIG", AmountOff: model.PriceTable{"EUR": eur(1000)}}
+		items := []model.LineItem{
+			{ItemID: "static-micro", ItemType: "plan", Price: eur(390), Quantity: 1},
+			{ItemID: "de-domain", ItemType: "addon", Price: eur(100), Quantity: 1},
+		}
+
+		quote, err := service.BuildQuote(cycle, "EUR", items, coupon, model.Money{}, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quote.Coupon).To(Equal(eur(490)))
+		Expect(quote.Net.IsZero()).To(BeTrue())
+	})
+
+	It("should reject coupons that do not fit the cart", func() {
+		_, err := cartService.ApplyCoupon(ctx, "sess", "nope")
+		Expect(err).To(MatchError(service.ErrInvalidCoupon))
+
+		_, err = cartService.SetBillingCycle(ctx, "sess", model.BillingYearly)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.ApplyCoupon(ctx, "sess", "NODE5")
+		Expect(err).To(MatchError(service.ErrCouponNotApplicable))
+
+		until := time.Now().Add(-time.Hour)
+		Expect(couponService.SaveCoupon(ctx, &model.Coupon{Code: "OLD", Name: "Old", PercentOffBPS: 1000, ValidUntil: &until})).To(Succeed())
+		_, err = cartService.ApplyCoupon(ctx, "sess", "OLD")
+		Expect(err).To(MatchError(service.ErrInvalidCoupon))
+	})
+
+	It("should stop discounting when the cart no longer qualifies", func() {
+		_, err := cartService.ApplyCoupon(ctx, "sess", "NODE5")
+		Expect(err).NotTo(HaveOccurred())
+		cart, err := cartService.SetBillingCycle(ctx, "sess", model.BillingYearly)
+		Expect(err).NotTo(HaveOccurred())
+
+		quote, err := cartService.Quote(ctx, cart, model.TaxDecision{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quote.CouponCode).To(BeEmpty())
+		Expect(cartService.CheckCoupon(ctx, cart)).To(MatchError(service.ErrCouponNotApplicable))
+
+		cart, err = cartService.RemoveCoupon(ctx, "sess")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.CouponCode).To(BeEmpty())
+		Expect(cartService.CheckCoupon(ctx, cart)).To(Succeed())
+	})
+
+	It("should enforce redemption limits once orders are paid", func() {
+		Expect(couponService.SaveCoupon(ctx, &model.Coupon{Code: "ONCE", Name: "Once", PercentOffBPS: 1000, MaxPerUser: 1, MaxRedemptions: 2})).To(Succeed())
+
+		_, err := cartService.ApplyCoupon(service.WithUserID(ctx, "user_1"), "sess", "ONCE")
+		Expect(err).NotTo(HaveOccurred())
+		pay("sess", "user_1")
+
+		coupon, err := couponService.GetCoupon(ctx, "ONCE")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(coupon.Redemptions).To(Equal(1))
+
+		cart, err := cartService.GetOrCreateCart(service.WithUserID(ctx, "user_1"), "sess")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cartService.CheckCoupon(service.WithUserID(ctx, "user_1"), cart)).To(MatchError(service.ErrCouponLimitReached))
+
+		_, err = cartService.AddPlan(ctx, "other", "node-pro", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.ApplyCoupon(service.WithUserID(ctx, "user_2"), "other", "ONCE")
+		Expect(err).NotTo(HaveOccurred())
+		pay("other", "user_2")
+
+		_, err = cartService.AddPlan(ctx, "third", "node-pro", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.ApplyCoupon(ctx, "third", "ONCE")
+		Expect(err).To(MatchError(service.ErrCouponLimitReached))
+	})
+
+	It("should validate coupons before saving", func() {
+		Expect(couponService.SaveCoupon(ctx, &model.Coupon{Code: "X", Name: "Short", PercentOffBPS: 100})).To(MatchError(service.ErrInvalidCatalogEntry))
+		Expect(couponService.SaveCoupon(ctx, &model.Coupon{Code: "BOTH", Name: "Both", PercentOffBPS: 100, AmountOff: model.PriceTable{"EUR": eur(100)}})).To(MatchError(service.ErrInvalidCatalogEntry))
+		Expect(couponService.SaveCoupon(ctx, &model.Coupon{Code: "PLAN", Name: "Plan", PercentOffBPS: 100, Plans: []string{"no-such-plan"}})).To(MatchError(service.ErrInvalidCatalogEntry))
+		Expect(couponService.DeleteCoupon(ctx, "missing")).To(MatchError(service.ErrInvalidCoupon))
+	})
+})
@@ -0,0 +1,27 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service
+
+import (
+	"strings"
+
+	"github.com/deicod/dysv/internal/model"
+)
+
+// countryCurrencies maps billing countries outside the euro area to the
+// currency we prefer to quote in. Countries not listed pay in DefaultCurrency.
+var countryCurrencies = map[string]string{
+	"CH": "CHF",
+	"LI": "CHF",
+	"GB": "GBP",
+	"US": "USD",
+}
+
+// CurrencyForCountry returns the preferred currency for an ISO 3166-1 alpha-2 country
+func CurrencyForCountry(country string) string {
+	if currency, ok := countryCurrencies[strings.ToUpper(country)]; ok {
+		return currency
+	}
+	return model.DefaultCurrency
+}
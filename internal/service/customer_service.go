@@ -0,0 +1,116 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+)
+
+// CustomerService keeps one gateway customer per user, so a returning
+// customer finds all subscriptions and payment methods in one place. The
+// customer's email and billing address follow the user's latest checkout.
+// Editing or deleting a saved address deliberately does not touch the
+// customer: it keeps the address it was last billed with until the next
+// checkout picks one.
+type CustomerService struct {
+	repo    repo.CustomerRepository
+	gateway PaymentGateway
+}
+
+// NewCustomerService creates a new customer service
+func NewCustomerService(repo repo.CustomerRepository, gateway PaymentGateway) *CustomerService {
+	return &CustomerService{repo: repo, gateway: gateway}
+}
+
+// CustomerID returns the ID of the user's gateway customer, creating it on
+// first use. The customer is updated if email or the billing address addr
+// changed since the last call.
+func (s *CustomerService) CustomerID(ctx context.Context, userID, email string, addr *model.Address) (string, error) {
+	addressHash, err := hashBillingAddress(addr)
+	if err != nil {
+		return "", err
+	}
+
+	customer, err := s.repo.FindByUserID(ctx, userID)
+	if errors.Is(err, repo.ErrNotFound) {
+		return s.create(ctx, userID, email, addr, addressHash)
+	}
+	if err != nil {
+		return "", err
+	}
+	if customer.Email == email && customer.AddressID == addr.ID && customer.AddressHash == addressHash {
+		return customer.StripeCustomerID, nil
+	}
+
+	if err := s.gateway.UpdateCustomer(ctx, customer.StripeCustomerID, &CustomerParams{Email: email, Address: addr}); err != nil {
+		fmt.Printf("CustomerService: UpdateCustomer Error: %v\n", err)
+		return "", fmt.Errorf("failed to update customer: %w", err)
+	}
+	customer.Email, customer.AddressID, customer.AddressHash = email, addr.ID, addressHash
+	customer.UpdatedAt = time.Now()
+	if err := s.repo.UpdateSynced(ctx, customer); err != nil {
+		return "", err
+	}
+	return customer.StripeCustomerID, nil
+}
+
+// create creates the user's gateway customer, syncs email and the billing
+// address addr to it and links it
+func (s *CustomerService) create(ctx context.Context, userID, email string, addr *model.Address, addressHash string) (string, error) {
+	// Concurrent and retried first checkouts get the same customer back
+	// from the gateway. Stripe requires a replay to send the same params,
+	// so the key and the params depend on the user alone; email and address
+	// follow with an update.
+	createdID, err := s.gateway.CreateCustomer(ctx, &CustomerParams{
+		Metadata:       map[string]string{"user_id": userID},
+		IdempotencyKey: "customer:" + userID,
+	})
+	if err != nil {
+		fmt.Printf("CustomerService: CreateCustomer Error: %v\n", err)
+		return "", fmt.Errorf("failed to create customer: %w", err)
+	}
+	if err := s.gateway.UpdateCustomer(ctx, createdID, &CustomerParams{Email: email, Address: addr}); err != nil {
+		fmt.Printf("CustomerService: UpdateCustomer Error: %v\n", err)
+		return "", fmt.Errorf("failed to update customer: %w", err)
+	}
+
+	now := time.Now()
+	customer := &model.Customer{
+		UserID:           userID,
+		StripeCustomerID: createdID,
+		Email:            email,
+		AddressID:        addr.ID,
+		AddressHash:      addressHash,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if err := s.repo.Create(ctx, customer); err != nil {
+		if !errors.Is(err, repo.ErrConflict) {
+			return "", err
+		}
+		// Linked by a concurrent checkout in the meantime, possibly with
+		// other details; sync ours as on any later checkout
+		return s.CustomerID(ctx, userID, email, addr)
+	}
+	return createdID, nil
+}
+
+// hashBillingAddress fingerprints the address fields synced to the gateway
+func hashBillingAddress(addr *model.Address) (string, error) {
+	data, err := json.Marshal([]string{addr.Company, addr.Phone, addr.Line1, addr.Line2, addr.City, addr.PostalCode, addr.State, addr.Country})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
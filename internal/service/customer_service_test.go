@@ -0,0 +1,156 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service_test
+
+import (
+	"context"
+
+	"github.com/deicod/dysv/internal/mocks"
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/deicod/dysv/internal/service"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stripe customers", func() {
+	var (
+		ctx          context.Context
+		stripeServer *mocks.StripeServer
+		cartService  *service.CartService
+		addresses    *service.AddressService
+		checkout     *service.CheckoutService
+		orderRepo    *repo.MockOrderRepo
+		address      *model.Address
+	)
+
+	BeforeEach(func() {
+		ctx = service.WithUserID(context.Background(), "user_1")
+		stripeServer = mocks.NewStripeServer()
+		gateway := service.NewStripeGateway(service.NewStripeClient("sk_test_123", stripeServer.URL))
+
+		catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		cartService = service.NewCartService(repo.NewMockCartRepo(), catalogService, nil, nil)
+		addresses = service.NewAddressService(mocks.NewMockAddressRepo(), nil)
+		orderRepo = repo.NewMockOrderRepo()
+		customers := service.NewCustomerService(repo.NewMockCustomerRepo(), gateway)
+		checkout = service.NewCheckoutService(cartService, orderRepo, addresses, nil, customers, gateway, "https://dysv.test/success", "https://dysv.test/cart")
+
+		address = &model.Address{UserID: "user_1", Label: "Office", Company: "Agentur GmbH", CustomerType: model.CustomerBusiness,
+			Line1: "Hauptstr. 1", City: "Berlin", PostalCode: "10115", Country: "DE"}
+		Expect(addresses.CreateAddress(ctx, address)).To(Succeed())
+		addPlan(ctx, cartService, "node-starter")
+	})
+
+	AfterEach(func() {
+		stripeServer.Close()
+	})
+
+	// buy checks out the cart of user_1 and marks the order paid
+	buy := func(key string) (*model.Order, mocks.StripeObject) {
+		GinkgoHelper()
+		_, err := checkout.CreateCheckoutSession(ctx, "sess", "user_1", "user@example.com", address.ID, key)
+		Expect(err).NotTo(HaveOccurred())
+		order, err := orderRepo.FindByIdempotencyKey(ctx, "user_1", key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checkout.HandleWebhook(ctx, order.StripeSessionID, "paid")).To(Succeed())
+		return order, stripeServer.Object(order.StripeSessionID)
+	}
+
+	It("should create the customer on the first checkout", func() {
+		order, session := buy("key-1")
+		Expect(stripeServer.Count("customer")).To(Equal(1))
+		Expect(session["customer"]).To(Equal(order.StripeCustomerID))
+		Expect(session).NotTo(HaveKey("customer_email"))
+		Expect(order.CustomerEmail).To(Equal("user@example.com"))
+
+		customer := stripeServer.Object(order.StripeCustomerID)
+		Expect(customer["email"]).To(Equal("user@example.com"))
+		Expect(customer["name"]).To(Equal("Agentur GmbH"))
+		Expect(customer["address"]).To(HaveKeyWithValue("city", "Berlin"))
+		Expect(customer["metadata"]).To(HaveKeyWithValue("user_id", "user_1"))
+	})
+
+	It("should reuse the customer of a returning user", func() {
+		first, _ := buy("key-1")
+		requests := len(stripeServer.Requests)
+
+		second, session := buy("key-2")
+		Expect(second.StripeCustomerID).To(Equal(first.StripeCustomerID))
+		Expect(session["customer"]).To(Equal(first.StripeCustomerID))
+		Expect(stripeServer.Count("customer")).To(Equal(1))
+		// Nothing changed, so the customer is not updated
+		Expect(stripeServer.Requests[requests:]).NotTo(ContainElement("POST /v1/customers/" + first.StripeCustomerID))
+	})
+
+	It("should sync a changed billing address and email", func() {
+		first, _ := buy("key-1")
+
+		address.Line1 = "Ilica 1"
+		address.City = "Zagreb"
+		address.PostalCode = "10000"
+		address.Country = "HR"
+		address.Company = ""
+		address.CustomerType = model.CustomerPrivate
+		Expect(addresses.UpdateAddress(ctx, address)).To(Succeed())
+		_, err := checkout.CreateCheckoutSession(ctx, "sess", "user_1", "new@example.com", address.ID, "key-2")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(stripeServer.Count("customer")).To(Equal(1))
+		customer := stripeServer.Object(first.StripeCustomerID)
+		Expect(customer["email"]).To(Equal("new@example.com"))
+		Expect(customer["name"]).To(BeEmpty())
+		Expect(customer["address"]).To(HaveKeyWithValue("city", "Zagreb"))
+		Expect(customer["address"]).To(HaveKeyWithValue("country", "HR"))
+	})
+
+	It("should leave the address alone when updating only the email", func() {
+		first, _ := buy("key-1")
+
+		gateway := service.NewStripeGateway(service.NewStripeClient("sk_test_123", stripeServer.URL))
+		Expect(gateway.UpdateCustomer(ctx, first.StripeCustomerID, &service.CustomerParams{Email: "new@example.com"})).To(Succeed())
+		Expect(gateway.UpdateCustomer(ctx, first.StripeCustomerID, &service.CustomerParams{})).To(Succeed())
+
+		customer := stripeServer.Object(first.StripeCustomerID)
+		Expect(customer["email"]).To(Equal("new@example.com"))
+		Expect(customer["name"]).To(Equal("Agentur GmbH"))
+		Expect(customer["address"]).To(HaveKeyWithValue("city", "Berlin"))
+	})
+
+	It("should create one customer per user even when the first details differ", func() {
+		// A retry after the link was lost, with another email and address
+		gateway := service.NewStripeGateway(service.NewStripeClient("sk_test_123", stripeServer.URL))
+		first, err := service.NewCustomerService(repo.NewMockCustomerRepo(), gateway).CustomerID(ctx, "user_1", "user@example.com", address)
+		Expect(err).NotTo(HaveOccurred())
+
+		moved := *address
+		moved.City = "Hamburg"
+		retried, err := service.NewCustomerService(repo.NewMockCustomerRepo(), gateway).CustomerID(ctx, "user_1", "new@example.com", &moved)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retried).To(Equal(first))
+		Expect(stripeServer.Count("customer")).To(Equal(1))
+
+		customer := stripeServer.Object(first)
+		Expect(customer["email"]).To(Equal("new@example.com"))
+		Expect(customer["address"]).To(HaveKeyWithValue("city", "Hamburg"))
+	})
+
+	It("should give every user their own customer", func() {
+		first, _ := buy("key-1")
+
+		otherCtx := service.WithUserID(context.Background(), "user_2")
+		other := &model.Address{UserID: "user_2", Label: "Home", Line1: "Ilica 1", City: "Zagreb", PostalCode: "10000", Country: "HR"}
+		Expect(addresses.CreateAddress(otherCtx, other)).To(Succeed())
+		addPlan(otherCtx, cartService, "node-starter")
+		_, err := checkout.CreateCheckoutSession(otherCtx, "sess", "user_2", "other@example.com", other.ID, "key-1")
+		Expect(err).NotTo(HaveOccurred())
+
+		order, err := orderRepo.FindByIdempotencyKey(otherCtx, "user_2", "key-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(order.StripeCustomerID).NotTo(BeEmpty())
+		Expect(order.StripeCustomerID).NotTo(Equal(first.StripeCustomerID))
+		Expect(stripeServer.Count("customer")).To(Equal(2))
+	})
+})
@@ -9,4 +9,38 @@ var (
 	ErrInvalidPlan  = errors.New("invalid plan ID")
 	ErrInvalidAddon = errors.New("invalid addon ID")
 	ErrEmptyCart    = errors.New("cart is empty")
+	ErrCartConflict = errors.New("cart was changed concurrently")
+
+	ErrInvalidCatalogEntry = errors.New("invalid catalog entry")
+	ErrUnsupportedCurrency = errors.New("currency not supported")
+	ErrInvalidBillingCycle = errors.New("invalid billing cycle")
+
+	ErrAddonRequiresPlan  = errors.New("addon requires a plan")
+	ErrAddonLimitExceeded = errors.New("addon quantity exceeds limit")
+	ErrAddonConflict      = errors.New("addons cannot be combined")
+	ErrInvalidSite        = errors.New("invalid site configuration")
+
+	ErrLoginRequired       = errors.New("login required")
+	ErrInvalidReminder     = errors.New("invalid reminder settings")
+	ErrInvalidRestoreToken = errors.New("invalid or expired restore link")
+
+	ErrInvalidCoupon       = errors.New("invalid coupon code")
+	ErrCouponNotApplicable = errors.New("coupon does not apply to this cart")
+	ErrCouponLimitReached  = errors.New("coupon redemption limit reached")
+
+	ErrInvalidReferralCode = errors.New("invalid referral code")
+	ErrReferralNotAllowed  = errors.New("referral not allowed")
+	ErrEmailNotVerified    = errors.New("email address not verified")
+	ErrCreditChanged       = errors.New("account credit changed, please check out again")
+
+	ErrInvalidAddress      = errors.New("invalid address")
+	ErrAddressNotFound     = errors.New("address not found")
+	ErrInvalidCountry      = errors.New("invalid country")
+	ErrInvalidVATID        = errors.New("invalid VAT ID")
+	ErrVATCheckUnavailable = errors.New("VAT ID register unavailable")
+
+	ErrCheckoutInProgress = errors.New("checkout is already being created")
+
+	ErrInvalidQuote = errors.New("invalid quote link")
+	ErrQuoteExpired = errors.New("quote has expired")
 )
@@ -0,0 +1,113 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+)
+
+// PaymentGateway is the payment provider behind checkout. StripeGateway
+// talks to Stripe; tests use an in-memory fake.
+type PaymentGateway interface {
+	// CreateCheckoutSession opens a hosted checkout for a subscription. A
+	// repeated idempotency key gets the session created first.
+	CreateCheckoutSession(ctx context.Context, params *CheckoutSessionParams) (*CheckoutSession, error)
+	// CreateDiscount creates a discount for a single checkout and returns its ID
+	CreateDiscount(ctx context.Context, params *DiscountParams) (string, error)
+	// TaxRate returns the ID of the provider's tax rate for tax, creating it
+	// on first use
+	TaxRate(ctx context.Context, tax model.TaxDecision) (string, error)
+
+	// CreateCustomer creates a customer and returns its ID
+	CreateCustomer(ctx context.Context, params *CustomerParams) (string, error)
+	// UpdateCustomer replaces the email and billing address of a customer.
+	// An empty email or nil address leaves that part unchanged.
+	UpdateCustomer(ctx context.Context, id string, params *CustomerParams) error
+
+	// GetSubscription returns a subscription created by checkout
+	GetSubscription(ctx context.Context, id string) (*GatewaySubscription, error)
+	// CancelSubscription cancels a subscription now or, with atPeriodEnd,
+	// once the paid period is over
+	CancelSubscription(ctx context.Context, id string, atPeriodEnd bool) error
+
+	// Refund refunds a payment and returns the refund's ID
+	Refund(ctx context.Context, params *RefundParams) (string, error)
+}
+
+// CheckoutSessionParams describe a checkout session for a subscription
+type CheckoutSessionParams struct {
+	SuccessURL           string
+	CancelURL            string
+	Currency             string // ISO 4217, used by lines without a price ID
+	Lines                []CheckoutLine
+	TaxRateID            string // applied to every line; empty for none
+	DiscountID           string // from CreateDiscount; empty for none
+	CustomerID           string // from CreateCustomer; without it CustomerEmail pre-fills the form
+	CustomerEmail        string
+	TrialDays            int
+	Metadata             map[string]string // on the session
+	SubscriptionMetadata map[string]string // on the subscription the session creates
+	IdempotencyKey       string
+}
+
+// CheckoutLine is a recurring line of a checkout session
+type CheckoutLine struct {
+	PriceID       string // catalog price synced to the provider; empty for an inline price
+	Name          string
+	Description   string
+	UnitAmount    int64 // minor units, for inline prices
+	Interval      string
+	IntervalCount int64
+	Quantity      int64
+}
+
+// CheckoutSession is a created checkout session
+type CheckoutSession struct {
+	ID        string
+	URL       string // where the customer pays
+	ExpiresAt time.Time
+}
+
+// DiscountParams describe a fixed-amount discount
+type DiscountParams struct {
+	Name           string
+	AmountOff      int64 // minor units
+	Currency       string
+	PercentOffBPS  int64    // percent off in basis points, instead of AmountOff
+	ProductIDs     []string // products a percentage applies to; empty for all
+	Recurring      bool     // taken off every invoice instead of the first only
+	Metadata       map[string]string
+	IdempotencyKey string
+}
+
+// CustomerParams describe a customer. Address is the billing address; its
+// company becomes the customer name. Email and Address are optional on
+// creation.
+type CustomerParams struct {
+	Email          string
+	Address        *model.Address
+	Metadata       map[string]string // only set on creation
+	IdempotencyKey string
+}
+
+// GatewaySubscription is a subscription as the provider reports it
+type GatewaySubscription struct {
+	ID                string
+	CustomerID        string
+	Status            string // trialing, active, past_due, canceled, ...
+	CancelAtPeriodEnd bool
+	TrialEnd          *time.Time
+	Metadata          map[string]string
+}
+
+// RefundParams describe a refund of a payment
+type RefundParams struct {
+	PaymentID      string // the provider's payment, a Stripe PaymentIntent
+	Amount         int64  // minor units; 0 refunds the whole payment
+	Reason         string
+	IdempotencyKey string
+}
@@ -0,0 +1,236 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service
+
+import (
+	"sort"
+
+	"github.com/deicod/dysv/internal/model"
+)
+
+// CycleUnitPrice returns what one unit of item costs per invoice of cycle.
+// Plans always get the cycle's discount rule, addons only if the cycle says so.
+func CycleUnitPrice(cycle *model.BillingCycleDef, item model.LineItem) (model.Money, error) {
+	discounted := item.ItemType == "plan" || cycle.DiscountAddons
+
+	months := cycle.Months
+	if discounted {
+		months -= cycle.FreeMonths
+	}
+	price, err := item.Price.Mul(months)
+	if err != nil {
+		return model.Money{}, err
+	}
+	if discounted && cycle.DiscountBPS > 0 {
+		return price.ApplyDiscount(cycle.DiscountBPS)
+	}
+	return price, nil
+}
+
+// CycleTotal returns the net invoice total for items under cycle, before
+// any coupon
+func CycleTotal(cycle *model.BillingCycleDef, currency string, items []model.LineItem) (model.Money, error) {
+	quote, err := BuildQuote(cycle, currency, items, nil, model.Money{}, 0)
+	if err != nil {
+		return model.Money{}, err
+	}
+	return quote.Net, nil
+}
+
+// BuildQuote breaks items down per line for one invoice of cycle. coupon
+// (optional) is worked out on the lines it discounts, a fixed amount never
+// exceeding what they are worth, and credit is drawn from what is left.
+// Tax at taxRateBPS is added to each line's net.
+//
+// The lines share the discount the way the payment gateway does (see
+// discountShares), so every line's tax is rounded as it will be on the
+// invoice.
+func BuildQuote(cycle *model.BillingCycleDef, currency string, items []model.LineItem, coupon *model.Coupon, credit model.Money, taxRateBPS int64) (*model.Quote, error) {
+	zero := model.NewMoney(0, currency)
+	quote := &model.Quote{
+		Currency:     zero.Currency,
+		BillingCycle: cycle.ID,
+		Months:       cycle.Months,
+		TaxRateBPS:   taxRateBPS,
+		Lines:        make([]model.QuoteLine, 0, len(items)),
+		List:         zero,
+		Discount:     zero,
+		Coupon:       zero,
+		Credit:       zero,
+		Net:          zero,
+		Tax:          zero,
+		Gross:        zero,
+	}
+
+	fixedLeft := zero
+	if coupon != nil {
+		if amount, ok := coupon.AmountOff.In(zero.Currency); ok {
+			fixedLeft = amount
+		}
+	}
+
+	lines := make([]model.QuoteLine, 0, len(items))
+	nets := make([]int64, len(items))
+	offs := make([]int64, len(items))
+	var net, couponOff int64
+	for i, item := range items {
+		line, err := quoteLine(cycle, item, zero)
+		if err != nil {
+			return nil, err
+		}
+		if coupon != nil && coupon.Discounts(item) {
+			if offs[i], err = couponAmount(line, coupon, &fixedLeft); err != nil {
+				return nil, err
+			}
+		}
+		lines = append(lines, line)
+		nets[i] = line.Net.Amount
+		net += line.Net.Amount
+		couponOff += offs[i]
+	}
+	var creditOff int64
+	if credit.Currency == zero.Currency && credit.Amount > 0 {
+		creditOff = min(credit.Amount, net-couponOff)
+	}
+
+	shares, credits := discountShares(coupon, nets, offs, couponOff, creditOff)
+	for i, line := range lines {
+		var err error
+		line.Credit = model.NewMoney(credits[i], zero.Currency)
+		line.Coupon = model.NewMoney(shares[i]-credits[i], zero.Currency)
+		if line.Discount, err = line.Discount.Add(line.Coupon); err != nil {
+			return nil, err
+		}
+		if line.Net, err = line.Net.Sub(model.NewMoney(shares[i], zero.Currency)); err != nil {
+			return nil, err
+		}
+		if line.Tax, err = line.Net.Percent(taxRateBPS); err != nil {
+			return nil, err
+		}
+		if line.Gross, err = line.Net.Add(line.Tax); err != nil {
+			return nil, err
+		}
+		quote.Lines = append(quote.Lines, line)
+
+		if err := addLine(quote, line); err != nil {
+			return nil, err
+		}
+	}
+	if !quote.Coupon.IsZero() {
+		quote.CouponCode = coupon.Code
+	}
+	return quote, nil
+}
+
+// discountShares splits coupon and credit over the lines worth nets the way
+// the payment gateway will, returning each line's discount and the credit
+// part of it. A recurring percentage without credit is passed on as a
+// percentage (see CheckoutService.discount) and taken off the lines it
+// discounts, offs. Anything else becomes one amount off the invoice, which
+// the gateway spreads over all lines in proportion to what they are worth.
+func discountShares(coupon *model.Coupon, nets, offs []int64, couponOff, creditOff int64) (shares, credits []int64) {
+	if coupon != nil && coupon.Recurring && coupon.PercentOffBPS > 0 && creditOff == 0 {
+		return offs, make([]int64, len(offs))
+	}
+	shares = allocate(couponOff+creditOff, nets)
+	return shares, allocate(creditOff, shares)
+}
+
+// allocate splits amount in proportion to weights. Rounded down shares are
+// topped up a unit at a time, largest remainder first, so they add up to
+// amount; no share exceeds its weight as long as amount does not exceed
+// their sum.
+func allocate(amount int64, weights []int64) []int64 {
+	shares := make([]int64, len(weights))
+	var total int64
+	for _, weight := range weights {
+		total += weight
+	}
+	if amount <= 0 || total <= 0 {
+		return shares
+	}
+
+	remainders := make([]int64, len(weights))
+	order := make([]int, len(weights))
+	left := amount
+	for i, weight := range weights {
+		shares[i] = amount * weight / total
+		remainders[i] = amount * weight % total
+		order[i] = i
+		left -= shares[i]
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for _, i := range order[:left] {
+		shares[i]++
+	}
+	return shares
+}
+
+// addLine adds the amounts of line to the quote totals
+func addLine(quote *model.Quote, line model.QuoteLine) error {
+	var err error
+	if quote.List, err = quote.List.Add(line.List); err != nil {
+		return err
+	}
+	if quote.Discount, err = quote.Discount.Add(line.Discount); err != nil {
+		return err
+	}
+	if quote.Coupon, err = quote.Coupon.Add(line.Coupon); err != nil {
+		return err
+	}
+	if quote.Credit, err = quote.Credit.Add(line.Credit); err != nil {
+		return err
+	}
+	if quote.Net, err = quote.Net.Add(line.Net); err != nil {
+		return err
+	}
+	if quote.Tax, err = quote.Tax.Add(line.Tax); err != nil {
+		return err
+	}
+	quote.Gross, err = quote.Gross.Add(line.Gross)
+	return err
+}
+
+// quoteLine prices item under cycle, before coupon, credit and tax
+func quoteLine(cycle *model.BillingCycleDef, item model.LineItem, zero model.Money) (model.QuoteLine, error) {
+	line := model.QuoteLine{
+		ItemID:   item.ItemID,
+		ItemType: item.ItemType,
+		Name:     item.Name,
+		Quantity: item.Quantity,
+		Coupon:   zero,
+		Credit:   zero,
+	}
+
+	var err error
+	if line.UnitPrice, err = CycleUnitPrice(cycle, item); err != nil {
+		return line, err
+	}
+	if line.Net, err = line.UnitPrice.Mul(int64(item.Quantity)); err != nil {
+		return line, err
+	}
+	if line.List, err = item.Price.Mul(cycle.Months * int64(item.Quantity)); err != nil {
+		return line, err
+	}
+	if line.Discount, err = line.List.Sub(line.Net); err != nil {
+		return line, err
+	}
+	return line, nil
+}
+
+// couponAmount returns what coupon takes off line. A fixed amount is drawn
+// from fixedLeft, never more than the line is worth.
+func couponAmount(line model.QuoteLine, coupon *model.Coupon, fixedLeft *model.Money) (int64, error) {
+	off, err := line.Net.Percent(coupon.PercentOffBPS)
+	if err != nil {
+		return 0, err
+	}
+	if fixed := min(fixedLeft.Amount, line.Net.Amount-off.Amount); fixed > 0 {
+		off.Amount += fixed
+		fixedLeft.Amount -= fixed
+	}
+	return off.Amount, nil
+}
@@ -0,0 +1,151 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// DefaultQuoteValidity is how long a saved quote's prices are honored when
+// no validity is given
+const DefaultQuoteValidity = 14 * 24 * time.Hour
+
+// QuoteService freezes carts into saved quotes and shares them as signed
+// links of the form baseURL/quote/<id>.<signature>
+type QuoteService struct {
+	quotes  repo.QuoteRepository
+	carts   *CartService
+	secret  []byte
+	baseURL string
+}
+
+// NewQuoteService creates a quote service. secret signs the quote links;
+// without one a random secret is generated, so links break on restart.
+func NewQuoteService(quotes repo.QuoteRepository, carts *CartService, secret, baseURL string) *QuoteService {
+	s := &QuoteService{quotes: quotes, carts: carts, secret: []byte(secret), baseURL: baseURL}
+	if secret == "" {
+		log.Println("Warning: QUOTE_SECRET not set, using a random secret")
+		s.secret = make([]byte, 32)
+		if _, err := rand.Read(s.secret); err != nil {
+			panic(err)
+		}
+	}
+	return s
+}
+
+// CreateQuote freezes the session's cart into a quote valid for validFor
+// (DefaultQuoteValidity if not positive) and returns it with its token
+func (s *QuoteService) CreateQuote(ctx context.Context, sessionID, createdBy, note string, validFor time.Duration) (*model.SavedQuote, string, error) {
+	cart, err := s.carts.GetCart(ctx, sessionID)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(cart.Items) == 0 {
+		return nil, "", ErrEmptyCart
+	}
+	if err := s.carts.ValidateCart(ctx, cart); err != nil {
+		return nil, "", err
+	}
+	// The sales person's account credit is not part of the quote. Prices are
+	// quoted net; VAT follows from the billing address at checkout.
+	breakdown, err := s.carts.QuoteWithoutCredit(ctx, cart, model.TaxDecision{})
+	if err != nil {
+		return nil, "", err
+	}
+	// Later catalog and coupon changes must not change the quoted amounts
+	cycle, err := s.carts.CycleFor(ctx, cart)
+	if err != nil {
+		return nil, "", err
+	}
+	var coupon *model.Coupon
+	if breakdown.CouponCode != "" {
+		if coupon, err = s.carts.couponFor(ctx, cart); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if validFor <= 0 {
+		validFor = DefaultQuoteValidity
+	}
+	now := time.Now()
+	quote := &model.SavedQuote{
+		Items:        cart.Items,
+		BillingCycle: cart.BillingCycle,
+		Currency:     cart.Currency,
+		Quote:        *breakdown,
+		Cycle:        cycle,
+		Coupon:       coupon,
+		Note:         strings.TrimSpace(note),
+		CreatedBy:    createdBy,
+		ExpiresAt:    now.Add(validFor),
+		CreatedAt:    now,
+	}
+	if err := s.quotes.Create(ctx, quote); err != nil {
+		return nil, "", err
+	}
+	return quote, s.Token(quote), nil
+}
+
+// Token returns the signed public token of a saved quote
+func (s *QuoteService) Token(quote *model.SavedQuote) string {
+	id := quote.ID.Hex()
+	return id + "." + s.signature(id)
+}
+
+// URL returns the public link to a saved quote
+func (s *QuoteService) URL(token string) string {
+	return s.baseURL + "/quote/" + token
+}
+
+// GetQuote returns the saved quote a token refers to. Fails with
+// ErrInvalidQuote for bad tokens and ErrQuoteExpired after expiry.
+func (s *QuoteService) GetQuote(ctx context.Context, token string) (*model.SavedQuote, error) {
+	id, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.signature(id))) {
+		return nil, ErrInvalidQuote
+	}
+	oid, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidQuote
+	}
+
+	quote, err := s.quotes.FindByID(ctx, oid)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, ErrInvalidQuote
+	}
+	if err != nil {
+		return nil, err
+	}
+	if quote.Expired(time.Now()) {
+		return nil, ErrQuoteExpired
+	}
+	return quote, nil
+}
+
+// LoadQuote replaces the session's cart with the quote a token refers to
+func (s *QuoteService) LoadQuote(ctx context.Context, sessionID, token string) (*model.Cart, error) {
+	quote, err := s.GetQuote(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.carts.ApplyQuote(ctx, sessionID, quote)
+}
+
+func (s *QuoteService) signature(id string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("quote:" + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
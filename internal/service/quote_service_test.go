@@ -0,0 +1,171 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/deicod/dysv/internal/service"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("QuoteService", func() {
+	var (
+		ctx            context.Context
+		catalogService *service.CatalogService
+		cartService    *service.CartService
+		quoteService   *service.QuoteService
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		catalogService = service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		cartService = service.NewCartService(repo.NewMockCartRepo(), catalogService, nil, nil)
+		quoteService = service.NewQuoteService(repo.NewMockQuoteRepo(), cartService, "quote-secret", "https://dysv.test")
+
+		_, err := cartService.AddPlan(ctx, "sales", "node-pro", 3)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.SetBillingCycle(ctx, "sales", model.BillingYearly)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	// discount lowers the catalog price of node-pro, as sales might agree
+	discount := func() {
+		plan, err := catalogService.GetPlan(ctx, "node-pro")
+		Expect(err).NotTo(HaveOccurred())
+		plan.MonthlyPrices["EUR"] = eur(2990)
+		Expect(catalogService.SavePlan(ctx, plan)).To(Succeed())
+	}
+
+	It("should freeze the cart into a signed link", func() {
+		quote, token, err := quoteService.CreateQuote(ctx, "sales", "admin_1", " Agency bundle ", 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quote.Note).To(Equal("Agency bundle"))
+		Expect(quote.Quote.Net).To(Equal(eur(119700))) // 3 x 39.90 x 10 months
+		Expect(quote.ExpiresAt).To(BeTemporally("~", time.Now().Add(service.DefaultQuoteValidity), time.Minute))
+		Expect(quoteService.URL(token)).To(Equal("https://dysv.test/quote/" + token))
+
+		found, err := quoteService.GetQuote(ctx, token)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found.ID).To(Equal(quote.ID))
+	})
+
+	It("should reject tampered and foreign tokens", func() {
+		_, token, err := quoteService.CreateQuote(ctx, "sales", "admin_1", "", 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = quoteService.GetQuote(ctx, token+"x")
+		Expect(err).To(MatchError(service.ErrInvalidQuote))
+		_, err = quoteService.GetQuote(ctx, "not-a-token")
+		Expect(err).To(MatchError(service.ErrInvalidQuote))
+
+		other := service.NewQuoteService(repo.NewMockQuoteRepo(), cartService, "other-secret", "")
+		_, err = other.GetQuote(ctx, token)
+		Expect(err).To(MatchError(service.ErrInvalidQuote))
+	})
+
+	It("should not save empty carts", func() {
+		_, _, err := quoteService.CreateQuote(ctx, "empty", "admin_1", "", 0)
+		Expect(err).To(MatchError(service.ErrEmptyCart))
+	})
+
+	It("should honor the quoted prices in the customer's cart", func() {
+		_, token, err := quoteService.CreateQuote(ctx, "sales", "admin_1", "", 0)
+		Expect(err).NotTo(HaveOccurred())
+		discount()
+
+		cart, err := quoteService.LoadQuote(ctx, "customer", token)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.Items).To(HaveLen(1))
+		Expect(cart.Items[0].Price).To(Equal(eur(3990)))
+		Expect(cart.BillingCycle).To(Equal(model.BillingYearly))
+		Expect(cart.QuoteID).NotTo(BeEmpty())
+
+		// Site configuration keeps the quote
+		cart, err = cartService.ConfigureSite(ctx, "customer", "node-pro", 0, model.SiteConfig{Name: "shop"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.QuoteID).NotTo(BeEmpty())
+
+		// Changing the bundle returns to catalog prices
+		cart, err = cartService.UpdateItemQuantity(ctx, "customer", "node-pro", 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.QuoteID).To(BeEmpty())
+		Expect(cart.Items[0].Price).To(Equal(eur(2990)))
+	})
+
+	It("should stop honoring prices once the quote expires", func() {
+		_, token, err := quoteService.CreateQuote(ctx, "sales", "admin_1", "", time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = quoteService.LoadQuote(ctx, "customer", token)
+		Expect(err).NotTo(HaveOccurred())
+		discount()
+
+		Eventually(func() error {
+			_, err := quoteService.GetQuote(ctx, token)
+			return err
+		}, 3*time.Second, 100*time.Millisecond).Should(MatchError(service.ErrQuoteExpired))
+
+		cart, err := cartService.GetCart(ctx, "customer")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.QuoteID).To(BeEmpty())
+		Expect(cart.Items[0].Price).To(Equal(eur(2990)))
+	})
+
+	It("should honor the quoted coupon and billing cycle until the quote expires", func() {
+		coupons := service.NewCouponService(repo.NewMockCouponRepo(), catalogService)
+		Expect(coupons.SaveCoupon(ctx, &model.Coupon{Code: "AGENCY", Name: "Agency", PercentOffBPS: 1000})).To(Succeed())
+		cartService = service.NewCartService(repo.NewMockCartRepo(), catalogService, coupons, nil)
+		quoteService = service.NewQuoteService(repo.NewMockQuoteRepo(), cartService, "quote-secret", "")
+		_, err := cartService.AddPlan(ctx, "sales", "node-pro", 3)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.SetBillingCycle(ctx, "sales", model.BillingYearly)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.ApplyCoupon(ctx, "sales", "AGENCY")
+		Expect(err).NotTo(HaveOccurred())
+		saved, token, err := quoteService.CreateQuote(ctx, "sales", "admin_1", "", 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(saved.Quote.Coupon).To(Equal(eur(11970)))
+
+		// The coupon ends and the yearly terms change after the quote was sent
+		until := time.Now().Add(-time.Minute)
+		Expect(coupons.SaveCoupon(ctx, &model.Coupon{Code: "AGENCY", Name: "Agency", PercentOffBPS: 500, ValidUntil: &until})).To(Succeed())
+		cycle, err := catalogService.GetCycle(ctx, model.BillingYearly)
+		Expect(err).NotTo(HaveOccurred())
+		cycle.FreeMonths = 1
+		Expect(catalogService.SaveCycle(ctx, cycle)).To(Succeed())
+
+		cart, err := quoteService.LoadQuote(ctx, "customer", token)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cartService.CheckCoupon(ctx, cart)).To(Succeed())
+		quote, err := cartService.Quote(ctx, cart, model.TaxDecision{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quote.Coupon).To(Equal(saved.Quote.Coupon))
+		Expect(quote.Net).To(Equal(saved.Quote.Net))
+
+		// Leaving the quote brings the current terms back
+		cart, err = cartService.UpdateItemQuantity(ctx, "customer", "node-pro", 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cartService.CheckCoupon(ctx, cart)).To(MatchError(service.ErrInvalidCoupon))
+	})
+
+	It("should carry the quote into an empty user cart on login", func() {
+		_, token, err := quoteService.CreateQuote(ctx, "sales", "admin_1", "", 0)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cartService.GetOrCreateCart(service.WithUserID(ctx, "user_1"), "old-session")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = quoteService.LoadQuote(ctx, "customer", token)
+		Expect(err).NotTo(HaveOccurred())
+		discount()
+
+		cart, err := cartService.MergeCarts(ctx, "customer", "user_1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cart.QuoteID).NotTo(BeEmpty())
+		Expect(cart.Items[0].Price).To(Equal(eur(3990)))
+	})
+})
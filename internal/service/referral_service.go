@@ -0,0 +1,351 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// DefaultReferralReward is the credit referrer and referee each get, in the
+// currency of the referee's first order
+var DefaultReferralReward = model.PriceTable{
+	"EUR": model.NewMoney(1000, "EUR"),
+	"USD": model.NewMoney(1000, "USD"),
+	"GBP": model.NewMoney(1000, "GBP"),
+	"CHF": model.NewMoney(1000, "CHF"),
+}
+
+// referralCodeAlphabet leaves out characters that are easily confused
+const referralCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// maxReferralChain bounds the walk up the referrers when looking for loops
+const maxReferralChain = 32
+
+// ReferralService hands out referral codes, attributes registrations to
+// them and keeps the account credit the rewards are paid in
+type ReferralService struct {
+	repo   repo.ReferralRepository
+	reward model.PriceTable
+}
+
+// NewReferralService creates a new referral service.
+// reward is optional and defaults to DefaultReferralReward.
+func NewReferralService(referralRepo repo.ReferralRepository, reward model.PriceTable) *ReferralService {
+	if reward == nil {
+		reward = DefaultReferralReward
+	}
+	return &ReferralService{repo: referralRepo, reward: reward}
+}
+
+// CanonicalEmail reduces an email address to the mailbox it delivers to:
+// lower case, without +tags and, for Gmail, without dots
+func CanonicalEmail(email string) string {
+	local, domain, ok := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	if !ok {
+		return local
+	}
+	local, _, _ = strings.Cut(local, "+")
+	if domain == "gmail.com" || domain == "googlemail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+	return local + "@" + domain
+}
+
+// CodeFor returns the referral code of a user, creating it on first use.
+// Only users with a verified email address get a code.
+func (s *ReferralService) CodeFor(ctx context.Context, userID, email string, verified bool) (*model.ReferralCode, error) {
+	code, err := s.repo.FindCodeByUser(ctx, userID)
+	if !errors.Is(err, repo.ErrNotFound) {
+		return code, err
+	}
+	if !verified {
+		return nil, ErrEmailNotVerified
+	}
+
+	for range 5 {
+		code = &model.ReferralCode{
+			Code:      newReferralCode(),
+			UserID:    userID,
+			Email:     CanonicalEmail(email),
+			CreatedAt: time.Now(),
+		}
+		err = s.repo.CreateCode(ctx, code)
+		if !errors.Is(err, repo.ErrConflict) {
+			break
+		}
+		// Either the code is taken or a concurrent request created the user's code
+		if existing, err := s.repo.FindCodeByUser(ctx, userID); err == nil {
+			return existing, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// CheckCode returns the referral code a new user with email may register
+// with. Fails with ErrInvalidReferralCode for unknown codes and
+// ErrReferralNotAllowed for the owner's own address.
+func (s *ReferralService) CheckCode(ctx context.Context, code, email string) (*model.ReferralCode, error) {
+	owner, err := s.repo.FindCode(ctx, strings.ToUpper(strings.TrimSpace(code)))
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, ErrInvalidReferralCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	if CanonicalEmail(email) == owner.Email {
+		return nil, fmt.Errorf("%w: self-referral", ErrReferralNotAllowed)
+	}
+	return owner, nil
+}
+
+// Attribute records that refereeID registered with code. The referral is
+// rewarded by Reward once the referee's first order is paid.
+func (s *ReferralService) Attribute(ctx context.Context, code, refereeID, email string) error {
+	owner, err := s.CheckCode(ctx, code, email)
+	if err != nil {
+		return err
+	}
+	if owner.UserID == refereeID {
+		return fmt.Errorf("%w: self-referral", ErrReferralNotAllowed)
+	}
+	loop, err := s.inChain(ctx, owner.UserID, refereeID)
+	if err != nil {
+		return err
+	}
+	if loop {
+		return fmt.Errorf("%w: referral loop", ErrReferralNotAllowed)
+	}
+
+	err = s.repo.CreateReferral(ctx, &model.Referral{
+		RefereeID:  refereeID,
+		ReferrerID: owner.UserID,
+		Code:       owner.Code,
+		Status:     model.ReferralPending,
+		CreatedAt:  time.Now(),
+	})
+	if errors.Is(err, repo.ErrConflict) {
+		return fmt.Errorf("%w: already referred", ErrReferralNotAllowed)
+	}
+	return err
+}
+
+// Reward credits referrer and referee when the referee's first order is
+// paid. Later orders and webhook retries leave the referral alone.
+func (s *ReferralService) Reward(ctx context.Context, order *model.Order) error {
+	// An order paid entirely with credit does not count, or credit would
+	// earn credit; neither does a trial, which pays nothing yet and is
+	// rewarded by RewardInvoice
+	if order.TotalAmount.Amount <= 0 || order.TrialDays > 0 {
+		return nil
+	}
+	return s.resolve(ctx, order, order.TotalAmount)
+}
+
+// RewardInvoice credits referrer and referee for a referral still pending
+// when paid was charged by an invoice of order's subscription, such as the
+// first invoice after a trial. Invoices paid entirely with credit do not
+// count.
+func (s *ReferralService) RewardInvoice(ctx context.Context, order *model.Order, paid model.Money) error {
+	if paid.Amount <= 0 {
+		return nil
+	}
+	return s.resolve(ctx, order, paid)
+}
+
+// resolve rewards the pending referral of order's user in the currency of
+// paid
+func (s *ReferralService) resolve(ctx context.Context, order *model.Order, paid model.Money) error {
+	if order.UserID == "" {
+		return nil
+	}
+	referral, err := s.repo.FindReferral(ctx, order.UserID)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil
+	}
+	if err != nil || referral.Status != model.ReferralPending {
+		return err
+	}
+
+	now := time.Now()
+	referral.OrderID = order.ID
+	referral.ResolvedAt = &now
+	referral.Status = model.ReferralRewarded
+
+	loop, err := s.inChain(ctx, referral.ReferrerID, referral.RefereeID)
+	if err != nil {
+		return err
+	}
+	if loop {
+		referral.Status = model.ReferralRejected
+		referral.Reason = "referral loop"
+		fmt.Printf("ReferralService: rejected referral of %s by %s: %s\n", referral.RefereeID, referral.ReferrerID, referral.Reason)
+		_, err := s.repo.ResolveReferral(ctx, referral)
+		return err
+	}
+
+	reward, ok := s.reward.In(paid.Currency)
+	if !ok {
+		reward, ok = s.reward.In(model.DefaultCurrency)
+	}
+	if ok {
+		// Credit first: entries are booked once, so a retry after a failure
+		// in between completes the reward
+		for role, userID := range map[string]string{"referrer": referral.ReferrerID, "referee": referral.RefereeID} {
+			if _, err := s.repo.AddCredit(ctx, &model.CreditEntry{
+				ID:        "referral:" + referral.RefereeID + ":" + role,
+				UserID:    userID,
+				Amount:    reward,
+				Reason:    "referral",
+				CreatedAt: now,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = s.repo.ResolveReferral(ctx, referral)
+	return err
+}
+
+// Hold takes the credit an order uses off the balance while its checkout is
+// open, so other checkouts cannot spend it too. It is booked once the order
+// is paid (Spend) or given back when the checkout ends unpaid (Release).
+// Fails with ErrCreditChanged if the balance no longer covers it.
+func (s *ReferralService) Hold(ctx context.Context, order *model.Order) error {
+	if order.Credit.Amount <= 0 {
+		return nil
+	}
+	entry := orderCredit(order)
+	entry.Held = true
+	if _, err := s.repo.AddCredit(ctx, entry); err != nil {
+		return err
+	}
+
+	// Checked after booking, so of two checkouts racing for the same
+	// credit at least one sees the other
+	balances, err := s.repo.CreditBalances(ctx, order.UserID)
+	if err != nil {
+		return err
+	}
+	if balance, _ := balances.In(order.Credit.Currency); balance.Amount < 0 {
+		if _, err := s.repo.ReleaseCredit(ctx, entry.ID); err != nil {
+			return err
+		}
+		return ErrCreditChanged
+	}
+	return nil
+}
+
+// Spend books the credit a paid order used. Webhook retries book it once.
+func (s *ReferralService) Spend(ctx context.Context, order *model.Order) error {
+	if order.Credit.Amount <= 0 {
+		return nil
+	}
+	entry := orderCredit(order)
+	settled, err := s.repo.SettleCredit(ctx, entry.ID)
+	if err != nil || settled {
+		return err
+	}
+	// Orders from before credit was held
+	_, err = s.repo.AddCredit(ctx, entry)
+	return err
+}
+
+// Release gives back the credit held by an order whose checkout ended
+// unpaid
+func (s *ReferralService) Release(ctx context.Context, orderID bson.ObjectID) error {
+	released, err := s.repo.ReleaseCredit(ctx, "order:"+orderID.Hex())
+	if released {
+		fmt.Printf("ReferralService: released the credit of order %s\n", orderID.Hex())
+	}
+	return err
+}
+
+// orderCredit is the entry debiting the credit order uses
+func orderCredit(order *model.Order) *model.CreditEntry {
+	return &model.CreditEntry{
+		ID:        "order:" + order.ID.Hex(),
+		UserID:    order.UserID,
+		Amount:    model.NewMoney(-order.Credit.Amount, order.Credit.Currency),
+		Reason:    "order",
+		CreatedAt: time.Now(),
+	}
+}
+
+// Balance returns the credit userID can spend in currency, less what open
+// checkouts hold
+func (s *ReferralService) Balance(ctx context.Context, userID, currency string) (model.Money, error) {
+	balances, err := s.repo.CreditBalances(ctx, userID)
+	if err != nil {
+		return model.Money{}, err
+	}
+	balance, ok := balances.In(currency)
+	if !ok || balance.Amount < 0 {
+		return model.NewMoney(0, currency), nil
+	}
+	return balance, nil
+}
+
+// Credits returns the credit balances of a user, one per currency
+func (s *ReferralService) Credits(ctx context.Context, userID string) ([]model.Money, error) {
+	balances, err := s.repo.CreditBalances(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	credits := []model.Money{}
+	for _, currency := range balances.Currencies() {
+		if balance := balances[currency]; balance.Amount != 0 {
+			credits = append(credits, balance)
+		}
+	}
+	return credits, nil
+}
+
+// Referrals returns the referrals made by a user, newest first
+func (s *ReferralService) Referrals(ctx context.Context, userID string) ([]model.Referral, error) {
+	return s.repo.ListReferrals(ctx, userID)
+}
+
+// inChain reports whether userID is start or one of the users who referred
+// start, directly or through others
+func (s *ReferralService) inChain(ctx context.Context, start, userID string) (bool, error) {
+	current := start
+	for range maxReferralChain {
+		if current == userID {
+			return true, nil
+		}
+		referral, err := s.repo.FindReferral(ctx, current)
+		if errors.Is(err, repo.ErrNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		current = referral.ReferrerID
+	}
+	return false, nil
+}
+
+func newReferralCode() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	for i := range b {
+		b[i] = referralCodeAlphabet[int(b[i])%len(referralCodeAlphabet)]
+	}
+	return string(b)
+}
@@ -0,0 +1,204 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service_test
+
+import (
+	"context"
+
+	"github.com/deicod/dysv/internal/mocks"
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/deicod/dysv/internal/service"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var _ = Describe("Referrals", func() {
+	var (
+		ctx         context.Context
+		referrals   *service.ReferralService
+		cartService *service.CartService
+		checkout    *service.CheckoutService
+		orderRepo   *repo.MockOrderRepo
+		code        string
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		referrals = service.NewReferralService(repo.NewMockReferralRepo(), nil)
+		cartService = service.NewCartService(repo.NewMockCartRepo(), catalogService, nil, referrals)
+		orderRepo = repo.NewMockOrderRepo()
+		checkout = service.NewCheckoutService(cartService, orderRepo, nil, nil, nil, nil, "", "")
+
+		referralCode, err := referrals.CodeFor(ctx, "alice", "Alice@Example.com", true)
+		Expect(err).NotTo(HaveOccurred())
+		code = referralCode.Code
+	})
+
+	// pay records a paid order of userID over total
+	pay := func(userID string, total, credit model.Money) {
+		order := &model.Order{StripeSessionID: "cs_" + userID + total.String(), UserID: userID, TotalAmount: total, Credit: credit}
+		Expect(orderRepo.Create(ctx, order)).To(Succeed())
+		Expect(checkout.HandleWebhook(ctx, order.StripeSessionID, "paid")).To(Succeed())
+		Expect(checkout.HandleWebhook(ctx, order.StripeSessionID, "paid")).To(Succeed()) // retried
+	}
+
+	balance := func(userID string) model.Money {
+		credit, err := referrals.Balance(ctx, userID, "EUR")
+		Expect(err).NotTo(HaveOccurred())
+		return credit
+	}
+
+	It("should canonicalize email addresses", func() {
+		Expect(service.CanonicalEmail(" Jane.Doe+shop@GMail.com ")).To(Equal("janedoe@gmail.com"))
+		Expect(service.CanonicalEmail("jane.doe@googlemail.com")).To(Equal("janedoe@gmail.com"))
+		Expect(service.CanonicalEmail("jane.doe+x@example.com")).To(Equal("jane.doe@example.com"))
+	})
+
+	It("should give each verified user one code", func() {
+		again, err := referrals.CodeFor(ctx, "alice", "alice@example.com", true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again.Code).To(Equal(code))
+		Expect(code).To(MatchRegexp(`^[A-Z2-9]{8}$`))
+
+		_, err = referrals.CodeFor(ctx, "bob", "bob@example.com", false)
+		Expect(err).To(MatchError(service.ErrEmailNotVerified))
+	})
+
+	It("should reward both users once the referee's first order is paid", func() {
+		Expect(referrals.Attribute(ctx, code, "bob", "bob@example.com")).To(Succeed())
+
+		pay("bob", eur(990), model.Money{})
+		Expect(balance("alice")).To(Equal(eur(1000)))
+		Expect(balance("bob")).To(Equal(eur(1000)))
+
+		pay("bob", eur(2490), model.Money{})
+		Expect(balance("alice")).To(Equal(eur(1000)))
+
+		list, err := referrals.Referrals(ctx, "alice")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(HaveLen(1))
+		Expect(list[0].Status).To(Equal(model.ReferralRewarded))
+	})
+
+	It("should not count orders paid entirely with credit", func() {
+		Expect(referrals.Attribute(ctx, code, "bob", "bob@example.com")).To(Succeed())
+
+		pay("bob", eur(0), model.Money{})
+		Expect(balance("alice").IsZero()).To(BeTrue())
+
+		list, err := referrals.Referrals(ctx, "alice")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list[0].Status).To(Equal(model.ReferralPending))
+	})
+
+	It("should reward a referee who started with a trial once an invoice is paid", func() {
+		Expect(referrals.Attribute(ctx, code, "bob", "bob@example.com")).To(Succeed())
+
+		order := &model.Order{StripeSessionID: "cs_trial", UserID: "bob", TotalAmount: eur(990), TrialDays: 14}
+		Expect(orderRepo.Create(ctx, order)).To(Succeed())
+		Expect(checkout.HandleWebhook(ctx, order.StripeSessionID, "paid")).To(Succeed())
+		Expect(checkout.InvoicePaid(ctx, order.ID.Hex(), eur(0))).To(Succeed()) // the trial invoice
+		Expect(balance("alice").IsZero()).To(BeTrue())
+
+		Expect(checkout.InvoicePaid(ctx, order.ID.Hex(), eur(990))).To(Succeed())
+		Expect(checkout.InvoicePaid(ctx, order.ID.Hex(), eur(990))).To(Succeed()) // next period
+		Expect(balance("alice")).To(Equal(eur(1000)))
+		Expect(balance("bob")).To(Equal(eur(1000)))
+
+		list, err := referrals.Referrals(ctx, "alice")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list[0].Status).To(Equal(model.ReferralRewarded))
+		Expect(list[0].OrderID).To(Equal(order.ID))
+	})
+
+	It("should hold credit for one open checkout at a time", func() {
+		Expect(referrals.Attribute(ctx, code, "bob", "bob@example.com")).To(Succeed())
+		pay("bob", eur(990), model.Money{})
+
+		stripeServer := mocks.NewStripeServer()
+		defer stripeServer.Close()
+		gateway := service.NewStripeGateway(service.NewStripeClient("sk_test_123", stripeServer.URL))
+		addresses := service.NewAddressService(mocks.NewMockAddressRepo(), nil)
+		stripeCheckout := service.NewCheckoutService(cartService, orderRepo, addresses, nil, nil, gateway, "https://dysv.test/success", "https://dysv.test/cart")
+		aliceCtx := service.WithUserID(ctx, "alice")
+		address := &model.Address{UserID: "alice", Label: "Home", Line1: "Hauptstr. 1", City: "Berlin", PostalCode: "10115", Country: "DE"}
+		Expect(addresses.CreateAddress(aliceCtx, address)).To(Succeed())
+
+		open := func(key string) *model.Order {
+			_, err := stripeCheckout.CreateCheckoutSession(aliceCtx, "sess", "alice", "alice@example.com", address.ID, key)
+			Expect(err).NotTo(HaveOccurred())
+			order, err := orderRepo.FindByIdempotencyKey(aliceCtx, "alice", key)
+			Expect(err).NotTo(HaveOccurred())
+			return order
+		}
+
+		addPlan(aliceCtx, cartService, "node-pro")
+		first := open("key-1")
+		Expect(first.Credit).To(Equal(eur(1000)))
+		Expect(balance("alice").IsZero()).To(BeTrue())
+
+		// A changed cart gets a second session, without the credit again
+		addPlan(aliceCtx, cartService, "node-starter")
+		second := open("key-2")
+		Expect(second.StripeSessionID).NotTo(Equal(first.StripeSessionID))
+		Expect(second.Credit.IsZero()).To(BeTrue())
+
+		// More than is left cannot be held
+		Expect(referrals.Hold(ctx, &model.Order{ID: bson.NewObjectID(), UserID: "alice", Credit: eur(1)})).To(MatchError(service.ErrCreditChanged))
+
+		// The expired session gives its credit back
+		Expect(stripeCheckout.HandleWebhook(ctx, first.StripeSessionID, "expired")).To(Succeed())
+		Expect(stripeCheckout.HandleWebhook(ctx, second.StripeSessionID, "paid")).To(Succeed())
+		Expect(stripeCheckout.HandleWebhook(ctx, second.StripeSessionID, "paid")).To(Succeed()) // retried
+		Expect(balance("alice")).To(Equal(eur(1000)))
+
+		third := open("key-3")
+		Expect(third.Credit).To(Equal(eur(1000)))
+		Expect(stripeCheckout.HandleWebhook(ctx, third.StripeSessionID, "paid")).To(Succeed())
+		Expect(stripeCheckout.HandleWebhook(ctx, third.StripeSessionID, "paid")).To(Succeed()) // retried
+		Expect(balance("alice").IsZero()).To(BeTrue())
+	})
+
+	It("should block self-referrals and loops", func() {
+		Expect(referrals.Attribute(ctx, code, "alice", "other@example.com")).To(MatchError(service.ErrReferralNotAllowed))
+		Expect(referrals.Attribute(ctx, code, "alice2", "alice+2@example.com")).To(MatchError(service.ErrReferralNotAllowed))
+		Expect(referrals.Attribute(ctx, "nope", "bob", "bob@example.com")).To(MatchError(service.ErrInvalidReferralCode))
+
+		// alice refers bob, bob refers carol; carol's code must not refer alice
+		Expect(referrals.Attribute(ctx, code, "bob", "bob@example.com")).To(Succeed())
+		Expect(referrals.Attribute(ctx, code, "bob", "bob@example.com")).To(MatchError(service.ErrReferralNotAllowed))
+		bobCode, err := referrals.CodeFor(ctx, "bob", "bob@example.com", true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(referrals.Attribute(ctx, bobCode.Code, "carol", "carol@example.com")).To(Succeed())
+		carolCode, err := referrals.CodeFor(ctx, "carol", "carol@example.com", true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(referrals.Attribute(ctx, carolCode.Code, "alice", "alice@example.com")).To(MatchError(service.ErrReferralNotAllowed))
+	})
+
+	It("should take credit off the next invoice and book it once paid", func() {
+		Expect(referrals.Attribute(ctx, code, "bob", "bob@example.com")).To(Succeed())
+		pay("bob", eur(990), model.Money{})
+
+		aliceCtx := service.WithUserID(ctx, "alice")
+		cart, err := cartService.AddPlan(aliceCtx, "alice-session", "node-starter", 1)
+		Expect(err).NotTo(HaveOccurred())
+
+		quote, err := cartService.Quote(aliceCtx, cart, model.TaxDecision{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quote.Credit).To(Equal(eur(990)))
+		Expect(quote.Net.IsZero()).To(BeTrue())
+
+		pay("alice", quote.Gross, quote.Credit)
+		Expect(balance("alice")).To(Equal(eur(10)))
+
+		quote, err = cartService.Quote(aliceCtx, cart, model.TaxDecision{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quote.Credit).To(Equal(eur(10)))
+		Expect(quote.Net).To(Equal(eur(980)))
+	})
+})
@@ -0,0 +1,22 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service
+
+import (
+	"github.com/stripe/stripe-go/v82"
+)
+
+// NewStripeClient creates a Stripe API client. apiURL overrides the API base
+// URL, e.g. for a local stand-in; empty means api.stripe.com.
+func NewStripeClient(key, apiURL string) *stripe.Client {
+	if apiURL == "" {
+		return stripe.NewClient(key)
+	}
+	retries := int64(0)
+	return stripe.NewClient(key, stripe.WithBackends(stripe.NewBackendsWithConfig(&stripe.BackendConfig{
+		URL:               stripe.String(apiURL),
+		MaxNetworkRetries: &retries,
+		LeveledLogger:     &stripe.LeveledLogger{Level: stripe.LevelError},
+	})))
+}
@@ -0,0 +1,270 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"github.com/stripe/stripe-go/v82"
+)
+
+// Ensure StripeGateway implements PaymentGateway
+var _ PaymentGateway = (*StripeGateway)(nil)
+
+// StripeGateway is the Stripe implementation of PaymentGateway
+type StripeGateway struct {
+	client *stripe.Client
+
+	mu       sync.Mutex
+	taxRates map[model.TaxDecision]string // Stripe tax rate IDs
+}
+
+// NewStripeGateway creates a Stripe gateway, usually with a client from
+// NewStripeClient
+func NewStripeGateway(client *stripe.Client) *StripeGateway {
+	return &StripeGateway{
+		client:   client,
+		taxRates: make(map[model.TaxDecision]string),
+	}
+}
+
+// CreateCheckoutSession implements PaymentGateway
+func (g *StripeGateway) CreateCheckoutSession(ctx context.Context, params *CheckoutSessionParams) (*CheckoutSession, error) {
+	var taxRates []*string
+	if params.TaxRateID != "" {
+		taxRates = []*string{stripe.String(params.TaxRateID)}
+	}
+
+	lineItems := make([]*stripe.CheckoutSessionCreateLineItemParams, 0, len(params.Lines))
+	for _, line := range params.Lines {
+		if line.PriceID != "" {
+			lineItems = append(lineItems, &stripe.CheckoutSessionCreateLineItemParams{
+				Price:    stripe.String(line.PriceID),
+				Quantity: stripe.Int64(line.Quantity),
+				TaxRates: taxRates,
+			})
+			continue
+		}
+		lineItems = append(lineItems, &stripe.CheckoutSessionCreateLineItemParams{
+			PriceData: &stripe.CheckoutSessionCreateLineItemPriceDataParams{
+				Currency: stripe.String(strings.ToLower(params.Currency)),
+				ProductData: &stripe.CheckoutSessionCreateLineItemPriceDataProductDataParams{
+					Name:        stripe.String(line.Name),
+					Description: stripe.String(line.Description),
+				},
+				UnitAmount: stripe.Int64(line.UnitAmount),
+				Recurring: &stripe.CheckoutSessionCreateLineItemPriceDataRecurringParams{
+					Interval:      stripe.String(line.Interval),
+					IntervalCount: stripe.Int64(line.IntervalCount),
+				},
+			},
+			Quantity: stripe.Int64(line.Quantity),
+			TaxRates: taxRates,
+		})
+	}
+
+	create := &stripe.CheckoutSessionCreateParams{
+		Mode:       stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		SuccessURL: stripe.String(params.SuccessURL),
+		CancelURL:  stripe.String(params.CancelURL),
+		LineItems:  lineItems,
+		Metadata:   params.Metadata,
+		// Provisioning reads the sites from the subscription
+		SubscriptionData: &stripe.CheckoutSessionCreateSubscriptionDataParams{
+			Metadata: params.SubscriptionMetadata,
+		},
+	}
+	if params.CustomerID != "" {
+		create.Customer = stripe.String(params.CustomerID)
+	} else if params.CustomerEmail != "" {
+		create.CustomerEmail = stripe.String(params.CustomerEmail)
+	}
+	if params.TrialDays > 0 {
+		create.SubscriptionData.TrialPeriodDays = stripe.Int64(int64(params.TrialDays))
+	}
+	if params.DiscountID != "" {
+		create.Discounts = []*stripe.CheckoutSessionCreateDiscountParams{{Coupon: stripe.String(params.DiscountID)}}
+	}
+	if params.IdempotencyKey != "" {
+		create.SetIdempotencyKey(params.IdempotencyKey)
+	}
+
+	session, err := g.client.V1CheckoutSessions.Create(ctx, create)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckoutSession{ID: session.ID, URL: session.URL, ExpiresAt: time.Unix(session.ExpiresAt, 0)}, nil
+}
+
+// CreateDiscount implements PaymentGateway with a Stripe coupon that can be
+// redeemed once
+func (g *StripeGateway) CreateDiscount(ctx context.Context, params *DiscountParams) (string, error) {
+	duration := stripe.CouponDurationOnce
+	if params.Recurring {
+		duration = stripe.CouponDurationForever
+	}
+	create := &stripe.CouponCreateParams{
+		Name:           stripe.String(params.Name),
+		Duration:       stripe.String(string(duration)),
+		MaxRedemptions: stripe.Int64(1),
+		Metadata:       params.Metadata,
+	}
+	if params.PercentOffBPS > 0 {
+		create.PercentOff = stripe.Float64(float64(params.PercentOffBPS) / 100)
+		if len(params.ProductIDs) > 0 {
+			create.AppliesTo = &stripe.CouponCreateAppliesToParams{Products: stripe.StringSlice(params.ProductIDs)}
+		}
+	} else {
+		create.AmountOff = stripe.Int64(params.AmountOff)
+		create.Currency = stripe.String(strings.ToLower(params.Currency))
+	}
+	if params.IdempotencyKey != "" {
+		create.SetIdempotencyKey(params.IdempotencyKey)
+	}
+	coupon, err := g.client.V1Coupons.Create(ctx, create)
+	if err != nil {
+		return "", err
+	}
+	return coupon.ID, nil
+}
+
+// TaxRate implements PaymentGateway. Stripe tax rates cannot change once
+// created, so one is created per country and rate and found again by its
+// metadata after a restart.
+func (g *StripeGateway) TaxRate(ctx context.Context, tax model.TaxDecision) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if id, ok := g.taxRates[tax]; ok {
+		return id, nil
+	}
+
+	key := fmt.Sprintf("%s:%s:%d", tax.Country, tax.Treatment, tax.RateBPS)
+	for rate, err := range g.client.V1TaxRates.List(ctx, &stripe.TaxRateListParams{Active: stripe.Bool(true)}) {
+		if err != nil {
+			return "", fmt.Errorf("failed to list stripe tax rates: %w", err)
+		}
+		if rate.Metadata["dysv_tax"] == key {
+			g.taxRates[tax] = rate.ID
+			return rate.ID, nil
+		}
+	}
+
+	created, err := g.client.V1TaxRates.Create(ctx, &stripe.TaxRateCreateParams{
+		DisplayName: stripe.String("VAT"),
+		Description: stripe.String(fmt.Sprintf("VAT %s (%s)", tax.Country, tax.Treatment)),
+		Country:     stripe.String(tax.Country),
+		Percentage:  stripe.Float64(float64(tax.RateBPS) / 100),
+		Inclusive:   stripe.Bool(false),
+		TaxType:     stripe.String(string(stripe.TaxRateTaxTypeVAT)),
+		Metadata:    map[string]string{"dysv_tax": key},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create stripe tax rate: %w", err)
+	}
+	g.taxRates[tax] = created.ID
+	return created.ID, nil
+}
+
+// CreateCustomer implements PaymentGateway
+func (g *StripeGateway) CreateCustomer(ctx context.Context, params *CustomerParams) (string, error) {
+	create := &stripe.CustomerCreateParams{Metadata: params.Metadata}
+	if params.Email != "" {
+		create.Email = stripe.String(params.Email)
+	}
+	if params.Address != nil {
+		create.Name, create.Phone, create.Address = stripeCustomerAddress(params.Address)
+	}
+	if params.IdempotencyKey != "" {
+		create.SetIdempotencyKey(params.IdempotencyKey)
+	}
+	customer, err := g.client.V1Customers.Create(ctx, create)
+	if err != nil {
+		return "", err
+	}
+	return customer.ID, nil
+}
+
+// UpdateCustomer implements PaymentGateway
+func (g *StripeGateway) UpdateCustomer(ctx context.Context, id string, params *CustomerParams) error {
+	update := &stripe.CustomerUpdateParams{}
+	if params.Email != "" {
+		update.Email = stripe.String(params.Email)
+	}
+	if params.Address != nil {
+		update.Name, update.Phone, update.Address = stripeCustomerAddress(params.Address)
+	}
+	_, err := g.client.V1Customers.Update(ctx, id, update)
+	return err
+}
+
+// stripeCustomerAddress sets every synced field, so fields removed from the
+// address are cleared on Stripe as well
+func stripeCustomerAddress(addr *model.Address) (name, phone *string, address *stripe.AddressParams) {
+	return stripe.String(addr.Company), stripe.String(addr.Phone), &stripe.AddressParams{
+		Line1:      stripe.String(addr.Line1),
+		Line2:      stripe.String(addr.Line2),
+		City:       stripe.String(addr.City),
+		PostalCode: stripe.String(addr.PostalCode),
+		State:      stripe.String(addr.State),
+		Country:    stripe.String(addr.Country),
+	}
+}
+
+// GetSubscription implements PaymentGateway
+func (g *StripeGateway) GetSubscription(ctx context.Context, id string) (*GatewaySubscription, error) {
+	sub, err := g.client.V1Subscriptions.Retrieve(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := &GatewaySubscription{
+		ID:                sub.ID,
+		Status:            string(sub.Status),
+		CancelAtPeriodEnd: sub.CancelAtPeriodEnd,
+		Metadata:          sub.Metadata,
+	}
+	if sub.Customer != nil {
+		result.CustomerID = sub.Customer.ID
+	}
+	if sub.TrialEnd > 0 {
+		trialEnd := time.Unix(sub.TrialEnd, 0)
+		result.TrialEnd = &trialEnd
+	}
+	return result, nil
+}
+
+// CancelSubscription implements PaymentGateway
+func (g *StripeGateway) CancelSubscription(ctx context.Context, id string, atPeriodEnd bool) error {
+	if atPeriodEnd {
+		_, err := g.client.V1Subscriptions.Update(ctx, id, &stripe.SubscriptionUpdateParams{
+			CancelAtPeriodEnd: stripe.Bool(true),
+		})
+		return err
+	}
+	_, err := g.client.V1Subscriptions.Cancel(ctx, id, nil)
+	return err
+}
+
+// Refund implements PaymentGateway
+func (g *StripeGateway) Refund(ctx context.Context, params *RefundParams) (string, error) {
+	create := &stripe.RefundCreateParams{PaymentIntent: stripe.String(params.PaymentID)}
+	if params.Amount > 0 {
+		create.Amount = stripe.Int64(params.Amount)
+	}
+	if params.Reason != "" {
+		create.Reason = stripe.String(params.Reason)
+	}
+	if params.IdempotencyKey != "" {
+		create.SetIdempotencyKey(params.IdempotencyKey)
+	}
+	refund, err := g.client.V1Refunds.Create(ctx, create)
+	if err != nil {
+		return "", err
+	}
+	return refund.ID, nil
+}
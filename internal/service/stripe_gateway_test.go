@@ -0,0 +1,70 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/deicod/dysv/internal/mocks"
+	"github.com/deicod/dysv/internal/service"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StripeGateway", func() {
+	var (
+		ctx          context.Context
+		stripeServer *mocks.StripeServer
+		gateway      *service.StripeGateway
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		stripeServer = mocks.NewStripeServer()
+		gateway = service.NewStripeGateway(service.NewStripeClient("sk_test_123", stripeServer.URL))
+
+		trialEnd := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+		stripeServer.Objects["sub_1"] = mocks.StripeObject{
+			"id": "sub_1", "object": "subscription", "customer": "cus_1", "status": "trialing",
+			"trial_end": trialEnd.Unix(), "metadata": map[string]interface{}{"order_id": "abc"},
+		}
+	})
+
+	AfterEach(func() {
+		stripeServer.Close()
+	})
+
+	It("should read subscriptions", func() {
+		sub, err := gateway.GetSubscription(ctx, "sub_1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sub.CustomerID).To(Equal("cus_1"))
+		Expect(sub.Status).To(Equal("trialing"))
+		Expect(sub.TrialEnd.UTC()).To(Equal(time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)))
+		Expect(sub.Metadata).To(HaveKeyWithValue("order_id", "abc"))
+	})
+
+	It("should cancel subscriptions now or at the end of the period", func() {
+		Expect(gateway.CancelSubscription(ctx, "sub_1", true)).To(Succeed())
+		Expect(stripeServer.Object("sub_1")["cancel_at_period_end"]).To(BeTrue())
+		Expect(stripeServer.Object("sub_1")["status"]).To(Equal("trialing"))
+
+		Expect(gateway.CancelSubscription(ctx, "sub_1", false)).To(Succeed())
+		Expect(stripeServer.Object("sub_1")["status"]).To(Equal("canceled"))
+	})
+
+	It("should refund payments once per idempotency key", func() {
+		params := &service.RefundParams{PaymentID: "pi_1", Amount: 1500, Reason: "requested_by_customer", IdempotencyKey: "refund:order_1"}
+		id, err := gateway.Refund(ctx, params)
+		Expect(err).NotTo(HaveOccurred())
+		again, err := gateway.Refund(ctx, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(Equal(id))
+
+		refund := stripeServer.Object(id)
+		Expect(refund["payment_intent"]).To(Equal("pi_1"))
+		Expect(refund["amount"]).To(Equal(int64(1500)))
+		Expect(stripeServer.Count("refund")).To(Equal(1))
+	})
+})
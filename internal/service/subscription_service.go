@@ -0,0 +1,114 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/stripe/stripe-go/v82"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// SubscriptionService keeps the subscription records of checkout orders in
+// sync with Stripe and reminds customers before their trial ends
+type SubscriptionService struct {
+	subs    repo.SubscriptionRepository
+	orders  repo.OrderRepository
+	mailer  Mailer
+	baseURL string
+}
+
+// NewSubscriptionService creates a new subscription service.
+// mailer is optional; without it no trial reminders are sent.
+func NewSubscriptionService(subs repo.SubscriptionRepository, orders repo.OrderRepository, mailer Mailer, baseURL string) *SubscriptionService {
+	return &SubscriptionService{
+		subs:    subs,
+		orders:  orders,
+		mailer:  mailer,
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// Sync stores the state of a Stripe subscription. Subscriptions not created
+// by our checkout carry no order_id and are skipped with a nil record.
+func (s *SubscriptionService) Sync(ctx context.Context, sub *stripe.Subscription) (*model.Subscription, error) {
+	orderID, err := bson.ObjectIDFromHex(sub.Metadata["order_id"])
+	if err != nil {
+		fmt.Printf("SubscriptionService: subscription %s has no order, skipping\n", sub.ID)
+		return nil, nil
+	}
+	order, err := s.orders.FindByID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("order of subscription %s: %w", sub.ID, err)
+	}
+
+	now := time.Now()
+	record := &model.Subscription{
+		ID:         sub.ID,
+		OrderID:    order.ID,
+		UserID:     order.UserID,
+		Email:      order.CustomerEmail,
+		Status:     string(sub.Status),
+		TrialStart: unixTime(sub.TrialStart),
+		TrialEnd:   unixTime(sub.TrialEnd),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := s.subs.Upsert(ctx, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// TrialWillEnd syncs sub and emails its customer that the trial is about to
+// end. Stripe sends the event three days ahead; retries send one email.
+func (s *SubscriptionService) TrialWillEnd(ctx context.Context, sub *stripe.Subscription) error {
+	record, err := s.Sync(ctx, sub)
+	if err != nil || record == nil || record.TrialEnd == nil {
+		return err
+	}
+	if s.mailer == nil || record.Email == "" {
+		fmt.Printf("SubscriptionService: no trial reminder for %s (mailer or email missing)\n", record.ID)
+		return nil
+	}
+
+	// Claim the reminder before sending, so concurrent deliveries of the
+	// event send one email. Stored times have millisecond precision.
+	claimedAt := time.Now().Truncate(time.Millisecond)
+	claimed, err := s.subs.MarkTrialReminded(ctx, record.ID, claimedAt)
+	if err != nil || !claimed {
+		return err
+	}
+	if err := s.mailer.Send(ctx, record.Email, "Your dysv trial ends soon", s.trialBody(record)); err != nil {
+		// Give the claim back, so Stripe's retry of the event sends it
+		if err := s.subs.UnmarkTrialReminded(ctx, record.ID, claimedAt); err != nil {
+			fmt.Printf("SubscriptionService: UnmarkTrialReminded Error: %v\n", err)
+		}
+		return fmt.Errorf("send trial reminder for %s: %w", record.ID, err)
+	}
+	return nil
+}
+
+// trialBody renders the plain-text trial reminder
+func (s *SubscriptionService) trialBody(sub *model.Subscription) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Hello,\n\nyour free trial ends on %s.\n", sub.TrialEnd.UTC().Format("2 January 2006"))
+	b.WriteString("Your subscription then continues and the first invoice is charged to the payment method you entered at checkout.\n")
+	fmt.Fprintf(&b, "\nTo make changes before then, visit:\n%s/account\n", s.baseURL)
+	return b.String()
+}
+
+// unixTime converts a Stripe timestamp, 0 for unset, to a time
+func unixTime(sec int64) *time.Time {
+	if sec == 0 {
+		return nil
+	}
+	t := time.Unix(sec, 0)
+	return &t
+}
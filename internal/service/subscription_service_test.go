@@ -0,0 +1,216 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/deicod/dysv/internal/mocks"
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/deicod/dysv/internal/service"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stripe/stripe-go/v82"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var _ = Describe("Trials", func() {
+	var (
+		ctx          context.Context
+		stripeServer *mocks.StripeServer
+		cartService  *service.CartService
+		checkout     *service.CheckoutService
+		orderRepo    *repo.MockOrderRepo
+		addressID    string
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		stripeServer = mocks.NewStripeServer()
+		gateway := service.NewStripeGateway(service.NewStripeClient("sk_test_123", stripeServer.URL))
+
+		catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		cartService = service.NewCartService(repo.NewMockCartRepo(), catalogService, nil, nil)
+		addressService := service.NewAddressService(mocks.NewMockAddressRepo(), nil)
+		orderRepo = repo.NewMockOrderRepo()
+		checkout = service.NewCheckoutService(cartService, orderRepo, addressService, nil, nil, gateway, "https://dysv.test/success", "https://dysv.test/cart")
+
+		address := &model.Address{UserID: "user_1", Label: "Home", Line1: "Hauptstr. 1", City: "Berlin", PostalCode: "10115", Country: "DE"}
+		Expect(addressService.CreateAddress(ctx, address)).To(Succeed())
+		addressID = address.ID
+	})
+
+	AfterEach(func() {
+		stripeServer.Close()
+	})
+
+	// checkoutPlan adds planIDs to the user's cart, checks it out and returns
+	// the order and the Stripe session parameters
+	checkoutPlan := func(planIDs ...string) (*model.Order, mocks.StripeObject) {
+		userCtx := service.WithUserID(ctx, "user_1")
+		for _, planID := range planIDs {
+			_, err := cartService.AddPlan(userCtx, "sess", planID, 1)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = cartService.ConfigureSite(userCtx, "sess", planID, 0, model.SiteConfig{Name: planID, Framework: "nuxt", Region: "nbg"})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		_, err := checkout.CreateCheckoutSession(userCtx, "sess", "user_1", "user@example.com", addressID, "")
+		Expect(err).NotTo(HaveOccurred())
+
+		session := stripeServer.Object(fmt.Sprintf("cs_%d", len(stripeServer.Requests)))
+		Expect(session).NotTo(BeNil())
+		metadata := session["subscription_data"].(map[string]interface{})["metadata"].(map[string]interface{})
+		orderID, err := bson.ObjectIDFromHex(metadata["order_id"].(string))
+		Expect(err).NotTo(HaveOccurred())
+		order, err := orderRepo.FindByID(ctx, orderID)
+		Expect(err).NotTo(HaveOccurred())
+		return order, session
+	}
+
+	trialDays := func(session mocks.StripeObject) interface{} {
+		return session["subscription_data"].(map[string]interface{})["trial_period_days"]
+	}
+
+	It("should start a trial for first-time subscribers only", func() {
+		order, session := checkoutPlan("node-starter")
+		Expect(trialDays(session)).To(Equal(int64(14)))
+		Expect(session["customer_email"]).To(Equal("user@example.com"))
+		Expect(order.TrialDays).To(Equal(14))
+		Expect(order.TrialStart).To(BeNil())
+
+		// An abandoned checkout does not use up the trial
+		order, _ = checkoutPlan()
+		Expect(order.TrialDays).To(Equal(14))
+
+		Expect(checkout.HandleWebhook(ctx, order.StripeSessionID, "paid")).To(Succeed())
+		paid, err := orderRepo.FindByID(ctx, order.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paid.TrialStart).NotTo(BeNil())
+		Expect(paid.TrialEnd.Sub(*paid.TrialStart)).To(Equal(14 * 24 * time.Hour))
+
+		order, session = checkoutPlan()
+		Expect(trialDays(session)).To(BeNil())
+		Expect(order.TrialDays).To(BeZero())
+	})
+
+	It("should offer the trial in one open checkout at a time", func() {
+		first, session := checkoutPlan("node-starter")
+		Expect(trialDays(session)).To(Equal(int64(14)))
+
+		// Another checkout for the same cart gets the open session back
+		userCtx := service.WithUserID(ctx, "user_1")
+		url, err := checkout.CreateCheckoutSession(userCtx, "sess", "user_1", "user@example.com", addressID, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(url).To(Equal(first.CheckoutURL))
+
+		// A different checkout while the first is open gets no trial
+		_, err = checkout.CreateCheckoutSession(userCtx, "sess", "user_1", "other@example.com", addressID, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stripeServer.Count("checkout.session")).To(Equal(2))
+		second := stripeServer.Object("cs_2")
+		Expect(trialDays(second)).To(BeNil())
+
+		// Once the first session expired, the trial is available again
+		Expect(orderRepo.AttachCheckout(ctx, first.ID, first.StripeSessionID, first.CheckoutURL, time.Now().Add(-time.Minute))).To(Succeed())
+		_, err = checkout.CreateCheckoutSession(userCtx, "sess", "user_1", "third@example.com", addressID, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trialDays(stripeServer.Object("cs_3"))).To(Equal(int64(14)))
+	})
+
+	It("should not give a trial when a plan in the cart has none", func() {
+		order, session := checkoutPlan("node-starter", "node-pro")
+		Expect(trialDays(session)).To(BeNil())
+		Expect(order.TrialDays).To(BeZero())
+	})
+
+	It("should reject trials Stripe does not accept", func() {
+		catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+		Expect(catalogService.Seed(ctx)).To(Succeed())
+		plan, err := catalogService.GetPlan(ctx, "node-pro")
+		Expect(err).NotTo(HaveOccurred())
+
+		plan.TrialDays = service.MaxTrialDays + 1
+		Expect(catalogService.SavePlan(ctx, plan)).To(MatchError(service.ErrInvalidCatalogEntry))
+		plan.TrialDays = 30
+		Expect(catalogService.SavePlan(ctx, plan)).To(Succeed())
+	})
+
+	Describe("SubscriptionService", func() {
+		var (
+			subscriptions *service.SubscriptionService
+			subRepo       *repo.MockSubscriptionRepo
+			mailer        *mocks.MockMailer
+		)
+
+		BeforeEach(func() {
+			subRepo = repo.NewMockSubscriptionRepo()
+			mailer = &mocks.MockMailer{}
+			subscriptions = service.NewSubscriptionService(subRepo, orderRepo, mailer, "https://dysv.test/")
+		})
+
+		It("should record the trial dates and remind once before the trial ends", func() {
+			order, _ := checkoutPlan("node-starter")
+			start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+			end := start.AddDate(0, 0, 14)
+			sub := &stripe.Subscription{
+				ID:         "sub_1",
+				Status:     stripe.SubscriptionStatusTrialing,
+				TrialStart: start.Unix(),
+				TrialEnd:   end.Unix(),
+				Metadata:   map[string]string{"order_id": order.ID.Hex()},
+			}
+
+			record, err := subscriptions.Sync(ctx, sub)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(record.UserID).To(Equal("user_1"))
+			Expect(record.TrialEnd.Equal(end)).To(BeTrue())
+
+			Expect(subscriptions.TrialWillEnd(ctx, sub)).To(Succeed())
+			Expect(subscriptions.TrialWillEnd(ctx, sub)).To(Succeed()) // retried
+			Expect(mailer.Sent).To(HaveLen(1))
+			Expect(mailer.Sent[0].To).To(Equal("user@example.com"))
+			Expect(mailer.Sent[0].Body).To(ContainSubstring("15 March 2026"))
+			Expect(mailer.Sent[0].Body).To(ContainSubstring("https://dysv.test/account"))
+
+			stored, err := subRepo.FindByID(ctx, "sub_1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.Status).To(Equal("trialing"))
+			Expect(stored.TrialReminderSentAt).NotTo(BeNil())
+		})
+
+		It("should send the reminder again when sending failed", func() {
+			order, _ := checkoutPlan("node-starter")
+			end := time.Now().Add(72 * time.Hour)
+			sub := &stripe.Subscription{
+				ID:         "sub_1",
+				Status:     stripe.SubscriptionStatusTrialing,
+				TrialStart: time.Now().Unix(),
+				TrialEnd:   end.Unix(),
+				Metadata:   map[string]string{"order_id": order.ID.Hex()},
+			}
+
+			mailer.SendErr = errors.New("relay down")
+			Expect(subscriptions.TrialWillEnd(ctx, sub)).To(MatchError(ContainSubstring("relay down")))
+			stored, err := subRepo.FindByID(ctx, "sub_1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.TrialReminderSentAt).To(BeNil())
+
+			mailer.SendErr = nil
+			Expect(subscriptions.TrialWillEnd(ctx, sub)).To(Succeed()) // retried by Stripe
+			Expect(subscriptions.TrialWillEnd(ctx, sub)).To(Succeed())
+			Expect(mailer.Sent).To(HaveLen(1))
+		})
+
+		It("should skip subscriptions without an order", func() {
+			record, err := subscriptions.Sync(ctx, &stripe.Subscription{ID: "sub_2", Status: stripe.SubscriptionStatusActive})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(record).To(BeNil())
+		})
+	})
+})
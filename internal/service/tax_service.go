@@ -0,0 +1,138 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/deicod/dysv/internal/model"
+)
+
+// HomeCountry is where dysv is established. Its VAT applies to every
+// domestic sale and to visitors whose country is not known yet.
+const HomeCountry = "DE"
+
+// DefaultVATRates are the standard VAT rates of the EU member states in
+// basis points, by ISO 3166-1 alpha-2 country code
+var DefaultVATRates = map[string]int64{
+	"AT": 2000, "BE": 2100, "BG": 2000, "CY": 1900, "CZ": 2100,
+	"DE": 1900, "DK": 2500, "EE": 2400, "ES": 2100, "FI": 2550,
+	"FR": 2000, "GR": 2400, "HR": 2500, "HU": 2700, "IE": 2300,
+	"IT": 2200, "LT": 2100, "LU": 1700, "LV": 2100, "MT": 1800,
+	"NL": 2100, "PL": 2300, "PT": 2300, "RO": 2100, "SE": 2500,
+	"SI": 2200, "SK": 2300,
+}
+
+// vatIDPatterns are the formats of EU VAT IDs after the country prefix
+var vatIDPatterns = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^U\d{8}$`),
+	"BE": regexp.MustCompile(`^[01]\d{9}$`),
+	"BG": regexp.MustCompile(`^\d{9,10}$`),
+	"CY": regexp.MustCompile(`^\d{8}[A-Z]$`),
+	"CZ": regexp.MustCompile(`^\d{8,10}$`),
+	"DE": regexp.MustCompile(`^\d{9}$`),
+	"DK": regexp.MustCompile(`^\d{8}$`),
+	"EE": regexp.MustCompile(`^\d{9}$`),
+	"ES": regexp.MustCompile(`^[A-Z0-9]\d{7}[A-Z0-9]$`),
+	"FI": regexp.MustCompile(`^\d{8}$`),
+	"FR": regexp.MustCompile(`^[A-HJ-NP-Z0-9]{2}\d{9}$`),
+	"GR": regexp.MustCompile(`^\d{9}$`),
+	"HR": regexp.MustCompile(`^\d{11}$`),
+	"HU": regexp.MustCompile(`^\d{8}$`),
+	"IE": regexp.MustCompile(`^(\d{7}[A-W][A-I]?|\d[A-Z+*]\d{5}[A-W])$`),
+	"IT": regexp.MustCompile(`^\d{11}$`),
+	"LT": regexp.MustCompile(`^(\d{9}|\d{12})$`),
+	"LU": regexp.MustCompile(`^\d{8}$`),
+	"LV": regexp.MustCompile(`^\d{11}$`),
+	"MT": regexp.MustCompile(`^\d{8}$`),
+	"NL": regexp.MustCompile(`^\d{9}B\d{2}$`),
+	"PL": regexp.MustCompile(`^\d{10}$`),
+	"PT": regexp.MustCompile(`^\d{9}$`),
+	"RO": regexp.MustCompile(`^\d{2,10}$`),
+	"SE": regexp.MustCompile(`^\d{12}$`),
+	"SI": regexp.MustCompile(`^\d{8}$`),
+	"SK": regexp.MustCompile(`^\d{10}$`),
+}
+
+// countryPattern is the shape of an ISO 3166-1 alpha-2 code
+var countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// VATIDPrefix returns the prefix VAT IDs of country start with. Greece uses
+// EL instead of its ISO code.
+func VATIDPrefix(country string) string {
+	if country == "GR" {
+		return "EL"
+	}
+	return country
+}
+
+// NormalizeVATID returns id in upper case without spaces, dots and dashes
+func NormalizeVATID(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '.', '-':
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(id)))
+}
+
+// ValidVATIDFormat reports whether the normalized id is shaped like a VAT ID
+// of the EU member state country. It does not tell whether the ID exists.
+func ValidVATIDFormat(country, id string) bool {
+	pattern, ok := vatIDPatterns[country]
+	if !ok {
+		return false
+	}
+	rest, ok := strings.CutPrefix(id, VATIDPrefix(country))
+	return ok && pattern.MatchString(rest)
+}
+
+// TaxService decides the VAT of a sale from the billing address. Private
+// customers in other EU states pay their country's rate, declared under the
+// One-Stop-Shop; EU businesses with a verified VAT ID (see AddressService)
+// are invoiced net under reverse charge; domestic sales always carry German
+// VAT.
+type TaxService struct {
+	rates map[string]int64
+}
+
+// NewTaxService creates a new tax service with the VAT rates of the EU
+// member states in basis points, usually DefaultVATRates
+func NewTaxService(rates map[string]int64) *TaxService {
+	return &TaxService{rates: rates}
+}
+
+// InEU reports whether country is an EU member state
+func (s *TaxService) InEU(country string) bool {
+	_, ok := s.rates[strings.ToUpper(country)]
+	return ok
+}
+
+// Decide returns the VAT for orders billed to addr
+func (s *TaxService) Decide(addr *model.Address) (model.TaxDecision, error) {
+	country := strings.ToUpper(strings.TrimSpace(addr.Country))
+	if !countryPattern.MatchString(country) {
+		return model.TaxDecision{}, fmt.Errorf("%w: %q", ErrInvalidCountry, addr.Country)
+	}
+
+	rate, inEU := s.rates[country]
+	switch {
+	case !inEU:
+		return model.TaxDecision{Country: country, Treatment: model.TaxOutsideEU}, nil
+	case country == HomeCountry:
+		return model.TaxDecision{Country: country, Treatment: model.TaxDomestic, RateBPS: rate}, nil
+	case addr.CustomerType == model.CustomerBusiness && addr.VATIDVerified():
+		return model.TaxDecision{Country: country, Treatment: model.TaxReverseCharge}, nil
+	}
+	return model.TaxDecision{Country: country, Treatment: model.TaxOSS, RateBPS: rate}, nil
+}
+
+// ForCountry returns the VAT for a private customer in country, used to
+// quote visitors who have no billing address yet
+func (s *TaxService) ForCountry(country string) (model.TaxDecision, error) {
+	return s.Decide(&model.Address{Country: country})
+}
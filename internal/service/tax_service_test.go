@@ -0,0 +1,148 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service_test
+
+import (
+	"context"
+
+	"github.com/deicod/dysv/internal/mocks"
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/repo"
+	"github.com/deicod/dysv/internal/service"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// verified marks the VAT ID of addr as checked and valid
+func verified(addr model.Address) model.Address {
+	addr.VATCheck = &model.VATCheck{VATID: addr.VATID, Status: model.VATValid}
+	return addr
+}
+
+var _ = Describe("TaxService", func() {
+	var taxes *service.TaxService
+
+	BeforeEach(func() {
+		taxes = service.NewTaxService(service.DefaultVATRates)
+	})
+
+	DescribeTable("Decide",
+		func(addr model.Address, treatment model.TaxTreatment, rateBPS int64) {
+			tax, err := taxes.Decide(&addr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tax.Treatment).To(Equal(treatment))
+			Expect(tax.RateBPS).To(Equal(rateBPS))
+		},
+		Entry("German consumer", model.Address{Country: "DE"}, model.TaxDomestic, int64(1900)),
+		Entry("German business", verified(model.Address{Country: "de", CustomerType: model.CustomerBusiness, VATID: "DE123456789"}), model.TaxDomestic, int64(1900)),
+		Entry("Croatian consumer", model.Address{Country: "HR"}, model.TaxOSS, int64(2500)),
+		Entry("Croatian business", verified(model.Address{Country: "HR", CustomerType: model.CustomerBusiness, VATID: "HR12345678901"}), model.TaxReverseCharge, int64(0)),
+		Entry("Greek business", verified(model.Address{Country: "GR", CustomerType: model.CustomerBusiness, VATID: "EL123456789"}), model.TaxReverseCharge, int64(0)),
+		Entry("business with an unchecked VAT ID", model.Address{Country: "HR", CustomerType: model.CustomerBusiness, VATID: "HR12345678901"}, model.TaxOSS, int64(2500)),
+		Entry("business with a pending VAT ID check", model.Address{Country: "HR", CustomerType: model.CustomerBusiness, VATID: "HR12345678901", VATCheck: &model.VATCheck{VATID: "HR12345678901", Status: model.VATPending}}, model.TaxOSS, int64(2500)),
+		Entry("consumer with a VAT ID", verified(model.Address{Country: "HR", VATID: "HR12345678901"}), model.TaxOSS, int64(2500)),
+		Entry("Swiss consumer", model.Address{Country: "CH"}, model.TaxOutsideEU, int64(0)),
+	)
+
+	It("should reject addresses without a country code", func() {
+		_, err := taxes.Decide(&model.Address{Country: "Germany"})
+		Expect(err).To(MatchError(service.ErrInvalidCountry))
+		_, err = taxes.ForCountry("")
+		Expect(err).To(MatchError(service.ErrInvalidCountry))
+	})
+
+	Describe("at checkout", func() {
+		var (
+			ctx          context.Context
+			stripeServer *mocks.StripeServer
+			cartService  *service.CartService
+			checkout     *service.CheckoutService
+			addresses    *service.AddressService
+			orderRepo    *repo.MockOrderRepo
+			address      *model.Address
+		)
+
+		BeforeEach(func() {
+			ctx = service.WithUserID(context.Background(), "user_1")
+			stripeServer = mocks.NewStripeServer()
+			gateway := service.NewStripeGateway(service.NewStripeClient("sk_test_123", stripeServer.URL))
+
+			catalogService := service.NewCatalogService(repo.NewMockCatalogRepo())
+			Expect(catalogService.Seed(ctx)).To(Succeed())
+			cartService = service.NewCartService(repo.NewMockCartRepo(), catalogService, nil, nil)
+			vies := &mocks.FakeVATValidator{Registered: map[string]string{"HR12345678901": "Agencija d.o.o."}}
+			addresses = service.NewAddressService(mocks.NewMockAddressRepo(), vies)
+			orderRepo = repo.NewMockOrderRepo()
+			checkout = service.NewCheckoutService(cartService, orderRepo, addresses, taxes, nil, gateway, "https://dysv.test/success", "https://dysv.test/cart")
+
+			address = &model.Address{UserID: "user_1", Label: "Office", Line1: "Ilica 1", City: "Zagreb", PostalCode: "10000", Country: "HR"}
+			Expect(addresses.CreateAddress(ctx, address)).To(Succeed())
+
+			_, err := cartService.AddPlan(ctx, "sess", "node-pro", 1)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = cartService.ConfigureSite(ctx, "sess", "node-pro", 0, model.SiteConfig{Name: "shop", Framework: "nuxt", Region: "nbg"})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			stripeServer.Close()
+		})
+
+		// firstOrder returns the order of the first checkout session
+		firstOrder := func() *model.Order {
+			for id, obj := range stripeServer.Objects {
+				if obj["object"] == "checkout.session" {
+					order, err := orderRepo.FindByStripeSessionID(ctx, id)
+					Expect(err).NotTo(HaveOccurred())
+					return order
+				}
+			}
+			Fail("no checkout session")
+			return nil
+		}
+
+		It("should charge destination VAT through a Stripe tax rate", func() {
+			_, err := checkout.CreateCheckoutSession(ctx, "sess", "user_1", "user@example.com", address.ID, "")
+			Expect(err).NotTo(HaveOccurred())
+
+			order := firstOrder()
+			Expect(order.Tax).To(Equal(model.TaxDecision{Country: "HR", Treatment: model.TaxOSS, RateBPS: 2500}))
+			Expect(order.TaxAmount.Amount).To(BeNumerically(">", 0))
+			Expect(order.NetAmount.Amount + order.TaxAmount.Amount).To(Equal(order.TotalAmount.Amount))
+
+			session := stripeServer.Object(order.StripeSessionID)
+			lineItem := session["line_items"].(map[string]interface{})["0"].(map[string]interface{})
+			taxRateID := lineItem["tax_rates"].(map[string]interface{})["0"].(string)
+			taxRate := stripeServer.Object(taxRateID)
+			Expect(taxRate["country"]).To(Equal("HR"))
+			Expect(taxRate["percentage"]).To(BeNumerically("==", 25))
+			Expect(taxRate["inclusive"]).To(BeFalse())
+
+			// The tax rate is reused for later checkouts
+			_, err = checkout.CreateCheckoutSession(ctx, "sess", "user_1", "user@example.com", address.ID, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stripeServer.Count("tax_rate")).To(Equal(1))
+		})
+
+		It("should invoice EU businesses net under reverse charge", func() {
+			address.CustomerType = model.CustomerBusiness
+			address.Company = "Agencija d.o.o."
+			address.VATID = "HR12345678901"
+			Expect(addresses.UpdateAddress(ctx, address)).To(Succeed())
+
+			_, err := checkout.CreateCheckoutSession(ctx, "sess", "user_1", "user@example.com", address.ID, "")
+			Expect(err).NotTo(HaveOccurred())
+
+			order := firstOrder()
+			Expect(order.Tax.Treatment).To(Equal(model.TaxReverseCharge))
+			Expect(order.TaxAmount.Amount).To(BeZero())
+			Expect(order.TotalAmount).To(Equal(order.NetAmount))
+
+			// The invoice shows the customer's company and checked VAT ID
+			Expect(order.BillingAddress.Company).To(Equal("Agencija d.o.o."))
+			Expect(order.BillingAddress.VATCheck.ConsultationNumber).NotTo(BeEmpty())
+			Expect(stripeServer.Count("tax_rate")).To(BeZero())
+		})
+	})
+})
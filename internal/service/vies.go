@@ -0,0 +1,138 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/deicod/dysv/internal/model"
+)
+
+// VATValidator checks VAT IDs against the register of the issuing member
+// state
+type VATValidator interface {
+	// Validate checks a normalized VAT ID including its country prefix and
+	// returns a valid or invalid check. It fails with ErrVATCheckUnavailable
+	// while the register cannot answer.
+	Validate(ctx context.Context, vatID string) (*model.VATCheck, error)
+}
+
+// DefaultVIESURL is the REST API of the EU's VAT Information Exchange System
+const DefaultVIESURL = "https://ec.europa.eu/taxation_customs/vies/rest-api"
+
+// viesTimeout bounds a VIES request; member state registers are often slow
+const viesTimeout = 15 * time.Second
+
+// Ensure VIESClient implements VATValidator
+var _ VATValidator = (*VIESClient)(nil)
+
+// VIESClient validates VAT IDs with the VIES REST API
+type VIESClient struct {
+	baseURL   string
+	requester string
+	client    *http.Client
+}
+
+// NewVIESClient creates a VIES client for baseURL (DefaultVIESURL if empty).
+// requesterVATID is our own VAT ID; VIES only hands out consultation numbers
+// to requests that name the requester.
+func NewVIESClient(baseURL, requesterVATID string) *VIESClient {
+	if baseURL == "" {
+		baseURL = DefaultVIESURL
+	}
+	return &VIESClient{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		requester: NormalizeVATID(requesterVATID),
+		client:    &http.Client{Timeout: viesTimeout},
+	}
+}
+
+// viesRequest is the body of POST /check-vat-number
+type viesRequest struct {
+	CountryCode              string `json:"countryCode"`
+	VATNumber                string `json:"vatNumber"`
+	RequesterMemberStateCode string `json:"requesterMemberStateCode,omitempty"`
+	RequesterNumber          string `json:"requesterNumber,omitempty"`
+}
+
+// viesResponse is the answer to POST /check-vat-number. Errors come as
+// errorWrappers, with or without an error status.
+type viesResponse struct {
+	Valid             bool   `json:"valid"`
+	RequestDate       string `json:"requestDate"`
+	RequestIdentifier string `json:"requestIdentifier"`
+	Name              string `json:"name"`
+	ErrorWrappers     []struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	} `json:"errorWrappers"`
+}
+
+// Validate implements VATValidator
+func (c *VIESClient) Validate(ctx context.Context, vatID string) (*model.VATCheck, error) {
+	if len(vatID) < 3 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidVATID, vatID)
+	}
+	req := viesRequest{CountryCode: vatID[:2], VATNumber: vatID[2:]}
+	if len(c.requester) > 2 {
+		req.RequesterMemberStateCode = c.requester[:2]
+		req.RequesterNumber = c.requester[2:]
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/check-vat-number", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVATCheckUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	var result viesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("%w: status %d: %v", ErrVATCheckUnavailable, resp.StatusCode, err)
+	}
+	if len(result.ErrorWrappers) > 0 {
+		// Malformed numbers are answered, everything else is an outage
+		if result.ErrorWrappers[0].Error == "INVALID_INPUT" {
+			return &model.VATCheck{VATID: vatID, Status: model.VATInvalid, CheckedAt: time.Now()}, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrVATCheckUnavailable, result.ErrorWrappers[0].Error)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrVATCheckUnavailable, resp.StatusCode)
+	}
+
+	check := &model.VATCheck{
+		VATID:              vatID,
+		Status:             model.VATInvalid,
+		ConsultationNumber: result.RequestIdentifier,
+		CheckedAt:          time.Now(),
+	}
+	if result.Valid {
+		check.Status = model.VATValid
+	}
+	if t, err := time.Parse(time.RFC3339, result.RequestDate); err == nil {
+		check.CheckedAt = t
+	}
+	// VIES shows undisclosed names as dashes
+	if name := strings.TrimSpace(result.Name); strings.Trim(name, "-") != "" {
+		check.Name = name
+	}
+	return check, nil
+}
@@ -0,0 +1,154 @@
+/*
+Copyright © 2025 Darko Luketic <info@icod.de>
+*/
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/deicod/dysv/internal/mocks"
+	"github.com/deicod/dysv/internal/model"
+	"github.com/deicod/dysv/internal/service"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("VIESClient", func() {
+	var (
+		server   *httptest.Server
+		received map[string]string
+		status   int
+		response string
+	)
+
+	BeforeEach(func() {
+		status = http.StatusOK
+		received = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal(http.MethodPost))
+			Expect(r.URL.Path).To(Equal("/check-vat-number"))
+			Expect(json.NewDecoder(r.Body).Decode(&received)).To(Succeed())
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(response))
+		}))
+		DeferCleanup(server.Close)
+	})
+
+	It("should record the consultation number of a valid VAT ID", func() {
+		response = `{"countryCode": "HR", "vatNumber": "12345678901", "requestDate": "2026-03-02T10:15:00.123Z",
+			"valid": true, "requestIdentifier": "WAPIAAAAY1234567", "name": "AGENCIJA D.O.O.", "address": "ILICA 1, ZAGREB"}`
+		check, err := service.NewVIESClient(server.URL, "DE 123 456 789").Validate(context.Background(), "HR12345678901")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(received).To(Equal(map[string]string{
+			"countryCode":              "HR",
+			"vatNumber":                "12345678901",
+			"requesterMemberStateCode": "DE",
+			"requesterNumber":          "123456789",
+		}))
+		Expect(check.Status).To(Equal(model.VATValid))
+		Expect(check.ConsultationNumber).To(Equal("WAPIAAAAY1234567"))
+		Expect(check.Name).To(Equal("AGENCIJA D.O.O."))
+		Expect(check.CheckedAt.Year()).To(Equal(2026))
+	})
+
+	It("should report unknown VAT IDs as invalid", func() {
+		response = `{"countryCode": "HR", "vatNumber": "12345678901", "valid": false, "name": "---"}`
+		check, err := service.NewVIESClient(server.URL, "").Validate(context.Background(), "HR12345678901")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(check.Status).To(Equal(model.VATInvalid))
+		Expect(check.Name).To(BeEmpty())
+		Expect(received).NotTo(HaveKey("requesterNumber"))
+	})
+
+	It("should report outages of a member state register", func() {
+		status = http.StatusInternalServerError
+		response = `{"actionSucceed": false, "errorWrappers": [{"error": "MS_UNAVAILABLE"}]}`
+		_, err := service.NewVIESClient(server.URL, "").Validate(context.Background(), "HR12345678901")
+		Expect(err).To(MatchError(service.ErrVATCheckUnavailable))
+	})
+})
+
+var _ = Describe("VAT ID checks", func() {
+	var (
+		ctx         context.Context
+		vies        *mocks.FakeVATValidator
+		addrRepo    *mocks.MockAddressRepo
+		addrService *service.AddressService
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		vies = &mocks.FakeVATValidator{Registered: map[string]string{"HR12345678901": "Agencija d.o.o."}}
+		addrRepo = mocks.NewMockAddressRepo()
+		addrService = service.NewAddressService(addrRepo, vies)
+	})
+
+	business := func(vatID string) *model.Address {
+		return &model.Address{UserID: "user_1", Label: "Office", Company: "Agencija d.o.o.", Line1: "Ilica 1", City: "Zagreb", PostalCode: "10000",
+			Country: "HR", CustomerType: model.CustomerBusiness, VATID: vatID}
+	}
+
+	It("should store the check of a registered VAT ID", func() {
+		addr := business("hr 1234 5678 901")
+		Expect(addrService.CreateAddress(ctx, addr)).To(Succeed())
+
+		stored, err := addrRepo.Get(ctx, addr.ID, "user_1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.VATID).To(Equal("HR12345678901"))
+		Expect(stored.VATIDVerified()).To(BeTrue())
+		Expect(stored.VATCheck.ConsultationNumber).NotTo(BeEmpty())
+		Expect(stored.VATCheck.CheckedAt).NotTo(BeZero())
+	})
+
+	It("should refuse VAT IDs that are malformed or not registered", func() {
+		Expect(addrService.CreateAddress(ctx, business("HR123"))).To(MatchError(service.ErrInvalidVATID))
+		Expect(addrService.CreateAddress(ctx, business("DE123456789"))).To(MatchError(service.ErrInvalidVATID))
+		Expect(vies.Checked).To(BeEmpty())
+
+		Expect(addrService.CreateAddress(ctx, business("HR98765432109"))).To(MatchError(service.ErrInvalidVATID))
+		Expect(addrRepo.Addresses).To(BeEmpty())
+	})
+
+	It("should not let clients claim a check", func() {
+		addr := business("HR98765432109")
+		addr.VATCheck = &model.VATCheck{VATID: addr.VATID, Status: model.VATValid}
+		vies.Unavailable = true
+		Expect(addrService.CreateAddress(ctx, addr)).To(Succeed())
+		Expect(addr.VATCheck.Status).To(Equal(model.VATPending))
+	})
+
+	It("should keep a passed check while the VAT ID is unchanged", func() {
+		addr := business("HR12345678901")
+		Expect(addrService.CreateAddress(ctx, addr)).To(Succeed())
+		consultation := addr.VATCheck.ConsultationNumber
+
+		update := business("HR12345678901")
+		update.ID = addr.ID
+		update.Label = "Head office"
+		Expect(addrService.UpdateAddress(ctx, update)).To(Succeed())
+		Expect(update.VATCheck.ConsultationNumber).To(Equal(consultation))
+		Expect(vies.Checked).To(HaveLen(1))
+	})
+
+	It("should save addresses while the register is down and check them again at checkout", func() {
+		vies.Unavailable = true
+		addr := business("HR12345678901")
+		Expect(addrService.CreateAddress(ctx, addr)).To(Succeed())
+		Expect(addr.VATCheck.Status).To(Equal(model.VATPending))
+
+		// Still down: checkout goes on without reverse charge
+		Expect(addrService.RecheckVATID(ctx, addr)).To(Succeed())
+		Expect(addr.VATIDVerified()).To(BeFalse())
+
+		vies.Unavailable = false
+		Expect(addrService.RecheckVATID(ctx, addr)).To(Succeed())
+		stored, err := addrRepo.Get(ctx, addr.ID, "user_1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.VATIDVerified()).To(BeTrue())
+		Expect(vies.Checked).To(HaveLen(3))
+	})
+})